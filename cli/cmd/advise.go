@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"cli/internal/advisor"
+	"cli/internal/db"
+	"cli/internal/format"
+	"cli/internal/ingest"
+	"cli/internal/logger"
+	"cli/internal/store"
+)
+
+var (
+	adviseBudget     string
+	adviseMaxIndexes int
+	adviseStatements int
+	adviseMinRows    int64
+)
+
+var adviseCmd = &cobra.Command{
+	Use:   "advise",
+	Short: "Build a workload-wide index plan",
+	Long: `Recommend a ranked, deduplicated set of indexes for the whole workload.
+
+Unlike 'scan', which looks at one query at a time, the advisor parses every
+statement, generates single-column, composite and covering index candidates,
+and scores each by the execution time it saves across all statements it
+serves, minus the cost of maintaining it for the rows the workload writes.
+Indexes are chosen greedily until the storage budget is used up.
+
+Examples:
+  optidb advise
+  optidb advise --budget 500MB --max-indexes 5
+  optidb advise --window 5m`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runAdvise()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(adviseCmd)
+
+	adviseCmd.Flags().StringVar(&adviseBudget, "budget", "0", "Storage budget for new indexes, e.g. 500MB or 2GB (0 for unlimited)")
+	adviseCmd.Flags().IntVar(&adviseMaxIndexes, "max-indexes", 10, "Maximum number of indexes to recommend")
+	adviseCmd.Flags().IntVar(&adviseStatements, "statements", 200, "Number of statements, by total time, to analyze")
+	adviseCmd.Flags().Int64Var(&adviseMinRows, "min-table-rows", 1000, "Ignore tables smaller than this")
+	adviseCmd.Flags().DurationVar(&window, "window", 0, "Analyze activity within this sampling window (e.g. 30s) instead of since the last stats reset")
+}
+
+func runAdvise() {
+	budget, err := advisor.ParseSize(adviseBudget)
+	if err != nil {
+		log.Fatalf("Invalid --budget: %v", err)
+	}
+
+	logger.LogInfo("Starting workload index advisor")
+	fmt.Println("🧭 Building workload index plan...")
+
+	database, err := db.ConnectAsProfiler()
+	if err != nil {
+		logger.LogErrorf("Failed to connect to database: %v", err)
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	collector := ingest.NewCollector(database)
+
+	var workload []store.QueryStats
+	if window > 0 {
+		fmt.Printf("⏱️  Sampling pg_stat_statements for %s...\n", window)
+		workload, err = collector.GetWorkloadInWindow(adviseStatements, window)
+	} else {
+		workload, err = collector.GetWorkload(adviseStatements)
+	}
+	if err != nil {
+		logger.LogErrorf("Failed to collect workload: %v", err)
+		log.Fatalf("Failed to collect workload: %v", err)
+	}
+
+	tables, err := collector.GetTableInfo()
+	if err != nil {
+		logger.LogErrorf("Failed to collect table info: %v", err)
+		log.Fatalf("Failed to collect table info: %v", err)
+	}
+	indexes, err := collector.GetIndexInfo()
+	if err != nil {
+		logger.LogErrorf("Failed to collect index info: %v", err)
+		log.Fatalf("Failed to collect index info: %v", err)
+	}
+
+	opts := advisor.DefaultOptions()
+	opts.StorageBudgetBytes = budget
+	opts.Engine = collector.Engine()
+	opts.MaxIndexes = adviseMaxIndexes
+	opts.MinTableRows = adviseMinRows
+
+	plan := advisor.NewAdvisor(opts).Advise(workload, tables, indexes)
+	printIndexPlan(plan)
+}
+
+func printIndexPlan(plan *advisor.Plan) {
+	fmt.Printf("   • Analyzed %d statements (%.2f ms total)", plan.QueriesAnalyzed, plan.WorkloadMS)
+	if plan.QueriesSkipped > 0 {
+		fmt.Printf(", %d could not be parsed", plan.QueriesSkipped)
+	}
+	fmt.Println()
+
+	if len(plan.Indexes) == 0 {
+		fmt.Println("✅ No new indexes would pay for themselves on this workload")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\n#\tKIND\tSAVED (ms)\tWRITE COST (ms)\tSIZE\tSTATEMENTS\tINDEX")
+	fmt.Fprintln(w, "-\t----\t----------\t---------------\t----\t----------\t-----")
+	for _, p := range plan.Indexes {
+		fmt.Fprintf(w, "%d\t%s\t%.2f\t%.2f\t%s\t%d\t%s\n",
+			p.Rank, p.Kind, p.SavedMS, p.WriteCostMS, format.Bytes(p.EstimatedBytes), len(p.Queries), describeProposal(p))
+	}
+	w.Flush()
+
+	fmt.Println("\n📝 DDL:")
+	for _, p := range plan.Indexes {
+		fmt.Printf("   %s\n", p.DDL)
+	}
+
+	share := 0.0
+	if plan.WorkloadMS > 0 {
+		share = plan.SavedMS / plan.WorkloadMS * 100
+	}
+	fmt.Printf("\n📈 Estimated savings: %.2f ms (%.1f%% of workload time) for %s of indexes", plan.SavedMS, share, format.Bytes(plan.UsedBytes))
+	if plan.BudgetBytes > 0 {
+		fmt.Printf(" (budget %s)", format.Bytes(plan.BudgetBytes))
+	}
+	fmt.Println()
+
+	if len(plan.OverBudget) > 0 {
+		fmt.Printf("\n💸 Over budget (%d):\n", len(plan.OverBudget))
+		for _, p := range plan.OverBudget {
+			fmt.Printf("   • %s — saves %.2f ms, needs %s\n", describeProposal(p), p.SavedMS, format.Bytes(p.EstimatedBytes))
+		}
+	}
+
+	fmt.Printf("\n💡 Run 'optidb simulate --query ... --ddl ...' to check an index with hypopg before building it\n")
+}
+
+func describeProposal(p advisor.Proposal) string {
+	desc := fmt.Sprintf("%s (%s)", p.Table, strings.Join(p.Columns, ", "))
+	if len(p.Include) > 0 {
+		desc += fmt.Sprintf(" INCLUDE (%s)", strings.Join(p.Include, ", "))
+	}
+	return desc
+}
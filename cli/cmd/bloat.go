@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"cli/internal/advisor"
+	"cli/internal/bloat"
+	"cli/internal/format"
+	"cli/internal/logger"
+)
+
+var (
+	bloatExact    bool
+	bloatMinSize  string
+	bloatMinRatio float64
+)
+
+var bloatCmd = &cobra.Command{
+	Use:   "bloat",
+	Short: "Estimate table and index bloat and how to reclaim it",
+	Long: `Report the space tables and indexes waste beyond what their live rows need.
+
+Bloat is estimated from the planner statistics, so run ANALYZE first on
+tables that have none. With --exact, relations that look bloated are
+measured with the pgstattuple extension when it is installed; this reads
+them, so expect I/O on large tables.
+
+Each finding comes with a remedy and its risk:
+  • VACUUM for moderate table bloat, whose space new rows will reuse
+  • pg_repack to rewrite a heavily bloated table online
+  • VACUUM FULL when pg_repack has no primary or unique key to work with
+  • REINDEX CONCURRENTLY for bloated B-tree indexes
+  • an online ALTER TABLE ... ENGINE=InnoDB rebuild on MySQL
+
+Examples:
+  optidb bloat
+  optidb bloat --exact
+  optidb bloat --min-size 100MB --min-ratio 0.3`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runBloat()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(bloatCmd)
+
+	bloatCmd.Flags().BoolVar(&bloatExact, "exact", false, "Measure bloated relations with pgstattuple when it is installed")
+	bloatCmd.Flags().StringVar(&bloatMinSize, "min-size", "10MB", "Ignore relations wasting less than this")
+	bloatCmd.Flags().Float64Var(&bloatMinRatio, "min-ratio", bloat.DefaultOptions().MinRatio, "Ignore relations wasting less than this fraction of their size")
+	addSnapshotFlag(bloatCmd)
+}
+
+func runBloat() {
+	minSize, err := advisor.ParseSize(bloatMinSize)
+	if err != nil {
+		log.Fatalf("Invalid --min-size: %v", err)
+	}
+
+	logger.LogInfo("Starting bloat analysis")
+	fmt.Println("🎈 Estimating table and index bloat...")
+
+	collector, database := openCollector()
+	if database != nil {
+		defer database.Close()
+	}
+
+	estimates, err := collector.GetBloat(bloatExact)
+	if err != nil {
+		logger.LogErrorf("Failed to estimate bloat: %v", err)
+		log.Fatalf("Failed to estimate bloat: %v", err)
+	}
+	tables, err := collector.GetTableInfo()
+	if err != nil {
+		logger.LogErrorf("Failed to collect table info: %v", err)
+		log.Fatalf("Failed to collect table info: %v", err)
+	}
+	indexes, err := collector.GetIndexInfo()
+	if err != nil {
+		logger.LogErrorf("Failed to collect index info: %v", err)
+		log.Fatalf("Failed to collect index info: %v", err)
+	}
+
+	opts := bloat.DefaultOptions()
+	opts.MinWastedBytes = minSize
+	opts.MinRatio = bloatMinRatio
+	opts.Engine = collector.Engine()
+	printBloatReport(bloat.Analyze(estimates, tables, indexes, opts))
+}
+
+func printBloatReport(report *bloat.Report) {
+	fmt.Printf("   • Analyzed %d tables and %d indexes", report.TablesAnalyzed, report.IndexesAnalyzed)
+	if report.Measured > 0 {
+		fmt.Printf(", %d measured with pgstattuple", report.Measured)
+	}
+	fmt.Println()
+
+	if len(report.Findings) == 0 {
+		fmt.Println("\n✅ No significant bloat found")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\nTABLE\tINDEX\tSIZE\tWASTED\tRATIO\tACTION\tRISK")
+	fmt.Fprintln(w, "-----\t-----\t----\t------\t-----\t------\t----")
+	for _, f := range report.Findings {
+		index := f.Index
+		if index == "" {
+			index = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%.0f%%\t%s\t%s\n",
+			f.Table, index, format.Bytes(f.SizeBytes), format.Bytes(f.WastedBytes), f.Ratio*100, f.Action, f.RiskLevel)
+	}
+	w.Flush()
+
+	fmt.Println("\n📝 Remedies:")
+	for _, f := range report.Findings {
+		fmt.Printf("   %s\n", f.DDL)
+	}
+
+	fmt.Printf("\n💾 Wasted: %s across %d relations\n", format.Bytes(report.WastedBytes), len(report.Findings))
+}
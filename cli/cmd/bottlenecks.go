@@ -7,11 +7,9 @@ import (
 
 	"github.com/spf13/cobra"
 
-	"cli/internal/db"
-	"cli/internal/ingest"
 	"cli/internal/logger"
 	"cli/internal/parse"
-	"cli/internal/rules"
+	"cli/internal/store"
 )
 
 var (
@@ -44,6 +42,11 @@ func init() {
 
 	bottlenecksCmd.Flags().BoolVar(&showDDL, "ddl", true, "Show DDL recommendations")
 	bottlenecksCmd.Flags().IntVar(&limit, "limit", 10, "Number of bottlenecks to show")
+	bottlenecksCmd.Flags().DurationVar(&window, "window", 0, "Rank by activity within this sampling window (e.g. 30s) instead of since the last stats reset")
+	bottlenecksCmd.Flags().BoolVar(&saveSnapshot, "save", false, "Persist the analysis as a snapshot in the meta store (database.meta, else the profiled database)")
+	addExplainFlags(bottlenecksCmd)
+	addSnapshotFlag(bottlenecksCmd)
+	addRuleFlags(bottlenecksCmd)
 }
 
 func runBottlenecks() {
@@ -51,22 +54,19 @@ func runBottlenecks() {
 	fmt.Println("🚨 Top Database Performance Bottlenecks")
 	fmt.Println("=====================================")
 
-	// Connect to database
-	database, err := db.ConnectAsProfiler()
-	if err != nil {
-		logger.LogErrorf("Failed to connect to database: %v", err)
-		log.Fatalf("Failed to connect to database: %v", err)
+	collector, database := openCollector()
+	if database != nil {
+		defer database.Close()
 	}
-	defer database.Close()
 
 	// Initialize components
-	collector := ingest.NewStatsCollector(database)
 	parser := parse.NewQueryParser()
-	ruleEngine := rules.NewRuleEngine()
+	ruleEngine := newRuleEngine()
+	planner := newPlanner(database, collector)
 	logger.LogInfo("Initialized components for bottlenecks analysis")
 
 	// Get slow queries
-	queryStats, err := collector.GetSlowQueries(0.1) // 0.1ms threshold
+	queryStats, err := collectSlowQueries(collector, 0.1) // 0.1ms threshold
 	if err != nil {
 		logger.LogErrorf("Failed to collect query stats: %v", err)
 		log.Fatalf("Failed to collect query stats: %v", err)
@@ -90,17 +90,27 @@ func runBottlenecks() {
 		logger.LogErrorf("Failed to collect index info: %v", err)
 		log.Fatalf("Failed to collect index info: %v", err)
 	}
+	inputs := loadRuleInputs(collector, ruleEngine, indexes)
 
 	// Analyze and display bottlenecks
 	logger.LogInfof("Analyzing %d queries for bottlenecks (limit: %d)", len(queryStats), limit)
 	count := 0
 	ddlBottlenecks := map[int]string{}
-	for _, query := range queryStats {
+	var analyzed []store.SnapshotQuery
+	for i, query := range queryStats {
 		if count >= limit {
 			break
 		}
 
-		recommendations := ruleEngine.AnalyzeQuery(query, tables, indexes)
+		plan := capturePlan(planner, i, query.Query)
+		recommendations := ruleEngine.AnalyzeQueryWithPlan(query, tables, indexes, plan, inputs)
+		analyzed = append(analyzed, store.SnapshotQuery{
+			Fingerprint:     parser.GenerateFingerprint(query.Query),
+			NormSQL:         parser.NormalizeQuery(query.Query),
+			Stats:           query,
+			Recommendations: recommendations,
+			Plan:            storedPlan(plan),
+		})
 		if len(recommendations) == 0 {
 			logger.LogDebugf("No recommendations for query: %s", query.Query[:min(50, len(query.Query))])
 			continue // Skip queries with no recommendations
@@ -117,7 +127,14 @@ func runBottlenecks() {
 		fmt.Printf("   • Calls: %d\n", query.Calls)
 		fmt.Printf("   • Avg Time: %.2f ms\n", query.MeanExecTime)
 		fmt.Printf("   • Total Time: %.2f ms\n", query.TotalTime)
+		fmt.Printf("   • Min/Max/Stddev: %.2f / %.2f / %.2f ms\n", query.MinExecTime, query.MaxExecTime, query.StddevExecTime)
+		if query.Plans > 0 {
+			fmt.Printf("   • Planning: %.2f ms avg over %d plans\n", query.MeanPlanTime, query.Plans)
+		}
 		fmt.Printf("   • Rows: %d\n", query.Rows)
+		if query.TempBlksWritten > 0 {
+			fmt.Printf("   • Temp Blocks Written: %d\n", query.TempBlksWritten)
+		}
 
 		// Query fingerprint
 		fingerprint := parser.GenerateFingerprint(query.Query)
@@ -130,6 +147,10 @@ func runBottlenecks() {
 		}
 		fmt.Printf("   • SQL: %s\n", displayQuery)
 
+		if plan != nil {
+			printPlanFacts(plan)
+		}
+
 		// Recommendations
 		fmt.Printf("\n💡 Recommendations (%d):\n", len(recommendations))
 
@@ -159,6 +180,8 @@ func runBottlenecks() {
 		fmt.Printf("\n" + strings.Repeat("─", 50))
 	}
 
+	persistScan("bottlenecks", analyzed, tables, indexes)
+
 	if count == 0 {
 		logger.LogInfo("No actionable bottlenecks found in top queries")
 		fmt.Println("✅ No actionable bottlenecks found in top queries!")
@@ -168,7 +191,8 @@ func runBottlenecks() {
 		fmt.Printf("💡 Use --ddl=false to hide DDL statements\n")
 		fmt.Printf("🔧 Use --limit=N to show more/fewer results\n\n")
 
-		if len(ddlBottlenecks) != 0 {
+		// Fixes can only be applied to a live database
+		if len(ddlBottlenecks) != 0 && database != nil {
 			fmt.Println("Would you like to apply a DDL bottleneck?")
 			bottleneckID := -1
 			for bottleneckID != 0 {
@@ -218,6 +242,10 @@ func formatRecommendationType(recType string) string {
 		return "JOIN Index Missing"
 	case "redundant_index":
 		return "Redundant Index"
+	case "temp_spill":
+		return "Temp File Spill"
+	case "cache_hit_ratio":
+		return "Buffer Cache Misses"
 	default:
 		return recType
 	}
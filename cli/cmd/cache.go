@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"cli/internal/cache"
+	"cli/internal/config"
+	"cli/internal/format"
+	"cli/internal/logger"
+)
+
+var (
+	cacheTop         int
+	cacheMinHitRatio float64
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Analyze buffer cache hit ratios per table and index",
+	Long: `Report how well shared_buffers serves each table and index, from
+pg_statio_user_tables and pg_statio_user_indexes, and whether the working
+set fits in it.
+
+The report shows:
+  • the server-wide hit ratio and the working set: the relations that take
+    95% of all block accesses, against shared_buffers
+  • the tables and indexes with the most blocks read from outside the
+    cache, with how much of each is cached now when pg_buffercache is
+    installed
+
+Findings are raised when the hit ratio is below --min-hit-ratio: a larger
+shared_buffers when the working set does not fit, reading less of a
+relation larger than the cache, and pg_prewarm for relations that fit but
+keep being evicted. The statements behind the misses get cache_hit_ratio
+recommendations from scan and bottlenecks. PostgreSQL only.
+
+Examples:
+  optidb cache
+  optidb cache --top 20 --min-hit-ratio 0.95`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runCache()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+
+	cacheCmd.Flags().IntVar(&cacheTop, "top", 10, "Number of relations to list by blocks read")
+	cacheCmd.Flags().Float64Var(&cacheMinHitRatio, "min-hit-ratio", cache.DefaultOptions().MinHitRatio, "Hit ratio below which tables and indexes are flagged")
+	addSnapshotFlag(cacheCmd)
+}
+
+func runCache() {
+	logger.LogInfo("Starting buffer cache analysis")
+	fmt.Println("🗄️  Checking buffer cache hit ratios...")
+
+	collector, database := openCollector()
+	if database != nil {
+		defer database.Close()
+	}
+	if collector.Engine() == config.EngineMySQL {
+		log.Fatalf("Buffer cache analysis needs PostgreSQL")
+	}
+
+	usage, err := collector.GetCacheStats()
+	if err != nil {
+		logger.LogErrorf("Failed to collect buffer cache statistics: %v", err)
+		log.Fatalf("Failed to collect buffer cache statistics: %v", err)
+	}
+	memory, err := collector.GetMemorySettings()
+	if err != nil {
+		logger.LogErrorf("Failed to collect memory settings: %v", err)
+		fmt.Printf("⚠️  Memory settings unavailable, the working set is not compared with shared_buffers: %v\n", err)
+	}
+
+	opts := cache.DefaultOptions()
+	opts.MinHitRatio = cacheMinHitRatio
+	printCacheReport(cache.Analyze(usage, memory, opts))
+}
+
+func printCacheReport(report *cache.Report) {
+	if report.SharedBuffers > 0 {
+		fmt.Printf("   • shared_buffers %s, effective_cache_size %s\n", format.Bytes(report.SharedBuffers), format.Bytes(report.EffectiveCacheSize))
+	}
+	fmt.Printf("   • Hit ratio %.2f%% over %d block accesses %s\n", report.HitRatio*100, report.BlksHit+report.BlksRead, report.Since())
+	fmt.Printf("   • Working set %s in %d relations\n", format.Bytes(report.WorkingSetBytes), report.WorkingSetRelations)
+
+	relations := report.Relations
+	if len(relations) > cacheTop {
+		relations = relations[:cacheTop]
+	}
+	if len(relations) > 0 {
+		fmt.Printf("\n📖 Relations by blocks read from outside the cache:\n")
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TABLE\tINDEX\tSIZE\tCACHED\tHIT %\tBLOCKS READ\tACCESSES %\tHOT")
+		fmt.Fprintln(w, "-----\t-----\t----\t------\t-----\t-----------\t----------\t---")
+		for _, r := range relations {
+			cached := "-"
+			if report.Buffercache {
+				cached = format.Bytes(r.CachedBytes)
+			}
+			hot := ""
+			if r.Hot {
+				hot = "yes"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%.1f%%\t%d\t%.1f%%\t%s\n",
+				r.TableName, orDash(r.IndexName), format.Bytes(r.SizeBytes), cached, r.HitRatio*100, r.BlksRead, r.AccessShare*100, hot)
+		}
+		w.Flush()
+	}
+
+	if len(report.Findings) == 0 {
+		fmt.Printf("\n✅ shared_buffers serves the workload well\n")
+		return
+	}
+
+	fmt.Printf("\n🚨 Findings (%d):\n", len(report.Findings))
+	for _, f := range report.Findings {
+		subject := f.Table
+		if f.Index != "" {
+			subject = f.Index
+		}
+		if subject == "" {
+			subject = "server"
+		}
+		fmt.Printf("\n   [%s] %s: %s\n", f.RiskLevel, f.Kind, subject)
+		fmt.Printf("   %s\n", f.Rationale)
+		if f.DDL != "" {
+			fmt.Printf("   %s\n", f.DDL)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"cli/internal/config"
+	"cli/internal/db"
+	"cli/internal/rules"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the optidb configuration",
+	Long: `optidb reads its settings from a YAML or TOML file (--config, $OPTIDB_CONFIG,
+./optidb.yaml or $HOME/.config/optidb/config.yaml), applies the selected
+profile (--profile, $OPTIDB_PROFILE or the file's "profile" key), then
+environment variables such as POSTGRES_HOST or OPTIDB_MIN_CALLS, then the
+named database target (--target, $OPTIDB_TARGET or the file's "target" key).`,
+	// Loading is done by the subcommands so that a broken file can be
+	// reported instead of aborting before they run.
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the config file and show the effective settings",
+	Long: `Load the configuration the way every other command does and report unknown
+keys, invalid values, unknown profiles and unknown rule IDs.
+
+Examples:
+  optidb config validate
+  optidb config validate --config optidb.toml --profile prod
+  optidb config validate --target staging`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runConfigValidate()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configValidateCmd)
+}
+
+func runConfigValidate() {
+	cfg, source, err := config.Load(cfgFile, cfgProfile, cfgTarget)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+
+	if source.File != "" {
+		fmt.Printf("📄 Config file: %s\n", source.File)
+	} else {
+		fmt.Println("📄 Config file: none found, using defaults")
+	}
+	if len(source.Profiles) > 0 {
+		fmt.Printf("   • Profiles: %s\n", strings.Join(source.Profiles, ", "))
+	}
+	if source.Profile != "" {
+		fmt.Printf("   • Active profile: %s\n", source.Profile)
+	}
+	if len(cfg.Targets) > 0 {
+		fmt.Printf("   • Targets: %s\n", strings.Join(cfg.TargetNames(), ", "))
+	}
+	if source.Target != "" {
+		fmt.Printf("   • Active target: %s\n", source.Target)
+	}
+	if len(source.Env) > 0 {
+		fmt.Printf("   • Environment overrides: %s\n", strings.Join(source.Env, ", "))
+	}
+
+	var problems []string
+	if err := cfg.Validate(); err != nil {
+		problems = append(problems, strings.Split(err.Error(), "\n")...)
+	}
+
+	// Rule IDs can only be checked against a registry. The engine is built
+	// without AI and without the disabled list, which is checked below.
+	probe := *cfg
+	probe.Rules.Disabled = nil
+	probe.AI.Enabled = false
+	config.Set(&probe)
+	registry := rules.NewRuleEngine().Registry()
+	for _, id := range cfg.Rules.Disabled {
+		if err := registry.Disable(id); err != nil {
+			problems = append(problems, fmt.Sprintf("rules.disabled: %v", err))
+		}
+	}
+
+	printConfig(cfg)
+
+	if len(problems) > 0 {
+		fmt.Printf("\n❌ Problems (%d):\n", len(problems))
+		for _, problem := range problems {
+			fmt.Printf("   • %s\n", problem)
+		}
+		os.Exit(1)
+	}
+	fmt.Println("\n✅ Configuration is valid")
+}
+
+func printConfig(cfg *config.Config) {
+	database := cfg.Database
+	fmt.Printf("\n🗄️  Database: %s, password %s\n", db.NewConfig(), passwordSource(database.Password, database.PasswordFile, database.PasswordCommand))
+	for _, role := range []struct {
+		name string
+		role config.RoleConfig
+	}{{"Profiler", database.Profiler}, {"Sandbox", database.Sandbox}} {
+		fmt.Printf("   • %s role: %s, password %s\n", role.name, role.role.User,
+			passwordSource(role.role.Password, role.role.PasswordFile, role.role.PasswordCommand))
+	}
+	if meta := database.Meta; meta != (config.MetaConfig{}) {
+		if meta.DSN != "" {
+			fmt.Println("   • Meta store: own DSN")
+		} else {
+			fmt.Printf("   • Meta store: %s@%s:%s/%s\n",
+				orDefault(meta.User, database.User), orDefault(meta.Host, database.Host),
+				orDefault(meta.Port, database.Port), orDefault(meta.Name, database.Name))
+		}
+	}
+
+	thresholds := cfg.Rules
+	fmt.Printf("📏 Rules: min_table_rows=%d min_mean_time_ms=%g min_calls=%d slow_query_limit=%d\n",
+		thresholds.MinTableRows, thresholds.MinMeanTimeMS, thresholds.MinCalls, thresholds.SlowQueryLimit)
+	if len(thresholds.Disabled) > 0 {
+		fmt.Printf("   • Disabled: %s\n", strings.Join(thresholds.Disabled, ", "))
+	}
+
+	ai := cfg.AI
+	switch {
+	case !ai.Enabled:
+		fmt.Println("🤖 AI: disabled")
+	case !ai.Configured():
+		fmt.Println("🤖 AI: not configured, heuristic rules only")
+	default:
+		fmt.Printf("🤖 AI: %s %s (deployment %s, max_tokens=%d, temperature=%g, timeout=%s)\n",
+			ai.Provider, ai.Endpoint, ai.Deployment, ai.MaxTokens, ai.Temperature, ai.Timeout)
+	}
+
+	fmt.Printf("🌐 Server: port %s, sample interval %s, allowed origins %s\n",
+		cfg.Server.Port, cfg.Server.SampleInterval, cfg.Server.AllowOrigins)
+}
+
+func orDefault(value, defaultValue string) string {
+	if value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// passwordSource says where a password comes from without printing it
+func passwordSource(password, file, command string) string {
+	switch {
+	case command != "":
+		return fmt.Sprintf("from command %q", command)
+	case file != "":
+		return "from file " + file
+	case password != "":
+		return "set"
+	}
+	if pgpass := os.Getenv("PGPASSFILE"); pgpass != "" {
+		return "from " + pgpass
+	}
+	return "from ~/.pgpass"
+}
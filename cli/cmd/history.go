@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"cli/internal/logger"
+)
+
+var historyLimit int
+
+var historyCmd = &cobra.Command{
+	Use:   "history [fingerprint]",
+	Short: "Show stored snapshots or the history of a single query",
+	Long: `Read persisted scans back from the meta store. Scans are persisted
+by 'scan', 'bottlenecks' and the ingest commands run with --save, and by
+'serve' when database.meta is set.
+
+Without arguments, lists the most recent snapshots. With a fingerprint (or the
+12-character prefix shown by 'bottlenecks'), shows first/last seen, metric
+history and every recommendation made for that query.
+
+Examples:
+  optidb history
+  optidb history 3f2a9c1b7d4e --limit 20`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			runSnapshotList()
+		} else {
+			runQueryHistory(args[0])
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+
+	historyCmd.Flags().IntVar(&historyLimit, "limit", 10, "Number of entries to show")
+}
+
+func runSnapshotList() {
+	repo, err := openRepository()
+	if err != nil {
+		logger.LogErrorf("Failed to open meta store: %v", err)
+		log.Fatalf("Failed to open meta store: %v", err)
+	}
+	defer repo.Close()
+
+	snapshots, err := repo.ListSnapshots(historyLimit)
+	if err != nil {
+		log.Fatalf("Failed to list snapshots: %v", err)
+	}
+
+	if len(snapshots) == 0 {
+		fmt.Println("No snapshots stored yet. Run 'optidb scan' to create one.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSOURCE\tCAPTURED AT")
+	for _, s := range snapshots {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", s.ID, s.Source, s.CapturedAt.Format("2006-01-02 15:04:05"))
+	}
+	w.Flush()
+}
+
+func runQueryHistory(fingerprint string) {
+	repo, err := openRepository()
+	if err != nil {
+		logger.LogErrorf("Failed to open meta store: %v", err)
+		log.Fatalf("Failed to open meta store: %v", err)
+	}
+	defer repo.Close()
+
+	query, err := repo.FindQueryByFingerprint(fingerprint)
+	if err != nil {
+		log.Fatalf("Failed to look up query: %v", err)
+	}
+	if query == nil {
+		fmt.Printf("No stored query matches fingerprint %s\n", fingerprint)
+		return
+	}
+
+	fmt.Printf("📜 Query %s\n", query.Fingerprint)
+	fmt.Printf("   • First seen: %s\n", query.FirstSeen.Format("2006-01-02 15:04:05"))
+	fmt.Printf("   • Last seen:  %s\n", query.LastSeen.Format("2006-01-02 15:04:05"))
+	fmt.Printf("   • SQL: %s\n\n", query.RawSQL)
+
+	metrics, err := repo.GetMetricHistory(query.ID, historyLimit)
+	if err != nil {
+		log.Fatalf("Failed to load metric history: %v", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SNAPSHOT\tCAPTURED AT\tCALLS\tAVG TIME (ms)\tTOTAL TIME (ms)")
+	for _, m := range metrics {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%.2f\t%.2f\n",
+			m.SnapshotID, m.CapturedAt.Format("2006-01-02 15:04:05"), m.Calls, m.MeanMS, m.TotalMS)
+	}
+	w.Flush()
+
+	recommendations, err := repo.GetRecommendationHistory(query.ID, historyLimit)
+	if err != nil {
+		log.Fatalf("Failed to load recommendation history: %v", err)
+	}
+
+	fmt.Printf("\n💡 Recommendations (%d):\n", len(recommendations))
+	for _, rec := range recommendations {
+		fmt.Printf("   • [%s] %s (%.0f%% confidence)\n",
+			rec.CreatedAt.Format("2006-01-02 15:04"), formatRecommendationType(rec.Type), rec.Confidence*100)
+		if rec.DDL != "" {
+			fmt.Printf("     %s\n", rec.DDL)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"cli/internal/advisor"
+	"cli/internal/config"
+	"cli/internal/db"
+	"cli/internal/format"
+	"cli/internal/hygiene"
+	"cli/internal/ingest"
+	"cli/internal/logger"
+)
+
+var (
+	indexReplicas       []string
+	indexMinObservation time.Duration
+	indexMinSize        string
+)
+
+var indexesCmd = &cobra.Command{
+	Use:   "indexes",
+	Short: "Find duplicate, redundant and unused indexes across the schema",
+	Long: `Report the indexes that can be dropped and the storage they would free.
+
+Every table is checked for:
+  • duplicates: same columns, expressions, operator classes and predicate
+  • redundant prefixes: B-tree indexes whose columns lead a wider index
+  • unused indexes: no scans since the statistics were reset
+  • invalid indexes left by a failed CREATE INDEX CONCURRENTLY
+
+Indexes behind a primary key, unique, exclusion or foreign key constraint,
+and the replica identity, are never proposed. Standbys count their own
+scans, so pass the targets of read replicas with --replica to include the
+scans they serve.
+
+Foreign keys without an index on the referencing columns are listed too,
+since every delete on the parent table scans the child.
+
+Examples:
+  optidb indexes
+  optidb indexes --replica standby1,standby2
+  optidb indexes --min-observation 720h --min-size 10MB`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runIndexes()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(indexesCmd)
+
+	indexesCmd.Flags().StringSliceVar(&indexReplicas, "replica", nil, "Targets of read replicas whose index scans count as usage")
+	indexesCmd.Flags().DurationVar(&indexMinObservation, "min-observation", hygiene.DefaultOptions().MinObservation, "Report unused indexes only when scans have been counted this long")
+	indexesCmd.Flags().StringVar(&indexMinSize, "min-size", "1MB", "Ignore unused indexes smaller than this")
+	addSnapshotFlag(indexesCmd)
+}
+
+func runIndexes() {
+	minSize, err := advisor.ParseSize(indexMinSize)
+	if err != nil {
+		log.Fatalf("Invalid --min-size: %v", err)
+	}
+
+	logger.LogInfo("Starting index hygiene analysis")
+	fmt.Println("🧹 Checking index hygiene...")
+
+	collector, database := openCollector()
+	if database != nil {
+		defer database.Close()
+	}
+
+	indexes, err := collector.GetIndexInfo()
+	if err != nil {
+		logger.LogErrorf("Failed to collect index info: %v", err)
+		log.Fatalf("Failed to collect index info: %v", err)
+	}
+
+	for _, name := range indexReplicas {
+		name = strings.TrimSpace(name)
+		fmt.Printf("🔁 Reading index scans on replica %s...\n", name)
+		replica, err := connectTarget(name)
+		if err != nil {
+			logger.LogErrorf("Failed to connect to replica %s: %v", name, err)
+			log.Fatalf("Failed to connect to replica %s: %v", name, err)
+		}
+		replicaIndexes, err := ingest.NewCollector(replica).GetIndexInfo()
+		replica.Close()
+		if err != nil {
+			logger.LogErrorf("Failed to collect index info from replica %s: %v", name, err)
+			log.Fatalf("Failed to collect index info from replica %s: %v", name, err)
+		}
+		hygiene.AddReplicaUsage(indexes, replicaIndexes)
+	}
+
+	opts := hygiene.DefaultOptions()
+	opts.MinObservation = indexMinObservation
+	opts.MinUnusedBytes = minSize
+	opts.Engine = collector.Engine()
+
+	tables, err := collector.GetTableInfo()
+	if err != nil {
+		logger.LogErrorf("Failed to collect table info: %v", err)
+		log.Fatalf("Failed to collect table info: %v", err)
+	}
+	keys, err := collector.GetForeignKeys()
+	if err != nil {
+		logger.LogErrorf("Failed to collect foreign keys: %v", err)
+		log.Fatalf("Failed to collect foreign keys: %v", err)
+	}
+
+	report := hygiene.Analyze(indexes, opts)
+	report.Replicas = indexReplicas
+	report.UnindexedForeignKeys = hygiene.UnindexedForeignKeys(keys, tables, indexes, opts.Engine)
+	printHygieneReport(report)
+}
+
+// connectTarget connects as the profiler role to a named target other than
+// the active one, e.g. a read replica.
+func connectTarget(name string) (*sql.DB, error) {
+	active := config.Get()
+	cfg := *active
+	if err := cfg.UseTarget(name); err != nil {
+		return nil, err
+	}
+	config.Set(&cfg)
+	defer config.Set(active)
+	return db.ConnectAsProfiler()
+}
+
+func printHygieneReport(report *hygiene.Report) {
+	fmt.Printf("   • Analyzed %d indexes, %d protected by constraints or replica identity\n", report.IndexesAnalyzed, report.Protected)
+	if report.StatsReset != nil {
+		fmt.Printf("   • Scans counted since %s", report.StatsReset.Local().Format("2006-01-02 15:04"))
+		if len(report.Replicas) > 0 {
+			fmt.Printf(", including replicas %s", strings.Join(report.Replicas, ", "))
+		}
+		fmt.Println()
+	}
+	if report.UnusedSkipped != "" {
+		fmt.Printf("⚠️  Unused indexes not reported: %s (see --min-observation)\n", report.UnusedSkipped)
+	}
+
+	printUnindexedForeignKeys(report.UnindexedForeignKeys)
+
+	if len(report.Findings) == 0 {
+		fmt.Println("\n✅ No droppable indexes found")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\nKIND\tTABLE\tINDEX\tCOLUMNS\tSCANS\tSIZE\tKEEP\tRISK")
+	fmt.Fprintln(w, "----\t-----\t-----\t-------\t-----\t----\t----\t----")
+	for _, f := range report.Findings {
+		keep := f.Keep
+		if keep == "" {
+			keep = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			f.Kind, f.Table, f.Index, strings.Join(f.Columns, ", "), f.IndexScans, format.Bytes(f.SizeBytes), keep, f.RiskLevel)
+	}
+	w.Flush()
+
+	fmt.Println("\n📝 DDL:")
+	for _, f := range report.Findings {
+		fmt.Printf("   %s\n", f.DDL)
+		if f.RestoreDDL != "" {
+			fmt.Printf("     -- to undo: %s;\n", f.RestoreDDL)
+		}
+	}
+
+	fmt.Printf("\n💾 Reclaimable: %s across %d indexes\n", format.Bytes(report.ReclaimableBytes), len(report.Findings))
+}
+
+func printUnindexedForeignKeys(keys []hygiene.UnindexedForeignKey) {
+	if len(keys) == 0 {
+		return
+	}
+
+	fmt.Printf("\n🔗 Foreign keys without a supporting index (%d):\n", len(keys))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SEVERITY\tTABLE\tCOLUMNS\tREFERENCES\tCHILD ROWS\tPARENT WRITES")
+	fmt.Fprintln(w, "--------\t-----\t-------\t----------\t----------\t-------------")
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\n",
+			k.Severity, k.Table, strings.Join(k.Columns, ", "), k.RefTable, k.ChildRows, k.ParentWrites)
+	}
+	w.Flush()
+	for _, k := range keys {
+		fmt.Printf("   %s\n", k.DDL)
+	}
+}
@@ -0,0 +1,263 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"cli/internal/format"
+	"cli/internal/ingest"
+	"cli/internal/logger"
+	"cli/internal/parse"
+	"cli/internal/store"
+)
+
+var (
+	logFormat       string
+	logFollow       bool
+	logFromStart    bool
+	logPollInterval time.Duration
+	logMinDuration  float64
+	logBatchSize    int
+)
+
+var ingestLogsCmd = &cobra.Command{
+	Use:   "ingest-logs <logfile>...",
+	Short: "Ingest slow statements and auto_explain plans from PostgreSQL logs",
+	Long: `Parse PostgreSQL server logs for statements logged by log_min_duration_statement
+and plans logged by auto_explain, and link them to query fingerprints.
+
+Supports stderr, csvlog and jsonlog output, and auto_explain plans in text or
+JSON format. Plans from auto_explain.log_analyze are what actually ran, so no
+EXPLAIN is executed against the database.
+
+Examples:
+  optidb ingest-logs /var/log/postgresql/postgresql.log
+  optidb ingest-logs --format csvlog postgresql.csv
+  optidb ingest-logs --follow /var/log/postgresql/postgresql.log`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if logFollow {
+			if len(args) != 1 {
+				log.Fatalf("--follow takes exactly one log file")
+			}
+			runFollowLogs(args[0])
+		} else {
+			runIngestLogs(args)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(ingestLogsCmd)
+
+	ingestLogsCmd.Flags().StringVar(&logFormat, "format", "auto", "Log format: auto, stderr, csvlog or jsonlog")
+	ingestLogsCmd.Flags().BoolVar(&logFollow, "follow", false, "Keep reading new entries as they are written")
+	ingestLogsCmd.Flags().BoolVar(&logFromStart, "from-start", false, "With --follow, read existing content before new entries")
+	ingestLogsCmd.Flags().DurationVar(&logPollInterval, "poll-interval", time.Second, "How often to check a followed file for new entries")
+	ingestLogsCmd.Flags().Float64Var(&logMinDuration, "min-duration", 0, "Ignore statements faster than this many ms")
+	ingestLogsCmd.Flags().IntVar(&logBatchSize, "batch-size", 100, "With --follow, statements per saved snapshot")
+	ingestLogsCmd.Flags().BoolVar(&saveSnapshot, "save", false, "Persist ingested statements in the meta store (database.meta, else the profiled database)")
+}
+
+func resolveLogFormat(path string) ingest.LogFormat {
+	switch logFormat {
+	case "stderr":
+		return ingest.LogFormatStderr
+	case "csvlog", "csv":
+		return ingest.LogFormatCSV
+	case "jsonlog", "json":
+		return ingest.LogFormatJSON
+	case "auto":
+	default:
+		log.Fatalf("Unknown log format %q (expected auto, stderr, csvlog or jsonlog)", logFormat)
+	}
+
+	format, err := ingest.DetectLogFormat(path)
+	if err != nil {
+		logger.LogErrorf("Failed to detect log format: %v", err)
+		log.Fatalf("Failed to detect log format: %v", err)
+	}
+	return format
+}
+
+func runIngestLogs(paths []string) {
+	logger.LogInfof("Ingesting %d log files", len(paths))
+	fmt.Println("📜 Ingesting PostgreSQL logs...")
+
+	var statements []ingest.LogStatement
+	for _, path := range paths {
+		format := resolveLogFormat(path)
+		parsed, err := ingest.ParseLogFile(path, format)
+		if err != nil {
+			logger.LogErrorf("Failed to parse %s: %v", path, err)
+			log.Fatalf("Failed to parse %s: %v", path, err)
+		}
+		fmt.Printf("   • %s (%s): %d statements\n", path, format, len(parsed))
+		statements = append(statements, filterLogStatements(parsed)...)
+	}
+
+	if len(statements) == 0 {
+		fmt.Println("✅ No logged statements found")
+		return
+	}
+
+	printLogSummary(statements)
+	persistLogStatements(statements)
+}
+
+func runFollowLogs(path string) {
+	detected := resolveLogFormat(path)
+	fmt.Printf("📜 Following %s (%s), press Ctrl+C to stop...\n", path, detected)
+
+	stop := make(chan struct{})
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		close(stop)
+	}()
+
+	var batch []ingest.LogStatement
+	err := ingest.TailLogFile(path, detected, logFromStart, logPollInterval, stop, func(s ingest.LogStatement) {
+		if s.DurationMS < logMinDuration {
+			return
+		}
+
+		planNote := ""
+		if s.Plan != nil {
+			planNote = fmt.Sprintf(" [%s plan: %s]", s.PlanFormat, s.Plan.Root.Label())
+		}
+		fmt.Printf("%s  %8.2f ms  %s  %s%s\n", s.LoggedAt.Format("15:04:05"), s.DurationMS, s.Fingerprint[:12], format.Truncate(s.Query, 60), planNote)
+
+		batch = append(batch, s)
+		if len(batch) >= logBatchSize {
+			persistLogStatements(batch)
+			batch = nil
+		}
+	})
+	if err != nil {
+		logger.LogErrorf("Failed to follow %s: %v", path, err)
+		log.Fatalf("Failed to follow %s: %v", path, err)
+	}
+
+	if len(batch) > 0 {
+		persistLogStatements(batch)
+	}
+}
+
+func filterLogStatements(statements []ingest.LogStatement) []ingest.LogStatement {
+	if logMinDuration <= 0 {
+		return statements
+	}
+
+	var filtered []ingest.LogStatement
+	for _, s := range statements {
+		if s.DurationMS >= logMinDuration {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered
+}
+
+// printLogSummary groups logged executions by fingerprint, slowest total first.
+func printLogSummary(statements []ingest.LogStatement) {
+	type group struct {
+		query     string
+		count     int
+		total     float64
+		max       float64
+		plans     int
+		planLabel string
+	}
+
+	groups := map[string]*group{}
+	var order []string
+	for _, s := range statements {
+		g, ok := groups[s.Fingerprint]
+		if !ok {
+			g = &group{query: s.Query}
+			groups[s.Fingerprint] = g
+			order = append(order, s.Fingerprint)
+		}
+		g.count++
+		g.total += s.DurationMS
+		if s.DurationMS > g.max {
+			g.max = s.DurationMS
+		}
+		if s.Plan != nil {
+			g.plans++
+			g.planLabel = s.Plan.Root.Label()
+		}
+	}
+
+	sort.Slice(order, func(i, j int) bool {
+		return groups[order[i]].total > groups[order[j]].total
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\nFINGERPRINT\tCOUNT\tAVG (ms)\tMAX (ms)\tPLANS\tQUERY")
+	fmt.Fprintln(w, "-----------\t-----\t--------\t--------\t-----\t-----")
+	for _, fp := range order {
+		g := groups[fp]
+		fmt.Fprintf(w, "%s\t%d\t%.2f\t%.2f\t%d\t%s\n",
+			fp[:12], g.count, g.total/float64(g.count), g.max, g.plans, format.Truncate(g.query, 60))
+		if g.planLabel != "" {
+			fmt.Fprintf(w, "\t\t\t\t\t↳ %s\n", g.planLabel)
+		}
+	}
+	w.Flush()
+
+	fmt.Printf("\n📈 %d executions across %d fingerprints\n", len(statements), len(order))
+}
+
+// persistLogStatements saves logged executions to the meta store. Like
+// persistScan, failures are reported without aborting.
+func persistLogStatements(statements []ingest.LogStatement) {
+	if !saveSnapshot {
+		return
+	}
+
+	repo, err := openRepository()
+	if err != nil {
+		logger.LogErrorf("Meta store unavailable, log samples not saved: %v", err)
+		fmt.Printf("⚠️  Log samples not saved: %v\n", err)
+		return
+	}
+	defer repo.Close()
+
+	parser := parse.NewQueryParser()
+	logged := make([]store.LoggedStatement, 0, len(statements))
+	for _, s := range statements {
+		logged = append(logged, store.LoggedStatement{
+			Fingerprint: s.Fingerprint,
+			RawSQL:      s.Query,
+			NormSQL:     parser.NormalizeQuery(s.Query),
+			Sample: store.LogSample{
+				LoggedAt:     s.LoggedAt,
+				DurationMS:   s.DurationMS,
+				UserName:     s.User,
+				DatabaseName: s.Database,
+				Parameters:   s.Parameters,
+				SourceFile:   s.SourceFile,
+			},
+			Plan: storedPlan(s.Plan),
+		})
+	}
+
+	snapshot, err := repo.SaveLogSamples("logs", logged)
+	if err != nil {
+		logger.LogErrorf("Failed to save log samples: %v", err)
+		fmt.Printf("⚠️  Log samples not saved: %v\n", err)
+		return
+	}
+
+	fmt.Printf("💾 Saved snapshot #%d (%d logged statements)\n", snapshot.ID, len(logged))
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"cli/internal/config"
+	"cli/internal/format"
+	"cli/internal/ingest"
+	"cli/internal/logger"
+	"cli/internal/parse"
+	"cli/internal/store"
+)
+
+var slowlogMinDuration float64
+
+var ingestSlowlogCmd = &cobra.Command{
+	Use:   "ingest-slowlog <slowlog>...",
+	Short: "Analyze a MySQL or MariaDB slow query log offline",
+	Long: `Parse MySQL or MariaDB slow query logs, aggregate the statements by
+fingerprint and run the rule engine over them without a database connection.
+
+Query_time, Lock_time, Rows_sent and Rows_examined are read from each entry,
+along with its "use db" and "SET timestamp" lines. Table sizes are estimated
+from rows examined and index definitions are not known, so check suggested
+indexes against SHOW INDEX before applying them.
+
+Examples:
+  optidb ingest-slowlog /var/lib/mysql/db1-slow.log
+  optidb ingest-slowlog --min-duration 500 --top 10 slow.log slow.log.1`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runIngestSlowlog(args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(ingestSlowlogCmd)
+
+	ingestSlowlogCmd.Flags().Float64Var(&slowlogMinDuration, "min-duration", 0, "Ignore executions faster than this many ms")
+	ingestSlowlogCmd.Flags().IntVar(&topN, "top", 20, "Number of top statements to analyze")
+	ingestSlowlogCmd.Flags().BoolVar(&saveSnapshot, "save", false, "Persist the analysis as a snapshot in the meta store (database.meta, else the profiled database)")
+	addRuleFlags(ingestSlowlogCmd)
+}
+
+func runIngestSlowlog(paths []string) {
+	logger.LogInfof("Ingesting %d slow logs", len(paths))
+	fmt.Println("🐢 Ingesting MySQL slow query logs...")
+
+	var entries []ingest.SlowLogEntry
+	for _, path := range paths {
+		parsed, err := ingest.ParseSlowLogFile(path)
+		if err != nil {
+			logger.LogErrorf("Failed to parse %s: %v", path, err)
+			log.Fatalf("Failed to parse %s: %v", path, err)
+		}
+		fmt.Printf("   • %s: %d statements\n", path, len(parsed))
+		for _, e := range parsed {
+			if e.QueryTimeMS >= slowlogMinDuration {
+				entries = append(entries, e)
+			}
+		}
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("✅ No logged statements found")
+		return
+	}
+
+	stats := ingest.AggregateSlowLog(entries)
+	tables := ingest.SlowLogTables(stats)
+
+	// The log comes from MySQL whatever target is configured, so the rule
+	// engine must emit MySQL DDL
+	ruleEngine := newRuleEngineFor(config.EngineMySQL)
+	parser := parse.NewQueryParser()
+
+	fmt.Printf("🔬 Analyzing %d statements...\n", min(topN, len(stats)))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\nFINGERPRINT\tCOUNT\tAVG (ms)\tMAX (ms)\tLOCK (ms)\tEXAMINED/CALL\tQUERY")
+	fmt.Fprintln(w, "-----------\t-----\t--------\t--------\t---------\t-------------\t-----")
+
+	totalRecommendations := 0
+	var analyzed []store.SnapshotQuery
+	for i, s := range stats {
+		if i >= topN {
+			break
+		}
+
+		recommendations := ruleEngine.AnalyzeQuery(s.Stats, tables, nil, nil)
+		totalRecommendations += len(recommendations)
+		analyzed = append(analyzed, store.SnapshotQuery{
+			Fingerprint:     s.Fingerprint,
+			NormSQL:         parser.NormalizeQuery(s.Stats.Query),
+			Stats:           s.Stats,
+			Recommendations: recommendations,
+		})
+
+		calls := float64(s.Stats.Calls)
+		fmt.Fprintf(w, "%s\t%d\t%.2f\t%.2f\t%.2f\t%.0f\t%s\n",
+			s.Fingerprint[:12], s.Stats.Calls, s.Stats.MeanExecTime, s.Stats.MaxExecTime,
+			s.LockTimeMS/calls, float64(s.RowsExamined)/calls, format.Truncate(s.Stats.Query, 60))
+
+		for _, rec := range recommendations {
+			fmt.Fprintf(w, "\t\t\t\t\t\t• %s (%.0f%% confidence)\n", rec.Type, rec.Confidence*100)
+			if rec.DDL != "" {
+				fmt.Fprintf(w, "\t\t\t\t\t\t  DDL: %s\n", rec.DDL)
+			}
+			fmt.Fprintf(w, "\t\t\t\t\t\t  %s\n", rec.Rationale)
+		}
+	}
+	w.Flush()
+
+	fmt.Printf("\n📈 Slow Log Summary:\n")
+	fmt.Printf("   • %d executions across %d fingerprints\n", len(entries), len(stats))
+	fmt.Printf("   • Estimated sizes for %d tables from rows examined\n", len(tables))
+	fmt.Printf("   • Generated %d recommendations\n", totalRecommendations)
+	printRuleStats(ruleEngine)
+
+	// Inferred table sizes are not catalog statistics, so only the
+	// statements are saved
+	persistScan("slowlog", analyzed, nil, nil)
+}
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"cli/internal/format"
+	"cli/internal/ingest"
+	"cli/internal/locks"
+	"cli/internal/logger"
+)
+
+var (
+	locksDuration time.Duration
+	locksInterval time.Duration
+	locksMinWait  time.Duration
+	locksTop      int
+)
+
+var locksCmd = &cobra.Command{
+	Use:   "locks",
+	Short: "Sample lock waits and show who blocks whom",
+	Long: `Watch the sessions of the server for a while and report lock contention.
+
+Every --interval the sessions are read from pg_stat_activity and pg_locks,
+using pg_blocking_pids to find who blocks whom (on MySQL, the process list
+and the sys schema's lock wait views). From the samples the report shows:
+  • the blocking trees: sessions holding locks others queue behind
+  • which statement waited for which, on what table and for how long
+  • the tables with the most lock wait
+
+Each blocked statement comes with an explanation and a remedy. The
+dashboard samples continuously while 'optidb serve' runs with
+--activity-interval set, and feeds the waits to the lock_contention rule.
+pg_blocking_pids takes the lock manager's shared state exclusively while it
+runs, so sample busy servers briefly or with a longer --interval.
+
+Examples:
+  optidb locks
+  optidb locks --duration 2m --interval 500ms
+  optidb locks --min-wait 5s --top 3`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runLocks()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(locksCmd)
+
+	locksCmd.Flags().DurationVar(&locksDuration, "duration", 30*time.Second, "How long to sample for")
+	locksCmd.Flags().DurationVar(&locksInterval, "interval", time.Second, "Time between samples")
+	locksCmd.Flags().DurationVar(&locksMinWait, "min-wait", locks.DefaultOptions().MinWait, "Ignore statement pairs that waited less than this in total")
+	locksCmd.Flags().IntVar(&locksTop, "top", 5, "Number of blocking trees to show")
+}
+
+func runLocks() {
+	if locksInterval <= 0 {
+		log.Fatalf("--interval must be positive")
+	}
+
+	logger.LogInfo("Starting lock contention analysis")
+	fmt.Printf("🔒 Sampling locks every %s for %s...\n", locksInterval, locksDuration)
+
+	collector, database := openCollector()
+	if database != nil {
+		defer database.Close()
+	}
+
+	samples, err := ingest.SampleActivityFor(collector.SampleActivity, locksDuration, locksInterval)
+	if err != nil {
+		logger.LogErrorf("Failed to sample activity: %v", err)
+		log.Fatalf("Failed to sample activity: %v", err)
+	}
+
+	opts := locks.DefaultOptions()
+	opts.Interval = locksInterval
+	opts.MinWait = locksMinWait
+	printLocksReport(locks.Analyze(samples, opts))
+}
+
+func printLocksReport(report *locks.Report) {
+	fmt.Printf("   • %d samples over %s\n", report.Samples, report.Window.Round(time.Second))
+
+	if len(report.Trees) == 0 && len(report.Waits) == 0 {
+		fmt.Println("\n✅ No session waited for a lock")
+		return
+	}
+
+	trees := report.Trees
+	if len(trees) > locksTop {
+		trees = trees[:locksTop]
+	}
+	fmt.Printf("\n🌳 Blocking trees (%d, largest first):\n", len(report.Trees))
+	for _, t := range trees {
+		fmt.Printf("\n   at %s, %d blocked:\n", t.CapturedAt.Local().Format("15:04:05"), t.Blocked)
+		printLockNode(t.Root, "   ", "")
+	}
+
+	if len(report.Waits) > 0 {
+		fmt.Printf("\n⏱️  Lock waits by statement:\n")
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "WAITER\tBLOCKER\tBLOCKER STATE\tLOCK\tRELATION\tWAIT TIME\tLONGEST")
+		fmt.Fprintln(w, "------\t-------\t-------------\t----\t--------\t---------\t-------")
+		for _, wait := range report.Waits {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				orDash(format.Truncate(wait.Query, 50)), orDash(format.Truncate(wait.BlockerQuery, 50)), wait.BlockerState, wait.LockMode,
+				orDash(wait.Relation), wait.WaitTime.Round(100*time.Millisecond), wait.LongestWait.Round(100*time.Millisecond))
+		}
+		w.Flush()
+	}
+
+	if len(report.Relations) > 0 {
+		fmt.Printf("\n📋 Lock wait by relation:\n")
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "RELATION\tWAIT TIME\tSTATEMENTS")
+		fmt.Fprintln(w, "--------\t---------\t----------")
+		for _, r := range report.Relations {
+			fmt.Fprintf(w, "%s\t%s\t%d\n", r.Relation, r.WaitTime.Round(100*time.Millisecond), r.Statements)
+		}
+		w.Flush()
+	}
+
+	if len(report.Waits) > 0 {
+		fmt.Printf("\n💡 What blocked what:\n")
+		for _, wait := range report.Waits {
+			fmt.Printf("\n   %s\n", wait.Describe())
+			fmt.Printf("   %s\n", wait.Remedy())
+		}
+	}
+}
+
+// printLockNode prints a session and, indented below it, the sessions
+// waiting for it
+func printLockNode(n *locks.Node, indent, branch string) {
+	detail := n.State
+	if n.XactAge > 0 {
+		detail += fmt.Sprintf(", transaction open %s", n.XactAge.Round(time.Second))
+	}
+	if branch != "" {
+		on := ""
+		if n.Relation != "" {
+			on = " on " + n.Relation
+		}
+		detail = fmt.Sprintf("waits %s for %s%s, %s", n.Waiting.Round(100*time.Millisecond), n.LockMode, on, detail)
+	}
+	fmt.Printf("%s%sPID %d (%s): %s\n", indent, branch, n.PID, detail, orDash(format.Truncate(n.Query, 60)))
+
+	if branch != "" {
+		indent += "   "
+	}
+	for _, child := range n.Blocked {
+		printLockNode(child, indent, "└─ ")
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
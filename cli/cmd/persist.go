@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+
+	"cli/internal/db"
+	"cli/internal/logger"
+	"cli/internal/store"
+)
+
+var saveSnapshot bool
+
+// openRepository connects to the meta store and applies any pending migrations.
+func openRepository() (*store.Repository, error) {
+	conn, err := db.ConnectMetaStore()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := store.Migrate(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return store.NewRepository(conn), nil
+}
+
+// persistScan records analyzed queries as a meta store snapshot. The live
+// analysis has already been printed by the time this runs, so failures are
+// reported but never abort the command.
+func persistScan(source string, queries []store.SnapshotQuery, tables []store.TableInfo, indexes []store.IndexInfo) {
+	if !saveSnapshot {
+		return
+	}
+
+	repo, err := openRepository()
+	if err != nil {
+		logger.LogErrorf("Meta store unavailable, snapshot not saved: %v", err)
+		fmt.Printf("⚠️  Snapshot not saved: %v\n", err)
+		return
+	}
+	defer repo.Close()
+
+	snapshot, err := repo.SaveSnapshot(source, queries, tables, indexes)
+	if err != nil {
+		logger.LogErrorf("Failed to save snapshot: %v", err)
+		fmt.Printf("⚠️  Snapshot not saved: %v\n", err)
+		return
+	}
+
+	fmt.Printf("💾 Saved snapshot #%d (%d queries)\n", snapshot.ID, len(queries))
+}
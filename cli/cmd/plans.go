@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"cli/internal/config"
+	"cli/internal/explain"
+	"cli/internal/ingest"
+	"cli/internal/logger"
+	"cli/internal/store"
+)
+
+var (
+	explainTop     int
+	explainAnalyze bool
+	explainTimeout time.Duration
+)
+
+// addExplainFlags registers the plan capture flags shared by scan and bottlenecks.
+func addExplainFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&explainTop, "explain-top", 10, "Capture EXPLAIN plans for the top K queries (0 to disable)")
+	cmd.Flags().BoolVar(&explainAnalyze, "explain-analyze", false, "Use EXPLAIN ANALYZE for read-only queries without parameters (executes them)")
+	cmd.Flags().DurationVar(&explainTimeout, "explain-timeout", 5*time.Second, "statement_timeout applied to each EXPLAIN")
+}
+
+// newPlanner returns the plans recorded in a --from-snapshot export, or a
+// live explainer. It returns nil on MySQL, whose EXPLAIN output the plan
+// parser does not read; capturePlan then captures nothing.
+func newPlanner(database *sql.DB, collector ingest.Collector) explain.Planner {
+	if fc, ok := collector.(*ingest.FileCollector); ok {
+		return fc
+	}
+	if collector.Engine() == config.EngineMySQL {
+		return nil
+	}
+	return explain.NewExplainer(database, explain.Options{
+		Analyze:          explainAnalyze,
+		Buffers:          explainAnalyze,
+		StatementTimeout: explainTimeout,
+	})
+}
+
+// capturePlan explains the query at the given rank if it falls within
+// --explain-top. Failures are logged and yield nil so one statement that
+// cannot be planned never aborts the scan.
+func capturePlan(planner explain.Planner, rank int, query string) *explain.Plan {
+	if planner == nil || rank >= explainTop {
+		return nil
+	}
+
+	plan, err := planner.Explain(query)
+	if errors.Is(err, ingest.ErrPlanNotExported) {
+		logger.LogDebugf("No exported plan for %s", query[:min(50, len(query))])
+		return nil
+	}
+	if err != nil {
+		logger.LogErrorf("Failed to explain query %s: %v", query[:min(50, len(query))], err)
+		return nil
+	}
+	return plan
+}
+
+// storedPlan converts a captured plan for persistence, passing nil through.
+func storedPlan(plan *explain.Plan) *store.QueryPlan {
+	if plan == nil {
+		return nil
+	}
+	qp := plan.ToQueryPlan()
+	return &qp
+}
+
+func printPlanFacts(plan *explain.Plan) {
+	facts := plan.Facts()
+
+	fmt.Printf("\n🧭 Plan (%s, cost %.2f, %d est rows):\n", facts.RootNodeType, facts.TotalCost, facts.EstimatedRows)
+	if facts.HasSeqScan {
+		fmt.Printf("   • Seq Scan on: %s\n", strings.Join(facts.SeqScanRelations, ", "))
+	}
+	if len(facts.IndexesUsed) > 0 {
+		fmt.Printf("   • Indexes used: %s\n", strings.Join(facts.IndexesUsed, ", "))
+	}
+	if len(facts.JoinTypes) > 0 {
+		fmt.Printf("   • Joins: %s\n", strings.Join(facts.JoinTypes, ", "))
+	}
+	if facts.Analyzed {
+		fmt.Printf("   • Actual rows: %d in %.2f ms\n", facts.ActualRows, facts.ExecutionTime)
+		if facts.MaxRowSkew >= 10 {
+			fmt.Printf("   • Row estimate off by %.0fx at %s\n", facts.MaxRowSkew, facts.SkewedNode)
+		}
+		fmt.Printf("   • Buffers: %d hit, %d read\n", facts.BuffersHit, facts.BuffersRead)
+	}
+	if facts.ExternalSort {
+		fmt.Printf("   • Sort spilled to disk\n")
+	}
+}
@@ -4,19 +4,29 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"log"
 	"os"
 
 	"github.com/spf13/cobra"
+
+	"cli/internal/config"
+	"cli/internal/logger"
+)
+
+var (
+	cfgFile    string
+	cfgProfile string
+	cfgTarget  string
 )
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "optidb",
 	Short: "AI-Powered Database Performance Profiler",
-	Long: `OptiDB analyzes PostgreSQL query performance and provides actionable optimization recommendations.
+	Long: `OptiDB analyzes PostgreSQL and MySQL/MariaDB query performance and provides actionable optimization recommendations.
 
 Features:
-- Scan pg_stat_statements for slow queries
+- Scan pg_stat_statements (or MySQL performance_schema) for slow queries
 - Detect missing indexes and inefficient queries  
 - Generate DDL recommendations with confidence scores
 - Analyze correlated subqueries and join patterns
@@ -26,6 +36,9 @@ Examples:
   optidb scan --min-duration 1.0 --top 20
   optidb bottlenecks --limit 5
   optidb serve --port 8090`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		loadConfig()
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -42,9 +55,29 @@ func init() {
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
-	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.cli.yaml)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file, YAML or TOML (default is ./optidb.yaml or $HOME/.config/optidb/config.yaml)")
+	rootCmd.PersistentFlags().StringVar(&cfgProfile, "profile", "", "config profile to apply, e.g. prod (default is $OPTIDB_PROFILE)")
+	rootCmd.PersistentFlags().StringVar(&cfgTarget, "target", "", "named database target from the config file, e.g. staging (default is $OPTIDB_TARGET)")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
+
+// loadConfig loads the config file, profile and environment overrides and
+// makes them the active configuration for every package.
+func loadConfig() {
+	cfg, source, err := config.Load(cfgFile, cfgProfile, cfgTarget)
+	if err != nil {
+		logger.LogErrorf("Failed to load configuration: %v", err)
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		logger.LogErrorf("Invalid configuration: %v", err)
+		log.Fatalf("Invalid configuration (see 'optidb config validate'):\n%v", err)
+	}
+	if source.Profile != "" {
+		logger.LogInfof("Using config profile %s", source.Profile)
+	}
+	config.Set(cfg)
+}
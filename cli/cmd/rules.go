@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"cli/internal/cache"
+	"cli/internal/config"
+	"cli/internal/ingest"
+	"cli/internal/logger"
+	"cli/internal/rules"
+	"cli/internal/store"
+)
+
+var disabledRules []string
+
+var rulesCmd = &cobra.Command{
+	Use:   "rules",
+	Short: "List the rules used to generate recommendations",
+	Long: `List every registered rule with its ID, the inputs it needs and whether it
+is enabled. Rules can be turned off for a run with --disable-rule on scan and
+bottlenecks, e.g. --disable-rule redundant_index,cardinality_issue.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runRules()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rulesCmd)
+}
+
+func addRuleFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&disabledRules, "disable-rule", nil, "Rule IDs to skip (see 'optidb rules')")
+}
+
+// newRuleEngine creates the rule engine with --disable-rule applied
+func newRuleEngine() *rules.RuleEngine {
+	return newRuleEngineFor(config.Get().Database.Engine)
+}
+
+// newRuleEngineFor builds the rule engine for data from another engine than
+// the configured target
+func newRuleEngineFor(dialect string) *rules.RuleEngine {
+	engine := rules.NewRuleEngineFor(dialect)
+	for _, id := range disabledRules {
+		if err := engine.Registry().Disable(strings.TrimSpace(id)); err != nil {
+			log.Fatalf("Invalid --disable-rule: %v", err)
+		}
+	}
+	return engine
+}
+
+// loadRuleInputs collects the rule inputs once for a run: the redundant
+// indexes among the collected ones, the planner's column statistics, the
+// foreign keys and, on PostgreSQL, the memory settings and buffer cache hit
+// ratios. Rules that need them are skipped without them, so a failure is a
+// warning.
+func loadRuleInputs(collector ingest.Collector, engine *rules.RuleEngine, indexes []store.IndexInfo) *rules.Inputs {
+	inputs := &rules.Inputs{Hygiene: engine.IndexHygiene(indexes)}
+
+	stats, err := collector.GetColumnStats(nil)
+	if err != nil {
+		logger.LogErrorf("Failed to collect column statistics: %v", err)
+		fmt.Printf("⚠️  Column statistics unavailable, index recommendations ignore selectivity: %v\n", err)
+	} else {
+		inputs.SetColumnStats(stats)
+	}
+
+	keys, err := collector.GetForeignKeys()
+	if err != nil {
+		logger.LogErrorf("Failed to collect foreign keys: %v", err)
+		fmt.Printf("⚠️  Foreign keys unavailable, unindexed foreign keys are not checked: %v\n", err)
+	} else {
+		inputs.ForeignKeys = keys
+	}
+
+	if collector.Engine() == config.EngineMySQL {
+		return inputs
+	}
+	memory, err := collector.GetMemorySettings()
+	if err != nil {
+		logger.LogErrorf("Failed to collect memory settings: %v", err)
+		fmt.Printf("⚠️  Memory settings unavailable, temp file spills are not checked: %v\n", err)
+	} else {
+		inputs.Memory = memory
+	}
+
+	usage, err := collector.GetCacheStats()
+	if err != nil {
+		logger.LogErrorf("Failed to collect buffer cache statistics: %v", err)
+		fmt.Printf("⚠️  Buffer cache statistics unavailable, cache hit ratios are not checked: %v\n", err)
+	} else {
+		inputs.Cache = cache.Analyze(usage, memory, cache.DefaultOptions())
+	}
+	return inputs
+}
+
+func runRules() {
+	engine := newRuleEngine()
+	registry := engine.Registry()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tENABLED\tREQUIRES\tDESCRIPTION")
+	fmt.Fprintln(w, "--\t-------\t--------\t-----------")
+	for _, rule := range registry.Rules() {
+		var inputs []string
+		for _, input := range rule.Requires() {
+			inputs = append(inputs, string(input))
+		}
+		enabled := "yes"
+		if !registry.IsEnabled(rule.ID()) {
+			enabled = "no"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", rule.ID(), enabled, strings.Join(inputs, ", "), rule.Description())
+	}
+	w.Flush()
+}
+
+// printRuleStats shows how long each rule took and which ones failed
+func printRuleStats(engine *rules.RuleEngine) {
+	stats := engine.Stats()
+	if len(stats) == 0 {
+		return
+	}
+
+	fmt.Printf("\n⚙️  Rules:\n")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, s := range stats {
+		status := ""
+		if s.Panics > 0 {
+			status = fmt.Sprintf("⚠️  %d panics: %s", s.Panics, s.LastError)
+		} else if s.Errors > 0 {
+			status = fmt.Sprintf("⚠️  %d errors: %s", s.Errors, s.LastError)
+		}
+		fmt.Fprintf(w, "   • %s\t%d runs\t%s avg\t%d recommendations\t%s\n",
+			s.RuleID, s.Evaluations, s.MeanDuration(), s.Recommendations, status)
+	}
+	w.Flush()
+}
@@ -5,18 +5,20 @@ import (
 	"log"
 	"os"
 	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
 
-	"cli/internal/db"
 	"cli/internal/ingest"
 	"cli/internal/logger"
-	"cli/internal/rules"
+	"cli/internal/parse"
+	"cli/internal/store"
 )
 
 var (
 	minDuration float64
 	topN        int
+	window      time.Duration
 )
 
 var scanCmd = &cobra.Command{
@@ -38,28 +40,31 @@ func init() {
 
 	scanCmd.Flags().Float64Var(&minDuration, "min-duration", 0.1, "Minimum query duration in ms to analyze")
 	scanCmd.Flags().IntVar(&topN, "top", 20, "Number of top queries to analyze")
+	scanCmd.Flags().DurationVar(&window, "window", 0, "Rank by activity within this sampling window (e.g. 30s) instead of since the last stats reset")
+	scanCmd.Flags().BoolVar(&saveSnapshot, "save", false, "Persist the scan as a snapshot in the meta store (database.meta, else the profiled database)")
+	addExplainFlags(scanCmd)
+	addSnapshotFlag(scanCmd)
+	addRuleFlags(scanCmd)
 }
 
 func runScan() {
 	logger.LogInfo("Starting database scan for performance issues")
 	fmt.Println("🔍 Scanning database for performance issues...")
 
-	// Connect to database as profiler_ro
-	database, err := db.ConnectAsProfiler()
-	if err != nil {
-		logger.LogErrorf("Failed to connect to database: %v", err)
-		log.Fatalf("Failed to connect to database: %v", err)
+	collector, database := openCollector()
+	if database != nil {
+		defer database.Close()
 	}
-	defer database.Close()
 
 	// Initialize components
-	collector := ingest.NewStatsCollector(database)
-	ruleEngine := rules.NewRuleEngine()
+	parser := parse.NewQueryParser()
+	ruleEngine := newRuleEngine()
+	planner := newPlanner(database, collector)
 	logger.LogInfo("Initialized stats collector and rule engine")
 
 	// Collect query statistics
 	fmt.Println("📊 Collecting query statistics...")
-	queryStats, err := collector.GetSlowQueries(minDuration)
+	queryStats, err := collectSlowQueries(collector, minDuration)
 	if err != nil {
 		logger.LogErrorf("Failed to collect query stats: %v", err)
 		log.Fatalf("Failed to collect query stats: %v", err)
@@ -84,6 +89,7 @@ func runScan() {
 		logger.LogErrorf("Failed to collect index info: %v", err)
 		log.Fatalf("Failed to collect index info: %v", err)
 	}
+	inputs := loadRuleInputs(collector, ruleEngine, indexes)
 
 	// Analyze queries and generate recommendations
 	fmt.Printf("🔬 Analyzing %d slow queries...\n", len(queryStats))
@@ -93,6 +99,8 @@ func runScan() {
 	fmt.Fprintln(w, "-----\t-----\t------------\t--------------\t---------------")
 
 	totalRecommendations := 0
+	plansCaptured := 0
+	var analyzed []store.SnapshotQuery
 
 	for i, query := range queryStats {
 		if i >= topN {
@@ -100,7 +108,18 @@ func runScan() {
 		}
 
 		// Parse and analyze query
-		recommendations := ruleEngine.AnalyzeQuery(query, tables, indexes)
+		plan := capturePlan(planner, i, query.Query)
+		recommendations := ruleEngine.AnalyzeQueryWithPlan(query, tables, indexes, plan, inputs)
+		if plan != nil {
+			plansCaptured++
+		}
+		analyzed = append(analyzed, store.SnapshotQuery{
+			Fingerprint:     parser.GenerateFingerprint(query.Query),
+			NormSQL:         parser.NormalizeQuery(query.Query),
+			Stats:           query,
+			Recommendations: recommendations,
+			Plan:            storedPlan(plan),
+		})
 
 		// Display query summary
 		shortQuery := query.Query
@@ -135,8 +154,30 @@ func runScan() {
 	fmt.Printf("   • Analyzed %d slow queries\n", len(queryStats))
 	fmt.Printf("   • Found %d tables with %d indexes\n", len(tables), len(indexes))
 	fmt.Printf("   • Generated %d recommendations\n", totalRecommendations)
+	if explainTop > 0 {
+		fmt.Printf("   • Captured %d EXPLAIN plans\n", plansCaptured)
+	}
+	printRuleStats(ruleEngine)
+
+	persistScan("scan", analyzed, tables, indexes)
 
 	if totalRecommendations > 0 {
 		fmt.Printf("\n💡 Run 'optidb bottlenecks' to see detailed recommendations\n")
+		fmt.Printf("💡 Run 'optidb advise' for a deduplicated index plan across the whole workload\n")
+	}
+}
+
+// collectSlowQueries reads cumulative stats, or samples a delta window when
+// --window is set.
+func collectSlowQueries(collector ingest.Collector, minDurationMS float64) ([]store.QueryStats, error) {
+	if window <= 0 {
+		return collector.GetSlowQueries(minDurationMS)
+	}
+
+	if fromSnapshot != "" {
+		fmt.Println("⏱️  Reading the window recorded in the snapshot...")
+	} else {
+		fmt.Printf("⏱️  Sampling pg_stat_statements for %s...\n", window)
 	}
+	return collector.GetSlowQueriesInWindow(minDurationMS, window)
 }
@@ -5,15 +5,21 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"cli/internal/config"
 	"cli/internal/http"
 	"cli/internal/logger"
+	"cli/internal/store"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	port string
+	port             string
+	sampleInterval   time.Duration
+	activityInterval time.Duration
+	waitInterval     time.Duration
 )
 
 // serveCmd represents the serve command
@@ -27,12 +33,29 @@ Features:
 - Interactive HTMX dashboard
 - REST API endpoints for integration
 - Query detail analysis
+- Lock contention and blocking trees
+- Active session history by wait event
 - AI-powered recommendations
 
 Examples:
   optidb serve --port 8090
-  optidb serve --port 3000`,
+  optidb serve --port 3000
+  optidb serve --from-snapshot prod.tar.gz`,
 	Run: func(cmd *cobra.Command, args []string) {
+		// Flags win over the config file only when given explicitly
+		settings := config.Get().Server
+		if !cmd.Flags().Changed("port") {
+			port = settings.Port
+		}
+		if !cmd.Flags().Changed("sample-interval") {
+			sampleInterval = settings.SampleInterval
+		}
+		if !cmd.Flags().Changed("activity-interval") {
+			activityInterval = settings.ActivityInterval
+		}
+		if !cmd.Flags().Changed("wait-interval") {
+			waitInterval = settings.WaitInterval
+		}
 		runServe()
 	},
 }
@@ -42,7 +65,16 @@ var initCmd = &cobra.Command{
 	Short: "Initialize database extensions, roles, and meta-store.",
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("NOTE: Assuming extensions (pg_stat_statements, etc.) and roles are created.")
-		fmt.Println("Initialization logic will go here.")
+
+		repo, err := openRepository()
+		if err != nil {
+			logger.LogErrorf("Failed to initialize meta store: %v", err)
+			fmt.Printf("❌ Failed to initialize meta store: %v\n", err)
+			os.Exit(1)
+		}
+		defer repo.Close()
+
+		fmt.Printf("✅ Meta store ready (schema version %d)\n", store.LatestSchemaVersion())
 	},
 }
 
@@ -50,12 +82,19 @@ func runServe() {
 	logger.LogInfo("Starting OptiDB web server")
 
 	// Create server
-	server := http.NewServer()
+	var server *http.Server
+	if fromSnapshot != "" {
+		server = http.NewSnapshotServer(loadSnapshot())
+	} else {
+		server = http.NewServer()
+	}
 	if server == nil {
 		logger.LogError("Failed to create web server")
 		os.Exit(1)
 	}
 
+	server.StartSampling(sampleInterval, activityInterval, waitInterval)
+
 	// Setup graceful shutdown
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
@@ -84,4 +123,8 @@ func init() {
 	rootCmd.AddCommand(initCmd)
 
 	serveCmd.Flags().StringVar(&port, "port", "8090", "Port to run the web server on")
+	addSnapshotFlag(serveCmd)
+	serveCmd.Flags().DurationVar(&sampleInterval, "sample-interval", time.Minute, "How often to snapshot pg_stat_statements for /api/v1/deltas (0 disables)")
+	serveCmd.Flags().DurationVar(&activityInterval, "activity-interval", 0, "How often to sample sessions and locks for /api/v1/locks, 0 to disable. Each sample calls pg_blocking_pids, which takes the lock manager's shared state exclusively while it runs, so keep this at 10s or more on busy servers")
+	serveCmd.Flags().DurationVar(&waitInterval, "wait-interval", time.Second, "How often to sample wait events from pg_stat_activity for /api/v1/waits (0 disables)")
 }
@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"cli/internal/config"
+	"cli/internal/format"
+	"cli/internal/horizon"
+	"cli/internal/logger"
+)
+
+var (
+	sessionsIdle            time.Duration
+	sessionsLongTransaction time.Duration
+	sessionsLongStatement   time.Duration
+	sessionsXminAge         int64
+	sessionsTerminate       bool
+	sessionsYes             bool
+)
+
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "Find long and idle-in-transaction sessions holding back vacuum",
+	Long: `Report what keeps vacuum from removing dead rows: every open transaction
+or snapshot in pg_stat_activity, the replication slots and the prepared
+transactions.
+
+Findings are raised for:
+  • sessions idle in a transaction for longer than --idle
+  • statements running longer than --long-statement
+  • transactions open longer than --long-transaction
+  • snapshots, slots and prepared transactions older than --xmin-age
+    transaction IDs, and inactive slots keeping a lot of WAL
+
+For the roles whose sessions were flagged, per-role
+idle_in_transaction_session_timeout and statement_timeout settings are
+recommended. PostgreSQL only.
+
+--terminate ends the sessions found idle in a transaction. Without --yes
+it only prints the statements; each one checks the session is still idle
+since the same moment, so a session that has moved on is left alone. The
+connecting role needs pg_signal_backend or superuser.
+
+Examples:
+  optidb sessions
+  optidb sessions --idle 1m --long-transaction 10m
+  optidb sessions --terminate
+  optidb sessions --terminate --yes`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runSessions()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sessionsCmd)
+
+	defaults := horizon.DefaultOptions()
+	sessionsCmd.Flags().DurationVar(&sessionsIdle, "idle", defaults.IdleInTransaction, "Flag sessions idle in a transaction for longer than this")
+	sessionsCmd.Flags().DurationVar(&sessionsLongTransaction, "long-transaction", defaults.LongTransaction, "Flag transactions open for longer than this")
+	sessionsCmd.Flags().DurationVar(&sessionsLongStatement, "long-statement", defaults.LongStatement, "Flag statements running for longer than this")
+	sessionsCmd.Flags().Int64Var(&sessionsXminAge, "xmin-age", defaults.XminAge, "Flag snapshots, slots and prepared transactions older than this many transaction IDs")
+	sessionsCmd.Flags().BoolVar(&sessionsTerminate, "terminate", false, "Terminate the sessions found idle in a transaction (dry run without --yes)")
+	sessionsCmd.Flags().BoolVar(&sessionsYes, "yes", false, "Run the --terminate statements instead of printing them")
+}
+
+func runSessions() {
+	logger.LogInfo("Starting transaction horizon analysis")
+	fmt.Println("🕰️  Checking open transactions and what holds back vacuum...")
+
+	collector, database := openCollector()
+	if database != nil {
+		defer database.Close()
+	}
+	if collector.Engine() == config.EngineMySQL {
+		log.Fatalf("Session horizon monitoring needs PostgreSQL")
+	}
+
+	state, err := collector.GetTransactionHorizon()
+	if err != nil {
+		logger.LogErrorf("Failed to collect open transactions: %v", err)
+		log.Fatalf("Failed to collect open transactions: %v", err)
+	}
+
+	opts := horizon.DefaultOptions()
+	opts.IdleInTransaction = sessionsIdle
+	opts.LongTransaction = sessionsLongTransaction
+	opts.LongStatement = sessionsLongStatement
+	opts.XminAge = sessionsXminAge
+	report := horizon.Analyze(state, opts)
+	printSessionsReport(report)
+
+	if sessionsTerminate {
+		terminateIdleSessions(database, report)
+	}
+}
+
+func printSessionsReport(report *horizon.Report) {
+	state := report.Horizon
+	fmt.Printf("   • idle_in_transaction_session_timeout %s, statement_timeout %s, idle_session_timeout %s\n",
+		timeoutOrOff(state.Settings.IdleInTransaction), timeoutOrOff(state.Settings.Statement), timeoutOrOff(state.Settings.IdleSession))
+	if report.OldestHolder != "" {
+		fmt.Printf("   • Oldest transaction ID held by %s, %d transactions ago\n", report.OldestHolder, report.OldestXminAge)
+	}
+
+	if len(state.Sessions) > 0 {
+		fmt.Printf("\n🧵 Open transactions (%d, oldest first):\n", len(state.Sessions))
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PID\tUSER\tAPPLICATION\tSTATE\tXACT AGE\tIN STATE\tXMIN AGE\tQUERY")
+		fmt.Fprintln(w, "---\t----\t-----------\t-----\t--------\t--------\t--------\t-----")
+		for _, s := range state.Sessions {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+				s.PID, orDash(s.User), orDash(s.Application), orDash(s.State),
+				elapsedSince(state.CapturedAt, s.XactStart), elapsedSince(state.CapturedAt, s.StateChange),
+				s.XminAge, orDash(format.Truncate(s.Query, 50)))
+		}
+		w.Flush()
+	}
+
+	if len(state.Slots) > 0 {
+		fmt.Printf("\n🛰️  Replication slots:\n")
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SLOT\tTYPE\tDATABASE\tACTIVE\tXMIN AGE\tCATALOG XMIN AGE\tRETAINED WAL")
+		fmt.Fprintln(w, "----\t----\t--------\t------\t--------\t----------------\t------------")
+		for _, s := range state.Slots {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%d\t%d\t%s\n",
+				s.Name, s.Type, orDash(s.Database), s.Active, s.XminAge, s.CatalogXminAge, format.Bytes(s.RetainedWALBytes))
+		}
+		w.Flush()
+	}
+
+	if len(state.Prepared) > 0 {
+		fmt.Printf("\n📝 Prepared transactions:\n")
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "GID\tOWNER\tDATABASE\tPREPARED\tXID AGE")
+		fmt.Fprintln(w, "---\t-----\t--------\t--------\t-------")
+		for _, p := range state.Prepared {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n", p.GID, p.Owner, p.Database, p.Prepared.Local().Format("2006-01-02 15:04"), p.XIDAge)
+		}
+		w.Flush()
+	}
+
+	if len(report.Findings) == 0 {
+		fmt.Println("\n✅ Nothing is holding back vacuum")
+		return
+	}
+
+	fmt.Printf("\n🚨 Findings (%d):\n", len(report.Findings))
+	for _, f := range report.Findings {
+		subject := f.Name
+		if f.PID != 0 {
+			subject = fmt.Sprintf("pid %d", f.PID)
+		} else if subject == "" {
+			subject = f.User
+		}
+		fmt.Printf("\n   [%s] %s: %s\n", f.RiskLevel, f.Kind, subject)
+		fmt.Printf("   %s\n", f.Rationale)
+		if f.DDL != "" {
+			fmt.Printf("   %s\n", f.DDL)
+		}
+		if f.Terminate != "" {
+			fmt.Printf("   To end it: %s\n", f.Terminate)
+		}
+	}
+}
+
+// terminateIdleSessions runs the guarded pg_terminate_backend of every
+// session found idle in a transaction, or prints them without --yes.
+// Sessions busy with work are left to the user.
+func terminateIdleSessions(database *sql.DB, report *horizon.Report) {
+	var targets []horizon.Finding
+	for _, f := range report.Findings {
+		if f.Kind == horizon.KindIdleInTransaction && f.Terminate != "" {
+			targets = append(targets, f)
+		}
+	}
+	if len(targets) == 0 {
+		fmt.Println("\n🔌 No session idle in a transaction to terminate")
+		return
+	}
+
+	if !sessionsYes {
+		fmt.Printf("\n🔌 Would terminate %d sessions (dry run, add --yes to run):\n", len(targets))
+		for _, f := range targets {
+			fmt.Printf("   %s\n", f.Terminate)
+		}
+		return
+	}
+
+	fmt.Printf("\n🔌 Terminating %d sessions idle in a transaction:\n", len(targets))
+	for _, f := range targets {
+		var terminated bool
+		err := database.QueryRow(f.Terminate).Scan(&terminated)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			fmt.Printf("   • pid %d: skipped, no longer idle in the same transaction\n", f.PID)
+		case err != nil:
+			logger.LogErrorf("Failed to terminate pid %d: %v", f.PID, err)
+			fmt.Printf("   ❌ pid %d: %v\n", f.PID, err)
+		case !terminated:
+			fmt.Printf("   ❌ pid %d: the server did not signal it\n", f.PID)
+		default:
+			logger.LogInfof("Terminated pid %d (%s), idle in a transaction for %s", f.PID, f.User, f.Duration.Round(time.Second))
+			fmt.Printf("   ✅ pid %d (%s) terminated\n", f.PID, f.User)
+		}
+	}
+}
+
+func timeoutOrOff(d time.Duration) string {
+	if d == 0 {
+		return "off"
+	}
+	return d.String()
+}
+
+func elapsedSince(now time.Time, t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return now.Sub(*t).Round(time.Second).String()
+}
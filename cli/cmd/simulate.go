@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"cli/internal/config"
+	"cli/internal/db"
+	"cli/internal/format"
+	"cli/internal/ingest"
+	"cli/internal/logger"
+	"cli/internal/parse"
+	"cli/internal/simulate"
+	"cli/internal/store"
+)
+
+var (
+	simulateDDL     string
+	simulateQuery   string
+	simulateTimeout time.Duration
+)
+
+var simulateCmd = &cobra.Command{
+	Use:   "simulate [fingerprint]",
+	Short: "Simulate index recommendations with hypothetical indexes (hypopg)",
+	Long: `Estimate the effect of an index without building it.
+
+The query is explained, the index is created as a hypopg hypothetical index,
+and the query is explained again. Hypothetical indexes are always reset
+afterwards; nothing is written to the database.
+
+With a fingerprint (or the 12-character prefix shown by 'bottlenecks'), every
+index recommendation for that query is simulated unless --ddl is given.
+Requires the hypopg extension and runs as profiler_sb.
+
+Examples:
+  optidb simulate 3f2a9c1b7d4e
+  optidb simulate 3f2a9c1b7d4e --ddl "CREATE INDEX ON orders (user_id)"
+  optidb simulate --query "SELECT * FROM orders WHERE user_id = 42" --ddl "CREATE INDEX ON orders (user_id)"`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		fingerprint := ""
+		if len(args) == 1 {
+			fingerprint = args[0]
+		}
+		runSimulate(fingerprint)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(simulateCmd)
+
+	simulateCmd.Flags().StringVar(&simulateDDL, "ddl", "", "CREATE INDEX statement to simulate")
+	simulateCmd.Flags().StringVar(&simulateQuery, "query", "", "Query to simulate against instead of a fingerprint")
+	simulateCmd.Flags().DurationVar(&simulateTimeout, "timeout", 5*time.Second, "statement_timeout applied to each EXPLAIN")
+}
+
+func runSimulate(fingerprint string) {
+	if fingerprint == "" && simulateQuery == "" {
+		log.Fatalf("Provide a query fingerprint or --query")
+	}
+	if simulateQuery != "" && simulateDDL == "" {
+		log.Fatalf("--query requires --ddl")
+	}
+
+	if config.Get().Database.Engine == config.EngineMySQL {
+		log.Fatalf("Simulation needs PostgreSQL with hypopg; it is not available for MySQL")
+	}
+
+	fmt.Println("🧪 Simulating hypothetical indexes...")
+
+	sandbox, err := db.ConnectAsSandbox()
+	if err != nil {
+		logger.LogErrorf("Failed to connect as sandbox role: %v", err)
+		log.Fatalf("Failed to connect as sandbox role: %v", err)
+	}
+	defer sandbox.Close()
+
+	simulator := simulate.NewSimulator(sandbox, simulateTimeout)
+	if err := simulator.Available(); err != nil {
+		log.Fatalf("Cannot simulate: %v", err)
+	}
+
+	query := simulateQuery
+	var recommendations []store.Recommendation
+	if simulateDDL != "" {
+		recommendations = []store.Recommendation{{Type: "manual", DDL: simulateDDL, RiskLevel: "low"}}
+	}
+
+	if fingerprint != "" {
+		stats, recs := findQueryRecommendations(fingerprint)
+		query = stats.Query
+		if simulateDDL == "" {
+			recommendations = recs
+		}
+	}
+
+	if len(recommendations) == 0 {
+		fmt.Println("✅ No index recommendations to simulate for this query")
+		return
+	}
+
+	fmt.Printf("   • SQL: %s\n", format.Truncate(query, 200))
+
+	for i, rec := range recommendations {
+		fmt.Printf("\n%d. %s\n", i+1, rec.DDL)
+
+		result, err := simulator.Simulate(query, rec)
+		if err != nil {
+			logger.LogErrorf("Simulation failed: %v", err)
+			fmt.Printf("   ❌ Simulation failed: %v\n", err)
+			continue
+		}
+
+		printSimulationResult(result)
+	}
+}
+
+// findQueryRecommendations looks the fingerprint up in pg_stat_statements and
+// returns the query with its CREATE INDEX recommendations.
+func findQueryRecommendations(fingerprint string) (store.QueryStats, []store.Recommendation) {
+	database, err := db.ConnectAsProfiler()
+	if err != nil {
+		logger.LogErrorf("Failed to connect to database: %v", err)
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	collector := ingest.NewCollector(database)
+	parser := parse.NewQueryParser()
+
+	queryStats, err := collector.GetSlowQueries(0.0)
+	if err != nil {
+		logger.LogErrorf("Failed to collect query stats: %v", err)
+		log.Fatalf("Failed to collect query stats: %v", err)
+	}
+
+	var target *store.QueryStats
+	for i := range queryStats {
+		if strings.HasPrefix(parser.GenerateFingerprint(queryStats[i].Query), fingerprint) {
+			target = &queryStats[i]
+			break
+		}
+	}
+	if target == nil {
+		log.Fatalf("No query found with fingerprint %s", fingerprint)
+	}
+
+	tables, err := collector.GetTableInfo()
+	if err != nil {
+		log.Fatalf("Failed to collect table info: %v", err)
+	}
+	indexes, err := collector.GetIndexInfo()
+	if err != nil {
+		log.Fatalf("Failed to collect index info: %v", err)
+	}
+
+	ruleEngine := newRuleEngine()
+	inputs := loadRuleInputs(collector, ruleEngine, indexes)
+
+	var indexRecs []store.Recommendation
+	for _, rec := range ruleEngine.AnalyzeQuery(*target, tables, indexes, inputs) {
+		if simulate.Supports(rec) {
+			indexRecs = append(indexRecs, rec)
+		}
+	}
+	return *target, indexRecs
+}
+
+func printSimulationResult(result *simulate.Result) {
+	icon := "📉"
+	if result.ImprovementPct <= 0 {
+		icon = "➖"
+	}
+
+	fmt.Printf("   %s Cost: %.2f → %.2f (%.1f%% improvement)\n", icon, result.BeforeCost, result.AfterCost, result.ImprovementPct)
+	fmt.Printf("   • Hypothetical index: %s (~%s)\n", result.IndexName, format.Bytes(result.IndexSizeBytes))
+	for _, change := range result.PlanChanges {
+		fmt.Printf("   • Plan change: %s\n", change)
+	}
+	for _, note := range result.Notes {
+		fmt.Printf("   ⚠️  %s\n", note)
+	}
+	fmt.Printf("   • Simulated in %.0f ms\n", result.DurationMS)
+}
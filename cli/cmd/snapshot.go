@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"cli/internal/config"
+	"cli/internal/db"
+	"cli/internal/ingest"
+	"cli/internal/logger"
+	"cli/internal/parse"
+)
+
+var (
+	fromSnapshot   string
+	snapshotOutput string
+)
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Export statistics for offline analysis",
+}
+
+var snapshotExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Dump statement statistics, schema metadata and plans to a file",
+	Long: `Capture everything scan, bottlenecks and serve read from the database, so it
+can be analyzed elsewhere with --from-snapshot and no database connection.
+
+The export holds pg_stat_statements (or performance_schema digests), table
+and index metadata, and EXPLAIN plans for the slowest statements. Names
+ending in .tar.gz or .tgz write a tarball with one file per section and one
+per plan; anything else writes a single JSON document. With --window, a
+baseline is taken first so the window can be analyzed offline with --window
+as well.
+
+Examples:
+  optidb snapshot export
+  optidb snapshot export -o prod.json --window 5m --explain-top 20
+  optidb scan --from-snapshot optidb-snapshot-20250102-101112.tar.gz`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runSnapshotExport()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(snapshotCmd)
+	snapshotCmd.AddCommand(snapshotExportCmd)
+
+	snapshotExportCmd.Flags().StringVarP(&snapshotOutput, "output", "o", "", "Export file (default optidb-snapshot-<time>.tar.gz)")
+	snapshotExportCmd.Flags().DurationVar(&window, "window", 0, "Also record a baseline this long before the export (e.g. 5m)")
+	addExplainFlags(snapshotExportCmd)
+}
+
+// addSnapshotFlag registers --from-snapshot on the analysis commands.
+func addSnapshotFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&fromSnapshot, "from-snapshot", "", "Analyze an export from 'optidb snapshot export' instead of a live database")
+}
+
+// openCollector reads --from-snapshot when it is set and otherwise connects
+// as the profiler role. The database is nil when working offline.
+func openCollector() (ingest.Collector, *sql.DB) {
+	if fromSnapshot != "" {
+		return loadSnapshot(), nil
+	}
+
+	database, err := db.ConnectAsProfiler()
+	if err != nil {
+		logger.LogErrorf("Failed to connect to database: %v", err)
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	return ingest.NewCollector(database), database
+}
+
+// loadSnapshot reads --from-snapshot and switches to the engine it was
+// exported from.
+func loadSnapshot() *ingest.FileCollector {
+	export, err := ingest.ReadExportFile(fromSnapshot)
+	if err != nil {
+		log.Fatalf("Failed to load snapshot: %v", err)
+	}
+	useEngine(export.Engine)
+	fmt.Printf("📦 Offline: %s, exported %s\n", export.Source, export.ExportedAt.Local().Format("2006-01-02 15:04:05"))
+	return ingest.NewFileCollector(export)
+}
+
+// useEngine points the rule engine and advisor at the dialect of data that
+// did not come from the configured target.
+func useEngine(engine string) {
+	if engine == "" || engine == config.Get().Database.Engine {
+		return
+	}
+	cfg := *config.Get()
+	cfg.Database.Engine = engine
+	config.Set(&cfg)
+}
+
+func runSnapshotExport() {
+	logger.LogInfo("Starting snapshot export")
+	fmt.Println("📦 Exporting statistics for offline analysis...")
+
+	database, err := db.ConnectAsProfiler()
+	if err != nil {
+		logger.LogErrorf("Failed to connect to database: %v", err)
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	collector := ingest.NewCollector(database)
+	export := &ingest.Export{
+		FormatVersion: ingest.ExportFormatVersion,
+		Engine:        collector.Engine(),
+		Source:        db.NewConfig().String(),
+	}
+
+	if window > 0 {
+		baseline, err := collector.TakeSnapshot()
+		if err != nil {
+			logger.LogErrorf("Failed to take baseline snapshot: %v", err)
+			log.Fatalf("Failed to take baseline snapshot: %v", err)
+		}
+		exported := ingest.NewExportedSnapshot(baseline)
+		export.Baseline = &exported
+		fmt.Printf("⏱️  Recorded baseline, waiting %s...\n", window)
+		time.Sleep(window)
+	}
+
+	snapshot, err := collector.TakeSnapshot()
+	if err != nil {
+		logger.LogErrorf("Failed to snapshot statement statistics: %v", err)
+		log.Fatalf("Failed to snapshot statement statistics: %v", err)
+	}
+	export.Statements = ingest.NewExportedSnapshot(snapshot)
+
+	export.Tables, err = collector.GetTableInfo()
+	if err != nil {
+		logger.LogErrorf("Failed to collect table info: %v", err)
+		log.Fatalf("Failed to collect table info: %v", err)
+	}
+	export.Indexes, err = collector.GetIndexInfo()
+	if err != nil {
+		logger.LogErrorf("Failed to collect index info: %v", err)
+		log.Fatalf("Failed to collect index info: %v", err)
+	}
+	export.ForeignKeys, err = collector.GetForeignKeys()
+	if err != nil {
+		logger.LogErrorf("Failed to collect foreign keys: %v", err)
+		log.Fatalf("Failed to collect foreign keys: %v", err)
+	}
+	// pg_stats hides columns the profiler cannot SELECT, so this is best effort
+	export.ColumnStats, err = collector.GetColumnStats(nil)
+	if err != nil {
+		logger.LogErrorf("Failed to collect column statistics: %v", err)
+		fmt.Printf("⚠️  Column statistics not exported: %v\n", err)
+	}
+	export.Bloat, err = collector.GetBloat(false)
+	if err != nil {
+		logger.LogErrorf("Failed to estimate bloat: %v", err)
+		fmt.Printf("⚠️  Bloat estimates not exported: %v\n", err)
+	}
+	if collector.Engine() != config.EngineMySQL {
+		export.Vacuum, err = collector.GetVacuumHealth()
+		if err != nil {
+			logger.LogErrorf("Failed to collect vacuum state: %v", err)
+			fmt.Printf("⚠️  Vacuum state not exported: %v\n", err)
+		}
+		export.Memory, err = collector.GetMemorySettings()
+		if err != nil {
+			logger.LogErrorf("Failed to collect memory settings: %v", err)
+			fmt.Printf("⚠️  Memory settings not exported: %v\n", err)
+		}
+		export.Cache, err = collector.GetCacheStats()
+		if err != nil {
+			logger.LogErrorf("Failed to collect buffer cache statistics: %v", err)
+			fmt.Printf("⚠️  Buffer cache statistics not exported: %v\n", err)
+		}
+	}
+
+	// Plans for the statements scan and bottlenecks would explain
+	planner := newPlanner(database, collector)
+	if planner != nil && explainTop > 0 {
+		slow, err := collector.GetSlowQueries(0)
+		if err != nil {
+			logger.LogErrorf("Failed to rank statements for plans: %v", err)
+			log.Fatalf("Failed to rank statements for plans: %v", err)
+		}
+
+		parser := parse.NewQueryParser()
+		export.Plans = map[string]json.RawMessage{}
+		for i, query := range slow {
+			if plan := capturePlan(planner, i, query.Query); plan != nil {
+				export.Plans[parser.GenerateFingerprint(query.Query)] = json.RawMessage(plan.Raw)
+			}
+		}
+	}
+
+	export.ExportedAt = time.Now().UTC()
+	output := snapshotOutput
+	if output == "" {
+		output = fmt.Sprintf("optidb-snapshot-%s.tar.gz", export.ExportedAt.Local().Format("20060102-150405"))
+	}
+	if err := ingest.WriteExportFile(output, export); err != nil {
+		logger.LogErrorf("Failed to write export: %v", err)
+		log.Fatalf("Failed to write export: %v", err)
+	}
+	fmt.Printf("✅ Wrote %s (format %d)\n", output, export.FormatVersion)
+	fmt.Printf("   • %d statements, %d tables, %d indexes, %d foreign keys, %d column statistics, %d plans\n",
+		len(export.Statements.Statements), len(export.Tables), len(export.Indexes), len(export.ForeignKeys), len(export.ColumnStats), len(export.Plans))
+	if export.Baseline != nil {
+		fmt.Printf("   • Window: %s\n", export.Statements.CapturedAt.Sub(export.Baseline.CapturedAt).Round(time.Second))
+	}
+	fmt.Printf("💡 Analyze it anywhere with: optidb scan --from-snapshot %s\n", output)
+}
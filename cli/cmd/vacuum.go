@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"cli/internal/config"
+	"cli/internal/logger"
+	"cli/internal/store"
+	"cli/internal/vacuum"
+)
+
+var (
+	vacuumTop             int
+	vacuumWraparoundRatio float64
+)
+
+var vacuumCmd = &cobra.Command{
+	Use:   "vacuum",
+	Short: "Check autovacuum health and transaction ID wraparound",
+	Long: `Report how close each database is to transaction ID wraparound and how
+well autovacuum keeps up with each table.
+
+The report shows:
+  • the transaction and multixact ID age of every database
+  • the tables with the most dead rows and when they were last vacuumed
+  • the vacuums running now and how far they have got
+
+Alerts are raised when a database or table has used more than --wraparound
+of the ID space, and per-table ALTER TABLE ... SET (autovacuum_...) settings
+are recommended for large tables that collect too many dead rows between
+vacuums. PostgreSQL only.
+
+Examples:
+  optidb vacuum
+  optidb vacuum --top 20 --wraparound 0.3`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runVacuum()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(vacuumCmd)
+
+	vacuumCmd.Flags().IntVar(&vacuumTop, "top", 10, "Number of tables to list by dead rows")
+	vacuumCmd.Flags().Float64Var(&vacuumWraparoundRatio, "wraparound", vacuum.DefaultOptions().WraparoundRatio, "Share of the ID space in use that raises a wraparound alert")
+	addSnapshotFlag(vacuumCmd)
+}
+
+func runVacuum() {
+	logger.LogInfo("Starting vacuum health analysis")
+	fmt.Println("🧽 Checking vacuum health...")
+
+	collector, database := openCollector()
+	if database != nil {
+		defer database.Close()
+	}
+	if collector.Engine() == config.EngineMySQL {
+		log.Fatalf("Vacuum monitoring needs PostgreSQL; InnoDB purges old row versions itself")
+	}
+
+	health, err := collector.GetVacuumHealth()
+	if err != nil {
+		logger.LogErrorf("Failed to collect vacuum state: %v", err)
+		log.Fatalf("Failed to collect vacuum state: %v", err)
+	}
+
+	opts := vacuum.DefaultOptions()
+	opts.WraparoundRatio = vacuumWraparoundRatio
+	printVacuumReport(vacuum.Analyze(health, opts))
+}
+
+func printVacuumReport(report *vacuum.Report) {
+	health := report.Health
+	fmt.Printf("   • Autovacuum %s, scale factor %g, threshold %d, freeze max age %d, %d workers\n",
+		onOff(health.Settings.Autovacuum), health.Settings.ScaleFactor, health.Settings.Threshold,
+		health.Settings.FreezeMaxAge, health.Settings.MaxWorkers)
+
+	fmt.Printf("\n🧊 Transaction ID age (%.1f%% of the ID space used at most):\n", report.WraparoundRatio*100)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DATABASE\tXID AGE\tMXID AGE")
+	fmt.Fprintln(w, "--------\t-------\t--------")
+	for _, d := range health.Databases {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", d.Name, d.XIDAge, d.MXIDAge)
+	}
+	w.Flush()
+
+	tables := append([]store.TableVacuum(nil), health.Tables...)
+	sort.SliceStable(tables, func(i, j int) bool { return tables[i].DeadTuples > tables[j].DeadTuples })
+	if len(tables) > vacuumTop {
+		tables = tables[:vacuumTop]
+	}
+	if len(tables) > 0 {
+		fmt.Printf("\n🗑️  Tables by dead rows:\n")
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TABLE\tLIVE\tDEAD\tDEAD %\tXID AGE\tLAST AUTOVACUUM\tAUTOVACUUMS")
+		fmt.Fprintln(w, "-----\t----\t----\t------\t-------\t---------------\t-----------")
+		for _, t := range tables {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%.1f%%\t%d\t%s\t%d\n",
+				t.TableName, t.LiveTuples, t.DeadTuples, t.DeadRatio()*100, t.XIDAge, formatTime(t.LastAutovacuum), t.AutovacuumCount)
+		}
+		w.Flush()
+	}
+
+	if len(health.Running) > 0 {
+		fmt.Printf("\n⏳ Vacuums running:\n")
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PID\tDATABASE\tTABLE\tPHASE\tSCANNED\tINDEX PASSES\tRUNNING FOR\tKIND")
+		fmt.Fprintln(w, "---\t--------\t-----\t-----\t-------\t------------\t-----------\t----")
+		for _, p := range health.Running {
+			scanned := "-"
+			if p.HeapBlksTotal > 0 {
+				scanned = fmt.Sprintf("%.0f%%", float64(p.HeapBlksScanned)/float64(p.HeapBlksTotal)*100)
+			}
+			elapsed := "-"
+			if p.Started != nil {
+				elapsed = health.CapturedAt.Sub(*p.Started).Round(time.Second).String()
+			}
+			kind := "manual"
+			if p.Wraparound {
+				kind = "wraparound"
+			} else if p.Autovacuum {
+				kind = "autovacuum"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+				p.PID, p.Database, p.TableName, p.Phase, scanned, p.IndexVacuumCount, elapsed, kind)
+		}
+		w.Flush()
+	}
+
+	if len(report.Findings) == 0 {
+		fmt.Println("\n✅ Autovacuum is keeping up")
+		return
+	}
+
+	fmt.Printf("\n🚨 Findings (%d):\n", len(report.Findings))
+	for _, f := range report.Findings {
+		subject := f.Table
+		if subject == "" {
+			subject = f.Database
+		}
+		if subject == "" {
+			subject = "server"
+		}
+		fmt.Printf("\n   [%s] %s: %s\n", f.RiskLevel, f.Kind, subject)
+		fmt.Printf("   %s\n", f.Rationale)
+		fmt.Printf("   %s\n", f.DDL)
+	}
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
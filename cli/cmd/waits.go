@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"cli/internal/ash"
+	"cli/internal/format"
+	"cli/internal/ingest"
+	"cli/internal/logger"
+)
+
+var (
+	waitsDuration time.Duration
+	waitsInterval time.Duration
+	waitsTop      int
+)
+
+var waitsCmd = &cobra.Command{
+	Use:     "waits",
+	Aliases: []string{"ash"},
+	Short:   "Sample active sessions to see what queries wait on",
+	Long: `Build an active session history: poll pg_stat_activity every --interval
+and record what each active session is doing, its wait event or CPU.
+
+pg_stat_statements says how long a statement took; the samples say where
+the time went. The report shows:
+  • database time by wait event, e.g. IO:DataFileRead, Lock:transactionid
+  • a timeline of average active sessions and what they waited on
+  • per statement, the share of its time in each event, with advice for
+    the dominant one
+
+A short interval catches short statements but costs a query per sample;
+100ms to 1s suits most servers. 'optidb serve' samples continuously and
+adds the same evidence to its recommendations.
+
+Examples:
+  optidb waits
+  optidb waits --duration 5m --interval 200ms
+  optidb ash --top 5`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runWaits()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(waitsCmd)
+
+	waitsCmd.Flags().DurationVar(&waitsDuration, "duration", time.Minute, "How long to sample for")
+	waitsCmd.Flags().DurationVar(&waitsInterval, "interval", 500*time.Millisecond, "Time between samples")
+	waitsCmd.Flags().IntVar(&waitsTop, "top", 10, "Number of statements to show")
+}
+
+func runWaits() {
+	if waitsInterval <= 0 {
+		log.Fatalf("--interval must be positive")
+	}
+
+	logger.LogInfo("Starting active session sampling")
+	fmt.Printf("📈 Sampling active sessions every %s for %s...\n", waitsInterval, waitsDuration)
+
+	collector, database := openCollector()
+	if database != nil {
+		defer database.Close()
+	}
+
+	samples, err := ingest.SampleActivityFor(collector.SampleWaits, waitsDuration, waitsInterval)
+	if err != nil {
+		logger.LogErrorf("Failed to sample activity: %v", err)
+		log.Fatalf("Failed to sample activity: %v", err)
+	}
+
+	opts := ash.DefaultOptions()
+	opts.Interval = waitsInterval
+	printWaitsReport(ash.Analyze(samples, opts))
+}
+
+func printWaitsReport(report *ash.Report) {
+	fmt.Printf("   • %d samples over %s: %s of database time, %.2f active sessions on average\n",
+		report.Samples, report.Window.Round(time.Second), report.DBTime.Round(100*time.Millisecond), report.ActiveSessions())
+
+	if len(report.Events) == 0 {
+		fmt.Println("\n✅ No session was active while sampling")
+		return
+	}
+
+	fmt.Printf("\n⏳ Database time by event:\n")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "EVENT\tTIME\tSHARE\tAVG SESSIONS")
+	fmt.Fprintln(w, "-----\t----\t-----\t------------")
+	for _, e := range report.Events {
+		fmt.Fprintf(w, "%s\t%s\t%.1f%%\t%.2f\n", e.Event, e.Time.Round(100*time.Millisecond), e.Share*100, e.Time.Seconds()/report.Window.Seconds())
+	}
+	w.Flush()
+
+	fmt.Printf("\n📊 Active sessions every %s:\n", report.Bucket)
+	peak := 0.0
+	for _, b := range report.Timeline {
+		peak = math.Max(peak, b.ActiveSessions)
+	}
+	for _, b := range report.Timeline {
+		bar := ""
+		if peak > 0 {
+			bar = strings.Repeat("█", int(math.Round(b.ActiveSessions/peak*30)))
+		}
+		fmt.Printf("   %s  %5.2f %-30s %s\n", b.Start.Local().Format("15:04:05"), b.ActiveSessions, bar, topEvents(b.Events))
+	}
+
+	statements := report.Statements
+	if len(statements) > waitsTop {
+		statements = statements[:waitsTop]
+	}
+	if len(statements) == 0 {
+		return
+	}
+	fmt.Printf("\n🔎 Statements by database time:\n")
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "QUERY\tDB TIME\tSAMPLES\tWHERE THE TIME GOES")
+	fmt.Fprintln(w, "-----\t-------\t-------\t-------------------")
+	for _, p := range statements {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", format.Truncate(p.Query, 50), p.DBTime.Round(100*time.Millisecond), p.Samples, p.Describe())
+	}
+	w.Flush()
+
+	fmt.Printf("\n💡 Advice:\n")
+	advised := false
+	for _, p := range statements {
+		dominant := p.Dominant()
+		advice := ash.Advice(dominant.Event)
+		if p.Samples < report.MinSamples || advice == "" {
+			continue
+		}
+		advised = true
+		fmt.Printf("\n   %s\n", format.Truncate(p.Query, 100))
+		fmt.Printf("   Spends %s. %s\n", p.Describe(), advice)
+	}
+	if !advised {
+		fmt.Println("   No statement was sampled often enough to judge")
+	}
+}
+
+// topEvents lists the busiest events of a timeline point
+func topEvents(events map[string]float64) string {
+	names := make([]string, 0, len(events))
+	for name := range events {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if events[names[i]] != events[names[j]] {
+			return events[names[i]] > events[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	var parts []string
+	for i, name := range names {
+		if i == 3 {
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%s %.2f", name, events[name]))
+	}
+	return strings.Join(parts, ", ")
+}
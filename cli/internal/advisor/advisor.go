@@ -0,0 +1,652 @@
+package advisor
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cli/internal/config"
+	"cli/internal/format"
+	"cli/internal/logger"
+	"cli/internal/parse"
+	"cli/internal/store"
+)
+
+// Index kinds
+const (
+	KindSingle    = "single"
+	KindComposite = "composite"
+	KindCovering  = "covering"
+)
+
+// maxIncludeColumns bounds INCLUDE lists, since wide covering indexes cost
+// more to maintain than the heap fetches they save.
+const maxIncludeColumns = 3
+
+// Options tune the advisor. StorageBudgetBytes <= 0 means no budget.
+type Options struct {
+	StorageBudgetBytes int64
+	MaxIndexes         int
+	MaxKeyColumns      int
+	MinTableRows       int64
+	WriteCostMS        float64 // cost of maintaining one index entry for one written row
+	Engine             string  // DDL dialect; empty means PostgreSQL
+}
+
+func DefaultOptions() Options {
+	return Options{
+		MaxIndexes:    10,
+		MaxKeyColumns: 3,
+		MinTableRows:  1000,
+		WriteCostMS:   0.005,
+	}
+}
+
+// Proposal is one index in the plan, scored against the whole workload.
+// SavedMS is the estimated execution time saved across every statement it
+// serves; WriteCostMS is the estimated cost of maintaining it for the rows
+// the workload wrote to the table.
+type Proposal struct {
+	Rank           int      `json:"rank"`
+	Kind           string   `json:"kind"`
+	Schema         string   `json:"schema,omitempty"`
+	Table          string   `json:"table"`
+	Columns        []string `json:"columns"`
+	Include        []string `json:"include,omitempty"`
+	Name           string   `json:"name"`
+	DDL            string   `json:"ddl"`
+	EstimatedBytes int64    `json:"estimated_bytes"`
+	SavedMS        float64  `json:"saved_ms"`
+	WriteCostMS    float64  `json:"write_cost_ms"`
+	Score          float64  `json:"score"`
+	Queries        []string `json:"queries"` // fingerprints of the statements served
+}
+
+// Plan is the ranked, deduplicated set of indexes for a workload. Indexes
+// that would help but do not fit the storage budget are listed separately.
+type Plan struct {
+	Indexes         []Proposal `json:"indexes"`
+	OverBudget      []Proposal `json:"over_budget,omitempty"`
+	BudgetBytes     int64      `json:"budget_bytes"`
+	UsedBytes       int64      `json:"used_bytes"`
+	WorkloadMS      float64    `json:"workload_ms"`
+	SavedMS         float64    `json:"saved_ms"`
+	QueriesAnalyzed int        `json:"queries_analyzed"`
+	QueriesSkipped  int        `json:"queries_skipped"` // did not parse
+}
+
+type Advisor struct {
+	opts   Options
+	parser *parse.QueryParser
+}
+
+func NewAdvisor(opts Options) *Advisor {
+	if opts.MaxKeyColumns <= 0 {
+		opts.MaxKeyColumns = 1
+	}
+	return &Advisor{opts: opts, parser: parse.NewQueryParser()}
+}
+
+// access is how one statement uses one table
+type access struct {
+	fingerprint string
+	timeMS      float64 // the statement's time attributed to this table
+	equality    []string
+	ranges      []string
+	joins       []string
+	orderBy     []string
+	hasLimit    bool
+	columns     []string
+	selectsAll  bool
+}
+
+// write is a statement modifying a table
+type write struct {
+	rows       int64
+	setColumns []string // UPDATE only; nil means every index is maintained
+}
+
+// indexColumns is an existing or chosen index
+type indexColumns struct {
+	columns []string
+	include []string
+}
+
+type candidate struct {
+	kind    string
+	table   string // schema-qualified
+	columns []string
+	include []string
+}
+
+func (c candidate) key() string {
+	return c.table + "(" + strings.Join(c.columns, ",") + ")" + strings.Join(c.include, ",")
+}
+
+// Advise builds an index plan for the workload. Each statement is parsed;
+// candidates are generated from the predicates, join columns and ORDER BY
+// of every statement, then chosen greedily by score (time saved minus write
+// cost), re-scoring the rest after each choice so that statements already
+// served by an existing or chosen index do not count twice.
+func (a *Advisor) Advise(workload []store.QueryStats, tables []store.TableInfo, indexes []store.IndexInfo) *Plan {
+	logger.LogInfof("Building index plan for %d statements", len(workload))
+
+	plan := &Plan{BudgetBytes: a.opts.StorageBudgetBytes}
+
+	// Tables are keyed by their schema-qualified name, so that tables of the
+	// same name in two schemas do not share accesses or indexes
+	tableInfo := make(map[string]store.TableInfo)
+	for _, t := range tables {
+		tableInfo[format.Qualified(t.SchemaName, t.TableName)] = t
+	}
+	keys := newTableKeys(tables)
+
+	accesses := make(map[string][]access)
+	writes := make(map[string][]write)
+
+	for _, q := range workload {
+		plan.WorkloadMS += q.TotalTime
+
+		shape, err := a.parser.Shape(q.Query)
+		if err != nil {
+			logger.LogDebugf("Skipping statement that does not parse: %v", err)
+			plan.QueriesSkipped++
+			continue
+		}
+		plan.QueriesAnalyzed++
+
+		if key, ok := keys.resolve(shape, shape.Target); ok && shape.StatementType != "SELECT" {
+			w := write{rows: q.Rows}
+			if shape.StatementType == "UPDATE" {
+				w.setColumns = shape.SetColumns
+			}
+			writes[key] = append(writes[key], w)
+		}
+
+		for _, acc := range a.accessesOf(q, shape, keys) {
+			if info, ok := tableInfo[acc.table]; !ok || info.RowCount < a.opts.MinTableRows {
+				continue
+			}
+			accesses[acc.table] = append(accesses[acc.table], acc.access)
+		}
+	}
+
+	existing := make(map[string][]indexColumns)
+	for _, idx := range indexes {
+		cols := make([]string, len(idx.Columns))
+		for i, c := range idx.Columns {
+			cols[i] = strings.ToLower(c)
+		}
+		key := format.Qualified(idx.SchemaName, idx.TableName)
+		existing[key] = append(existing[key], indexColumns{columns: cols})
+	}
+
+	candidates := a.candidates(accesses)
+	logger.LogDebugf("Generated %d index candidates", len(candidates))
+
+	chosen := make(map[string]bool)
+	overBudget := make(map[string]bool)
+	for a.opts.MaxIndexes <= 0 || len(plan.Indexes) < a.opts.MaxIndexes {
+		var best *Proposal
+		var bestKey string
+		for _, c := range candidates {
+			k := c.key()
+			if chosen[k] {
+				continue
+			}
+			p := a.evaluate(c, accesses[c.table], writes[c.table], existing[c.table], tableInfo[c.table])
+			if p.Score <= 0 {
+				continue
+			}
+			if plan.BudgetBytes > 0 && plan.UsedBytes+p.EstimatedBytes > plan.BudgetBytes {
+				overBudget[k] = true
+				continue
+			}
+			if best == nil || p.Score > best.Score {
+				best, bestKey = &p, k
+			}
+		}
+		if best == nil {
+			break
+		}
+
+		chosen[bestKey] = true
+		delete(overBudget, bestKey)
+		existing[bestKey] = append(existing[bestKey], indexColumns{columns: best.Columns, include: best.Include})
+
+		best.Rank = len(plan.Indexes) + 1
+		plan.Indexes = append(plan.Indexes, *best)
+		plan.UsedBytes += best.EstimatedBytes
+		plan.SavedMS += best.SavedMS
+	}
+
+	// Re-score what did not fit against the final plan, so only indexes that
+	// would still add something are reported
+	for _, c := range candidates {
+		if !overBudget[c.key()] {
+			continue
+		}
+		p := a.evaluate(c, accesses[c.table], writes[c.table], existing[c.table], tableInfo[c.table])
+		if p.Score > 0 {
+			plan.OverBudget = append(plan.OverBudget, p)
+		}
+	}
+	sort.Slice(plan.OverBudget, func(i, j int) bool {
+		return plan.OverBudget[i].Score > plan.OverBudget[j].Score
+	})
+
+	logger.LogInfof("Index plan has %d indexes (%d bytes), saving an estimated %.2fms", len(plan.Indexes), plan.UsedBytes, plan.SavedMS)
+	return plan
+}
+
+type tableAccess struct {
+	table string
+	access
+}
+
+// accessesOf splits a statement into per-table accesses. The statement's
+// time is shared evenly between the tables it filters or joins on.
+func (a *Advisor) accessesOf(q store.QueryStats, shape *parse.QueryShape, keys tableKeys) []tableAccess {
+	fingerprint := a.parser.GenerateFingerprint(q.Query)
+
+	var result []tableAccess
+	for _, table := range shape.Tables() {
+		key, ok := keys.resolve(shape, table)
+		if !ok {
+			continue
+		}
+		acc := access{
+			fingerprint: fingerprint,
+			hasLimit:    shape.HasLimit,
+			columns:     shape.ColumnsOf(table),
+			selectsAll:  shape.SelectsAll,
+		}
+
+		for _, p := range shape.PredicatesOn(table) {
+			if p.Function != "" {
+				continue
+			}
+			switch p.Operator {
+			case "=", "IN", "= ANY", "IS NULL":
+				acc.equality = appendUnique(acc.equality, p.Column.Column)
+			case "<", ">", "<=", ">=", "BETWEEN", "LIKE":
+				acc.ranges = appendUnique(acc.ranges, p.Column.Column)
+			}
+		}
+		for _, j := range shape.Joins {
+			if j.Operator != "=" {
+				continue
+			}
+			if j.Left.Table == table {
+				acc.joins = appendUnique(acc.joins, j.Left.Column)
+			}
+			if j.Right.Table == table {
+				acc.joins = appendUnique(acc.joins, j.Right.Column)
+			}
+		}
+		for _, key := range shape.OrderBy {
+			if key.Column.Table != table {
+				acc.orderBy = nil
+				break
+			}
+			acc.orderBy = append(acc.orderBy, key.Column.Column)
+		}
+
+		if len(acc.equality)+len(acc.ranges)+len(acc.joins)+len(acc.orderBy) == 0 {
+			continue
+		}
+		result = append(result, tableAccess{table: key, access: acc})
+	}
+
+	for i := range result {
+		result[i].timeMS = q.TotalTime / float64(len(result))
+	}
+	return result
+}
+
+// tableKeys resolves the table names of statements to the schema-qualified
+// names of known tables.
+type tableKeys struct {
+	known  map[string]bool
+	byName map[string][]string
+}
+
+func newTableKeys(tables []store.TableInfo) tableKeys {
+	keys := tableKeys{known: make(map[string]bool), byName: make(map[string][]string)}
+	for _, t := range tables {
+		key := format.Qualified(t.SchemaName, t.TableName)
+		keys.known[key] = true
+		keys.byName[t.TableName] = append(keys.byName[t.TableName], key)
+	}
+	return keys
+}
+
+// resolve returns the key of a table the statement refers to. A name the
+// statement qualifies is taken as is; an unqualified one is the only known
+// table of that name, or the one in public when several schemas have it.
+func (k tableKeys) resolve(shape *parse.QueryShape, table string) (string, bool) {
+	if table == "" {
+		return "", false
+	}
+	for _, rel := range shape.Relations {
+		if rel.Kind == parse.RelationTable && rel.Name == table && rel.Schema != "" {
+			key := format.Qualified(rel.Schema, table)
+			return key, k.known[key]
+		}
+	}
+
+	candidates := k.byName[table]
+	if len(candidates) == 1 {
+		return candidates[0], true
+	}
+	for _, key := range candidates {
+		if key == format.Qualified("public", table) {
+			return key, true
+		}
+	}
+	if len(candidates) > 1 {
+		logger.LogDebugf("Skipping table %s, which is in several schemas", table)
+	}
+	return "", false
+}
+
+// candidates generates single-column indexes for every searchable column, a
+// composite index of equality columns followed by one range or ORDER BY
+// column, and a covering variant when the statement reads few other columns.
+func (a *Advisor) candidates(accesses map[string][]access) []candidate {
+	seen := make(map[string]bool)
+	var result []candidate
+	add := func(c candidate) {
+		if len(c.columns) == 0 || seen[c.key()] {
+			return
+		}
+		seen[c.key()] = true
+		result = append(result, c)
+	}
+
+	tables := make([]string, 0, len(accesses))
+	for table := range accesses {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	for _, table := range tables {
+		for _, acc := range accesses[table] {
+			for _, col := range acc.equality {
+				add(candidate{kind: KindSingle, table: table, columns: []string{col}})
+			}
+			for _, col := range acc.ranges {
+				add(candidate{kind: KindSingle, table: table, columns: []string{col}})
+			}
+			for _, col := range acc.joins {
+				add(candidate{kind: KindSingle, table: table, columns: []string{col}})
+			}
+
+			key := append([]string{}, acc.equality...)
+			for _, col := range acc.joins {
+				key = appendUnique(key, col)
+			}
+			if len(acc.ranges) > 0 {
+				key = appendUnique(key, acc.ranges[0])
+			} else if acc.hasLimit {
+				for _, col := range acc.orderBy {
+					key = appendUnique(key, col)
+				}
+			}
+			if len(key) > a.opts.MaxKeyColumns {
+				key = key[:a.opts.MaxKeyColumns]
+			}
+			if len(key) >= 2 {
+				add(candidate{kind: KindComposite, table: table, columns: key})
+			}
+
+			if len(key) == 0 || acc.selectsAll {
+				continue
+			}
+			var include []string
+			for _, col := range acc.columns {
+				if !containsString(key, col) {
+					include = append(include, col)
+				}
+			}
+			// MySQL has no INCLUDE; a covering index there is just a wider key
+			if len(include) > 0 && len(include) <= maxIncludeColumns && a.opts.Engine != config.EngineMySQL {
+				sort.Strings(include)
+				add(candidate{kind: KindCovering, table: table, columns: key, include: include})
+			}
+		}
+	}
+	return result
+}
+
+// evaluate scores a candidate given the indexes that already exist (or have
+// been chosen) on its table.
+func (a *Advisor) evaluate(c candidate, accesses []access, writes []write, existing []indexColumns, info store.TableInfo) Proposal {
+	p := Proposal{
+		Kind:           c.kind,
+		Schema:         info.SchemaName,
+		Table:          info.TableName,
+		Columns:        c.columns,
+		Include:        c.include,
+		EstimatedBytes: estimateIndexBytes(info, len(c.columns)+len(c.include)),
+	}
+
+	for _, acc := range accesses {
+		current := 0.0
+		for _, idx := range existing {
+			current = max(current, usefulness(acc, idx.columns, idx.include))
+		}
+		gain := usefulness(acc, c.columns, c.include) - current
+		if gain <= 0 {
+			continue
+		}
+		p.SavedMS += acc.timeMS * gain
+		if !containsString(p.Queries, acc.fingerprint) {
+			p.Queries = append(p.Queries, acc.fingerprint)
+		}
+	}
+
+	indexed := append(append([]string{}, c.columns...), c.include...)
+	for _, w := range writes {
+		if w.setColumns != nil && !overlaps(w.setColumns, indexed) {
+			// HOT updates skip indexes on unchanged columns
+			continue
+		}
+		p.WriteCostMS += float64(w.rows) * a.opts.WriteCostMS
+	}
+
+	p.Score = p.SavedMS - p.WriteCostMS
+	p.Name = indexName(c.kind, info.TableName, c.columns)
+	p.DDL = indexDDL(p, a.opts.Engine)
+	return p
+}
+
+// usefulness estimates the fraction of a statement's time on a table that an
+// index with these columns saves. Equality and join columns extend the
+// usable prefix; the first range column ends it. A matching ORDER BY after
+// the prefix avoids a sort, and covering every referenced column allows an
+// index-only scan.
+func usefulness(acc access, columns, include []string) float64 {
+	matched := 0
+	leadingRange := false
+	rest := columns
+	for i, col := range columns {
+		if containsString(acc.equality, col) || containsString(acc.joins, col) {
+			matched++
+			rest = columns[i+1:]
+			continue
+		}
+		if containsString(acc.ranges, col) {
+			matched++
+			leadingRange = i == 0
+			rest = columns[i+1:]
+		}
+		break
+	}
+
+	score := 0.0
+	if matched > 0 {
+		score = 0.5 + 0.15*float64(matched-1)
+		if leadingRange {
+			score = 0.4
+		}
+	}
+
+	if len(acc.orderBy) > 0 && hasPrefix(rest, acc.orderBy) {
+		if matched == 0 && acc.hasLimit {
+			score = 0.3
+		} else if matched > 0 {
+			score += 0.1
+		}
+	}
+
+	if score > 0 && !acc.selectsAll && len(acc.columns) > 0 {
+		covered := true
+		for _, col := range acc.columns {
+			if !containsString(columns, col) && !containsString(include, col) {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			score += 0.1
+		}
+	}
+
+	return min(score, 0.9)
+}
+
+// estimateIndexBytes assumes a B-tree entry of a 16 byte header plus 8 bytes
+// per column at the default 90% fill factor.
+func estimateIndexBytes(info store.TableInfo, columns int) int64 {
+	rows := info.RowCount
+	if rows <= 0 {
+		return info.SizeBytes / 4
+	}
+	return int64(float64(rows*int64(16+8*columns)) / 0.9)
+}
+
+func indexName(kind, table string, columns []string) string {
+	name := "idx_" + table + "_" + strings.Join(columns, "_")
+	if kind == KindCovering {
+		name += "_cov"
+	}
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	return name
+}
+
+func indexDDL(p Proposal, engine string) string {
+	table := p.Table
+	if p.Schema != "" && p.Schema != "public" {
+		table = p.Schema + "." + p.Table
+	}
+	if engine == config.EngineMySQL {
+		return fmt.Sprintf("CREATE INDEX %s ON %s (%s) ALGORITHM=INPLACE LOCK=NONE;", p.Name, table, strings.Join(p.Columns, ", "))
+	}
+	ddl := fmt.Sprintf("CREATE INDEX CONCURRENTLY %s ON %s (%s)", p.Name, table, strings.Join(p.Columns, ", "))
+	if len(p.Include) > 0 {
+		ddl += fmt.Sprintf(" INCLUDE (%s)", strings.Join(p.Include, ", "))
+	}
+	return ddl + ";"
+}
+
+// Recommendation converts a proposal for code that works with recommendations,
+// such as the simulator and the meta store.
+func (p Proposal) Recommendation(workloadMS float64) store.Recommendation {
+	recType, confidence := "missing_index", 0.8
+	switch p.Kind {
+	case KindComposite:
+		recType, confidence = "composite_index", 0.75
+	case KindCovering:
+		recType, confidence = "covering_index", 0.7
+	}
+
+	risk := "low"
+	if p.WriteCostMS > p.SavedMS*0.25 {
+		risk = "medium"
+	}
+
+	share := 0.0
+	if workloadMS > 0 {
+		share = p.SavedMS / workloadMS * 100
+	}
+
+	return store.Recommendation{
+		Type:           recType,
+		DDL:            p.DDL,
+		Rationale:      fmt.Sprintf("Serves %d statements on table '%s' filtering, joining or sorting by (%s).", len(p.Queries), p.Table, strings.Join(p.Columns, ", ")),
+		Confidence:     confidence,
+		ImpactEstimate: fmt.Sprintf("Saves an estimated %.0f ms (%.1f%% of workload time) for %.0f ms of extra write cost", p.SavedMS, share, p.WriteCostMS),
+		RiskLevel:      risk,
+	}
+}
+
+// ParseSize reads a storage size such as "500MB" or "2GB". Units are
+// powers of 1024; a bare number is bytes. Anything else after the number,
+// such as "500M" or "10MiB", is an error.
+func ParseSize(value string) (int64, error) {
+	input := value
+	value = strings.ToUpper(strings.TrimSpace(value))
+	units := []struct {
+		suffix string
+		factor int64
+	}{
+		{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1},
+	}
+
+	factor := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(value, u.suffix) {
+			factor = u.factor
+			value = strings.TrimSpace(strings.TrimSuffix(value, u.suffix))
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 || math.IsNaN(n) || n*float64(factor) >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size %q, expected a number with an optional B, KB, MB, GB or TB unit", input)
+	}
+	return int64(n * float64(factor)), nil
+}
+
+func hasPrefix(columns, prefix []string) bool {
+	if len(prefix) > len(columns) {
+		return false
+	}
+	for i, col := range prefix {
+		if columns[i] != col {
+			return false
+		}
+	}
+	return true
+}
+
+func overlaps(a, b []string) bool {
+	for _, s := range a {
+		if containsString(b, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func appendUnique(slice []string, item string) []string {
+	if containsString(slice, item) {
+		return slice
+	}
+	return append(slice, item)
+}
+
+func containsString(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package advisor
+
+import (
+	"testing"
+
+	"cli/internal/store"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "0", want: 0},
+		{value: "4096", want: 4096},
+		{value: "512B", want: 512},
+		{value: "64KB", want: 64 << 10},
+		{value: "500MB", want: 500 << 20},
+		{value: "2GB", want: 2 << 30},
+		{value: "1TB", want: 1 << 40},
+		{value: "1.5GB", want: 3 << 29},
+		{value: " 2 gb ", want: 2 << 30},
+		{value: "", wantErr: true},
+		{value: "GB", wantErr: true},
+		{value: "500M", wantErr: true},
+		{value: "10MiB", wantErr: true},
+		{value: "2GB of disk", wantErr: true},
+		{value: "-1GB", wantErr: true},
+		{value: "NaN", wantErr: true},
+		{value: "1e30TB", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseSize(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseSize(%q) = %d, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSize(%q) error = %v", tt.value, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSize(%q) = %d, want %d", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdviseSchemas(t *testing.T) {
+	tables := []store.TableInfo{
+		{SchemaName: "public", TableName: "orders", RowCount: 100_000, SizeBytes: 64 << 20},
+		{SchemaName: "archive", TableName: "orders", RowCount: 100_000, SizeBytes: 64 << 20},
+		{SchemaName: "archive", TableName: "events", RowCount: 100_000, SizeBytes: 64 << 20},
+	}
+	indexes := []store.IndexInfo{
+		{SchemaName: "public", TableName: "orders", IndexName: "orders_customer_idx", Columns: []string{"customer_id"}},
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string // DDL
+	}{
+		{
+			name:  "qualified table without the index",
+			query: "SELECT * FROM archive.orders WHERE customer_id = $1",
+			want:  []string{"CREATE INDEX CONCURRENTLY idx_orders_customer_id ON archive.orders (customer_id);"},
+		},
+		{
+			name:  "unqualified name in several schemas is the public table",
+			query: "SELECT * FROM orders WHERE customer_id = $1",
+		},
+		{
+			name:  "unqualified name in one schema",
+			query: "SELECT * FROM events WHERE kind = $1",
+			want:  []string{"CREATE INDEX CONCURRENTLY idx_events_kind ON archive.events (kind);"},
+		},
+		{
+			name:  "qualified name of an unknown table",
+			query: "SELECT * FROM billing.orders WHERE customer_id = $1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workload := []store.QueryStats{{Query: tt.query, Calls: 100, TotalTime: 1000}}
+			plan := NewAdvisor(DefaultOptions()).Advise(workload, tables, indexes)
+
+			var got []string
+			for _, p := range plan.Indexes {
+				got = append(got, p.DDL)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("index %d = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
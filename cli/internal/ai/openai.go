@@ -6,19 +6,22 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 	"time"
 
+	"cli/internal/config"
 	"cli/internal/logger"
 	"cli/internal/store"
 )
 
 type OpenAIClient struct {
-	apiKey     string
-	endpoint   string
-	apiVersion string
-	deployment string
-	httpClient *http.Client
+	apiKey      string
+	endpoint    string
+	apiVersion  string
+	deployment  string
+	maxTokens   int
+	temperature float64
+	httpClient  *http.Client
+	engine      string // dialect of the DDL asked for
 }
 
 type OpenAIRequest struct {
@@ -63,26 +66,28 @@ type AIRecommendationResponse struct {
 	Analysis        string             `json:"analysis"`
 }
 
-func NewOpenAIClient() (*OpenAIClient, error) {
-	apiKey := os.Getenv("AZURE_OPENAI_API_KEY")
-	endpoint := os.Getenv("AZURE_OPENAI_ENDPOINT")
-	apiVersion := os.Getenv("AZURE_OPENAI_API_VERSION")
-	deployment := os.Getenv("AZURE_OPENAI_CHAT_DEPLOYMENT_NAME")
-
-	if apiKey == "" || endpoint == "" || apiVersion == "" || deployment == "" {
-		return nil, fmt.Errorf("missing Azure OpenAI environment variables")
+func NewOpenAIClient(engine string) (*OpenAIClient, error) {
+	settings := config.Get().AI
+	if !settings.Enabled {
+		return nil, fmt.Errorf("AI recommendations are disabled in the config")
+	}
+	if !settings.Configured() {
+		return nil, fmt.Errorf("missing Azure OpenAI settings (ai.* in the config or AZURE_OPENAI_* environment variables)")
 	}
 
-	logger.LogInfof("Initializing Azure OpenAI client with endpoint: %s, deployment: %s", endpoint, deployment)
+	logger.LogInfof("Initializing Azure OpenAI client with endpoint: %s, deployment: %s", settings.Endpoint, settings.Deployment)
 
 	return &OpenAIClient{
-		apiKey:     apiKey,
-		endpoint:   endpoint,
-		apiVersion: apiVersion,
-		deployment: deployment,
+		apiKey:      settings.APIKey,
+		endpoint:    settings.Endpoint,
+		apiVersion:  settings.APIVersion,
+		deployment:  settings.Deployment,
+		maxTokens:   settings.MaxTokens,
+		temperature: settings.Temperature,
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout: settings.Timeout,
 		},
+		engine: engine,
 	}, nil
 }
 
@@ -107,21 +112,34 @@ func (c *OpenAIClient) GenerateRecommendations(query store.QueryStats, tables []
 	return recommendations, nil
 }
 
+// engineName names the target engine in prompts, so DDL comes back in the
+// right dialect
+func (c *OpenAIClient) engineName() string {
+	if c.engine == config.EngineMySQL {
+		return "MySQL"
+	}
+	return "PostgreSQL"
+}
+
 func (c *OpenAIClient) buildRecommendationPrompt(query store.QueryStats, tables []store.TableInfo, indexes []store.IndexInfo) string {
 	// Convert data to JSON for structured input
 	tablesJSON, _ := json.MarshalIndent(tables, "", "  ")
 	indexesJSON, _ := json.MarshalIndent(indexes, "", "  ")
 
-	prompt := fmt.Sprintf(`You are an expert PostgreSQL performance analyst. Analyze the following slow query and database metadata to provide actionable optimization recommendations.
+	prompt := fmt.Sprintf(`You are an expert %s performance analyst. Analyze the following slow query and database metadata to provide actionable optimization recommendations.
 
 QUERY PERFORMANCE DATA:
 - SQL: %s
 - Calls: %d
 - Mean Execution Time: %.2f ms
 - Total Time: %.2f ms
+- Min / Max / Stddev Execution Time: %.2f / %.2f / %.2f ms
+- Mean Planning Time: %.2f ms
 - Rows Returned: %d
 - Shared Blocks Hit: %d
 - Shared Blocks Read: %d
+- Temp Blocks Read / Written: %d / %d
+- Block Read / Write Time: %.2f / %.2f ms
 
 DATABASE TABLES:
 %s
@@ -163,7 +181,10 @@ RESPONSE FORMAT (JSON only, no markdown):
 }
 
 Provide only valid JSON response. Focus on actionable, high-impact recommendations based on the actual query patterns and database structure.`,
-		query.Query, query.Calls, query.MeanExecTime, query.TotalTime, query.Rows, query.SharedBlksHit, query.SharedBlksRead,
+		c.engineName(), query.Query, query.Calls, query.MeanExecTime, query.TotalTime,
+		query.MinExecTime, query.MaxExecTime, query.StddevExecTime, query.MeanPlanTime,
+		query.Rows, query.SharedBlksHit, query.SharedBlksRead,
+		query.TempBlksRead, query.TempBlksWritten, query.BlkReadTime, query.BlkWriteTime,
 		string(tablesJSON), string(indexesJSON))
 
 	return prompt
@@ -177,15 +198,15 @@ func (c *OpenAIClient) callOpenAI(prompt string) (string, error) {
 		Messages: []Message{
 			{
 				Role:    "system",
-				Content: "You are an expert PostgreSQL performance analyst. Respond only with valid JSON.",
+				Content: fmt.Sprintf("You are an expert %s performance analyst. Respond only with valid JSON.", c.engineName()),
 			},
 			{
 				Role:    "user",
 				Content: prompt,
 			},
 		},
-		MaxTokens:   2000,
-		Temperature: 0.1, // Low temperature for consistent, factual responses
+		MaxTokens:   c.maxTokens,
+		Temperature: c.temperature, // Low by default for consistent, factual responses
 	}
 
 	jsonData, err := json.Marshal(reqBody)
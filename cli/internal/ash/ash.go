@@ -0,0 +1,304 @@
+package ash
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cli/internal/logger"
+	"cli/internal/parse"
+	"cli/internal/store"
+)
+
+// CPU is the event of an active session that waits for nothing: it is
+// running, or runnable and waiting for a core.
+const CPU = "CPU"
+
+// Options tune the analysis.
+type Options struct {
+	// Interval is how far apart the samples were taken; each active
+	// session seen stands for one interval of database time
+	Interval time.Duration
+	// Bucket is the width of one timeline point; zero picks a width that
+	// gives about 30 points
+	Bucket time.Duration
+	// MinSamples is how often a statement must have been seen before its
+	// wait profile is used as evidence
+	MinSamples int
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Interval:   time.Second,
+		MinSamples: 10,
+	}
+}
+
+// EventTime is the database time spent in one wait event, or on CPU.
+type EventTime struct {
+	Event   string        `json:"event"` // wait_event_type:wait_event, or CPU
+	Samples int           `json:"samples"`
+	Time    time.Duration `json:"time_ns"`
+	Share   float64       `json:"share"`
+}
+
+// Bucket is one point of the timeline: the average number of active
+// sessions, in total and per event.
+type Bucket struct {
+	Start          time.Time          `json:"start"`
+	ActiveSessions float64            `json:"active_sessions"`
+	Events         map[string]float64 `json:"events"`
+}
+
+// StatementProfile is where one statement spent its active time.
+type StatementProfile struct {
+	Fingerprint string        `json:"fingerprint"`
+	QueryID     int64         `json:"queryid,omitempty"`
+	Query       string        `json:"query"`
+	Samples     int           `json:"samples"`
+	DBTime      time.Duration `json:"db_time_ns"`
+	Events      []EventTime   `json:"events"`
+}
+
+// Dominant is the event the statement was seen in most
+func (p StatementProfile) Dominant() EventTime {
+	if len(p.Events) == 0 {
+		return EventTime{}
+	}
+	return p.Events[0]
+}
+
+// Describe says where the statement spends its time, e.g. "70% in
+// IO:DataFileRead, 20% on CPU".
+func (p StatementProfile) Describe() string {
+	var parts []string
+	for i, e := range p.Events {
+		if i == 3 || e.Share < 0.05 {
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%.0f%% %s", e.Share*100, eventPhrase(e.Event)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Report is the active session history of a series of samples.
+type Report struct {
+	Samples    int                `json:"samples"`
+	Interval   time.Duration      `json:"interval_ns"`
+	Window     time.Duration      `json:"window_ns"`
+	Bucket     time.Duration      `json:"bucket_ns"`
+	DBTime     time.Duration      `json:"db_time_ns"`
+	Timeline   []Bucket           `json:"timeline"`
+	Events     []EventTime        `json:"events"`
+	Statements []StatementProfile `json:"statements"`
+	// MinSamples is carried from the options for ForStatement
+	MinSamples int `json:"min_samples"`
+}
+
+// ActiveSessions is the average number of sessions working at once
+func (r *Report) ActiveSessions() float64 {
+	if r.Window <= 0 {
+		return 0
+	}
+	return r.DBTime.Seconds() / r.Window.Seconds()
+}
+
+// ForStatement returns the profile of a statement when it was sampled
+// often enough to be evidence. Statements are matched by query ID where
+// the server reports one, else by fingerprint.
+func (r *Report) ForStatement(fingerprint string, queryID int64) *StatementProfile {
+	for i, p := range r.Statements {
+		if (queryID != 0 && p.QueryID == queryID) || p.Fingerprint == fingerprint {
+			if p.Samples < r.MinSamples {
+				return nil
+			}
+			return &r.Statements[i]
+		}
+	}
+	return nil
+}
+
+// Active reports whether a sampled session was doing work. Idle in
+// transaction sessions are not, and background processes waiting in their
+// main loop (wait_event_type Activity) are idle too.
+func Active(s store.Session) bool {
+	if s.State == "" {
+		return s.WaitEventType != "Activity"
+	}
+	return s.State == "active"
+}
+
+// Event names what an active session was doing: its wait event, or CPU.
+// MySQL sessions report their thread state instead of a wait event.
+func Event(s store.Session) string {
+	switch {
+	case s.WaitEventType != "" && s.WaitEvent != "":
+		return s.WaitEventType + ":" + s.WaitEvent
+	case s.WaitEventType != "":
+		return s.WaitEventType
+	case s.WaitEvent != "":
+		return s.WaitEvent
+	}
+	return CPU
+}
+
+// Analyze turns activity samples into database time per event, per
+// statement and over time. Every active session in a sample stands for one
+// interval of database time, so statements shorter than the interval are
+// seen in proportion to how often they run.
+func Analyze(samples []store.ActivitySample, opts Options) *Report {
+	logger.LogInfof("Building active session history from %d samples", len(samples))
+
+	report := &Report{Samples: len(samples), Interval: opts.Interval, MinSamples: opts.MinSamples}
+	if len(samples) == 0 {
+		return report
+	}
+	start := samples[0].CapturedAt
+	report.Window = samples[len(samples)-1].CapturedAt.Sub(start) + opts.Interval
+	report.Bucket = opts.Bucket
+	if report.Bucket <= 0 {
+		report.Bucket = max(opts.Interval, (report.Window / 30).Round(time.Second))
+	}
+
+	parser := parse.NewQueryParser()
+	fingerprints := map[string]string{}
+	events := map[string]int{}
+	statements := map[string]*StatementProfile{}
+	statementEvents := map[string]map[string]int{}
+	buckets := map[int]*Bucket{}
+	bucketSamples := map[int]int{}
+
+	for _, sample := range samples {
+		n := int(sample.CapturedAt.Sub(start) / report.Bucket)
+		b, ok := buckets[n]
+		if !ok {
+			b = &Bucket{Start: start.Add(time.Duration(n) * report.Bucket), Events: map[string]float64{}}
+			buckets[n] = b
+		}
+		bucketSamples[n]++
+
+		for _, s := range sample.Sessions {
+			if !Active(s) {
+				continue
+			}
+			event := Event(s)
+			events[event]++
+			b.ActiveSessions++
+			b.Events[event]++
+
+			if s.Query == "" {
+				continue
+			}
+			fp, ok := fingerprints[s.Query]
+			if !ok {
+				fp = parser.GenerateFingerprint(s.Query)
+				fingerprints[s.Query] = fp
+			}
+			p, ok := statements[fp]
+			if !ok {
+				p = &StatementProfile{Fingerprint: fp, Query: s.Query}
+				statements[fp] = p
+				statementEvents[fp] = map[string]int{}
+			}
+			if p.QueryID == 0 {
+				p.QueryID = s.QueryID
+			}
+			p.Samples++
+			statementEvents[fp][event]++
+		}
+	}
+
+	total := 0
+	for _, n := range events {
+		total += n
+	}
+	report.DBTime = time.Duration(total) * opts.Interval
+	report.Events = eventTimes(events, opts.Interval)
+
+	for fp, p := range statements {
+		p.DBTime = time.Duration(p.Samples) * opts.Interval
+		p.Events = eventTimes(statementEvents[fp], opts.Interval)
+		report.Statements = append(report.Statements, *p)
+	}
+	sort.Slice(report.Statements, func(i, j int) bool {
+		if report.Statements[i].Samples != report.Statements[j].Samples {
+			return report.Statements[i].Samples > report.Statements[j].Samples
+		}
+		return report.Statements[i].Fingerprint < report.Statements[j].Fingerprint
+	})
+
+	for n, b := range buckets {
+		// Average over the samples in the bucket, so a partial last bucket
+		// is not understated
+		taken := float64(bucketSamples[n])
+		b.ActiveSessions /= taken
+		for event := range b.Events {
+			b.Events[event] /= taken
+		}
+		report.Timeline = append(report.Timeline, *b)
+	}
+	sort.Slice(report.Timeline, func(i, j int) bool { return report.Timeline[i].Start.Before(report.Timeline[j].Start) })
+
+	logger.LogInfof("Active session history: %s of database time over %s, %d statements",
+		report.DBTime, report.Window, len(report.Statements))
+	return report
+}
+
+// eventTimes orders counted events by time spent, most first
+func eventTimes(counts map[string]int, interval time.Duration) []EventTime {
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	var times []EventTime
+	for event, n := range counts {
+		times = append(times, EventTime{
+			Event:   event,
+			Samples: n,
+			Time:    time.Duration(n) * interval,
+			Share:   float64(n) / float64(total),
+		})
+	}
+	sort.Slice(times, func(i, j int) bool {
+		if times[i].Samples != times[j].Samples {
+			return times[i].Samples > times[j].Samples
+		}
+		return times[i].Event < times[j].Event
+	})
+	return times
+}
+
+func eventPhrase(event string) string {
+	if event == CPU {
+		return "on CPU"
+	}
+	return "in " + event
+}
+
+// Advice explains what a statement dominated by event is waiting for and
+// what usually helps. Events without specific advice return "".
+func Advice(event string) string {
+	class, name, _ := strings.Cut(event, ":")
+	switch {
+	case event == CPU:
+		return "It is CPU-bound: look for large sorts, hash joins, function calls per row or scans that filter out most rows, and check the plan for work an index could skip."
+	case event == "IO:DataFileRead" || event == "IO:DataFilePrefetch":
+		return "It mostly waits for table and index pages to be read from disk: an index that reads fewer pages, or a working set that fits in shared_buffers and the OS cache, cuts this time."
+	case event == "IO:BufFileRead" || event == "IO:BufFileWrite":
+		return "It waits on temporary files: sorts or hashes spill to disk because they do not fit work_mem."
+	case event == "IO:WALSync" || event == "IO:WALWrite" || event == "LWLock:WALWrite" || event == "LWLock:WALInsert":
+		return "It waits for WAL to be written and flushed at commit: batch writes into fewer transactions, or for data you can afford to lose, use synchronous_commit = off for this workload."
+	case class == "Lock":
+		return "It waits for heavyweight locks held by other sessions; the lock report shows which statements block it."
+	case event == "LWLock:BufferMapping" || event == "LWLock:buffer_mapping":
+		return "It contends on the buffer mapping table, a sign the working set churns through shared_buffers."
+	case event == "LWLock:BufferContent" || event == "LWLock:buffer_content":
+		return "Many sessions touch the same pages at once (hot rows or index leaf pages); spreading writes, e.g. away from monotonically increasing keys, reduces it."
+	case class == "Client":
+		return "It waits on the client: the application reads results slowly or pauses mid-transaction, which the database cannot speed up."
+	case class == "IPC" && (strings.HasPrefix(name, "Parallel") || name == "BgWorkerShutdown" || name == "ExecuteGather"):
+		return "It waits on parallel workers; check that max_parallel_workers allows the planned workers to start."
+	}
+	return ""
+}
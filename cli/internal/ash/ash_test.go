@@ -0,0 +1,182 @@
+package ash
+
+import (
+	"testing"
+	"time"
+
+	"cli/internal/store"
+)
+
+func TestActiveAndEvent(t *testing.T) {
+	tests := []struct {
+		name       string
+		session    store.Session
+		wantActive bool
+		wantEvent  string
+	}{
+		{name: "active on CPU", session: store.Session{State: "active"}, wantActive: true, wantEvent: CPU},
+		{
+			name:       "active reading",
+			session:    store.Session{State: "active", WaitEventType: "IO", WaitEvent: "DataFileRead"},
+			wantActive: true, wantEvent: "IO:DataFileRead",
+		},
+		{
+			name:      "idle in transaction",
+			session:   store.Session{State: "idle in transaction", WaitEventType: "Client", WaitEvent: "ClientRead"},
+			wantEvent: "Client:ClientRead",
+		},
+		{
+			name:       "background worker at work",
+			session:    store.Session{WaitEventType: "IO", WaitEvent: "WALWrite"},
+			wantActive: true, wantEvent: "IO:WALWrite",
+		},
+		{
+			name:      "background worker in its main loop",
+			session:   store.Session{WaitEventType: "Activity", WaitEvent: "AutoVacuumMain"},
+			wantEvent: "Activity:AutoVacuumMain",
+		},
+		{
+			name:       "MySQL thread state",
+			session:    store.Session{State: "active", WaitEvent: "Sending data"},
+			wantActive: true, wantEvent: "Sending data",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Active(tt.session); got != tt.wantActive {
+				t.Errorf("Active() = %v, want %v", got, tt.wantActive)
+			}
+			if got := Event(tt.session); got != tt.wantEvent {
+				t.Errorf("Event() = %q, want %q", got, tt.wantEvent)
+			}
+		})
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	base := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	const (
+		report = "SELECT customer_id, sum(total) FROM orders GROUP BY customer_id"
+		lookup = "SELECT * FROM orders WHERE id = 1"
+	)
+	reading := store.Session{State: "active", Query: report, QueryID: 42, WaitEventType: "IO", WaitEvent: "DataFileRead"}
+	computing := store.Session{State: "active", Query: report, QueryID: 42}
+	looking := store.Session{State: "active", Query: lookup}
+	idle := store.Session{State: "idle", Query: lookup}
+
+	// samples repeats the sessions in n samples one second apart
+	samples := func(n int, sessions ...store.Session) []store.ActivitySample {
+		var out []store.ActivitySample
+		for i := range n {
+			out = append(out, store.ActivitySample{CapturedAt: base.Add(time.Duration(i) * time.Second), Sessions: sessions})
+		}
+		return out
+	}
+
+	type statement struct {
+		query    string
+		samples  int
+		dominant string
+	}
+	tests := []struct {
+		name           string
+		samples        []store.ActivitySample
+		wantDBTime     time.Duration
+		wantWindow     time.Duration
+		wantEvents     []string
+		wantStatements []statement
+		wantTimeline   int
+	}{
+		{
+			name: "no samples",
+		},
+		{
+			name:         "idle sessions add no time",
+			samples:      samples(5, idle),
+			wantWindow:   5 * time.Second,
+			wantTimeline: 5,
+		},
+		{
+			name:         "time split by event and statement",
+			samples:      samples(12, reading, reading, computing, looking, idle),
+			wantDBTime:   48 * time.Second,
+			wantWindow:   12 * time.Second,
+			wantEvents:   []string{CPU, "IO:DataFileRead"},
+			wantTimeline: 12,
+			wantStatements: []statement{
+				{query: report, samples: 36, dominant: "IO:DataFileRead"},
+				{query: lookup, samples: 12, dominant: CPU},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Analyze(tt.samples, DefaultOptions())
+
+			if got.DBTime != tt.wantDBTime || got.Window != tt.wantWindow {
+				t.Errorf("DBTime, Window = %s, %s, want %s, %s", got.DBTime, got.Window, tt.wantDBTime, tt.wantWindow)
+			}
+			if len(got.Timeline) != tt.wantTimeline {
+				t.Errorf("got %d timeline points, want %d", len(got.Timeline), tt.wantTimeline)
+			}
+			if len(got.Events) != len(tt.wantEvents) {
+				t.Fatalf("got %d events, want %d: %+v", len(got.Events), len(tt.wantEvents), got.Events)
+			}
+			for i, event := range tt.wantEvents {
+				if got.Events[i].Event != event {
+					t.Errorf("event %d = %q, want %q", i, got.Events[i].Event, event)
+				}
+			}
+			if len(got.Statements) != len(tt.wantStatements) {
+				t.Fatalf("got %d statements, want %d: %+v", len(got.Statements), len(tt.wantStatements), got.Statements)
+			}
+			for i, want := range tt.wantStatements {
+				p := got.Statements[i]
+				if p.Query != want.query || p.Samples != want.samples || p.Dominant().Event != want.dominant {
+					t.Errorf("statement %d = %q seen %d times mostly in %q, want %q seen %d times mostly in %q",
+						i, p.Query, p.Samples, p.Dominant().Event, want.query, want.samples, want.dominant)
+				}
+				if p.DBTime != time.Duration(want.samples)*time.Second {
+					t.Errorf("statement %d: DBTime = %s, want %ds", i, p.DBTime, want.samples)
+				}
+			}
+		})
+	}
+}
+
+func TestReportForStatement(t *testing.T) {
+	report := &Report{
+		MinSamples: 10,
+		Statements: []StatementProfile{
+			{Fingerprint: "report", QueryID: 42, Samples: 36},
+			{Fingerprint: "lookup", Samples: 4},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		fingerprint string
+		queryID     int64
+		want        string
+	}{
+		{name: "by fingerprint", fingerprint: "report", want: "report"},
+		{name: "by query ID", fingerprint: "renamed", queryID: 42, want: "report"},
+		{name: "seen too rarely", fingerprint: "lookup"},
+		{name: "never seen", fingerprint: "missing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := report.ForStatement(tt.fingerprint, tt.queryID)
+			got := ""
+			if p != nil {
+				got = p.Fingerprint
+			}
+			if got != tt.want {
+				t.Errorf("ForStatement(%q, %d) = %q, want %q", tt.fingerprint, tt.queryID, got, tt.want)
+			}
+		})
+	}
+}
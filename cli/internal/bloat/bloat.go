@@ -0,0 +1,226 @@
+package bloat
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"cli/internal/config"
+	"cli/internal/format"
+	"cli/internal/logger"
+	"cli/internal/store"
+)
+
+// Remedies, from least to most disruptive
+const (
+	ActionVacuum     = "vacuum"      // makes dead rows' space reusable, file keeps its size
+	ActionReindex    = "reindex"     // rebuilds one index online
+	ActionRepack     = "pg_repack"   // rewrites the table online, needs a primary or unique key
+	ActionRebuild    = "rebuild"     // InnoDB online table rebuild
+	ActionVacuumFull = "vacuum_full" // rewrites the table under an exclusive lock
+)
+
+// Options tune the analysis.
+type Options struct {
+	// MinWastedBytes skips relations wasting less than this
+	MinWastedBytes int64
+	// MinRatio skips relations wasting less than this fraction of their size
+	MinRatio float64
+	// RewriteRatio is the bloat above which a table is rewritten rather than
+	// vacuumed, since its pages will not fill up again soon
+	RewriteRatio float64
+	Engine       string // DDL dialect; empty means PostgreSQL
+}
+
+func DefaultOptions() Options {
+	return Options{
+		MinWastedBytes: 10 * 1024 * 1024,
+		MinRatio:       0.2,
+		RewriteRatio:   0.5,
+	}
+}
+
+// Finding is one bloated table or index and how to reclaim its space.
+type Finding struct {
+	Schema      string  `json:"schema,omitempty"`
+	Table       string  `json:"table"`
+	Index       string  `json:"index,omitempty"` // empty for the table itself
+	SizeBytes   int64   `json:"size_bytes"`
+	WastedBytes int64   `json:"wasted_bytes"`
+	Ratio       float64 `json:"ratio"`
+	Source      string  `json:"source"` // estimate, pgstattuple or data_free
+	Action      string  `json:"action"`
+	DDL         string  `json:"ddl"`
+	RiskLevel   string  `json:"risk_level"`
+	Rationale   string  `json:"rationale"`
+}
+
+// Report is the bloat of a schema, most wasted bytes first.
+type Report struct {
+	Findings        []Finding `json:"findings"`
+	WastedBytes     int64     `json:"wasted_bytes"`
+	TablesAnalyzed  int       `json:"tables_analyzed"`
+	IndexesAnalyzed int       `json:"indexes_analyzed"`
+	Measured        int       `json:"measured"` // by pgstattuple rather than estimated
+}
+
+// Analyze picks the bloated relations out of the estimates and recommends
+// a remedy for each. Tables and indexes are needed to tell dead rows from
+// free space and whether pg_repack can rewrite a table.
+func Analyze(estimates []store.BloatEstimate, tables []store.TableInfo, indexes []store.IndexInfo, opts Options) *Report {
+	logger.LogInfof("Analyzing bloat of %d relations", len(estimates))
+
+	tableInfo := make(map[string]store.TableInfo, len(tables))
+	for _, t := range tables {
+		tableInfo[format.Qualified(t.SchemaName, t.TableName)] = t
+	}
+	keyed := make(map[string]bool)
+	indexSize := make(map[string]int64)
+	for _, idx := range indexes {
+		table := format.Qualified(idx.SchemaName, idx.TableName)
+		if repackKey(idx) {
+			keyed[table] = true
+		}
+		indexSize[table] += idx.SizeBytes
+	}
+
+	report := &Report{}
+	for _, b := range estimates {
+		if b.IndexName == "" {
+			report.TablesAnalyzed++
+		} else {
+			report.IndexesAnalyzed++
+		}
+		if b.Source == store.BloatPgstattuple {
+			report.Measured++
+		}
+		if b.WastedBytes < opts.MinWastedBytes || b.BloatRatio() < opts.MinRatio {
+			continue
+		}
+
+		f := Finding{
+			Schema:      b.SchemaName,
+			Table:       b.TableName,
+			Index:       b.IndexName,
+			SizeBytes:   b.SizeBytes,
+			WastedBytes: b.WastedBytes,
+			Ratio:       b.BloatRatio(),
+			Source:      b.Source,
+		}
+		table := format.Qualified(b.SchemaName, b.TableName)
+		switch {
+		case b.IndexName != "":
+			reindex(&f)
+		case opts.Engine == config.EngineMySQL:
+			rebuild(&f)
+		default:
+			vacuumOrRewrite(&f, b, tableInfo[table], keyed[table], indexSize[table], opts)
+		}
+		report.Findings = append(report.Findings, f)
+		report.WastedBytes += f.WastedBytes
+	}
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		return report.Findings[i].WastedBytes > report.Findings[j].WastedBytes
+	})
+	logger.LogInfof("Found %d bloated relations wasting %d bytes", len(report.Findings), report.WastedBytes)
+	return report
+}
+
+// vacuumOrRewrite vacuums moderately bloated tables, whose free space new
+// rows will reuse, and rewrites the rest: online with pg_repack when the
+// table has a key it can use, otherwise with VACUUM FULL.
+func vacuumOrRewrite(f *Finding, b store.BloatEstimate, t store.TableInfo, keyed bool, indexBytes int64, opts Options) {
+	name := format.Qualified(f.Schema, f.Table)
+	evidence := fmt.Sprintf("Table '%s' wastes %s of its %s (%.0f%%, %s).",
+		f.Table, format.Bytes(f.WastedBytes), format.Bytes(f.SizeBytes), f.Ratio*100, describeSource(f.Source))
+	if dead := deadFraction(b, t); dead > 0 {
+		evidence += fmt.Sprintf(" About %.0f%% of its rows are dead.", dead*100)
+	}
+
+	if f.Ratio < opts.RewriteRatio {
+		f.Action = ActionVacuum
+		f.DDL = fmt.Sprintf("VACUUM (ANALYZE) %s;", name)
+		f.RiskLevel = "low"
+		f.Rationale = evidence + " VACUUM marks the space of dead rows for reuse without locking out reads or writes, so the table stops growing; the file only shrinks by its empty trailing pages."
+		return
+	}
+
+	// Both rewrites need room for a full copy of the table and its indexes
+	copyBytes := f.SizeBytes - f.WastedBytes + indexBytes
+	if keyed {
+		f.Action = ActionRepack
+		f.DDL = fmt.Sprintf("pg_repack --no-order --table=%s", name)
+		f.RiskLevel = "medium"
+		f.Rationale = evidence + fmt.Sprintf(" At this ratio VACUUM cannot give the space back, so rewrite it with pg_repack, which holds an exclusive lock only briefly at the start and end. It needs the pg_repack extension and about %s of free disk.", format.Bytes(copyBytes))
+		return
+	}
+	f.Action = ActionVacuumFull
+	f.DDL = fmt.Sprintf("VACUUM (FULL, ANALYZE) %s;", name)
+	f.RiskLevel = "high"
+	f.Rationale = evidence + fmt.Sprintf(" At this ratio VACUUM cannot give the space back, and without a primary key or unique index pg_repack cannot rewrite it online. VACUUM FULL blocks all reads and writes of the table while it copies it, and needs about %s of free disk; run it in a maintenance window.", format.Bytes(copyBytes))
+}
+
+// reindex rebuilds a bloated index alongside the old one, which keeps
+// serving queries until the swap
+func reindex(f *Finding) {
+	f.Action = ActionReindex
+	f.DDL = fmt.Sprintf("REINDEX INDEX CONCURRENTLY %s;", format.Qualified(f.Schema, f.Index))
+	f.RiskLevel = "low"
+	f.Rationale = fmt.Sprintf("Index '%s' on '%s' wastes %s of its %s (%.0f%%, %s). Empty and half-empty pages make every scan read more than it needs; REINDEX CONCURRENTLY builds a compact copy without blocking writes (PostgreSQL 12+).",
+		f.Index, f.Table, format.Bytes(f.WastedBytes), format.Bytes(f.SizeBytes), f.Ratio*100, describeSource(f.Source))
+	if f.SizeBytes-f.WastedBytes > 10*1024*1024*1024 {
+		f.RiskLevel = "medium"
+		f.Rationale += " The build is long at this size and doubles the index's disk use until it finishes."
+	}
+}
+
+// rebuild is the InnoDB equivalent of pg_repack, an online table copy
+func rebuild(f *Finding) {
+	f.Action = ActionRebuild
+	f.DDL = fmt.Sprintf("ALTER TABLE %s ENGINE=InnoDB, ALGORITHM=INPLACE, LOCK=NONE;", format.Qualified(f.Schema, f.Table))
+	f.RiskLevel = "medium"
+	f.Rationale = fmt.Sprintf("Table '%s' has %s free in its tablespace (%.0f%% of %s). InnoDB reuses it for new rows but only a rebuild returns it to the file system; the online rebuild allows writes but needs free disk for a copy of the table and adds replication lag on replicas.",
+		f.Table, format.Bytes(f.WastedBytes), f.Ratio*100, format.Bytes(f.SizeBytes))
+}
+
+// repackKey reports whether pg_repack can use the index to rewrite the
+// table: a primary key, or a unique index on plain columns without a
+// predicate (pg_repack also requires the columns to be NOT NULL, which the
+// index metadata does not show).
+func repackKey(idx store.IndexInfo) bool {
+	if idx.IsPrimary {
+		return true
+	}
+	if !idx.IsUnique || idx.Invalid || idx.Predicate != "" {
+		return false
+	}
+	for _, col := range idx.Keys() {
+		if strings.Contains(col, "(") {
+			return false
+		}
+	}
+	return true
+}
+
+// deadFraction is the share of dead rows, as pgstattuple measured it or
+// else as the statistics collector counts it
+func deadFraction(b store.BloatEstimate, t store.TableInfo) float64 {
+	if b.DeadTupleBytes > 0 && b.SizeBytes > 0 {
+		return float64(b.DeadTupleBytes) / float64(b.SizeBytes)
+	}
+	if total := t.LiveTuples + t.DeadTuples; total > 0 {
+		return float64(t.DeadTuples) / float64(total)
+	}
+	return 0
+}
+
+func describeSource(source string) string {
+	switch source {
+	case store.BloatPgstattuple:
+		return "measured with pgstattuple"
+	case store.BloatDataFree:
+		return "InnoDB DATA_FREE"
+	}
+	return "estimated from statistics"
+}
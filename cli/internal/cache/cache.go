@@ -0,0 +1,337 @@
+package cache
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"cli/internal/format"
+	"cli/internal/logger"
+	"cli/internal/store"
+)
+
+// Finding kinds
+const (
+	KindSharedBuffers = "shared_buffers" // the working set does not fit shared_buffers
+	KindExceedsCache  = "exceeds_cache"  // a relation read from outside the cache is larger than it
+	KindPrewarm       = "prewarm"        // a relation that fits is still read from outside the cache
+)
+
+// headroom is how much larger than the working set a recommended
+// shared_buffers is, so that it survives some growth and the odd scan
+const headroom = 1.2
+
+// Options tune the analysis.
+type Options struct {
+	// MinHitRatio is the share of block accesses shared_buffers should
+	// serve; a read-mostly OLTP workload usually gets over 99%
+	MinHitRatio float64
+	// MinBlocksRead is how many blocks a relation must have read from
+	// outside the cache before it is flagged
+	MinBlocksRead int64
+	// WorkingSetShare is the share of all block accesses the working set
+	// covers, taking the most accessed relations first
+	WorkingSetShare float64
+	// MaxSharedBuffers is the largest shared_buffers recommended; past it
+	// the workload should read less instead
+	MaxSharedBuffers int64
+}
+
+func DefaultOptions() Options {
+	return Options{
+		MinHitRatio:      0.99,
+		MinBlocksRead:    10_000,
+		WorkingSetShare:  0.95,
+		MaxSharedBuffers: 64 << 30,
+	}
+}
+
+// Relation is the cache activity of one table or index. Hot relations are
+// part of the working set.
+type Relation struct {
+	store.CacheStats
+	HitRatio    float64 `json:"hit_ratio"`
+	AccessShare float64 `json:"access_share"` // of all block accesses
+	Hot         bool    `json:"hot"`
+}
+
+// Finding is one cache problem and its fix. Server-wide findings have no
+// table.
+type Finding struct {
+	Kind      string  `json:"kind"`
+	Schema    string  `json:"schema,omitempty"`
+	Table     string  `json:"table,omitempty"`
+	Index     string  `json:"index,omitempty"`
+	HitRatio  float64 `json:"hit_ratio"`
+	BlksRead  int64   `json:"blks_read"`
+	SizeBytes int64   `json:"size_bytes,omitempty"`
+	DDL       string  `json:"ddl,omitempty"`
+	RiskLevel string  `json:"risk_level"`
+	Rationale string  `json:"rationale"`
+}
+
+// Report is how well shared_buffers serves the tables and indexes of a
+// database, with relations listed by blocks read from outside the cache.
+type Report struct {
+	Findings  []Finding  `json:"findings"`
+	Relations []Relation `json:"relations"`
+	// HitRatio covers every user table and index
+	HitRatio float64 `json:"hit_ratio"`
+	BlksHit  int64   `json:"blks_hit"`
+	BlksRead int64   `json:"blks_read"`
+	// WorkingSetBytes is the size of the hot relations, an upper bound on
+	// the data the workload keeps coming back to
+	WorkingSetBytes     int64 `json:"working_set_bytes"`
+	WorkingSetRelations int   `json:"working_set_relations"`
+
+	SharedBuffers      int64      `json:"shared_buffers"`
+	EffectiveCacheSize int64      `json:"effective_cache_size"`
+	BlockSize          int64      `json:"block_size"`
+	MinHitRatio        float64    `json:"min_hit_ratio"`
+	Buffercache        bool       `json:"buffercache"`
+	StatsReset         *time.Time `json:"stats_reset,omitempty"`
+	CapturedAt         time.Time  `json:"captured_at"`
+}
+
+// Analyze computes the hit ratio of every table and index, estimates the
+// working set and compares it with shared_buffers. It recommends a larger
+// shared_buffers when the working set does not fit, and for each relation
+// read too often from outside the cache, reading less of it when it is
+// larger than the cache or prewarming it when it fits. Without memory
+// settings only the ratios are reported.
+func Analyze(usage *store.CacheUsage, memory *store.MemorySettings, opts Options) *Report {
+	logger.LogInfof("Analyzing buffer cache use of %d relations", len(usage.Relations))
+
+	report := &Report{
+		MinHitRatio: opts.MinHitRatio,
+		BlockSize:   8192,
+		Buffercache: usage.Buffercache,
+		StatsReset:  usage.StatsReset,
+		CapturedAt:  usage.CapturedAt,
+	}
+	if memory != nil {
+		report.SharedBuffers = memory.SharedBuffers
+		report.EffectiveCacheSize = memory.EffectiveCacheSize
+		if memory.BlockSize > 0 {
+			report.BlockSize = memory.BlockSize
+		}
+	}
+
+	for _, c := range usage.Relations {
+		report.BlksHit += c.BlksHit
+		report.BlksRead += c.BlksRead
+		report.Relations = append(report.Relations, Relation{CacheStats: c, HitRatio: c.HitRatio()})
+	}
+	accesses := report.BlksHit + report.BlksRead
+	report.HitRatio = 1
+	if accesses > 0 {
+		report.HitRatio = float64(report.BlksHit) / float64(accesses)
+	}
+
+	// The working set is the most accessed relations, until they cover
+	// WorkingSetShare of all accesses
+	sort.SliceStable(report.Relations, func(i, j int) bool {
+		return report.Relations[i].BlksHit+report.Relations[i].BlksRead > report.Relations[j].BlksHit+report.Relations[j].BlksRead
+	})
+	var covered int64
+	for i := range report.Relations {
+		r := &report.Relations[i]
+		if accesses == 0 || r.BlksHit+r.BlksRead == 0 {
+			break
+		}
+		r.AccessShare = float64(r.BlksHit+r.BlksRead) / float64(accesses)
+		if float64(covered) < opts.WorkingSetShare*float64(accesses) {
+			r.Hot = true
+			covered += r.BlksHit + r.BlksRead
+			report.WorkingSetBytes += r.SizeBytes
+			report.WorkingSetRelations++
+		}
+	}
+	sort.SliceStable(report.Relations, func(i, j int) bool {
+		return report.Relations[i].BlksRead > report.Relations[j].BlksRead
+	})
+
+	if report.SharedBuffers > 0 {
+		if f, ok := report.sizingFinding(opts); ok {
+			report.Findings = append(report.Findings, f)
+		}
+		for _, r := range report.Relations {
+			if r.BlksRead < opts.MinBlocksRead || r.HitRatio >= opts.MinHitRatio {
+				continue
+			}
+			if r.SizeBytes > report.SharedBuffers {
+				report.Findings = append(report.Findings, report.exceedsFinding(r))
+			} else if report.WorkingSetBytes <= report.SharedBuffers {
+				// With a working set larger than the cache, a prewarmed
+				// relation is evicted again
+				report.Findings = append(report.Findings, report.prewarmFinding(r, usage))
+			}
+		}
+	}
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		return format.RiskRank(report.Findings[i].RiskLevel) > format.RiskRank(report.Findings[j].RiskLevel)
+	})
+	logger.LogInfof("Buffer cache hit ratio %.1f%%, working set %d bytes in %d relations, %d findings",
+		report.HitRatio*100, report.WorkingSetBytes, report.WorkingSetRelations, len(report.Findings))
+	return report
+}
+
+// Table returns the heap of a table
+func (r *Report) Table(name string) (Relation, bool) {
+	for _, rel := range r.Relations {
+		if rel.TableName == name && rel.IndexName == "" {
+			return rel, true
+		}
+	}
+	return Relation{}, false
+}
+
+// Indexes returns the indexes of a table, most blocks read first
+func (r *Report) Indexes(table string) []Relation {
+	var result []Relation
+	for _, rel := range r.Relations {
+		if rel.TableName == table && rel.IndexName != "" {
+			result = append(result, rel)
+		}
+	}
+	return result
+}
+
+// Since describes the window the counters cover
+func (r *Report) Since() string {
+	if r.StatsReset == nil {
+		return "since the statistics were last reset"
+	}
+	return fmt.Sprintf("since the statistics reset %s ago", format.Age(r.CapturedAt.Sub(*r.StatsReset)))
+}
+
+// sizingFinding recommends a shared_buffers that holds the working set
+// when the cache misses too often and the working set does not fit
+func (r *Report) sizingFinding(opts Options) (Finding, bool) {
+	if r.HitRatio >= opts.MinHitRatio || r.WorkingSetBytes <= r.SharedBuffers {
+		return Finding{}, false
+	}
+
+	f := Finding{
+		Kind:      KindSharedBuffers,
+		HitRatio:  r.HitRatio,
+		BlksRead:  r.BlksRead,
+		SizeBytes: r.WorkingSetBytes,
+		RiskLevel: "medium",
+	}
+	evidence := fmt.Sprintf("shared_buffers served %.1f%% of %s block accesses to tables and indexes %s; %s blocks (%s) came from the OS cache or disk. The %d relations that take %.0f%% of the accesses total %s, against %s of shared_buffers. That is an upper bound on the working set, since only part of a large table may be hot.",
+		r.HitRatio*100, format.Count(r.BlksHit+r.BlksRead), r.Since(), format.Count(r.BlksRead), format.Bytes(r.BlksRead*r.BlockSize),
+		r.WorkingSetRelations, opts.WorkingSetShare*100, format.Bytes(r.WorkingSetBytes), format.Bytes(r.SharedBuffers))
+
+	suggested := roundSharedBuffers(int64(float64(r.WorkingSetBytes) * headroom))
+	if suggested > opts.MaxSharedBuffers {
+		f.Rationale = evidence + fmt.Sprintf(" Caching it would take more than %s of shared_buffers, so the statements have to read less instead: see the relations larger than the cache below and the cache_hit_ratio recommendations of the statements reading them.",
+			format.Bytes(opts.MaxSharedBuffers))
+		return f, true
+	}
+
+	f.DDL = fmt.Sprintf("ALTER SYSTEM SET shared_buffers = '%s';", pgSize(suggested))
+	rationale := evidence + fmt.Sprintf(" A shared_buffers of %s holds it with %.0f%% headroom; it takes effect after a restart. Keep shared_buffers at about 25%% of RAM, so this needs %s of memory: with less, the OS cache serves the rest better than a larger shared_buffers would.",
+		pgSize(suggested), (headroom-1)*100, format.Bytes(4*suggested))
+	if r.EffectiveCacheSize < 2*suggested {
+		// With shared_buffers at a quarter of RAM, three quarters is the
+		// usual effective_cache_size
+		f.DDL += fmt.Sprintf(" ALTER SYSTEM SET effective_cache_size = '%s';", pgSize(3*suggested))
+		rationale += fmt.Sprintf(" effective_cache_size (%s) tells the planner how much of shared_buffers and the OS cache index scans can count on; it is usually about 75%% of RAM.",
+			format.Bytes(r.EffectiveCacheSize))
+	}
+	f.Rationale = rationale
+	return f, true
+}
+
+// exceedsFinding explains a relation that cannot be kept cached: the
+// statements reading it have to read less of it
+func (r *Report) exceedsFinding(rel Relation) Finding {
+	f := Finding{
+		Kind:      KindExceedsCache,
+		Schema:    rel.SchemaName,
+		Table:     rel.TableName,
+		Index:     rel.IndexName,
+		HitRatio:  rel.HitRatio,
+		BlksRead:  rel.BlksRead,
+		SizeBytes: rel.SizeBytes,
+		RiskLevel: "low",
+	}
+	if rel.HitRatio < 0.9 {
+		f.RiskLevel = "medium"
+	}
+
+	rationale := fmt.Sprintf("%s (%s) is larger than shared_buffers (%s), and %s only %.1f%% of its %s block accesses hit the cache: %s blocks (%s) were read from the OS cache or disk.",
+		describe(rel), format.Bytes(rel.SizeBytes), format.Bytes(r.SharedBuffers), r.Since(), rel.HitRatio*100,
+		format.Count(rel.BlksHit+rel.BlksRead), format.Count(rel.BlksRead), format.Bytes(rel.BlksRead*r.BlockSize))
+	if rel.IndexName == "" {
+		rationale += " It cannot be kept cached, so the statements reading it have to read less of it. An index holding every column a statement reads allows an index-only scan that skips the heap, as long as vacuum keeps the visibility map current; sequential scans of it are better served by an index or by partitioning on the column they filter on. The cache_hit_ratio recommendations of those statements name the indexes."
+	} else {
+		rationale += " It cannot be kept cached, so the statements using it have to read less of it: a scan over a wide key range, a bloated index (see optidb bloat) or a key wider than the lookups need all read more index blocks than necessary. A partial index on the rows actually searched is much smaller."
+	}
+	f.Rationale = rationale
+	return f
+}
+
+// prewarmFinding loads a relation that fits in shared_buffers but keeps
+// getting evicted and read back block by block
+func (r *Report) prewarmFinding(rel Relation, usage *store.CacheUsage) Finding {
+	name := format.Qualified(rel.SchemaName, rel.TableName)
+	if rel.IndexName != "" {
+		name = format.Qualified(rel.SchemaName, rel.IndexName)
+	}
+
+	f := Finding{
+		Kind:      KindPrewarm,
+		Schema:    rel.SchemaName,
+		Table:     rel.TableName,
+		Index:     rel.IndexName,
+		HitRatio:  rel.HitRatio,
+		BlksRead:  rel.BlksRead,
+		SizeBytes: rel.SizeBytes,
+		DDL:       fmt.Sprintf("SELECT pg_prewarm('%s');", name),
+		RiskLevel: "low",
+	}
+	if !usage.Prewarm {
+		f.DDL = "CREATE EXTENSION IF NOT EXISTS pg_prewarm; " + f.DDL
+	}
+
+	rationale := fmt.Sprintf("%s (%s) fits in shared_buffers (%s), and the working set does too, yet %s only %.1f%% of its %s block accesses hit the cache: %s blocks were read back one at a time after a restart or after large scans evicted them.",
+		describe(rel), format.Bytes(rel.SizeBytes), format.Bytes(r.SharedBuffers), r.Since(), rel.HitRatio*100,
+		format.Count(rel.BlksHit+rel.BlksRead), format.Count(rel.BlksRead))
+	if usage.Buffercache {
+		rationale += fmt.Sprintf(" %s of it is in shared_buffers now.", format.Bytes(rel.CachedBytes))
+	}
+	rationale += " pg_prewarm loads it in one sequential pass."
+	if !usage.Autoprewarm {
+		rationale += " Adding pg_prewarm to shared_preload_libraries also saves the cache contents and loads them back after a restart (autoprewarm)."
+	}
+	f.Rationale = rationale
+	return f
+}
+
+func describe(rel Relation) string {
+	if rel.IndexName != "" {
+		return fmt.Sprintf("Index '%s' on '%s'", format.Qualified(rel.SchemaName, rel.IndexName), rel.TableName)
+	}
+	return fmt.Sprintf("Table '%s'", format.Qualified(rel.SchemaName, rel.TableName))
+}
+
+// roundSharedBuffers rounds up to a power of two, at least the 128MB
+// server default
+func roundSharedBuffers(bytes int64) int64 {
+	size := int64(128 << 20)
+	for size < bytes {
+		size *= 2
+	}
+	return size
+}
+
+// pgSize writes a size in the units PostgreSQL accepts for memory settings
+func pgSize(bytes int64) string {
+	if bytes%(1<<30) == 0 {
+		return fmt.Sprintf("%dGB", bytes>>30)
+	}
+	return fmt.Sprintf("%dMB", bytes>>20)
+}
@@ -0,0 +1,350 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config holds every setting that used to be hard-coded. It is loaded once
+// by the root command (see Load) and read by the other packages with Get.
+type Config struct {
+	Database DatabaseConfig `yaml:"database" toml:"database" json:"database"`
+	// Targets are named clusters, e.g. staging and production. A target only
+	// lists what differs from database; the one selected with --target,
+	// $OPTIDB_TARGET or Target replaces database.
+	Target  string                    `yaml:"target" toml:"target" json:"target,omitempty"`
+	Targets map[string]DatabaseConfig `yaml:"targets" toml:"targets" json:"targets,omitempty"`
+	Rules   RulesConfig               `yaml:"rules" toml:"rules" json:"rules"`
+	AI      AIConfig                  `yaml:"ai" toml:"ai" json:"ai"`
+	Server  ServerConfig              `yaml:"server" toml:"server" json:"server"`
+
+	// base is the database section before UseTarget replaced it
+	base *DatabaseConfig
+}
+
+// Engines optidb can profile
+const (
+	EnginePostgres = "postgres"
+	EngineMySQL    = "mysql"
+)
+
+// DatabaseConfig is the monitored database and the roles optidb uses on it.
+// With a DSN (a postgres:// URL or key=value string, or for MySQL a
+// user:pass@tcp(host:port)/db string), host, port, name, user
+// and password are ignored. A password is read from password_command, then
+// password_file, then password; when none is set, .pgpass ($PGPASSFILE) is
+// used.
+type DatabaseConfig struct {
+	Engine          string     `yaml:"engine" toml:"engine" json:"engine"` // postgres (default) or mysql, which also covers MariaDB
+	DSN             string     `yaml:"dsn" toml:"dsn" json:"-"`
+	Host            string     `yaml:"host" toml:"host" json:"host"`
+	Port            string     `yaml:"port" toml:"port" json:"port"`
+	Name            string     `yaml:"name" toml:"name" json:"name"`
+	User            string     `yaml:"user" toml:"user" json:"user"`
+	Password        string     `yaml:"password" toml:"password" json:"-"`
+	PasswordFile    string     `yaml:"password_file" toml:"password_file" json:"password_file,omitempty"`
+	PasswordCommand string     `yaml:"password_command" toml:"password_command" json:"password_command,omitempty"`
+	SSLMode         string     `yaml:"ssl_mode" toml:"ssl_mode" json:"ssl_mode,omitempty"` // disable (default), require, verify-ca, verify-full
+	SSLRootCert     string     `yaml:"ssl_root_cert" toml:"ssl_root_cert" json:"ssl_root_cert,omitempty"`
+	SSLCert         string     `yaml:"ssl_cert" toml:"ssl_cert" json:"ssl_cert,omitempty"`
+	SSLKey          string     `yaml:"ssl_key" toml:"ssl_key" json:"ssl_key,omitempty"`
+	Profiler        RoleConfig `yaml:"profiler" toml:"profiler" json:"profiler"`
+	Sandbox         RoleConfig `yaml:"sandbox" toml:"sandbox" json:"sandbox"`
+	// Meta is the database holding the optidb_meta schema. Empty fields
+	// fall back to the settings above.
+	Meta MetaConfig `yaml:"meta" toml:"meta" json:"meta"`
+}
+
+// RoleConfig is a login role. Setting password_file or password_command
+// takes precedence over password. A DSN that names a user keeps its own
+// credentials, so the roles only apply to connections configured without.
+type RoleConfig struct {
+	User            string `yaml:"user" toml:"user" json:"user"`
+	Password        string `yaml:"password" toml:"password" json:"-"`
+	PasswordFile    string `yaml:"password_file" toml:"password_file" json:"password_file,omitempty"`
+	PasswordCommand string `yaml:"password_command" toml:"password_command" json:"password_command,omitempty"`
+}
+
+type MetaConfig struct {
+	DSN             string `yaml:"dsn" toml:"dsn" json:"-"`
+	Host            string `yaml:"host" toml:"host" json:"host,omitempty"`
+	Port            string `yaml:"port" toml:"port" json:"port,omitempty"`
+	Name            string `yaml:"name" toml:"name" json:"name,omitempty"`
+	User            string `yaml:"user" toml:"user" json:"user,omitempty"`
+	Password        string `yaml:"password" toml:"password" json:"-"`
+	PasswordFile    string `yaml:"password_file" toml:"password_file" json:"password_file,omitempty"`
+	PasswordCommand string `yaml:"password_command" toml:"password_command" json:"password_command,omitempty"`
+}
+
+// Configured reports whether a meta store is set apart from the profiled
+// database
+func (m MetaConfig) Configured() bool {
+	return m != MetaConfig{}
+}
+
+// RulesConfig holds the rule engine thresholds.
+type RulesConfig struct {
+	MinTableRows   int64    `yaml:"min_table_rows" toml:"min_table_rows" json:"min_table_rows"`       // smallest table worth an index
+	MinMeanTimeMS  float64  `yaml:"min_mean_time_ms" toml:"min_mean_time_ms" json:"min_mean_time_ms"` // mean time below which a query is not slow
+	MinCalls       int64    `yaml:"min_calls" toml:"min_calls" json:"min_calls"`                      // calls below which a query is ignored
+	SlowQueryLimit int      `yaml:"slow_query_limit" toml:"slow_query_limit" json:"slow_query_limit"` // statements returned by a slow query scan
+	MaxSelectivity float64  `yaml:"max_selectivity" toml:"max_selectivity" json:"max_selectivity"`    // fraction of rows above which an index is not worth it
+	Disabled       []string `yaml:"disabled" toml:"disabled" json:"disabled,omitempty"`               // rule IDs to skip
+}
+
+// AIConfig configures the Azure OpenAI client. AI recommendations are used
+// only when enabled and fully configured.
+type AIConfig struct {
+	Enabled     bool          `yaml:"enabled" toml:"enabled" json:"enabled"`
+	Provider    string        `yaml:"provider" toml:"provider" json:"provider"`
+	Endpoint    string        `yaml:"endpoint" toml:"endpoint" json:"endpoint,omitempty"`
+	APIKey      string        `yaml:"api_key" toml:"api_key" json:"-"`
+	APIVersion  string        `yaml:"api_version" toml:"api_version" json:"api_version,omitempty"`
+	Deployment  string        `yaml:"deployment" toml:"deployment" json:"deployment,omitempty"`
+	MaxTokens   int           `yaml:"max_tokens" toml:"max_tokens" json:"max_tokens"`
+	Temperature float64       `yaml:"temperature" toml:"temperature" json:"temperature"`
+	Timeout     time.Duration `yaml:"timeout" toml:"timeout" json:"timeout"`
+}
+
+// Configured reports whether every setting the client needs is present
+func (c AIConfig) Configured() bool {
+	return c.Endpoint != "" && c.APIKey != "" && c.APIVersion != "" && c.Deployment != ""
+}
+
+// ServerConfig configures optidb serve.
+type ServerConfig struct {
+	Port             string        `yaml:"port" toml:"port" json:"port"`
+	SampleInterval   time.Duration `yaml:"sample_interval" toml:"sample_interval" json:"sample_interval"`
+	ActivityInterval time.Duration `yaml:"activity_interval" toml:"activity_interval" json:"activity_interval"`
+	WaitInterval     time.Duration `yaml:"wait_interval" toml:"wait_interval" json:"wait_interval"`
+	AllowOrigins     string        `yaml:"allow_origins" toml:"allow_origins" json:"allow_origins"`
+}
+
+// Default returns the settings optidb used before it had a config file,
+// without passwords: those come from the config, the environment or
+// .pgpass ($PGPASSFILE).
+func Default() *Config {
+	return &Config{
+		Database: DatabaseConfig{
+			Engine:   EnginePostgres,
+			Host:     "localhost",
+			Port:     "5432",
+			Name:     "optidb",
+			User:     "postgres",
+			Profiler: RoleConfig{User: "profiler_ro"},
+			Sandbox:  RoleConfig{User: "profiler_sb"},
+		},
+		Rules: RulesConfig{
+			MinTableRows:   1000,
+			MinMeanTimeMS:  0.1,
+			MinCalls:       5,
+			SlowQueryLimit: 50,
+			MaxSelectivity: 0.1,
+		},
+		AI: AIConfig{
+			Enabled:     true,
+			Provider:    "azure",
+			MaxTokens:   2000,
+			Temperature: 0.1,
+			Timeout:     30 * time.Second,
+		},
+		Server: ServerConfig{
+			Port:             "8090",
+			SampleInterval:   time.Minute,
+			ActivityInterval: 0, // opt-in: pg_blocking_pids takes the lock manager exclusively
+			WaitInterval:     time.Second,
+			AllowOrigins:     "*",
+		},
+	}
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	errs = append(errs, validateDatabase("database", c.Database)...)
+	for _, name := range c.TargetNames() {
+		target, _ := c.ResolveTarget(name)
+		errs = append(errs, validateDatabase("targets."+name, target)...)
+	}
+	if c.Target != "" {
+		_, err := c.ResolveTarget(c.Target)
+		check(err == nil, "target: %v", err)
+	}
+
+	check(c.Rules.MinTableRows >= 0, "rules.min_table_rows must not be negative")
+	check(c.Rules.MinMeanTimeMS >= 0, "rules.min_mean_time_ms must not be negative")
+	check(c.Rules.MinCalls >= 0, "rules.min_calls must not be negative")
+	check(c.Rules.SlowQueryLimit > 0, "rules.slow_query_limit must be positive")
+	check(c.Rules.MaxSelectivity > 0 && c.Rules.MaxSelectivity <= 1, "rules.max_selectivity must be greater than 0 and at most 1")
+
+	check(c.AI.Provider == "azure", "ai.provider %q is not supported (supported: azure)", c.AI.Provider)
+	check(c.AI.MaxTokens > 0, "ai.max_tokens must be positive")
+	check(c.AI.Temperature >= 0 && c.AI.Temperature <= 2, "ai.temperature must be between 0 and 2")
+	check(c.AI.Timeout > 0, "ai.timeout must be positive")
+
+	check(validPort(c.Server.Port), "server.port %q is not a valid port", c.Server.Port)
+	check(c.Server.SampleInterval >= 0, "server.sample_interval must not be negative")
+	check(c.Server.ActivityInterval >= 0, "server.activity_interval must not be negative")
+	check(c.Server.WaitInterval >= 0, "server.wait_interval must not be negative")
+
+	return errors.Join(errs...)
+}
+
+var sslModes = []string{"", "disable", "require", "verify-ca", "verify-full"}
+
+func validateDatabase(prefix string, db DatabaseConfig) []error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(prefix+"."+format, args...))
+		}
+	}
+
+	check(db.Engine == EnginePostgres || db.Engine == EngineMySQL, "engine %q is not supported (use postgres or mysql)", db.Engine)
+	if db.Engine == EngineMySQL {
+		check(db.DSN == "" || strings.Contains(db.DSN, "/"), "dsn is not a MySQL DSN (user:password@tcp(host:port)/dbname)")
+	} else if db.DSN != "" {
+		check(validDSN(db.DSN), "dsn is neither a postgres:// URL nor a key=value string")
+	} else {
+		check(db.Host != "", "host is required")
+		check(validPort(db.Port), "port %q is not a valid port", db.Port)
+		check(db.Name != "", "name is required")
+		check(db.User != "", "user is required")
+	}
+	check(slices.Contains(sslModes, db.SSLMode), "ssl_mode %q is not supported (use disable, require, verify-ca or verify-full)", db.SSLMode)
+	check((db.SSLCert == "") == (db.SSLKey == ""), "ssl_cert and ssl_key must be set together")
+	for key, path := range map[string]string{
+		"ssl_root_cert":          db.SSLRootCert,
+		"ssl_cert":               db.SSLCert,
+		"ssl_key":                db.SSLKey,
+		"password_file":          db.PasswordFile,
+		"profiler.password_file": db.Profiler.PasswordFile,
+		"sandbox.password_file":  db.Sandbox.PasswordFile,
+		"meta.password_file":     db.Meta.PasswordFile,
+	} {
+		check(fileExists(path), "%s: %s does not exist", key, path)
+	}
+	check(db.Profiler.User != "", "profiler.user is required")
+	check(db.Sandbox.User != "", "sandbox.user is required")
+	check(db.Meta.DSN == "" || validDSN(db.Meta.DSN), "meta.dsn is neither a postgres:// URL nor a key=value string")
+	check(db.Meta.Port == "" || validPort(db.Meta.Port), "meta.port %q is not a valid port", db.Meta.Port)
+
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errs
+}
+
+func validDSN(dsn string) bool {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		_, err := url.Parse(dsn)
+		return err == nil
+	}
+	return strings.Contains(dsn, "=")
+}
+
+func fileExists(path string) bool {
+	if path == "" {
+		return true
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n < 65536
+}
+
+var (
+	mu      sync.RWMutex
+	current = Default()
+)
+
+// Get returns the active configuration. Callers must not modify it.
+func Get() *Config {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// Set makes cfg the active configuration
+func Set(cfg *Config) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = cfg
+}
+
+// TargetNames returns the configured target names, sorted
+func (c *Config) TargetNames() []string {
+	names := make([]string, 0, len(c.Targets))
+	for name := range c.Targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolveTarget returns the database settings of a named target: the
+// database section with the fields the target sets replaced.
+func (c *Config) ResolveTarget(name string) (DatabaseConfig, error) {
+	target, ok := c.Targets[name]
+	if !ok {
+		return DatabaseConfig{}, fmt.Errorf("unknown target %q (defined: %v)", name, c.TargetNames())
+	}
+
+	resolved := c.Database
+	if c.base != nil {
+		resolved = *c.base
+	}
+	// A target with its own DSN describes a different cluster; only the
+	// roles and the meta store carry over.
+	if target.DSN != "" {
+		resolved = DatabaseConfig{Engine: resolved.Engine, Profiler: resolved.Profiler, Sandbox: resolved.Sandbox, Meta: resolved.Meta}
+	}
+	overlay(reflect.ValueOf(&resolved).Elem(), reflect.ValueOf(target))
+	return resolved, nil
+}
+
+// UseTarget makes a named target the active database
+func (c *Config) UseTarget(name string) error {
+	resolved, err := c.ResolveTarget(name)
+	if err != nil {
+		return err
+	}
+	if c.base == nil {
+		base := c.Database
+		c.base = &base
+	}
+	c.Target = name
+	c.Database = resolved
+	return nil
+}
+
+// overlay copies the non-empty string fields of src onto dst, recursing
+// into nested structs.
+func overlay(dst, src reflect.Value) {
+	for i := 0; i < src.NumField(); i++ {
+		switch field := src.Field(i); field.Kind() {
+		case reflect.String:
+			if field.String() != "" {
+				dst.Field(i).SetString(field.String())
+			}
+		case reflect.Struct:
+			overlay(dst.Field(i), field)
+		}
+	}
+}
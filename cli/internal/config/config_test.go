@@ -0,0 +1,216 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*Config)
+		want   []string // substrings of the errors, in order
+	}{
+		{
+			name:   "defaults",
+			change: func(*Config) {},
+		},
+		{
+			name: "rule thresholds",
+			change: func(c *Config) {
+				c.Rules.MinCalls = -1
+				c.Rules.SlowQueryLimit = 0
+				c.Rules.MaxSelectivity = 1.5
+			},
+			want: []string{
+				"rules.min_calls must not be negative",
+				"rules.slow_query_limit must be positive",
+				"rules.max_selectivity must be greater than 0 and at most 1",
+			},
+		},
+		{
+			name: "AI and server settings",
+			change: func(c *Config) {
+				c.AI.Provider = "openai"
+				c.AI.Temperature = 3
+				c.Server.Port = "http"
+				c.Server.SampleInterval = -1
+			},
+			want: []string{
+				`ai.provider "openai" is not supported`,
+				"ai.temperature must be between 0 and 2",
+				`server.port "http" is not a valid port`,
+				"server.sample_interval must not be negative",
+			},
+		},
+		{
+			name: "database without host or name",
+			change: func(c *Config) {
+				c.Database.Host = ""
+				c.Database.Name = ""
+				c.Database.Port = "70000"
+			},
+			want: []string{
+				"database.host is required",
+				"database.name is required",
+				`database.port "70000" is not a valid port`,
+			},
+		},
+		{
+			name: "DSN replaces host, port, name and user",
+			change: func(c *Config) {
+				c.Database.DSN = "postgres://app@db.internal/shop"
+				c.Database.Host, c.Database.Port, c.Database.Name, c.Database.User = "", "", "", ""
+			},
+		},
+		{
+			name:   "DSN that is neither a URL nor key=value",
+			change: func(c *Config) { c.Database.DSN = "db.internal:5432" },
+			want:   []string{"database.dsn is neither a postgres:// URL nor a key=value string"},
+		},
+		{
+			name: "TLS settings",
+			change: func(c *Config) {
+				c.Database.SSLMode = "prefer"
+				c.Database.SSLCert = "/nonexistent/client.crt"
+			},
+			want: []string{
+				"database.ssl_cert and ssl_key must be set together",
+				"database.ssl_cert: /nonexistent/client.crt does not exist",
+				`database.ssl_mode "prefer" is not supported`,
+			},
+		},
+		{
+			name: "targets are validated as resolved",
+			change: func(c *Config) {
+				c.Targets = map[string]DatabaseConfig{
+					"staging":    {Host: "staging.internal"},
+					"production": {Port: "0"},
+				}
+				c.Target = "qa"
+			},
+			want: []string{
+				`targets.production.port "0" is not a valid port`,
+				`target: unknown target "qa" (defined: [production staging])`,
+			},
+		},
+		{
+			name: "MySQL DSN",
+			change: func(c *Config) {
+				c.Database.Engine = EngineMySQL
+				c.Database.DSN = "app:secret@tcp(db.internal:3306)"
+			},
+			want: []string{"database.dsn is not a MySQL DSN"},
+		},
+		{
+			name:   "unknown engine",
+			change: func(c *Config) { c.Database.Engine = "oracle" },
+			want:   []string{`database.engine "oracle" is not supported`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.change(cfg)
+			err := cfg.Validate()
+
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() = nil, want %q", tt.want)
+			}
+			got := strings.Split(err.Error(), "\n")
+			if len(got) != len(tt.want) {
+				t.Fatalf("Validate() = %q, want %d errors", got, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(got[i], want) {
+					t.Errorf("error %d = %q, want it to contain %q", i, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveTarget(t *testing.T) {
+	cfg := Default()
+	cfg.Database.Password = "secret"
+	cfg.Targets = map[string]DatabaseConfig{
+		"staging":    {Host: "staging.internal", Name: "shop", Profiler: RoleConfig{User: "profiler_staging"}},
+		"production": {DSN: "postgres://app@prod.internal/shop", SSLMode: "verify-full"},
+	}
+
+	tests := []struct {
+		name    string
+		target  string
+		want    func(*DatabaseConfig)
+		wantErr bool
+	}{
+		{
+			name:   "target overrides the fields it sets",
+			target: "staging",
+			want: func(db *DatabaseConfig) {
+				db.Host, db.Name, db.Profiler.User = "staging.internal", "shop", "profiler_staging"
+			},
+		},
+		{
+			name:   "target with a DSN keeps only the roles",
+			target: "production",
+			want: func(db *DatabaseConfig) {
+				*db = DatabaseConfig{
+					Engine: db.Engine, Profiler: db.Profiler, Sandbox: db.Sandbox, Meta: db.Meta,
+					DSN: "postgres://app@prod.internal/shop", SSLMode: "verify-full",
+				}
+			},
+		},
+		{
+			name:    "unknown target",
+			target:  "qa",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cfg.ResolveTarget(tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveTarget(%q) error = %v, wantErr %t", tt.target, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			want := cfg.Database
+			tt.want(&want)
+			if got != want {
+				t.Errorf("ResolveTarget(%q) = %+v, want %+v", tt.target, got, want)
+			}
+		})
+	}
+}
+
+func TestUseTarget(t *testing.T) {
+	cfg := Default()
+	cfg.Targets = map[string]DatabaseConfig{
+		"staging":    {Host: "staging.internal"},
+		"production": {Port: "6432"},
+	}
+
+	if err := cfg.UseTarget("staging"); err != nil {
+		t.Fatalf("UseTarget(staging): %v", err)
+	}
+	if err := cfg.UseTarget("production"); err != nil {
+		t.Fatalf("UseTarget(production): %v", err)
+	}
+	// Targets apply to the database section, not to the previous target
+	if cfg.Target != "production" || cfg.Database.Host != "localhost" || cfg.Database.Port != "6432" {
+		t.Errorf("Target, Host, Port = %q, %q, %q, want production, localhost, 6432", cfg.Target, cfg.Database.Host, cfg.Database.Port)
+	}
+	if err := cfg.UseTarget("qa"); err == nil {
+		t.Error("UseTarget(qa) = nil, want an error")
+	}
+}
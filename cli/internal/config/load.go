@@ -0,0 +1,377 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cli/internal/logger"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Source records where the loaded configuration came from.
+type Source struct {
+	File     string   // empty when no config file was found
+	Profile  string   // empty when no profile was applied
+	Profiles []string // profiles defined in the file
+	Target   string   // empty when the database section is used as is
+	Env      []string // environment variables that overrode a setting
+}
+
+// yamlFile and tomlFile are the on-disk layouts: the settings at the top
+// level, then named profiles that override them per environment, e.g.
+//
+//	rules:
+//	  min_calls: 5
+//	profile: dev
+//	profiles:
+//	  prod:
+//	    database:
+//	      host: db.internal
+//	    rules:
+//	      min_calls: 50
+type yamlFile struct {
+	Config   `yaml:",inline"`
+	Profile  string               `yaml:"profile"`
+	Profiles map[string]yaml.Node `yaml:"profiles"`
+}
+
+type tomlFile struct {
+	Config
+	Profile  string                    `toml:"profile"`
+	Profiles map[string]toml.Primitive `toml:"profiles"`
+}
+
+// Load builds the configuration: defaults, then the config file, then the
+// selected profile, then environment variables, then the selected target.
+// path may be empty, in which case $OPTIDB_CONFIG and the default locations
+// are tried and a missing file is not an error. profile and target may be
+// empty, in which case $OPTIDB_PROFILE and $OPTIDB_TARGET, then the file's
+// "profile" and "target" keys are used.
+func Load(path, profile, target string) (*Config, *Source, error) {
+	cfg := Default()
+	source := &Source{}
+
+	explicit := path != ""
+	if !explicit {
+		path = os.Getenv("OPTIDB_CONFIG")
+		explicit = path != ""
+	}
+	if !explicit {
+		path = findConfigFile()
+	}
+	if profile == "" {
+		profile = os.Getenv("OPTIDB_PROFILE")
+	}
+
+	if path != "" {
+		logger.LogInfof("Loading config file %s", path)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+
+		var profiles []string
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml":
+			profile, profiles, err = decodeYAML(data, cfg, profile)
+		case ".toml":
+			profile, profiles, err = decodeTOML(data, cfg, profile)
+		default:
+			err = fmt.Errorf("unsupported config format %q (use .yaml, .yml or .toml)", filepath.Ext(path))
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+		source.File = path
+		source.Profiles = profiles
+	} else if profile != "" {
+		return nil, nil, fmt.Errorf("profile %q requested but no config file was found", profile)
+	}
+	source.Profile = profile
+
+	env, err := applyEnv(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	source.Env = env
+
+	if target == "" {
+		target = os.Getenv("OPTIDB_TARGET")
+	}
+	if target == "" {
+		target = cfg.Target
+	}
+	if target != "" {
+		if err := cfg.UseTarget(target); err != nil {
+			return nil, nil, err
+		}
+		logger.LogInfof("Using target %s", target)
+	}
+	source.Target = target
+
+	return cfg, source, nil
+}
+
+// findConfigFile returns the first config file in the default locations
+func findConfigFile() string {
+	candidates := []string{"optidb.yaml", "optidb.yml", "optidb.toml"}
+	if home, err := os.UserHomeDir(); err == nil {
+		dir := filepath.Join(home, ".config", "optidb")
+		candidates = append(candidates,
+			filepath.Join(dir, "config.yaml"),
+			filepath.Join(dir, "config.yml"),
+			filepath.Join(dir, "config.toml"),
+		)
+	}
+
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return ""
+}
+
+func decodeYAML(data []byte, cfg *Config, profile string) (string, []string, error) {
+	file := yamlFile{Config: *cfg}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) { // io.EOF: empty file
+		return "", nil, err
+	}
+	*cfg = file.Config
+
+	if profile == "" {
+		profile = file.Profile
+	}
+
+	// Every profile is decoded strictly so that a typo in one that is not
+	// selected still fails validation.
+	names := make([]string, 0, len(file.Profiles))
+	for name, node := range file.Profiles {
+		names = append(names, name)
+		target := Default()
+		if name == profile {
+			target = cfg
+		}
+		raw, err := yaml.Marshal(&node)
+		if err != nil {
+			return "", nil, fmt.Errorf("profile %s: %w", name, err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(raw))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(target); err != nil {
+			return "", nil, fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+	sort.Strings(names)
+
+	if profile != "" && !slices.Contains(names, profile) {
+		return "", nil, fmt.Errorf("unknown profile %q (defined: %v)", profile, names)
+	}
+	return profile, names, nil
+}
+
+func decodeTOML(data []byte, cfg *Config, profile string) (string, []string, error) {
+	file := tomlFile{Config: *cfg}
+	md, err := toml.Decode(string(data), &file)
+	if err != nil {
+		return "", nil, err
+	}
+	*cfg = file.Config
+
+	if profile == "" {
+		profile = file.Profile
+	}
+
+	names := make([]string, 0, len(file.Profiles))
+	for name, primitive := range file.Profiles {
+		names = append(names, name)
+		target := Default()
+		if name == profile {
+			target = cfg
+		}
+		if err := md.PrimitiveDecode(primitive, target); err != nil {
+			return "", nil, fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+	sort.Strings(names)
+
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, key := range undecoded {
+			keys[i] = key.String()
+		}
+		return "", nil, fmt.Errorf("unknown keys: %s", strings.Join(keys, ", "))
+	}
+	if profile != "" && !slices.Contains(names, profile) {
+		return "", nil, fmt.Errorf("unknown profile %q (defined: %v)", profile, names)
+	}
+	return profile, names, nil
+}
+
+// envVars are the environment variables that override the config file. The
+// POSTGRES_*, OPTIDB_META_* and AZURE_OPENAI_* names predate the config file.
+var envVars = []struct {
+	name string
+	set  func(cfg *Config, value string) error
+}{
+	{"POSTGRES_HOST", setString(func(c *Config) *string { return &c.Database.Host })},
+	{"POSTGRES_PORT", setString(func(c *Config) *string { return &c.Database.Port })},
+	{"POSTGRES_DB", setString(func(c *Config) *string { return &c.Database.Name })},
+	{"POSTGRES_USER", setString(func(c *Config) *string { return &c.Database.User })},
+	{"POSTGRES_PASSWORD", setString(func(c *Config) *string { return &c.Database.Password })},
+	{"OPTIDB_ENGINE", setString(func(c *Config) *string { return &c.Database.Engine })},
+	{"OPTIDB_DSN", setString(func(c *Config) *string { return &c.Database.DSN })},
+	{"OPTIDB_PASSWORD_FILE", setString(func(c *Config) *string { return &c.Database.PasswordFile })},
+	{"OPTIDB_PASSWORD_COMMAND", setString(func(c *Config) *string { return &c.Database.PasswordCommand })},
+	{"OPTIDB_SSL_MODE", setString(func(c *Config) *string { return &c.Database.SSLMode })},
+	{"OPTIDB_SSL_ROOT_CERT", setString(func(c *Config) *string { return &c.Database.SSLRootCert })},
+	{"OPTIDB_SSL_CERT", setString(func(c *Config) *string { return &c.Database.SSLCert })},
+	{"OPTIDB_SSL_KEY", setString(func(c *Config) *string { return &c.Database.SSLKey })},
+	{"OPTIDB_PROFILER_USER", setString(func(c *Config) *string { return &c.Database.Profiler.User })},
+	{"OPTIDB_PROFILER_PASSWORD", setString(func(c *Config) *string { return &c.Database.Profiler.Password })},
+	{"OPTIDB_PROFILER_PASSWORD_FILE", setString(func(c *Config) *string { return &c.Database.Profiler.PasswordFile })},
+	{"OPTIDB_PROFILER_PASSWORD_COMMAND", setString(func(c *Config) *string { return &c.Database.Profiler.PasswordCommand })},
+	{"OPTIDB_SANDBOX_USER", setString(func(c *Config) *string { return &c.Database.Sandbox.User })},
+	{"OPTIDB_SANDBOX_PASSWORD", setString(func(c *Config) *string { return &c.Database.Sandbox.Password })},
+	{"OPTIDB_SANDBOX_PASSWORD_FILE", setString(func(c *Config) *string { return &c.Database.Sandbox.PasswordFile })},
+	{"OPTIDB_SANDBOX_PASSWORD_COMMAND", setString(func(c *Config) *string { return &c.Database.Sandbox.PasswordCommand })},
+	{"OPTIDB_META_DSN", setString(func(c *Config) *string { return &c.Database.Meta.DSN })},
+	{"OPTIDB_META_HOST", setString(func(c *Config) *string { return &c.Database.Meta.Host })},
+	{"OPTIDB_META_PORT", setString(func(c *Config) *string { return &c.Database.Meta.Port })},
+	{"OPTIDB_META_DB", setString(func(c *Config) *string { return &c.Database.Meta.Name })},
+	{"OPTIDB_META_USER", setString(func(c *Config) *string { return &c.Database.Meta.User })},
+	{"OPTIDB_META_PASSWORD", setString(func(c *Config) *string { return &c.Database.Meta.Password })},
+
+	{"OPTIDB_MIN_TABLE_ROWS", setInt64(func(c *Config) *int64 { return &c.Rules.MinTableRows })},
+	{"OPTIDB_MIN_MEAN_TIME_MS", setFloat(func(c *Config) *float64 { return &c.Rules.MinMeanTimeMS })},
+	{"OPTIDB_MIN_CALLS", setInt64(func(c *Config) *int64 { return &c.Rules.MinCalls })},
+	{"OPTIDB_SLOW_QUERY_LIMIT", setInt(func(c *Config) *int { return &c.Rules.SlowQueryLimit })},
+	{"OPTIDB_MAX_SELECTIVITY", setFloat(func(c *Config) *float64 { return &c.Rules.MaxSelectivity })},
+	{"OPTIDB_DISABLED_RULES", setList(func(c *Config) *[]string { return &c.Rules.Disabled })},
+
+	{"OPTIDB_AI_ENABLED", setBool(func(c *Config) *bool { return &c.AI.Enabled })},
+	{"AZURE_OPENAI_ENDPOINT", setString(func(c *Config) *string { return &c.AI.Endpoint })},
+	{"AZURE_OPENAI_API_KEY", setString(func(c *Config) *string { return &c.AI.APIKey })},
+	{"AZURE_OPENAI_API_VERSION", setString(func(c *Config) *string { return &c.AI.APIVersion })},
+	{"AZURE_OPENAI_CHAT_DEPLOYMENT_NAME", setString(func(c *Config) *string { return &c.AI.Deployment })},
+	{"OPTIDB_AI_MAX_TOKENS", setInt(func(c *Config) *int { return &c.AI.MaxTokens })},
+	{"OPTIDB_AI_TEMPERATURE", setFloat(func(c *Config) *float64 { return &c.AI.Temperature })},
+	{"OPTIDB_AI_TIMEOUT", setDuration(func(c *Config) *time.Duration { return &c.AI.Timeout })},
+
+	{"OPTIDB_PORT", setString(func(c *Config) *string { return &c.Server.Port })},
+	{"OPTIDB_SAMPLE_INTERVAL", setDuration(func(c *Config) *time.Duration { return &c.Server.SampleInterval })},
+	{"OPTIDB_ACTIVITY_INTERVAL", setDuration(func(c *Config) *time.Duration { return &c.Server.ActivityInterval })},
+	{"OPTIDB_ALLOW_ORIGINS", setString(func(c *Config) *string { return &c.Server.AllowOrigins })},
+}
+
+// EnvVars lists the environment variables that override settings
+func EnvVars() []string {
+	names := make([]string, len(envVars))
+	for i, v := range envVars {
+		names[i] = v.name
+	}
+	return names
+}
+
+func applyEnv(cfg *Config) ([]string, error) {
+	var applied []string
+	for _, v := range envVars {
+		value := os.Getenv(v.name)
+		if value == "" {
+			continue
+		}
+		if err := v.set(cfg, value); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", v.name, err)
+		}
+		applied = append(applied, v.name)
+	}
+	return applied, nil
+}
+
+func setString(field func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func setInt(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func setInt64(field func(*Config) *int64) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func setFloat(field func(*Config) *float64) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		*field(c) = f
+		return nil
+	}
+}
+
+func setBool(field func(*Config) *bool) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+func setDuration(field func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+func setList(field func(*Config) *[]string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*field(c) = items
+		return nil
+	}
+}
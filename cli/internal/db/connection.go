@@ -3,47 +3,181 @@ package db
 import (
 	"database/sql"
 	"fmt"
-	"os"
 
+	"cli/internal/config"
 	"cli/internal/logger"
 
+	"github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
 )
 
+// Config describes one connection. DSN, when set, is either a postgres://
+// URL or a libpq key=value string; the other fields override what it says.
+// The password is taken from PasswordCommand, then PasswordFile, then
+// Password; when all are empty lib/pq falls back to .pgpass (or $PGPASSFILE).
 type Config struct {
-	Host     string
-	Port     string
-	Database string
-	Username string
-	Password string
+	Engine          string // config.EnginePostgres (default) or config.EngineMySQL
+	DSN             string
+	Host            string
+	Port            string
+	Database        string
+	Username        string
+	Password        string
+	PasswordFile    string
+	PasswordCommand string
+	SSLMode         string // disable (default), require, verify-ca or verify-full
+	SSLRootCert     string
+	SSLCert         string
+	SSLKey          string
 }
 
+// NewConfig returns the admin connection settings of the active target from
+// the loaded configuration (config file, then POSTGRES_* environment
+// variables). With a DSN, host, port, database, user and password come from
+// the DSN rather than from the defaults.
 func NewConfig() *Config {
-	return &Config{
-		Host:     getEnv("POSTGRES_HOST", "localhost"),
-		Port:     getEnv("POSTGRES_PORT", "5432"),
-		Database: getEnv("POSTGRES_DB", "optidb"),
-		Username: getEnv("POSTGRES_USER", "postgres"),
-		Password: getEnv("POSTGRES_PASSWORD", "postgres"),
+	settings := config.Get().Database
+	cfg := &Config{
+		Engine:          settings.Engine,
+		DSN:             settings.DSN,
+		PasswordFile:    settings.PasswordFile,
+		PasswordCommand: settings.PasswordCommand,
+		SSLMode:         settings.SSLMode,
+		SSLRootCert:     settings.SSLRootCert,
+		SSLCert:         settings.SSLCert,
+		SSLKey:          settings.SSLKey,
 	}
+	if settings.DSN == "" {
+		cfg.Host = settings.Host
+		cfg.Port = settings.Port
+		cfg.Database = settings.Name
+		cfg.Username = settings.User
+		cfg.Password = settings.Password
+	}
+	return cfg
+}
+
+// withRole returns a copy of the config that logs in as another role,
+// unless the DSN carries a user or password of its own
+func (c *Config) withRole(role config.RoleConfig) *Config {
+	cfg := *c
+	if c.dsnHasCredentials() {
+		return &cfg
+	}
+	cfg.Username = role.User
+	cfg.Password = role.Password
+	cfg.PasswordFile = role.PasswordFile
+	cfg.PasswordCommand = role.PasswordCommand
+	return &cfg
+}
+
+// dsnHasCredentials reports whether the DSN names a user or a password. An
+// invalid DSN has none; connecting reports the parse error.
+func (c *Config) dsnHasCredentials() bool {
+	if c.DSN == "" {
+		return false
+	}
+	if c.Engine == config.EngineMySQL {
+		parsed, err := mysql.ParseDSN(c.DSN)
+		return err == nil && (parsed.User != "" || parsed.Passwd != "")
+	}
+	params, err := parseDSN(c.DSN)
+	return err == nil && (params["user"] != "" || params["password"] != "")
 }
 
-func (c *Config) ConnectionString() string {
-	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		c.Host, c.Port, c.Username, c.Password, c.Database)
+// ConnectionString renders the config as a libpq key=value string,
+// resolving the password from its file or command.
+func (c *Config) ConnectionString() (string, error) {
+	params, err := c.params()
+	if err != nil {
+		return "", err
+	}
+
+	password, err := c.password()
+	if err != nil {
+		return "", err
+	}
+	if password != "" {
+		params["password"] = password
+	}
+	return formatKeyValue(params), nil
 }
 
-func Connect(config *Config) (*sql.DB, error) {
-	logger.LogInfof("Attempting to connect to database: %s:%s/%s as user %s",
-		config.Host, config.Port, config.Database, config.Username)
+// params merges the DSN with the explicit fields, without the password
+// sources, which are resolved only when connecting.
+func (c *Config) params() (map[string]string, error) {
+	params := map[string]string{}
+	if c.DSN != "" {
+		parsed, err := parseDSN(c.DSN)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DSN: %w", err)
+		}
+		params = parsed
+	}
+
+	set := func(key, value string) {
+		if value != "" {
+			params[key] = value
+		}
+	}
+	set("host", c.Host)
+	set("port", c.Port)
+	set("dbname", c.Database)
+	set("user", c.Username)
+	set("sslmode", c.SSLMode)
+	set("sslrootcert", c.SSLRootCert)
+	set("sslcert", c.SSLCert)
+	set("sslkey", c.SSLKey)
+
+	// lib/pq defaults to sslmode=require; optidb has always connected
+	// without TLS unless told otherwise.
+	if params["sslmode"] == "" {
+		params["sslmode"] = "disable"
+	}
+	return params, nil
+}
 
-	db, err := sql.Open("postgres", config.ConnectionString())
+// String describes the connection for logs, without the password
+func (c *Config) String() string {
+	if c.Engine == config.EngineMySQL {
+		return c.mysqlString()
+	}
+	params, err := c.params()
 	if err != nil {
-		logger.LogErrorf("Failed to open database connection: %v", err)
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return "invalid DSN"
+	}
+	return fmt.Sprintf("%s:%s/%s as user %s (sslmode=%s)",
+		orDefault(params["host"], "localhost"), orDefault(params["port"], "5432"),
+		params["dbname"], params["user"], params["sslmode"])
+}
+
+func Connect(cfg *Config) (*sql.DB, error) {
+	logger.LogInfof("Attempting to connect to database: %s", cfg)
+
+	var db *sql.DB
+	if cfg.Engine == config.EngineMySQL {
+		connector, err := cfg.mysqlConnector()
+		if err != nil {
+			logger.LogErrorf("Failed to build MySQL connection: %v", err)
+			return nil, fmt.Errorf("failed to build MySQL connection: %w", err)
+		}
+		db = sql.OpenDB(connector)
+	} else {
+		connStr, err := cfg.ConnectionString()
+		if err != nil {
+			logger.LogErrorf("Failed to build connection string: %v", err)
+			return nil, fmt.Errorf("failed to build connection string: %w", err)
+		}
+
+		db, err = sql.Open("postgres", connStr)
+		if err != nil {
+			logger.LogErrorf("Failed to open database connection: %v", err)
+			return nil, fmt.Errorf("failed to open database: %w", err)
+		}
 	}
 
 	if err := db.Ping(); err != nil {
+		db.Close()
 		logger.LogErrorf("Failed to ping database: %v", err)
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
@@ -52,20 +186,52 @@ func Connect(config *Config) (*sql.DB, error) {
 	return db, nil
 }
 
+// ConnectAsProfiler connects as the read-only profiler role
+// (database.profiler, profiler_ro by default), or with the credentials of
+// the DSN when it has them.
 func ConnectAsProfiler() (*sql.DB, error) {
-	logger.LogInfo("Connecting as profiler_ro user")
-	config := &Config{
-		Host:     getEnv("POSTGRES_HOST", "localhost"),
-		Port:     getEnv("POSTGRES_PORT", "5432"),
-		Database: getEnv("POSTGRES_DB", "optidb"),
-		Username: "profiler_ro",
-		Password: "profiler_ro_pass",
-	}
-	return Connect(config)
+	role := config.Get().Database.Profiler
+	logger.LogInfof("Connecting as %s user", role.User)
+	return Connect(NewConfig().withRole(role))
+}
+
+// ConnectAsSandbox connects as the role allowed to run hypopg simulations
+// (database.sandbox, profiler_sb by default), or with the credentials of
+// the DSN when it has them.
+func ConnectAsSandbox() (*sql.DB, error) {
+	role := config.Get().Database.Sandbox
+	logger.LogInfof("Connecting as %s user", role.User)
+	return Connect(NewConfig().withRole(role))
+}
+
+// ConnectMetaStore connects to the database that holds the optidb_meta schema.
+// The profiler roles are read-only, so this uses the database.meta settings
+// (OPTIDB_META_*) and falls back to the admin settings of the active target.
+func ConnectMetaStore() (*sql.DB, error) {
+	logger.LogInfo("Connecting to meta store")
+	meta := config.Get().Database.Meta
+	cfg := NewConfig()
+	// The meta store is always PostgreSQL, even when profiling MySQL
+	if meta.DSN != "" || cfg.Engine == config.EngineMySQL {
+		if meta.DSN == "" && meta.Host == "" {
+			return nil, fmt.Errorf("the meta store must be PostgreSQL: set database.meta when profiling MySQL")
+		}
+		cfg = &Config{DSN: meta.DSN}
+	}
+	cfg.Host = orDefault(meta.Host, cfg.Host)
+	cfg.Port = orDefault(meta.Port, cfg.Port)
+	cfg.Database = orDefault(meta.Name, cfg.Database)
+	cfg.Username = orDefault(meta.User, cfg.Username)
+	if meta.Password != "" || meta.PasswordFile != "" || meta.PasswordCommand != "" {
+		cfg.Password = meta.Password
+		cfg.PasswordFile = meta.PasswordFile
+		cfg.PasswordCommand = meta.PasswordCommand
+	}
+	return Connect(cfg)
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
+func orDefault(value, defaultValue string) string {
+	if value != "" {
 		return value
 	}
 	return defaultValue
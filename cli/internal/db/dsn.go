@@ -0,0 +1,133 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// passwordCommandTimeout bounds password_command, e.g. a vault or cloud CLI
+const passwordCommandTimeout = 30 * time.Second
+
+// password resolves the password from the most specific source configured
+func (c *Config) password() (string, error) {
+	switch {
+	case c.PasswordCommand != "":
+		return runPasswordCommand(c.PasswordCommand)
+	case c.PasswordFile != "":
+		data, err := os.ReadFile(c.PasswordFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read password file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	return c.Password, nil
+}
+
+// runPasswordCommand runs command with the shell and returns the first line
+// it prints.
+func runPasswordCommand(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), passwordCommandTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("password command failed: %w: %s", err, msg)
+		}
+		return "", fmt.Errorf("password command failed: %w", err)
+	}
+
+	password, _, _ := strings.Cut(stdout.String(), "\n")
+	password = strings.TrimRight(password, "\r")
+	if password == "" {
+		return "", fmt.Errorf("password command printed nothing")
+	}
+	return password, nil
+}
+
+// parseDSN parses a postgres:// URL or a libpq key=value string
+func parseDSN(dsn string) (map[string]string, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		converted, err := pq.ParseURL(dsn)
+		if err != nil {
+			return nil, err
+		}
+		dsn = converted
+	}
+	return parseKeyValue(dsn)
+}
+
+// parseKeyValue parses key=value pairs separated by spaces, where values may
+// be single-quoted with backslash escapes, as libpq does.
+func parseKeyValue(s string) (map[string]string, error) {
+	params := map[string]string{}
+	i := 0
+	for {
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+		if i >= len(s) {
+			return params, nil
+		}
+
+		eq := strings.IndexByte(s[i:], '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("missing \"=\" after %q", s[i:])
+		}
+		key := strings.TrimSpace(s[i : i+eq])
+		i += eq + 1
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+
+		var value strings.Builder
+		if i < len(s) && s[i] == '\'' {
+			i++
+			for ; i < len(s) && s[i] != '\''; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				value.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated quoted value for %s", key)
+			}
+			i++
+		} else {
+			for ; i < len(s) && s[i] != ' '; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				value.WriteByte(s[i])
+			}
+		}
+		params[key] = value.String()
+	}
+}
+
+// formatKeyValue renders params as a libpq key=value string in a stable order
+func formatKeyValue(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	quoter := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprintf("%s='%s'", key, quoter.Replace(params[key]))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql/driver"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysqlConfig merges the DSN with the explicit fields, like params does for
+// PostgreSQL, without resolving the password.
+func (c *Config) mysqlConfig() (*mysql.Config, error) {
+	cfg := mysql.NewConfig()
+	if c.DSN != "" {
+		parsed, err := mysql.ParseDSN(c.DSN)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DSN: %w", err)
+		}
+		cfg = parsed
+	}
+
+	if c.Host != "" || c.Port != "" {
+		host, port, err := net.SplitHostPort(cfg.Addr)
+		if err != nil || cfg.Net != "tcp" {
+			host, port = "127.0.0.1", "3306"
+		}
+		cfg.Net = "tcp"
+		cfg.Addr = net.JoinHostPort(orDefault(c.Host, host), orDefault(c.Port, port))
+	}
+	if c.Username != "" {
+		cfg.User = c.Username
+	}
+	if c.Database != "" {
+		cfg.DBName = c.Database
+	}
+	cfg.ParseTime = true
+	return cfg, nil
+}
+
+// mysqlConnector builds the connector for a MySQL or MariaDB server. TLS
+// follows the PostgreSQL sslmode names so one config covers both engines.
+func (c *Config) mysqlConnector() (driver.Connector, error) {
+	cfg, err := c.mysqlConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := c.password()
+	if err != nil {
+		return nil, err
+	}
+	if password != "" {
+		cfg.Passwd = password
+	}
+
+	if c.SSLMode != "" && c.SSLMode != "disable" {
+		host, _, _ := net.SplitHostPort(cfg.Addr)
+		tlsConfig, err := c.mysqlTLS(host)
+		if err != nil {
+			return nil, err
+		}
+		cfg.TLS = tlsConfig
+	}
+
+	return mysql.NewConnector(cfg)
+}
+
+func (c *Config) mysqlTLS(host string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{ServerName: host}
+
+	if c.SSLRootCert != "" {
+		pem, err := os.ReadFile(c.SSLRootCert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ssl root cert: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.SSLRootCert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if c.SSLCert != "" {
+		cert, err := tls.LoadX509KeyPair(c.SSLCert, c.SSLKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	switch c.SSLMode {
+	case "require":
+		tlsConfig.InsecureSkipVerify = true
+	case "verify-ca":
+		// Check the chain but not the host name, as libpq does
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyChain(rawCerts, tlsConfig.RootCAs)
+		}
+	}
+	return tlsConfig, nil
+}
+
+func verifyChain(rawCerts [][]byte, roots *x509.CertPool) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("server sent no certificate")
+	}
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs[i] = cert
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	return err
+}
+
+func (c *Config) mysqlString() string {
+	cfg, err := c.mysqlConfig()
+	if err != nil {
+		return "invalid DSN"
+	}
+	return fmt.Sprintf("mysql %s/%s as user %s (sslmode=%s)",
+		cfg.Addr, cfg.DBName, cfg.User, orDefault(c.SSLMode, "disable"))
+}
@@ -0,0 +1,94 @@
+package explain
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// AutoExplain is the body of an auto_explain log message, the part after
+// "duration: ... ms  plan:".
+type AutoExplain struct {
+	QueryText string
+	// Parameters holds "$1 = '42'" style values, logged by PostgreSQL 16+
+	// when auto_explain.log_parameter_max_length allows it
+	Parameters string
+	Format     string
+	Plan       *Plan
+}
+
+// ParseAutoExplain handles both auto_explain.log_format = text and json.
+// XML is rejected; YAML fails as a text plan with no nodes.
+func ParseAutoExplain(body string) (*AutoExplain, error) {
+	body = strings.TrimSpace(body)
+	if strings.HasPrefix(body, "{") {
+		return parseAutoExplainJSON(body)
+	}
+	if strings.HasPrefix(body, "<") {
+		return nil, fmt.Errorf("unsupported auto_explain log_format")
+	}
+	return parseAutoExplainText(body)
+}
+
+func parseAutoExplainJSON(body string) (*AutoExplain, error) {
+	var header struct {
+		QueryText  string `json:"Query Text"`
+		Parameters string `json:"Query Parameters"`
+	}
+	if err := json.Unmarshal([]byte(body), &header); err != nil {
+		return nil, fmt.Errorf("failed to parse auto_explain JSON: %w", err)
+	}
+
+	plan, err := Parse(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AutoExplain{
+		QueryText:  header.QueryText,
+		Parameters: header.Parameters,
+		Format:     "json",
+		Plan:       plan,
+	}, nil
+}
+
+// parseAutoExplainText splits the text body into the query, which may span
+// several lines, and the plan tree that starts at the first node line.
+func parseAutoExplainText(body string) (*AutoExplain, error) {
+	ae := &AutoExplain{Format: "text"}
+
+	lines := strings.Split(body, "\n")
+	var query []string
+	inQuery := false
+	planStart := -1
+
+	for i, line := range lines {
+		if textNodePattern.MatchString(line) {
+			planStart = i
+			break
+		}
+
+		switch {
+		case strings.HasPrefix(line, "Query Text: "):
+			query = append(query, strings.TrimPrefix(line, "Query Text: "))
+			inQuery = true
+		case strings.HasPrefix(line, "Query Parameters: "):
+			ae.Parameters = strings.TrimPrefix(line, "Query Parameters: ")
+			inQuery = false
+		case inQuery:
+			query = append(query, line)
+		}
+	}
+	if planStart < 0 {
+		return nil, fmt.Errorf("auto_explain message contains no plan")
+	}
+
+	plan, err := ParseText(strings.Join(lines[planStart:], "\n"))
+	if err != nil {
+		return nil, err
+	}
+
+	ae.QueryText = strings.TrimSpace(strings.Join(query, "\n"))
+	ae.Plan = plan
+	return ae, nil
+}
@@ -0,0 +1,235 @@
+package explain
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cli/internal/logger"
+)
+
+var placeholderPattern = regexp.MustCompile(`\$(\d+)`)
+
+// Options control how plans are captured. Analyze actually executes the
+// statement, so it is opt-in and limited to read-only statements.
+type Options struct {
+	Analyze          bool
+	Buffers          bool
+	StatementTimeout time.Duration
+}
+
+func DefaultOptions() Options {
+	return Options{
+		StatementTimeout: 5 * time.Second,
+	}
+}
+
+// Planner produces the plan for a statement. Explainer asks the server; an
+// offline snapshot export returns the plans recorded when it was taken.
+type Planner interface {
+	Explain(query string) (*Plan, error)
+}
+
+type Explainer struct {
+	db   *sql.DB
+	opts Options
+
+	// The HTTP handlers explain concurrently; a failed lookup is retried
+	versionMu     sync.Mutex
+	serverVersion int
+}
+
+func NewExplainer(db *sql.DB, opts Options) *Explainer {
+	if opts.StatementTimeout <= 0 {
+		opts.StatementTimeout = DefaultOptions().StatementTimeout
+	}
+	return &Explainer{db: db, opts: opts}
+}
+
+// Explain captures the plan for a statement. Normalized pg_stat_statements
+// text ($1, $2, ...) is planned generically: with EXPLAIN (GENERIC_PLAN) on
+// PostgreSQL 16+, or via PREPARE and plan_cache_mode = force_generic_plan on
+// older servers. Everything runs in a read-only transaction that is always
+// rolled back, under a local statement_timeout.
+func (e *Explainer) Explain(query string) (*Plan, error) {
+	query = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(query), ";"))
+	if !isExplainable(query) {
+		return nil, fmt.Errorf("statement type cannot be explained")
+	}
+
+	params := countPlaceholders(query)
+	analyze := e.opts.Analyze
+	if analyze && params > 0 {
+		logger.LogDebug("Skipping ANALYZE for parameterized statement, using generic plan")
+		analyze = false
+	}
+	if analyze && !isReadOnly(query) {
+		return nil, fmt.Errorf("EXPLAIN ANALYZE is only allowed for read-only statements")
+	}
+
+	version, err := e.version()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.opts.StatementTimeout+time.Second)
+	defer cancel()
+
+	// A dedicated connection keeps PREPARE/DEALLOCATE on the same session
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	return e.explainOn(ctx, conn, query, params, analyze, version)
+}
+
+// ExplainOn is Explain on a caller-held connection, for callers that set up
+// session state the plan must see, such as hypopg hypothetical indexes.
+// ANALYZE is never used here since it would not reflect that state.
+func (e *Explainer) ExplainOn(conn *sql.Conn, query string) (*Plan, error) {
+	query = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(query), ";"))
+	if !isExplainable(query) {
+		return nil, fmt.Errorf("statement type cannot be explained")
+	}
+
+	version, err := e.version()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.opts.StatementTimeout+time.Second)
+	defer cancel()
+
+	return e.explainOn(ctx, conn, query, countPlaceholders(query), false, version)
+}
+
+func (e *Explainer) explainOn(ctx context.Context, conn *sql.Conn, query string, params int, analyze bool, version int) (*Plan, error) {
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin explain transaction: %w", err)
+	}
+
+	prepared := false
+	defer func() {
+		tx.Rollback()
+		if prepared {
+			// PREPARE is session-scoped and survives the rollback
+			conn.ExecContext(context.Background(), "DEALLOCATE optidb_explain")
+		}
+	}()
+
+	timeoutMS := e.opts.StatementTimeout.Milliseconds()
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", timeoutMS)); err != nil {
+		return nil, fmt.Errorf("failed to set statement_timeout: %w", err)
+	}
+
+	options := []string{"FORMAT JSON"}
+	if analyze {
+		options = append(options, "ANALYZE")
+		if e.opts.Buffers {
+			options = append(options, "BUFFERS")
+		}
+	}
+
+	var explainSQL string
+	switch {
+	case params == 0:
+		explainSQL = fmt.Sprintf("EXPLAIN (%s) %s", strings.Join(options, ", "), query)
+	case version >= 160000:
+		options = append(options, "GENERIC_PLAN")
+		explainSQL = fmt.Sprintf("EXPLAIN (%s) %s", strings.Join(options, ", "), query)
+	default:
+		if _, err := tx.ExecContext(ctx, "SET LOCAL plan_cache_mode = force_generic_plan"); err != nil {
+			return nil, fmt.Errorf("failed to force generic plan: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, "PREPARE optidb_explain AS "+query); err != nil {
+			return nil, fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		prepared = true
+
+		args := make([]string, params)
+		for i := range args {
+			args[i] = "NULL"
+		}
+		explainSQL = fmt.Sprintf("EXPLAIN (%s) EXECUTE optidb_explain(%s)", strings.Join(options, ", "), strings.Join(args, ", "))
+	}
+
+	logger.LogDebugf("Running %s", explainSQL[:min(120, len(explainSQL))])
+
+	var raw string
+	if err := tx.QueryRowContext(ctx, explainSQL).Scan(&raw); err != nil {
+		logger.LogErrorf("EXPLAIN failed: %v", err)
+		return nil, fmt.Errorf("explain failed: %w", err)
+	}
+
+	return Parse(raw)
+}
+
+func (e *Explainer) version() (int, error) {
+	e.versionMu.Lock()
+	defer e.versionMu.Unlock()
+	if e.serverVersion != 0 {
+		return e.serverVersion, nil
+	}
+
+	var v string
+	if err := e.db.QueryRow(`SHOW server_version_num`).Scan(&v); err != nil {
+		return 0, fmt.Errorf("failed to read server version: %w", err)
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected server_version_num %q: %w", v, err)
+	}
+	e.serverVersion = n
+	return n, nil
+}
+
+// countPlaceholders returns the highest $N referenced by the statement.
+func countPlaceholders(query string) int {
+	highest := 0
+	for _, m := range placeholderPattern.FindAllStringSubmatch(query, -1) {
+		if n, err := strconv.Atoi(m[1]); err == nil && n > highest {
+			highest = n
+		}
+	}
+	return highest
+}
+
+func isExplainable(query string) bool {
+	switch firstKeyword(query) {
+	case "SELECT", "WITH", "INSERT", "UPDATE", "DELETE", "VALUES", "TABLE", "MERGE":
+		return true
+	}
+	return false
+}
+
+func isReadOnly(query string) bool {
+	switch firstKeyword(query) {
+	case "SELECT", "VALUES", "TABLE":
+		return !strings.Contains(strings.ToUpper(query), " FOR UPDATE")
+	case "WITH":
+		upper := strings.ToUpper(query)
+		for _, kw := range []string{"INSERT ", "UPDATE ", "DELETE ", "MERGE "} {
+			if strings.Contains(upper, kw) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func firstKeyword(query string) string {
+	fields := strings.Fields(strings.TrimLeft(query, "( \t\n"))
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(fields[0])
+}
@@ -0,0 +1,307 @@
+package explain
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"cli/internal/store"
+)
+
+// Node is one node of an EXPLAIN (FORMAT JSON) plan tree. Actual* and buffer
+// fields are only populated when the plan was captured with ANALYZE/BUFFERS.
+type Node struct {
+	NodeType           string   `json:"Node Type"`
+	ParentRelationship string   `json:"Parent Relationship,omitempty"`
+	Strategy           string   `json:"Strategy,omitempty"`
+	JoinType           string   `json:"Join Type,omitempty"`
+	RelationName       string   `json:"Relation Name,omitempty"`
+	Schema             string   `json:"Schema,omitempty"`
+	Alias              string   `json:"Alias,omitempty"`
+	IndexName          string   `json:"Index Name,omitempty"`
+	StartupCost        float64  `json:"Startup Cost"`
+	TotalCost          float64  `json:"Total Cost"`
+	PlanRows           float64  `json:"Plan Rows"`
+	PlanWidth          int64    `json:"Plan Width"`
+	ActualStartupTime  float64  `json:"Actual Startup Time,omitempty"`
+	ActualTotalTime    float64  `json:"Actual Total Time,omitempty"`
+	ActualRows         float64  `json:"Actual Rows,omitempty"`
+	ActualLoops        float64  `json:"Actual Loops,omitempty"`
+	Filter             string   `json:"Filter,omitempty"`
+	IndexCond          string   `json:"Index Cond,omitempty"`
+	RecheckCond        string   `json:"Recheck Cond,omitempty"`
+	HashCond           string   `json:"Hash Cond,omitempty"`
+	MergeCond          string   `json:"Merge Cond,omitempty"`
+	JoinFilter         string   `json:"Join Filter,omitempty"`
+	RowsRemovedFilter  float64  `json:"Rows Removed by Filter,omitempty"`
+	SortKey            []string `json:"Sort Key,omitempty"`
+	SortMethod         string   `json:"Sort Method,omitempty"`
+	SortSpaceUsed      int64    `json:"Sort Space Used,omitempty"`
+	SortSpaceType      string   `json:"Sort Space Type,omitempty"`
+	HashBatches        int64    `json:"Hash Batches,omitempty"`
+	PeakMemoryUsage    int64    `json:"Peak Memory Usage,omitempty"`
+	HashAggBatches     int64    `json:"HashAgg Batches,omitempty"`
+	DiskUsage          int64    `json:"Disk Usage,omitempty"`
+	SharedHitBlocks    int64    `json:"Shared Hit Blocks,omitempty"`
+	SharedReadBlocks   int64    `json:"Shared Read Blocks,omitempty"`
+	SharedDirtied      int64    `json:"Shared Dirtied Blocks,omitempty"`
+	SharedWritten      int64    `json:"Shared Written Blocks,omitempty"`
+	TempReadBlocks     int64    `json:"Temp Read Blocks,omitempty"`
+	TempWrittenBlocks  int64    `json:"Temp Written Blocks,omitempty"`
+	Plans              []Node   `json:"Plans,omitempty"`
+}
+
+// Plan is a parsed EXPLAIN result.
+type Plan struct {
+	Root          Node    `json:"Plan"`
+	PlanningTime  float64 `json:"Planning Time,omitempty"`
+	ExecutionTime float64 `json:"Execution Time,omitempty"`
+
+	// Raw is the JSON exactly as returned by the server
+	Raw string `json:"-"`
+}
+
+// Facts are the plan properties the rules and dashboard care about.
+type Facts struct {
+	HasSeqScan       bool     `json:"has_seq_scan"`
+	HasIndexScan     bool     `json:"has_index_scan"`
+	HasIndexOnlyScan bool     `json:"has_index_only_scan"`
+	HasBitmapScan    bool     `json:"has_bitmap_scan"`
+	SeqScanRelations []string `json:"seq_scan_relations,omitempty"`
+	IndexesUsed      []string `json:"indexes_used,omitempty"`
+	JoinTypes        []string `json:"join_types,omitempty"`
+	TotalCost        float64  `json:"total_cost"`
+	EstimatedRows    int64    `json:"estimated_rows"`
+	ActualRows       int64    `json:"actual_rows"`
+	// MaxRowSkew is the worst est-vs-actual ratio of any node, always >= 1.
+	// Zero when the plan was not analyzed.
+	MaxRowSkew    float64     `json:"max_row_skew"`
+	SkewedNode    string      `json:"skewed_node,omitempty"`
+	BuffersHit    int64       `json:"buffers_hit"`
+	BuffersRead   int64       `json:"buffers_read"`
+	TempBlocks    int64       `json:"temp_blocks"`
+	ExternalSort  bool        `json:"external_sort"`
+	Analyzed      bool        `json:"analyzed"`
+	ExecutionTime float64     `json:"execution_time,omitempty"`
+	PlanningTime  float64     `json:"planning_time,omitempty"`
+	NodeCount     int         `json:"node_count"`
+	RootNodeType  string      `json:"root_node_type"`
+	Nodes         []NodeFacts `json:"nodes"`
+}
+
+// NodeFacts is the per-node view of the plan, in depth-first order.
+type NodeFacts struct {
+	Label         string  `json:"label"`
+	Depth         int     `json:"depth"`
+	EstimatedRows int64   `json:"estimated_rows"`
+	ActualRows    int64   `json:"actual_rows,omitempty"`
+	RowSkew       float64 `json:"row_skew,omitempty"`
+	TotalCost     float64 `json:"total_cost"`
+	BuffersHit    int64   `json:"buffers_hit,omitempty"`
+	BuffersRead   int64   `json:"buffers_read,omitempty"`
+	TempBlocks    int64   `json:"temp_blocks,omitempty"`
+}
+
+// Spill is a sort or hash node that ran out of memory and wrote temporary
+// files. Sizes are in kB as EXPLAIN reports them: DiskKB is what a sort or
+// hash aggregate wrote, MemoryKB the peak memory of a hash node.
+type Spill struct {
+	Node     string `json:"node"`
+	Kind     string `json:"kind"` // sort, hash or aggregate
+	DiskKB   int64  `json:"disk_kb,omitempty"`
+	MemoryKB int64  `json:"memory_kb,omitempty"`
+	Batches  int64  `json:"batches,omitempty"`
+}
+
+// Parse decodes the JSON document produced by EXPLAIN (FORMAT JSON), which is
+// a one-element array wrapping the plan.
+func Parse(raw string) (*Plan, error) {
+	var plans []Plan
+	if err := json.Unmarshal([]byte(raw), &plans); err != nil {
+		// auto_explain and some tools emit the object without the array
+		var single Plan
+		if err2 := json.Unmarshal([]byte(raw), &single); err2 != nil {
+			return nil, fmt.Errorf("failed to parse plan JSON: %w", err)
+		}
+		plans = []Plan{single}
+	}
+	if len(plans) == 0 || plans[0].Root.NodeType == "" {
+		return nil, fmt.Errorf("plan JSON contains no plan")
+	}
+
+	plan := plans[0]
+	plan.Raw = raw
+	return &plan, nil
+}
+
+// Walk visits every node depth-first, parents before children.
+func (p *Plan) Walk(fn func(n *Node, depth int)) {
+	var walk func(n *Node, depth int)
+	walk = func(n *Node, depth int) {
+		fn(n, depth)
+		for i := range n.Plans {
+			walk(&n.Plans[i], depth+1)
+		}
+	}
+	walk(&p.Root, 0)
+}
+
+// Facts summarizes the plan tree. Buffer counts are taken from the root,
+// since PostgreSQL reports them cumulatively up the tree.
+func (p *Plan) Facts() Facts {
+	facts := Facts{
+		TotalCost:     p.Root.TotalCost,
+		EstimatedRows: int64(p.Root.PlanRows),
+		BuffersHit:    p.Root.SharedHitBlocks,
+		BuffersRead:   p.Root.SharedReadBlocks,
+		TempBlocks:    p.Root.TempReadBlocks + p.Root.TempWrittenBlocks,
+		Analyzed:      p.Root.ActualLoops > 0,
+		ExecutionTime: p.ExecutionTime,
+		PlanningTime:  p.PlanningTime,
+		RootNodeType:  p.Root.NodeType,
+	}
+	if facts.Analyzed {
+		facts.ActualRows = int64(p.Root.ActualRows * p.Root.ActualLoops)
+	}
+
+	p.Walk(func(n *Node, depth int) {
+		facts.NodeCount++
+		facts.Nodes = append(facts.Nodes, NodeFacts{
+			Label:         n.Label(),
+			Depth:         depth,
+			EstimatedRows: int64(n.PlanRows),
+			ActualRows:    int64(n.ActualRows),
+			RowSkew:       n.RowSkew(),
+			TotalCost:     n.TotalCost,
+			BuffersHit:    n.SharedHitBlocks,
+			BuffersRead:   n.SharedReadBlocks,
+			TempBlocks:    n.TempReadBlocks + n.TempWrittenBlocks,
+		})
+
+		switch n.NodeType {
+		case "Seq Scan", "Parallel Seq Scan":
+			facts.HasSeqScan = true
+			facts.SeqScanRelations = appendUnique(facts.SeqScanRelations, n.QualifiedRelation())
+		case "Index Scan":
+			facts.HasIndexScan = true
+			facts.IndexesUsed = appendUnique(facts.IndexesUsed, n.IndexName)
+		case "Index Only Scan":
+			facts.HasIndexScan = true
+			facts.HasIndexOnlyScan = true
+			facts.IndexesUsed = appendUnique(facts.IndexesUsed, n.IndexName)
+		case "Bitmap Index Scan":
+			facts.HasBitmapScan = true
+			facts.IndexesUsed = appendUnique(facts.IndexesUsed, n.IndexName)
+		case "Bitmap Heap Scan":
+			facts.HasBitmapScan = true
+		}
+
+		if n.IsJoin() {
+			facts.JoinTypes = appendUnique(facts.JoinTypes, n.NodeType)
+		}
+
+		if strings.Contains(n.SortMethod, "external") {
+			facts.ExternalSort = true
+		}
+
+		if skew := n.RowSkew(); skew > facts.MaxRowSkew {
+			facts.MaxRowSkew = skew
+			facts.SkewedNode = n.Label()
+		}
+	})
+
+	return facts
+}
+
+// Spills lists the nodes that spilled to disk. Only analyzed plans say so.
+func (p *Plan) Spills() []Spill {
+	var spills []Spill
+	p.Walk(func(n *Node, depth int) {
+		switch {
+		case n.SortSpaceType == "Disk":
+			spills = append(spills, Spill{Node: n.Label(), Kind: "sort", DiskKB: n.SortSpaceUsed})
+		case n.NodeType == "Hash" && n.HashBatches > 1:
+			spills = append(spills, Spill{Node: n.Label(), Kind: "hash", MemoryKB: n.PeakMemoryUsage, Batches: n.HashBatches})
+		case n.HashAggBatches > 1 || n.DiskUsage > 0:
+			spills = append(spills, Spill{Node: n.Label(), Kind: "aggregate", DiskKB: n.DiskUsage, MemoryKB: n.PeakMemoryUsage, Batches: n.HashAggBatches})
+		}
+	})
+	return spills
+}
+
+// ToQueryPlan converts the plan into its meta store form.
+func (p *Plan) ToQueryPlan() store.QueryPlan {
+	facts := p.Facts()
+	return store.QueryPlan{
+		PlanJSON:     p.Raw,
+		HadSeqScan:   facts.HasSeqScan,
+		HadIndexScan: facts.HasIndexScan || facts.HasBitmapScan,
+		JoinTypes:    facts.JoinTypes,
+		TotalCost:    facts.TotalCost,
+		EstRows:      facts.EstimatedRows,
+		ActRows:      facts.ActualRows,
+		MaxRowSkew:   facts.MaxRowSkew,
+		BuffersHit:   facts.BuffersHit,
+		BuffersRead:  facts.BuffersRead,
+		TempBlocks:   facts.TempBlocks,
+		Analyzed:     facts.Analyzed,
+		ExecutionMS:  facts.ExecutionTime,
+	}
+}
+
+// IsJoin reports whether the node joins its children.
+func (n *Node) IsJoin() bool {
+	switch n.NodeType {
+	case "Nested Loop", "Hash Join", "Merge Join":
+		return true
+	}
+	return false
+}
+
+// RowSkew is max(est, actual) / min(est, actual) for an analyzed node, with
+// both sides floored at one row. Actual rows are per loop, matching Plan Rows.
+func (n *Node) RowSkew() float64 {
+	if n.ActualLoops == 0 {
+		return 0
+	}
+	est := math.Max(n.PlanRows, 1)
+	act := math.Max(n.ActualRows, 1)
+	return math.Max(est, act) / math.Min(est, act)
+}
+
+// QualifiedRelation returns schema.relation when the schema is known.
+func (n *Node) QualifiedRelation() string {
+	if n.Schema != "" && n.RelationName != "" {
+		return n.Schema + "." + n.RelationName
+	}
+	return n.RelationName
+}
+
+// Label is a short human-readable description such as
+// "Index Scan using users_email_idx on users".
+func (n *Node) Label() string {
+	label := n.NodeType
+	if n.JoinType != "" && n.IsJoin() && n.JoinType != "Inner" {
+		label = n.NodeType + " (" + n.JoinType + ")"
+	}
+	if n.IndexName != "" {
+		label += " using " + n.IndexName
+	}
+	if n.RelationName != "" {
+		label += " on " + n.RelationName
+	}
+	return label
+}
+
+func appendUnique(slice []string, item string) []string {
+	if item == "" {
+		return slice
+	}
+	for _, s := range slice {
+		if s == item {
+			return slice
+		}
+	}
+	return append(slice, item)
+}
@@ -0,0 +1,102 @@
+package explain
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name          string
+		raw           string
+		wantRoot      string
+		wantExecution float64
+		wantErr       bool
+	}{
+		{
+			name:     "EXPLAIN array",
+			raw:      `[{"Plan": {"Node Type": "Seq Scan", "Relation Name": "orders", "Total Cost": 431.0, "Plan Rows": 10000}}]`,
+			wantRoot: "Seq Scan",
+		},
+		{
+			name:          "auto_explain object",
+			raw:           `{"Plan": {"Node Type": "Index Scan", "Index Name": "orders_pkey"}, "Execution Time": 0.042}`,
+			wantRoot:      "Index Scan",
+			wantExecution: 0.042,
+		},
+		{name: "invalid JSON", raw: `[{"Plan": `, wantErr: true},
+		{name: "empty array", raw: `[]`, wantErr: true},
+		{name: "no plan", raw: `{"Planning Time": 0.1}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := Parse(tt.raw)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Parse() = %+v, want an error", plan)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if plan.Root.NodeType != tt.wantRoot || plan.ExecutionTime != tt.wantExecution {
+				t.Errorf("Parse() root, execution = %q, %v, want %q, %v", plan.Root.NodeType, plan.ExecutionTime, tt.wantRoot, tt.wantExecution)
+			}
+			if plan.Raw != tt.raw {
+				t.Errorf("Parse() kept Raw = %q, want the input", plan.Raw)
+			}
+		})
+	}
+}
+
+func TestSpills(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want []Spill
+	}{
+		{
+			name: "in-memory plan",
+			raw: `[{"Plan": {"Node Type": "Sort", "Sort Space Used": 25, "Sort Space Type": "Memory", "Actual Loops": 1,
+				"Plans": [{"Node Type": "Seq Scan", "Relation Name": "orders", "Actual Loops": 1}]}}]`,
+		},
+		{
+			name: "external sort over a spilled aggregate",
+			raw: `[{"Plan": {"Node Type": "Sort", "Sort Method": "external merge", "Sort Space Used": 64000, "Sort Space Type": "Disk",
+				"Plans": [{"Node Type": "Aggregate", "Strategy": "Hashed", "HashAgg Batches": 5, "Peak Memory Usage": 4145, "Disk Usage": 12336,
+					"Plans": [{"Node Type": "Seq Scan", "Relation Name": "orders"}]}]}}]`,
+			want: []Spill{
+				{Node: "Sort", Kind: "sort", DiskKB: 64000},
+				{Node: "Aggregate", Kind: "aggregate", DiskKB: 12336, MemoryKB: 4145, Batches: 5},
+			},
+		},
+		{
+			name: "multi-batch hash join",
+			raw: `[{"Plan": {"Node Type": "Hash Join", "Join Type": "Left",
+				"Plans": [
+					{"Node Type": "Seq Scan", "Relation Name": "orders"},
+					{"Node Type": "Hash", "Hash Batches": 8, "Peak Memory Usage": 4097,
+						"Plans": [{"Node Type": "Seq Scan", "Relation Name": "customers"}]}]}}]`,
+			want: []Spill{{Node: "Hash", Kind: "hash", MemoryKB: 4097, Batches: 8}},
+		},
+		{
+			name: "single-batch hash",
+			raw: `[{"Plan": {"Node Type": "Hash", "Hash Batches": 1, "Peak Memory Usage": 1024,
+				"Plans": [{"Node Type": "Seq Scan", "Relation Name": "customers"}]}}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := Parse(tt.raw)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := plan.Spills(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Spills() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
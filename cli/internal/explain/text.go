@@ -0,0 +1,259 @@
+package explain
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// "->  Seq Scan on orders o  (cost=0.00..35.50 rows=2550 width=4) (actual time=0.010..0.020 rows=10 loops=1)"
+	textNodePattern   = regexp.MustCompile(`^(\s*)(->\s+)?(\S.*?)\s+\(cost=([\d.]+)\.\.([\d.]+) rows=(\d+) width=(\d+)\)(.*)$`)
+	textActualPattern = regexp.MustCompile(`actual (?:time=([\d.]+)\.\.([\d.]+) )?rows=([\d.]+) loops=(\d+)`)
+	textSortPattern   = regexp.MustCompile(`^(.+?)\s+(Disk|Memory):\s+(\d+)kB`)
+	textBatchPattern  = regexp.MustCompile(`Batches:\s+(\d+)`)
+	textMemoryPattern = regexp.MustCompile(`Memory Usage:\s+(\d+)kB`)
+	textDiskPattern   = regexp.MustCompile(`Disk Usage:\s+(\d+)kB`)
+	textBufferPattern = regexp.MustCompile(`(shared|local|temp)((?: (?:hit|read|dirtied|written)=\d+)+)`)
+	textCountPattern  = regexp.MustCompile(`(hit|read|dirtied|written)=(\d+)`)
+	textTimingPattern = regexp.MustCompile(`^(Planning|Execution) Time: ([\d.]+) ms`)
+)
+
+var textJoinTypes = []string{"Right Semi", "Right Anti", "Left", "Right", "Full", "Semi", "Anti"}
+
+type textNode struct {
+	node     Node
+	indent   int
+	children []*textNode
+}
+
+// ParseText parses EXPLAIN (FORMAT TEXT) output, as written by auto_explain
+// with its default log_format, into the same tree Parse builds from JSON.
+// Raw is set to the JSON encoding of the result so text and JSON plans can be
+// stored alike. Lines before the first plan node (such as auto_explain's
+// "Query Text:") are skipped.
+func ParseText(text string) (*Plan, error) {
+	var plan Plan
+	var root *textNode
+	var stack []*textNode
+	footer := false
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if m := textNodePattern.FindStringSubmatch(line); m != nil && !footer {
+			tn := &textNode{node: parseTextNodeHeader(m), indent: len(m[1])}
+
+			for len(stack) > 0 && stack[len(stack)-1].indent >= tn.indent {
+				stack = stack[:len(stack)-1]
+			}
+			if len(stack) == 0 {
+				if root != nil {
+					// A second top-level tree is not part of this plan
+					footer = true
+					continue
+				}
+				root = tn
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, tn)
+			}
+			stack = append(stack, tn)
+			continue
+		}
+
+		if root == nil {
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if m := textTimingPattern.FindStringSubmatch(trimmed); m != nil {
+			v, _ := strconv.ParseFloat(m[2], 64)
+			if m[1] == "Planning" {
+				plan.PlanningTime = v
+			} else {
+				plan.ExecutionTime = v
+			}
+			footer = true
+			continue
+		}
+
+		// Top-level lines after the tree (Planning:, JIT:, Trigger ...) do not
+		// describe a node
+		if strings.TrimLeft(line, " \t") == line {
+			footer = true
+		}
+		if footer || len(stack) == 0 {
+			continue
+		}
+
+		applyTextAttribute(&stack[len(stack)-1].node, trimmed)
+	}
+
+	if root == nil {
+		return nil, fmt.Errorf("text contains no plan")
+	}
+
+	plan.Root = buildTextTree(root)
+
+	raw, err := json.Marshal([]Plan{plan})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode plan: %w", err)
+	}
+	plan.Raw = string(raw)
+	return &plan, nil
+}
+
+func buildTextTree(tn *textNode) Node {
+	node := tn.node
+	for _, child := range tn.children {
+		node.Plans = append(node.Plans, buildTextTree(child))
+	}
+	return node
+}
+
+func parseTextNodeHeader(m []string) Node {
+	var n Node
+	n.StartupCost, _ = strconv.ParseFloat(m[4], 64)
+	n.TotalCost, _ = strconv.ParseFloat(m[5], 64)
+	n.PlanRows, _ = strconv.ParseFloat(m[6], 64)
+	n.PlanWidth, _ = strconv.ParseInt(m[7], 10, 64)
+
+	if a := textActualPattern.FindStringSubmatch(m[8]); a != nil {
+		n.ActualStartupTime, _ = strconv.ParseFloat(a[1], 64)
+		n.ActualTotalTime, _ = strconv.ParseFloat(a[2], 64)
+		n.ActualRows, _ = strconv.ParseFloat(a[3], 64)
+		n.ActualLoops, _ = strconv.ParseFloat(a[4], 64)
+	}
+
+	desc := m[3]
+	target := ""
+	if i := strings.Index(desc, " using "); i >= 0 {
+		desc, target = desc[:i], desc[i+len(" using "):]
+		if j := strings.Index(target, " on "); j >= 0 {
+			n.IndexName = target[:j]
+			setTextRelation(&n, target[j+len(" on "):])
+		} else {
+			n.IndexName = target
+		}
+	} else if i := strings.Index(desc, " on "); i >= 0 {
+		desc, target = desc[:i], desc[i+len(" on "):]
+		if desc == "Bitmap Index Scan" {
+			n.IndexName = target
+		} else {
+			setTextRelation(&n, target)
+		}
+	}
+	desc = strings.TrimSuffix(desc, " Backward")
+
+	n.NodeType = desc
+	if strings.HasSuffix(desc, " Join") || desc == "Nested Loop" {
+		n.JoinType = "Inner"
+		for _, jt := range textJoinTypes {
+			suffix := " " + jt + " Join"
+			if strings.HasSuffix(desc, suffix) {
+				n.JoinType = jt
+				n.NodeType = strings.TrimSuffix(desc, suffix)
+				break
+			}
+		}
+		if n.NodeType == "Hash" || n.NodeType == "Merge" {
+			n.NodeType += " Join"
+		}
+	}
+	return n
+}
+
+func setTextRelation(n *Node, target string) {
+	fields := strings.Fields(target)
+	if len(fields) == 0 {
+		return
+	}
+	rel := fields[0]
+	if i := strings.LastIndex(rel, "."); i >= 0 {
+		n.Schema, rel = rel[:i], rel[i+1:]
+	}
+	n.RelationName = rel
+	n.Alias = rel
+	if len(fields) > 1 {
+		n.Alias = fields[1]
+	}
+}
+
+func applyTextAttribute(n *Node, line string) {
+	key, value, ok := strings.Cut(line, ": ")
+	if !ok {
+		return
+	}
+	value = strings.TrimSpace(value)
+
+	switch key {
+	case "Filter":
+		n.Filter = value
+	case "Index Cond":
+		n.IndexCond = value
+	case "Recheck Cond":
+		n.RecheckCond = value
+	case "Hash Cond":
+		n.HashCond = value
+	case "Merge Cond":
+		n.MergeCond = value
+	case "Join Filter":
+		n.JoinFilter = value
+	case "Rows Removed by Filter":
+		n.RowsRemovedFilter, _ = strconv.ParseFloat(value, 64)
+	case "Sort Key":
+		n.SortKey = strings.Split(value, ", ")
+	case "Sort Method":
+		if m := textSortPattern.FindStringSubmatch(value); m != nil {
+			n.SortMethod = m[1]
+			n.SortSpaceType = m[2]
+			n.SortSpaceUsed, _ = strconv.ParseInt(m[3], 10, 64)
+		} else {
+			n.SortMethod = value
+		}
+	case "Buckets":
+		if m := textBatchPattern.FindStringSubmatch(line); m != nil {
+			n.HashBatches, _ = strconv.ParseInt(m[1], 10, 64)
+		}
+		if m := textMemoryPattern.FindStringSubmatch(line); m != nil {
+			n.PeakMemoryUsage, _ = strconv.ParseInt(m[1], 10, 64)
+		}
+	case "Batches":
+		// Hash aggregates, PostgreSQL 13+
+		if m := textBatchPattern.FindStringSubmatch(line); m != nil {
+			n.HashAggBatches, _ = strconv.ParseInt(m[1], 10, 64)
+		}
+		if m := textMemoryPattern.FindStringSubmatch(line); m != nil {
+			n.PeakMemoryUsage, _ = strconv.ParseInt(m[1], 10, 64)
+		}
+		if m := textDiskPattern.FindStringSubmatch(line); m != nil {
+			n.DiskUsage, _ = strconv.ParseInt(m[1], 10, 64)
+		}
+	case "Buffers":
+		for _, group := range textBufferPattern.FindAllStringSubmatch(value, -1) {
+			for _, c := range textCountPattern.FindAllStringSubmatch(group[2], -1) {
+				v, _ := strconv.ParseInt(c[2], 10, 64)
+				switch group[1] + " " + c[1] {
+				case "shared hit":
+					n.SharedHitBlocks = v
+				case "shared read":
+					n.SharedReadBlocks = v
+				case "shared dirtied":
+					n.SharedDirtied = v
+				case "shared written":
+					n.SharedWritten = v
+				case "temp read":
+					n.TempReadBlocks = v
+				case "temp written":
+					n.TempWrittenBlocks = v
+				}
+			}
+		}
+	}
+}
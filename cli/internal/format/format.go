@@ -0,0 +1,101 @@
+// Package format writes sizes, counts, ages and SQL fragments the way the
+// analyzers and commands show them in findings and reports.
+package format
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Truncate flattens a statement onto one line and cuts it to width
+// characters.
+func Truncate(s string, width int) string {
+	runes := []rune(strings.Join(strings.Fields(s), " "))
+	if len(runes) <= width {
+		return string(runes)
+	}
+	return string(runes[:width-3]) + "..."
+}
+
+// Bytes writes a size in B, KB, MB or GB.
+func Bytes(bytes int64) string {
+	if bytes < 1024 {
+		return fmt.Sprintf("%d B", bytes)
+	} else if bytes < 1024*1024 {
+		return fmt.Sprintf("%.1f KB", float64(bytes)/1024)
+	} else if bytes < 1024*1024*1024 {
+		return fmt.Sprintf("%.1f MB", float64(bytes)/(1024*1024))
+	}
+	return fmt.Sprintf("%.1f GB", float64(bytes)/(1024*1024*1024))
+}
+
+// Percent writes a fraction as a percentage, with more decimals the
+// smaller it is.
+func Percent(fraction float64) string {
+	switch {
+	case fraction >= 0.1:
+		return fmt.Sprintf("%.0f%%", fraction*100)
+	case fraction >= 0.001:
+		return fmt.Sprintf("%.2f%%", fraction*100)
+	}
+	return fmt.Sprintf("%.4f%%", fraction*100)
+}
+
+// Qualified writes schema.name, or the name alone when the schema is not
+// known.
+func Qualified(schema, name string) string {
+	if schema == "" {
+		return name
+	}
+	return schema + "." + name
+}
+
+// Count writes a row or transaction count, e.g. 12K, 3.4M or 1.20B.
+func Count(n int64) string {
+	switch {
+	case n >= 1_000_000_000:
+		return fmt.Sprintf("%.2fB", float64(n)/1e9)
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1e6)
+	case n >= 10_000:
+		return fmt.Sprintf("%.0fK", float64(n)/1e3)
+	}
+	return fmt.Sprintf("%d", n)
+}
+
+// RiskRank orders risk levels, so that sorting by it descending puts high
+// risk findings first.
+func RiskRank(risk string) int {
+	switch risk {
+	case "high":
+		return 2
+	case "medium":
+		return 1
+	}
+	return 0
+}
+
+// Age writes a duration in days, hours or minutes, and in seconds below
+// one minute.
+func Age(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%d days", int(d.Hours()/24))
+	case d >= 2*time.Hour:
+		return fmt.Sprintf("%.0f hours", d.Hours())
+	case d >= time.Minute:
+		return fmt.Sprintf("%.0f minutes", d.Minutes())
+	}
+	return d.Round(time.Second).String()
+}
+
+// QuoteIdent quotes a PostgreSQL identifier.
+func QuoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// Literal escapes a string for use inside a single-quoted SQL literal.
+func Literal(s string) string {
+	return strings.ReplaceAll(s, "'", "''")
+}
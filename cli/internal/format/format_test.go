@@ -0,0 +1,47 @@
+package format
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{name: "short statement", got: Truncate("SELECT 1", 20), want: "SELECT 1"},
+		{name: "multi-line statement", got: Truncate("SELECT *\n  FROM orders\n WHERE id = 1", 20), want: "SELECT * FROM ord..."},
+		{name: "multi-byte statement", got: Truncate("SELECT 'ééééé'", 10), want: "SELECT ..."},
+		{name: "bytes", got: Bytes(512), want: "512 B"},
+		{name: "kilobytes", got: Bytes(1536), want: "1.5 KB"},
+		{name: "megabytes", got: Bytes(64 << 20), want: "64.0 MB"},
+		{name: "gigabytes", got: Bytes(3 << 30), want: "3.0 GB"},
+		{name: "large percentage", got: Percent(0.25), want: "25%"},
+		{name: "small percentage", got: Percent(0.0123), want: "1.23%"},
+		{name: "tiny percentage", got: Percent(0.00001), want: "0.0010%"},
+		{name: "qualified", got: Qualified("public", "orders"), want: "public.orders"},
+		{name: "unqualified", got: Qualified("", "orders"), want: "orders"},
+		{name: "small count", got: Count(9_999), want: "9999"},
+		{name: "thousands", got: Count(12_400), want: "12K"},
+		{name: "millions", got: Count(3_450_000), want: "3.5M"},
+		{name: "billions", got: Count(1_200_000_000), want: "1.20B"},
+		{name: "risk order", got: fmt.Sprint(RiskRank("high"), RiskRank("medium"), RiskRank("low")), want: "2 1 0"},
+		{name: "seconds", got: Age(42 * time.Second), want: "42s"},
+		{name: "minutes", got: Age(90 * time.Minute), want: "90 minutes"},
+		{name: "hours", got: Age(30 * time.Hour), want: "30 hours"},
+		{name: "days", got: Age(100 * time.Hour), want: "4 days"},
+		{name: "identifier", got: QuoteIdent(`app"role`), want: `"app""role"`},
+		{name: "literal", got: Literal("it's"), want: "it''s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %q, want %q", tt.got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,388 @@
+package horizon
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cli/internal/format"
+	"cli/internal/logger"
+	"cli/internal/store"
+)
+
+// Finding kinds
+const (
+	KindIdleInTransaction = "idle_in_transaction"  // a session idles with a transaction open
+	KindLongTransaction   = "long_transaction"     // a transaction has been open too long
+	KindLongStatement     = "long_statement"       // a statement has been running too long
+	KindXminHorizon       = "xmin_horizon"         // a backend's snapshot holds back vacuum
+	KindReplicationSlot   = "replication_slot"     // a slot holds back WAL or vacuum
+	KindPrepared          = "prepared_transaction" // a two-phase transaction was never finished
+	KindTimeoutSetting    = "timeout_setting"      // per-role timeouts that would end the above
+)
+
+// Options tune the analysis.
+type Options struct {
+	// IdleInTransaction is how long a session may sit idle inside a
+	// transaction before it is flagged
+	IdleInTransaction time.Duration
+	// LongTransaction is the transaction age that is flagged
+	LongTransaction time.Duration
+	// LongStatement is the statement run time that is flagged
+	LongStatement time.Duration
+	// XminAge is the transaction ID age from which a snapshot or slot is
+	// said to hold back vacuum
+	XminAge int64
+	// PreparedAge is how old a prepared transaction may get; a healthy
+	// transaction manager finishes them within seconds
+	PreparedAge time.Duration
+	// RetainedWAL is how much WAL an inactive slot may keep
+	RetainedWAL int64
+	// IdleInTransactionTimeout and StatementTimeout are the per-role
+	// settings recommended for the roles that were flagged
+	IdleInTransactionTimeout time.Duration
+	StatementTimeout         time.Duration
+}
+
+func DefaultOptions() Options {
+	return Options{
+		IdleInTransaction:        5 * time.Minute,
+		LongTransaction:          time.Hour,
+		LongStatement:            15 * time.Minute,
+		XminAge:                  10_000_000,
+		PreparedAge:              5 * time.Minute,
+		RetainedWAL:              1 << 30,
+		IdleInTransactionTimeout: 10 * time.Minute,
+		StatementTimeout:         30 * time.Minute,
+	}
+}
+
+// Finding is one session, slot or prepared transaction holding the
+// horizon back, or a timeout for one role. DDL is the fix to review;
+// Terminate, on session findings, ends the session only if it is still in
+// the state it was found in.
+type Finding struct {
+	Kind        string        `json:"kind"`
+	PID         int           `json:"pid,omitempty"`
+	User        string        `json:"user,omitempty"`
+	Database    string        `json:"database,omitempty"`
+	Application string        `json:"application,omitempty"`
+	Name        string        `json:"name,omitempty"` // slot name or prepared transaction GID
+	Duration    time.Duration `json:"duration,omitempty"`
+	XminAge     int64         `json:"xmin_age,omitempty"`
+	Query       string        `json:"query,omitempty"`
+	DDL         string        `json:"ddl,omitempty"`
+	Terminate   string        `json:"terminate,omitempty"`
+	RiskLevel   string        `json:"risk_level"`
+	Rationale   string        `json:"rationale"`
+}
+
+// Report lists what holds the transaction horizon back, worst first.
+type Report struct {
+	Findings []Finding                 `json:"findings"`
+	Horizon  *store.TransactionHorizon `json:"horizon"`
+	// OldestHolder names what holds the oldest transaction ID, and
+	// OldestXminAge is its age
+	OldestHolder  string `json:"oldest_holder,omitempty"`
+	OldestXminAge int64  `json:"oldest_xmin_age"`
+}
+
+// Analyze flags long and idle transactions, old snapshots, stale
+// replication slots and forgotten prepared transactions, and recommends
+// per-role timeouts for the roles whose sessions were flagged.
+func Analyze(horizon *store.TransactionHorizon, opts Options) *Report {
+	logger.LogInfof("Analyzing %d open transactions, %d replication slots and %d prepared transactions",
+		len(horizon.Sessions), len(horizon.Slots), len(horizon.Prepared))
+
+	report := &Report{Horizon: horizon}
+	now := horizon.CapturedAt
+
+	idleByRole := map[string]time.Duration{}
+	runningByRole := map[string]time.Duration{}
+	for _, s := range horizon.Sessions {
+		report.hold(fmt.Sprintf("pid %d (%s)", s.PID, describeSession(s)), s.XminAge)
+		f, ok := sessionFinding(s, now, opts)
+		if !ok {
+			continue
+		}
+		report.Findings = append(report.Findings, f)
+		switch f.Kind {
+		case KindIdleInTransaction:
+			idleByRole[s.User] = max(idleByRole[s.User], f.Duration)
+		case KindLongStatement:
+			runningByRole[s.User] = max(runningByRole[s.User], f.Duration)
+		}
+	}
+
+	for _, slot := range horizon.Slots {
+		report.hold(fmt.Sprintf("replication slot '%s'", slot.Name), max(slot.XminAge, slot.CatalogXminAge))
+		if f, ok := slotFinding(slot, opts); ok {
+			report.Findings = append(report.Findings, f)
+		}
+	}
+
+	for _, p := range horizon.Prepared {
+		report.hold(fmt.Sprintf("prepared transaction '%s'", p.GID), p.XIDAge)
+		if f, ok := preparedFinding(p, now, opts); ok {
+			report.Findings = append(report.Findings, f)
+		}
+	}
+
+	report.Findings = append(report.Findings, timeoutFindings(idleByRole, runningByRole, horizon.Settings, opts)...)
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		return format.RiskRank(report.Findings[i].RiskLevel) > format.RiskRank(report.Findings[j].RiskLevel)
+	})
+	logger.LogInfof("Found %d transaction horizon findings", len(report.Findings))
+	return report
+}
+
+func (r *Report) hold(holder string, age int64) {
+	if age > r.OldestXminAge {
+		r.OldestHolder, r.OldestXminAge = holder, age
+	}
+}
+
+// sessionFinding flags a client session that idles in a transaction, runs
+// a long statement or keeps a transaction open for long, in that order;
+// any other backend is flagged only when its snapshot is old
+func sessionFinding(s store.Session, now time.Time, opts Options) (Finding, bool) {
+	f := Finding{
+		PID:         s.PID,
+		User:        s.User,
+		Database:    s.Database,
+		Application: s.Application,
+		XminAge:     s.XminAge,
+		Query:       s.Query,
+		RiskLevel:   "medium",
+	}
+	holds := s.XminAge >= opts.XminAge
+	xactAge := since(now, s.XactStart)
+
+	if s.BackendType != "" && s.BackendType != "client backend" {
+		if !holds {
+			return Finding{}, false
+		}
+		f.Kind = KindXminHorizon
+		f.Rationale = fmt.Sprintf("The %s (pid %d) holds a snapshot %s transactions old, so vacuum cannot remove rows deleted since.",
+			s.BackendType, s.PID, format.Count(s.XminAge))
+		if s.BackendType == "walsender" {
+			f.Rationale += " This is hot_standby_feedback from a standby: a long query there holds back vacuum here. Set max_standby_streaming_delay on the standby, or turn hot_standby_feedback off if canceled standby queries are acceptable."
+		}
+		return f, true
+	}
+
+	switch {
+	case strings.HasPrefix(s.State, "idle in transaction") && since(now, s.StateChange) >= opts.IdleInTransaction:
+		f.Kind = KindIdleInTransaction
+		f.Duration = since(now, s.StateChange)
+		f.Rationale = fmt.Sprintf("Session %d (%s) has been idle for %s in a transaction that began %s ago. It keeps its locks and holds back vacuum while the application does something else, typically a missing COMMIT, an exception path that skips ROLLBACK, or a pooled connection returned mid-transaction. Its last statement was '%s'.",
+			s.PID, describeSession(s), format.Age(f.Duration), format.Age(xactAge), format.Truncate(s.Query, 120))
+		if s.State == "idle in transaction (aborted)" {
+			f.Rationale += " The transaction has already failed; only a ROLLBACK ends it."
+		}
+		f.Terminate = terminate(s, fmt.Sprintf("state = '%s' AND state_change = '%s'::timestamptz", s.State, timestamp(s.StateChange)))
+	case s.State == "active" && since(now, s.QueryStart) >= opts.LongStatement:
+		f.Kind = KindLongStatement
+		f.Duration = since(now, s.QueryStart)
+		f.Rationale = fmt.Sprintf("Session %d (%s) has been running '%s' for %s.",
+			s.PID, describeSession(s), format.Truncate(s.Query, 120), format.Age(f.Duration))
+		if s.WaitEventType != "" {
+			f.Rationale += fmt.Sprintf(" It is waiting on %s:%s.", s.WaitEventType, s.WaitEvent)
+		}
+		f.Terminate = terminate(s, fmt.Sprintf("query_start = '%s'::timestamptz", timestamp(s.QueryStart)))
+	case xactAge >= opts.LongTransaction:
+		f.Kind = KindLongTransaction
+		f.Duration = xactAge
+		f.Rationale = fmt.Sprintf("Session %d (%s) has kept a transaction open for %s; it is %s now, running '%s'. Every row updated or deleted since it began stays on disk until it ends. Split the work into shorter transactions or commit in batches.",
+			s.PID, describeSession(s), format.Age(xactAge), s.State, format.Truncate(s.Query, 120))
+		f.Terminate = terminate(s, fmt.Sprintf("xact_start = '%s'::timestamptz", timestamp(s.XactStart)))
+	case holds:
+		f.Kind = KindXminHorizon
+		f.Duration = xactAge
+		f.Rationale = fmt.Sprintf("Session %d (%s) holds a snapshot %s transactions old, so vacuum cannot remove rows deleted since.",
+			s.PID, describeSession(s), format.Count(s.XminAge))
+		f.Terminate = terminate(s, fmt.Sprintf("xact_start = '%s'::timestamptz", timestamp(s.XactStart)))
+	default:
+		return Finding{}, false
+	}
+
+	if holds {
+		f.RiskLevel = "high"
+		if f.Kind != KindXminHorizon {
+			f.Rationale += fmt.Sprintf(" Its snapshot is %s transactions old.", format.Count(s.XminAge))
+		}
+	}
+	return f, true
+}
+
+// slotFinding flags inactive slots, which keep WAL and, for logical or
+// feedback slots, dead rows until they are dropped, and active slots whose
+// consumer has fallen far behind
+func slotFinding(slot store.ReplicationSlot, opts Options) (Finding, bool) {
+	age := max(slot.XminAge, slot.CatalogXminAge)
+	f := Finding{
+		Kind:      KindReplicationSlot,
+		Database:  slot.Database,
+		Name:      slot.Name,
+		XminAge:   age,
+		RiskLevel: "medium",
+	}
+	holds := age >= opts.XminAge
+	if holds {
+		f.RiskLevel = "high"
+	}
+
+	retained := fmt.Sprintf("keeps %s of WAL", format.Bytes(slot.RetainedWALBytes))
+	if age > 0 {
+		what := "rows"
+		if slot.XminAge == 0 {
+			what = "catalog rows"
+		}
+		retained += fmt.Sprintf(" and stops vacuum from removing %s deleted in the last %s transactions", what, format.Count(age))
+	}
+
+	switch {
+	case !slot.Active && (holds || slot.RetainedWALBytes >= opts.RetainedWAL):
+		f.DDL = fmt.Sprintf("SELECT pg_drop_replication_slot('%s');", format.Literal(slot.Name))
+		f.Rationale = fmt.Sprintf("The %s replication slot '%s' has no consumer connected and %s. If the replica or subscriber that used it is gone, drop it; otherwise the disk fills with WAL. A dropped slot cannot be resumed: the consumer must be resynchronized.",
+			slot.Type, slot.Name, retained)
+	case slot.Active && holds:
+		f.Rationale = fmt.Sprintf("The %s replication slot '%s' is in use but its consumer is far behind: it %s. Check the consumer's lag and, for a physical standby with hot_standby_feedback, its long-running queries.",
+			slot.Type, slot.Name, retained)
+	default:
+		return Finding{}, false
+	}
+	return f, true
+}
+
+// preparedFinding flags a prepared transaction left behind by a transaction
+// manager; it holds its locks and the horizon, even across restarts
+func preparedFinding(p store.PreparedXact, now time.Time, opts Options) (Finding, bool) {
+	age := now.Sub(p.Prepared)
+	if age < opts.PreparedAge && p.XIDAge < opts.XminAge {
+		return Finding{}, false
+	}
+	return Finding{
+		Kind:      KindPrepared,
+		User:      p.Owner,
+		Database:  p.Database,
+		Name:      p.GID,
+		Duration:  age,
+		XminAge:   p.XIDAge,
+		DDL:       fmt.Sprintf("ROLLBACK PREPARED '%s'; -- connected to %s, or COMMIT PREPARED if the coordinator committed it", format.Literal(p.GID), p.Database),
+		RiskLevel: "high",
+		Rationale: fmt.Sprintf("Transaction '%s' was prepared by %s %s ago and never committed or rolled back. It holds its locks and keeps vacuum from removing rows deleted in the last %s transactions, and survives restarts. Ask the coordinator how it ended before resolving it by hand.",
+			p.GID, p.Owner, format.Age(age), format.Count(p.XIDAge)),
+	}, true
+}
+
+// timeoutFindings recommends per-role timeouts for the roles whose sessions
+// were flagged, where the timeout in effect did not end them. Set on the
+// role, they leave migrations, pg_dump and maintenance jobs under other
+// roles alone, which a server-wide statement_timeout would cancel.
+func timeoutFindings(idleByRole, runningByRole map[string]time.Duration, settings store.TimeoutSettings, opts Options) []Finding {
+	roles := map[string]bool{}
+	for role := range idleByRole {
+		roles[role] = true
+	}
+	for role := range runningByRole {
+		roles[role] = true
+	}
+	names := make([]string, 0, len(roles))
+	for role := range roles {
+		if role != "" {
+			names = append(names, role)
+		}
+	}
+	sort.Strings(names)
+
+	var findings []Finding
+	for _, role := range names {
+		var set, reasons []string
+		if idle, ok := idleByRole[role]; ok && needsTimeout(settings.IdleInTransaction, idle, opts.IdleInTransactionTimeout) {
+			set = append(set, fmt.Sprintf("ALTER ROLE %s SET idle_in_transaction_session_timeout = '%s';", format.QuoteIdent(role), pgDuration(opts.IdleInTransactionTimeout)))
+			reasons = append(reasons, fmt.Sprintf("a session stayed idle in a transaction for %s (idle_in_transaction_session_timeout %s)",
+				format.Age(idle), timeoutSetting(settings.IdleInTransaction)))
+		}
+		if running, ok := runningByRole[role]; ok && needsTimeout(settings.Statement, running, opts.StatementTimeout) {
+			set = append(set, fmt.Sprintf("ALTER ROLE %s SET statement_timeout = '%s';", format.QuoteIdent(role), pgDuration(opts.StatementTimeout)))
+			reasons = append(reasons, fmt.Sprintf("a statement ran for %s (statement_timeout %s)",
+				format.Age(running), timeoutSetting(settings.Statement)))
+		}
+		if len(set) == 0 {
+			continue
+		}
+		findings = append(findings, Finding{
+			Kind:      KindTimeoutSetting,
+			User:      role,
+			DDL:       strings.Join(set, " "),
+			RiskLevel: "low",
+			Rationale: fmt.Sprintf("For role '%s', %s. Setting the timeout on the role ends such sessions without touching migrations, pg_dump or maintenance jobs run under other roles, which a server-wide value would cancel too. New sessions pick it up; existing ones keep their value. A job of this role that legitimately needs longer can raise it with SET LOCAL.",
+				role, strings.Join(reasons, " and ")),
+		})
+	}
+	return findings
+}
+
+// needsTimeout reports whether a timeout should be recommended: it is off,
+// above the recommendation, or something overrides it for the session
+// that ran past it
+func needsTimeout(current, observed, recommended time.Duration) bool {
+	return current == 0 || current > recommended || observed > current
+}
+
+// terminate builds a pg_terminate_backend call that only fires if the
+// session is still the one found, in the same state
+func terminate(s store.Session, guard string) string {
+	return fmt.Sprintf("SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE pid = %d AND %s;", s.PID, guard)
+}
+
+func describeSession(s store.Session) string {
+	parts := []string{s.User}
+	if s.Application != "" {
+		parts = append(parts, s.Application)
+	}
+	if s.Database != "" {
+		parts = append(parts, "on "+s.Database)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func since(now time.Time, t *time.Time) time.Duration {
+	if t == nil {
+		return 0
+	}
+	return max(now.Sub(*t), 0)
+}
+
+// timestamp writes a time at the microsecond precision PostgreSQL keeps,
+// so it compares equal to the column it was read from
+func timestamp(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format("2006-01-02T15:04:05.999999Z07:00")
+}
+
+func timeoutSetting(d time.Duration) string {
+	if d == 0 {
+		return "is off"
+	}
+	return "is " + pgDuration(d)
+}
+
+// pgDuration writes a duration in the units PostgreSQL accepts for
+// time settings
+func pgDuration(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dmin", d/time.Minute)
+	case d%time.Second == 0:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+	return fmt.Sprintf("%dms", d/time.Millisecond)
+}
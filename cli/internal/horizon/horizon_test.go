@@ -0,0 +1,143 @@
+package horizon
+
+import (
+	"testing"
+	"time"
+
+	"cli/internal/store"
+)
+
+func TestAnalyze(t *testing.T) {
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	ago := func(d time.Duration) *time.Time {
+		t := now.Add(-d)
+		return &t
+	}
+	session := func(change func(*store.Session)) store.Session {
+		s := store.Session{
+			PID: 4242, BackendType: "client backend", User: "app", Database: "shop", State: "active",
+			Query: "SELECT 1", XactStart: ago(time.Minute), QueryStart: ago(time.Minute), StateChange: ago(time.Minute),
+		}
+		change(&s)
+		return s
+	}
+
+	type finding struct {
+		kind string
+		risk string
+		ddl  string // checked when set
+	}
+	tests := []struct {
+		name       string
+		horizon    store.TransactionHorizon
+		want       []finding
+		wantHolder string
+	}{
+		{
+			name:    "short transactions",
+			horizon: store.TransactionHorizon{Sessions: []store.Session{session(func(*store.Session) {})}},
+		},
+		{
+			name: "idle in transaction",
+			horizon: store.TransactionHorizon{Sessions: []store.Session{session(func(s *store.Session) {
+				s.State, s.StateChange = "idle in transaction", ago(20*time.Minute)
+			})}},
+			want: []finding{
+				{kind: KindIdleInTransaction, risk: "medium"},
+				{kind: KindTimeoutSetting, risk: "low", ddl: `ALTER ROLE "app" SET idle_in_transaction_session_timeout = '10min';`},
+			},
+		},
+		{
+			name: "idle in transaction holding the horizon",
+			horizon: store.TransactionHorizon{Sessions: []store.Session{session(func(s *store.Session) {
+				s.State, s.StateChange, s.XminAge = "idle in transaction (aborted)", ago(20*time.Minute), 20_000_000
+			})}},
+			want: []finding{
+				{kind: KindIdleInTransaction, risk: "high"},
+				{kind: KindTimeoutSetting, risk: "low"},
+			},
+			wantHolder: "pid 4242 (app, on shop)",
+		},
+		{
+			name: "long statement",
+			horizon: store.TransactionHorizon{Sessions: []store.Session{session(func(s *store.Session) {
+				s.User, s.QueryStart = "report", ago(40*time.Minute)
+			})}},
+			want: []finding{
+				{kind: KindLongStatement, risk: "medium"},
+				{kind: KindTimeoutSetting, risk: "low", ddl: `ALTER ROLE "report" SET statement_timeout = '30min';`},
+			},
+		},
+		{
+			name: "long statement under the timeout in effect",
+			horizon: store.TransactionHorizon{
+				Settings: store.TimeoutSettings{Statement: 30 * time.Minute},
+				Sessions: []store.Session{session(func(s *store.Session) { s.QueryStart = ago(20 * time.Minute) })},
+			},
+			want: []finding{{kind: KindLongStatement, risk: "medium"}},
+		},
+		{
+			name: "long transaction",
+			horizon: store.TransactionHorizon{Sessions: []store.Session{session(func(s *store.Session) {
+				s.XactStart = ago(2 * time.Hour)
+			})}},
+			want: []finding{{kind: KindLongTransaction, risk: "medium"}},
+		},
+		{
+			name: "standby feedback",
+			horizon: store.TransactionHorizon{Sessions: []store.Session{session(func(s *store.Session) {
+				s.PID, s.BackendType, s.User, s.Database, s.XminAge = 7, "walsender", "replicator", "", 20_000_000
+			})}},
+			want:       []finding{{kind: KindXminHorizon, risk: "medium"}},
+			wantHolder: "pid 7 (replicator)",
+		},
+		{
+			name: "replication slots",
+			horizon: store.TransactionHorizon{Slots: []store.ReplicationSlot{
+				{Name: "old_replica", Type: "physical", RetainedWALBytes: 2 << 30},
+				{Name: "live_replica", Type: "physical", Active: true, RetainedWALBytes: 2 << 30},
+				{Name: "old_subscriber", Type: "logical", Database: "shop", CatalogXminAge: 30_000_000},
+			}},
+			want: []finding{
+				{kind: KindReplicationSlot, risk: "high", ddl: "SELECT pg_drop_replication_slot('old_subscriber');"},
+				{kind: KindReplicationSlot, risk: "medium", ddl: "SELECT pg_drop_replication_slot('old_replica');"},
+			},
+			wantHolder: "replication slot 'old_subscriber'",
+		},
+		{
+			name: "prepared transactions",
+			horizon: store.TransactionHorizon{Prepared: []store.PreparedXact{
+				{GID: "tx-1", Prepared: *ago(time.Hour), Owner: "app", Database: "shop", XIDAge: 5_000},
+				{GID: "tx-2", Prepared: *ago(time.Second), Owner: "app", Database: "shop", XIDAge: 10},
+			}},
+			want: []finding{{
+				kind: KindPrepared, risk: "high",
+				ddl: "ROLLBACK PREPARED 'tx-1'; -- connected to shop, or COMMIT PREPARED if the coordinator committed it",
+			}},
+			wantHolder: "prepared transaction 'tx-1'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.horizon.CapturedAt = now
+			report := Analyze(&tt.horizon, DefaultOptions())
+
+			if len(report.Findings) != len(tt.want) {
+				t.Fatalf("got %d findings, want %d: %+v", len(report.Findings), len(tt.want), report.Findings)
+			}
+			for i, want := range tt.want {
+				f := report.Findings[i]
+				if f.Kind != want.kind || f.RiskLevel != want.risk {
+					t.Errorf("finding %d = %s (%s), want %s (%s)", i, f.Kind, f.RiskLevel, want.kind, want.risk)
+				}
+				if want.ddl != "" && f.DDL != want.ddl {
+					t.Errorf("finding %d: DDL = %q, want %q", i, f.DDL, want.ddl)
+				}
+			}
+			if report.OldestHolder != tt.wantHolder {
+				t.Errorf("OldestHolder = %q, want %q", report.OldestHolder, tt.wantHolder)
+			}
+		})
+	}
+}
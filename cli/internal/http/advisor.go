@@ -0,0 +1,97 @@
+package http
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"cli/internal/advisor"
+	"cli/internal/format"
+	"cli/internal/logger"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetIndexPlan returns the workload-wide index plan (CLI: optidb advise)
+func (h *Handlers) GetIndexPlan(c *fiber.Ctx) error {
+	logger.LogInfo("HTTP: Building index plan")
+
+	budget, err := advisor.ParseSize(c.Query("budget", "0"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fmt.Sprintf("Invalid budget: %v", err),
+		})
+	}
+	limit, err := strconv.Atoi(c.Query("limit", "10"))
+	if err != nil || limit <= 0 {
+		limit = 10
+	}
+	statements, err := strconv.Atoi(c.Query("statements", "200"))
+	if err != nil || statements <= 0 {
+		statements = 200
+	}
+
+	workload, err := h.collector.GetWorkload(statements)
+	if err != nil {
+		logger.LogErrorf("Failed to get workload: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to retrieve workload",
+		})
+	}
+	tables, err := h.collector.GetTableInfo()
+	if err != nil {
+		logger.LogErrorf("Failed to get table info: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to retrieve table information",
+		})
+	}
+	indexes, err := h.collector.GetIndexInfo()
+	if err != nil {
+		logger.LogErrorf("Failed to get index info: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to retrieve index information",
+		})
+	}
+
+	opts := advisor.DefaultOptions()
+	opts.StorageBudgetBytes = budget
+	opts.Engine = h.collector.Engine()
+	opts.MaxIndexes = limit
+	plan := advisor.NewAdvisor(opts).Advise(workload, tables, indexes)
+
+	if c.Get("HX-Request") == "true" {
+		return c.SendString(h.renderIndexPlanHTML(plan))
+	}
+
+	return c.JSON(plan)
+}
+
+// renderIndexPlanHTML renders the index plan as HTML for HTMX
+func (h *Handlers) renderIndexPlanHTML(plan *advisor.Plan) string {
+	if len(plan.Indexes) == 0 {
+		return `<div class="text-center py-4 text-gray-400"><p class="text-sm">No new indexes would pay for themselves on this workload</p></div>`
+	}
+
+	html := `<div class="space-y-3">`
+	for _, p := range plan.Indexes {
+		columns := strings.Join(p.Columns, ", ")
+		if len(p.Include) > 0 {
+			columns += " INCLUDE (" + strings.Join(p.Include, ", ") + ")"
+		}
+		html += fmt.Sprintf(`
+		<div class="bg-white/5 rounded-lg p-4 border border-white/10">
+			<div class="flex items-center justify-between mb-2">
+				<span class="text-sm text-white font-medium">#%d %s (%s)</span>
+				<span class="px-2 py-1 text-xs rounded-full bg-blue-500/20 text-blue-300">%s</span>
+			</div>
+			<div class="text-sm text-gray-400 mb-2">Saves %.2f ms across %d statements · write cost %.2f ms · ~%s</div>
+			<div class="text-xs font-mono text-gray-300">%s</div>
+		</div>`,
+			p.Rank, p.Table, columns, p.Kind,
+			p.SavedMS, len(p.Queries), p.WriteCostMS, format.Bytes(p.EstimatedBytes),
+			p.DDL,
+		)
+	}
+	html += `</div>`
+	return html
+}
@@ -0,0 +1,107 @@
+package http
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	"cli/internal/advisor"
+	"cli/internal/bloat"
+	"cli/internal/format"
+	"cli/internal/logger"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetBloat returns the bloated tables and indexes and their remedies
+// (CLI: optidb bloat)
+func (h *Handlers) GetBloat(c *fiber.Ctx) error {
+	logger.LogInfo("HTTP: Estimating bloat")
+
+	opts := bloat.DefaultOptions()
+	opts.Engine = h.collector.Engine()
+	if value := c.Query("min_size"); value != "" {
+		size, err := advisor.ParseSize(value)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": fmt.Sprintf("Invalid min_size: %v", err),
+			})
+		}
+		opts.MinWastedBytes = size
+	}
+	if value := c.Query("min_ratio"); value != "" {
+		ratio, err := strconv.ParseFloat(value, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid min_ratio, expected a fraction between 0 and 1",
+			})
+		}
+		opts.MinRatio = ratio
+	}
+
+	estimates, err := h.collector.GetBloat(c.QueryBool("exact"))
+	if err != nil {
+		logger.LogErrorf("Failed to estimate bloat: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to estimate bloat",
+		})
+	}
+	tables, err := h.collector.GetTableInfo()
+	if err != nil {
+		logger.LogErrorf("Failed to get table info: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to retrieve table information",
+		})
+	}
+	indexes, err := h.collector.GetIndexInfo()
+	if err != nil {
+		logger.LogErrorf("Failed to get index info: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to retrieve index information",
+		})
+	}
+
+	report := bloat.Analyze(estimates, tables, indexes, opts)
+
+	if c.Get("HX-Request") == "true" {
+		return c.SendString(h.renderBloatHTML(report))
+	}
+
+	return c.JSON(report)
+}
+
+// renderBloatHTML renders the bloat report as HTML for HTMX
+func (h *Handlers) renderBloatHTML(report *bloat.Report) string {
+	if len(report.Findings) == 0 {
+		return `<div class="text-center py-8 text-gray-500"><i class="fas fa-check-circle text-3xl text-green-500 mb-2"></i><p class="text-sm">No significant bloat found</p></div>`
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<div class="p-6">
+		<p class="text-sm text-gray-600 mb-4">%s wasted across %d relations</p>
+		<div class="space-y-3">`, format.Bytes(report.WastedBytes), len(report.Findings))
+	for _, f := range report.Findings {
+		name := f.Table
+		if f.Index != "" {
+			name = f.Index + " on " + f.Table
+		}
+		fmt.Fprintf(&b, `
+			<div class="bg-gray-50 rounded-lg p-4 border border-gray-100">
+				<div class="flex items-center justify-between mb-2">
+					<span class="text-sm font-semibold text-gray-800">%s</span>
+					<span class="plan-fact-chip risk-%s">%s · %s risk</span>
+				</div>
+				<div class="text-sm text-gray-600 mb-2">%s wasted of %s (%.0f%%)</div>
+				<p class="text-xs text-gray-600 mb-2">%s</p>
+				<div class="text-xs font-mono text-gray-800 bg-white rounded p-2">%s</div>
+			</div>`,
+			html.EscapeString(name), html.EscapeString(f.RiskLevel), html.EscapeString(f.Action), html.EscapeString(f.RiskLevel),
+			format.Bytes(f.WastedBytes), format.Bytes(f.SizeBytes), f.Ratio*100,
+			html.EscapeString(f.Rationale),
+			html.EscapeString(f.DDL),
+		)
+	}
+	b.WriteString(`</div></div>`)
+	return b.String()
+}
@@ -0,0 +1,50 @@
+package http
+
+import (
+	"strconv"
+
+	"cli/internal/cache"
+	"cli/internal/config"
+	"cli/internal/logger"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetCache returns the buffer cache hit ratio of every table and index, the
+// working set against shared_buffers and the sizing and prewarm findings
+// (CLI: optidb cache)
+func (h *Handlers) GetCache(c *fiber.Ctx) error {
+	logger.LogInfo("HTTP: Analyzing buffer cache hit ratios")
+
+	if h.collector.Engine() == config.EngineMySQL {
+		return c.Status(503).JSON(fiber.Map{
+			"error": "Buffer cache analysis is only available for PostgreSQL",
+		})
+	}
+
+	opts := cache.DefaultOptions()
+	if value := c.Query("min_hit_ratio"); value != "" {
+		ratio, err := strconv.ParseFloat(value, 64)
+		if err != nil || ratio <= 0 || ratio > 1 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid min_hit_ratio, expected a fraction between 0 and 1",
+			})
+		}
+		opts.MinHitRatio = ratio
+	}
+
+	usage, err := h.collector.GetCacheStats()
+	if err != nil {
+		logger.LogErrorf("Failed to get buffer cache statistics: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to retrieve buffer cache statistics",
+		})
+	}
+	// Without shared_buffers the ratios are still reported
+	memory, err := h.collector.GetMemorySettings()
+	if err != nil {
+		logger.LogErrorf("Failed to get memory settings: %v", err)
+	}
+
+	return c.JSON(cache.Analyze(usage, memory, opts))
+}
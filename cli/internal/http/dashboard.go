@@ -191,6 +191,10 @@ func (h *Handlers) renderDashboardHTML() string {
                             <option value="inefficient_join">Inefficient Joins</option>
                             <option value="redundant_index">Redundant Indexes</option>
                             <option value="cardinality_issue">Cardinality Issues</option>
+                            <option value="lock_contention">Lock Contention</option>
+                            <option value="wait_profile">Wait Profile</option>
+                            <option value="temp_spill">Temp File Spill</option>
+                            <option value="cache_hit_ratio">Buffer Cache Misses</option>
                         </select>
                     </div>
                     <div class="flex items-end">
@@ -249,6 +253,82 @@ func (h *Handlers) renderDashboardHTML() string {
                      class="fade-in">
                 </div>
             </div>
+
+            <div class="bg-white rounded-xl shadow-lg border border-gray-100 overflow-hidden mt-8">
+                <div class="px-6 py-4 bg-gradient-to-r from-gray-50 to-blue-50 border-b border-gray-200">
+                    <div class="flex items-center justify-between">
+                        <div>
+                            <h2 class="text-2xl font-bold text-gray-900 flex items-center space-x-3">
+                                <i class="fas fa-compress-alt text-blue-600"></i>
+                                <span>Table &amp; Index Bloat</span>
+                            </h2>
+                            <p class="text-gray-600 mt-1">Wasted space and how to reclaim it</p>
+                        </div>
+                        <button hx-get="/api/v1/bloat" hx-target="#bloat-content" hx-swap="innerHTML"
+                                class="bg-gray-200 text-gray-700 px-4 py-2 rounded-lg text-sm font-medium hover:bg-gray-300 transition-colors duration-200">
+                            <i class="fas fa-sync-alt"></i>
+                        </button>
+                    </div>
+                </div>
+
+                <div id="bloat-content"
+                     hx-get="/api/v1/bloat"
+                     hx-trigger="load"
+                     hx-target="this"
+                     hx-swap="innerHTML"
+                     class="fade-in">
+                </div>
+            </div>
+            <div class="bg-white rounded-xl shadow-lg border border-gray-100 overflow-hidden mt-8">
+                <div class="px-6 py-4 bg-gradient-to-r from-gray-50 to-blue-50 border-b border-gray-200">
+                    <div class="flex items-center justify-between">
+                        <div>
+                            <h2 class="text-2xl font-bold text-gray-900 flex items-center space-x-3">
+                                <i class="fas fa-lock text-blue-600"></i>
+                                <span>Lock Contention</span>
+                            </h2>
+                            <p class="text-gray-600 mt-1">Blocking trees and who waited on whom</p>
+                        </div>
+                        <button hx-get="/api/v1/locks" hx-target="#locks-content" hx-swap="innerHTML"
+                                class="bg-gray-200 text-gray-700 px-4 py-2 rounded-lg text-sm font-medium hover:bg-gray-300 transition-colors duration-200">
+                            <i class="fas fa-sync-alt"></i>
+                        </button>
+                    </div>
+                </div>
+
+                <div id="locks-content"
+                     hx-get="/api/v1/locks"
+                     hx-trigger="load, every 30s"
+                     hx-target="this"
+                     hx-swap="innerHTML"
+                     class="fade-in">
+                </div>
+            </div>
+            <div class="bg-white rounded-xl shadow-lg border border-gray-100 overflow-hidden mt-8">
+                <div class="px-6 py-4 bg-gradient-to-r from-gray-50 to-blue-50 border-b border-gray-200">
+                    <div class="flex items-center justify-between">
+                        <div>
+                            <h2 class="text-2xl font-bold text-gray-900 flex items-center space-x-3">
+                                <i class="fas fa-chart-area text-blue-600"></i>
+                                <span>Active Session History</span>
+                            </h2>
+                            <p class="text-gray-600 mt-1">What active sessions wait on, over time and per query</p>
+                        </div>
+                        <button hx-get="/api/v1/waits" hx-target="#waits-content" hx-swap="innerHTML"
+                                class="bg-gray-200 text-gray-700 px-4 py-2 rounded-lg text-sm font-medium hover:bg-gray-300 transition-colors duration-200">
+                            <i class="fas fa-sync-alt"></i>
+                        </button>
+                    </div>
+                </div>
+
+                <div id="waits-content"
+                     hx-get="/api/v1/waits"
+                     hx-trigger="load, every 30s"
+                     hx-target="this"
+                     hx-swap="innerHTML"
+                     class="fade-in">
+                </div>
+            </div>
         </main>
     </div>
 
@@ -392,6 +472,7 @@ func (h *Handlers) GetBottlenecksTable(c *fiber.Ctx) error {
             <p class="text-xl font-semibold">Error loading index information</p>
         </div>`)
 	}
+	inputs := h.ruleInputs()
 
 	// Generate HTML content
 	html := `<div class="p-6">`
@@ -412,7 +493,7 @@ func (h *Handlers) GetBottlenecksTable(c *fiber.Ctx) error {
 			}
 
 			// Generate recommendations
-			recommendations := h.ruleEngine.AnalyzeQuery(query, tables, indexes)
+			recommendations := h.ruleEngine.AnalyzeQuery(query, tables, indexes, inputs)
 
 			// Filter by analysis type if specified
 			if analysisType != "all" {
@@ -430,8 +511,8 @@ func (h *Handlers) GetBottlenecksTable(c *fiber.Ctx) error {
 				continue
 			}
 
-			// Generate plan facts
-			planFacts := h.generatePlanFacts(query, tables)
+			// Explain the query for plan facts
+			planFacts := h.planFacts(i, query, tables)
 
 			// Generate fingerprint
 			fingerprint := h.generateFingerprint(query.Query)
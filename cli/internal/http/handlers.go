@@ -1,24 +1,40 @@
 package http
 
 import (
-	"crypto/md5"
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"cli/internal/cache"
+	"cli/internal/config"
 	"cli/internal/db"
+	"cli/internal/explain"
 	"cli/internal/ingest"
 	"cli/internal/logger"
+	"cli/internal/parse"
 	"cli/internal/rules"
+	"cli/internal/simulate"
 	"cli/internal/store"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type Handlers struct {
-	collector  *ingest.StatsCollector
+	collector  ingest.Collector
 	ruleEngine *rules.RuleEngine
+	parser     *parse.QueryParser
+	repo       *store.Repository
+	explainer  explain.Planner
+	plans      *planCache
+	simulator  *simulate.Simulator
+	activity   *ingest.ActivityRecorder // sessions with their locks, for /locks
+	waits      *ingest.ActivityRecorder // sessions and wait events alone, for /waits
+
+	// Schema facts for the rules, replaced by refreshRuleInputs
+	inputsMu sync.RWMutex
+	inputs   *rules.Inputs
 }
 
 func NewHandlers(database *db.Config) *Handlers {
@@ -28,13 +44,158 @@ func NewHandlers(database *db.Config) *Handlers {
 		return nil
 	}
 
-	collector := ingest.NewStatsCollector(conn)
-	ruleEngine := rules.NewRuleEngine()
+	collector := ingest.NewCollector(conn)
 
-	return &Handlers{
+	// Simulation is optional: it needs the profiler_sb role and hypopg, and
+	// plans are only read from PostgreSQL
+	if collector.Engine() == config.EngineMySQL {
+		logger.LogInfo("Plan facts and simulation are not available for MySQL")
+		h := newHandlers(collector, nil, nil)
+		h.activity = ingest.NewActivityRecorder(collector.SampleActivity, activityRetention)
+		h.waits = ingest.NewActivityRecorder(collector.SampleWaits, activityRetention)
+		return h
+	}
+	h := newHandlers(collector, explain.NewExplainer(conn, explain.DefaultOptions()), newSimulator())
+	h.activity = ingest.NewActivityRecorder(collector.SampleActivity, activityRetention)
+	h.waits = ingest.NewActivityRecorder(collector.SampleWaits, activityRetention)
+	return h
+}
+
+// NewSnapshotHandlers serves an export from 'optidb snapshot export'. Plan
+// facts come from the exported plans; simulation needs a live server.
+func NewSnapshotHandlers(collector *ingest.FileCollector) *Handlers {
+	return newHandlers(collector, collector, nil)
+}
+
+func newHandlers(collector ingest.Collector, planner explain.Planner, simulator *simulate.Simulator) *Handlers {
+	// The meta store is optional: without it the API still serves live
+	// analysis, only history endpoints are unavailable. It has to be
+	// configured, so the server never creates optidb_meta in the profiled
+	// database on its own.
+	var repo *store.Repository
+	if !config.Get().Database.Meta.Configured() {
+		logger.LogInfo("No meta store configured in database.meta, history disabled")
+	} else if metaConn, err := db.ConnectMetaStore(); err != nil {
+		logger.LogErrorf("Meta store unavailable, history disabled: %v", err)
+	} else if err := store.Migrate(metaConn); err != nil {
+		logger.LogErrorf("Meta store migration failed, history disabled: %v", err)
+		metaConn.Close()
+	} else {
+		repo = store.NewRepository(metaConn)
+	}
+
+	h := &Handlers{
 		collector:  collector,
-		ruleEngine: ruleEngine,
+		ruleEngine: rules.NewRuleEngine(),
+		parser:     parse.NewQueryParser(),
+		repo:       repo,
+		explainer:  planner,
+		plans:      newPlanCache(),
+		simulator:  simulator,
+	}
+	h.refreshRuleInputs()
+	return h
+}
+
+// newSimulator connects the sandbox role, returning nil when it or hypopg is
+// unavailable
+func newSimulator() *simulate.Simulator {
+	sandbox, err := db.ConnectAsSandbox()
+	if err != nil {
+		logger.LogErrorf("Sandbox role unavailable, simulation disabled: %v", err)
+		return nil
+	}
+
+	simulator := simulate.NewSimulator(sandbox, explain.DefaultOptions().StatementTimeout)
+	if err := simulator.Available(); err != nil {
+		logger.LogErrorf("Simulation disabled: %v", err)
+		sandbox.Close()
+		return nil
 	}
+	return simulator
+}
+
+// refreshRuleInputs collects the redundant indexes, column statistics,
+// foreign keys, memory settings and buffer cache hit ratios the rules read.
+// It runs once when the handlers are created and then on the sampling
+// interval, see Server.StartSampling. Rules that need an input are skipped
+// without it, so a failure is only logged and keeps the previous one.
+func (h *Handlers) refreshRuleInputs() {
+	h.inputsMu.RLock()
+	inputs := &rules.Inputs{}
+	if h.inputs != nil {
+		*inputs = *h.inputs
+	}
+	h.inputsMu.RUnlock()
+
+	indexes, err := h.collector.GetIndexInfo()
+	if err != nil {
+		logger.LogErrorf("Failed to get indexes: %v", err)
+	} else {
+		inputs.Hygiene = h.ruleEngine.IndexHygiene(indexes)
+	}
+
+	stats, err := h.collector.GetColumnStats(nil)
+	if err != nil {
+		logger.LogErrorf("Failed to get column statistics: %v", err)
+	} else {
+		inputs.SetColumnStats(stats)
+	}
+
+	keys, err := h.collector.GetForeignKeys()
+	if err != nil {
+		logger.LogErrorf("Failed to get foreign keys: %v", err)
+	} else {
+		inputs.ForeignKeys = keys
+	}
+
+	if h.collector.Engine() != config.EngineMySQL {
+		memory, err := h.collector.GetMemorySettings()
+		if err != nil {
+			logger.LogErrorf("Failed to get memory settings: %v", err)
+		} else {
+			inputs.Memory = memory
+		}
+
+		usage, err := h.collector.GetCacheStats()
+		if err != nil {
+			logger.LogErrorf("Failed to get buffer cache statistics: %v", err)
+		} else {
+			inputs.Cache = cache.Analyze(usage, inputs.Memory, cache.DefaultOptions())
+		}
+	}
+
+	h.inputsMu.Lock()
+	h.inputs = inputs
+	h.inputsMu.Unlock()
+}
+
+// refreshRuleInputsEvery refreshes the rule inputs every interval until
+// stop is closed.
+func (h *Handlers) refreshRuleInputsEvery(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.refreshRuleInputs()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// ruleInputs returns the inputs for one analysis: those of the last refresh
+// with the lock waits and wait events recorded so far.
+func (h *Handlers) ruleInputs() *rules.Inputs {
+	h.inputsMu.RLock()
+	inputs := *h.inputs
+	h.inputsMu.RUnlock()
+
+	inputs.Locks = h.lockReport(0, -1)
+	inputs.Waits = h.waitReport(0, 0)
+	return &inputs
 }
 
 // BottleneckDTO represents a bottleneck with recommendations
@@ -52,6 +213,7 @@ type BottleneckDTO struct {
 
 // RecommendationDTO represents a single recommendation
 type RecommendationDTO struct {
+	RuleID         string  `json:"rule_id,omitempty"`
 	Type           string  `json:"type"`
 	DDL            string  `json:"ddl,omitempty"`
 	RewriteSQL     string  `json:"rewrite_sql,omitempty"`
@@ -61,15 +223,25 @@ type RecommendationDTO struct {
 	RiskLevel      string  `json:"risk_level"`
 }
 
-// PlanFactsDTO represents query execution plan facts
+// PlanFactsDTO represents facts from the query's EXPLAIN plan. Available is
+// false when no plan was captured, in which case the other fields are zero.
 type PlanFactsDTO struct {
-	HasSeqScan    bool    `json:"has_seq_scan"`
-	HasIndexScan  bool    `json:"has_index_scan"`
-	EstimatedRows int64   `json:"estimated_rows"`
-	ActualRows    int64   `json:"actual_rows"`
-	BuffersHit    int64   `json:"buffers_hit"`
-	BuffersRead   int64   `json:"buffers_read"`
-	Selectivity   float64 `json:"selectivity"`
+	Available        bool                `json:"available"`
+	Error            string              `json:"error,omitempty"`
+	Analyzed         bool                `json:"analyzed"`
+	HasSeqScan       bool                `json:"has_seq_scan"`
+	HasIndexScan     bool                `json:"has_index_scan"`
+	SeqScanRelations []string            `json:"seq_scan_relations,omitempty"`
+	IndexesUsed      []string            `json:"indexes_used,omitempty"`
+	JoinTypes        []string            `json:"join_types,omitempty"`
+	TotalCost        float64             `json:"total_cost"`
+	EstimatedRows    int64               `json:"estimated_rows"`
+	ActualRows       int64               `json:"actual_rows"`
+	MaxRowSkew       float64             `json:"max_row_skew"`
+	BuffersHit       int64               `json:"buffers_hit"`
+	BuffersRead      int64               `json:"buffers_read"`
+	Selectivity      float64             `json:"selectivity"`
+	Nodes            []explain.NodeFacts `json:"nodes,omitempty"`
 }
 
 // QueryDetailDTO represents detailed query information
@@ -85,12 +257,22 @@ type QueryDetailDTO struct {
 
 // QueryStatsDTO represents query performance statistics
 type QueryStatsDTO struct {
-	Calls          int64   `json:"calls"`
-	MeanExecTime   float64 `json:"mean_exec_time"`
-	TotalTime      float64 `json:"total_time"`
-	Rows           int64   `json:"rows"`
-	SharedBlksHit  int64   `json:"shared_blks_hit"`
-	SharedBlksRead int64   `json:"shared_blks_read"`
+	QueryID         int64   `json:"queryid,omitempty"`
+	Calls           int64   `json:"calls"`
+	MeanExecTime    float64 `json:"mean_exec_time"`
+	TotalTime       float64 `json:"total_time"`
+	MinExecTime     float64 `json:"min_exec_time"`
+	MaxExecTime     float64 `json:"max_exec_time"`
+	StddevExecTime  float64 `json:"stddev_exec_time"`
+	MeanPlanTime    float64 `json:"mean_plan_time"`
+	Rows            int64   `json:"rows"`
+	SharedBlksHit   int64   `json:"shared_blks_hit"`
+	SharedBlksRead  int64   `json:"shared_blks_read"`
+	TempBlksRead    int64   `json:"temp_blks_read"`
+	TempBlksWritten int64   `json:"temp_blks_written"`
+	BlkReadTime     float64 `json:"blk_read_time"`
+	BlkWriteTime    float64 `json:"blk_write_time"`
+	WALBytes        int64   `json:"wal_bytes"`
 }
 
 // ScanResultDTO represents scan command results
@@ -179,6 +361,7 @@ func (h *Handlers) GetBottlenecks(c *fiber.Ctx) error {
 			"error": "Failed to retrieve index information",
 		})
 	}
+	inputs := h.ruleInputs()
 
 	// Convert to DTOs
 	var bottlenecks []BottleneckDTO
@@ -188,12 +371,13 @@ func (h *Handlers) GetBottlenecks(c *fiber.Ctx) error {
 		}
 
 		// Generate recommendations
-		recommendations := h.ruleEngine.AnalyzeQuery(query, tables, indexes)
+		recommendations := h.ruleEngine.AnalyzeQuery(query, tables, indexes, inputs)
 
 		// Convert recommendations to DTOs
 		var recDTOs []RecommendationDTO
 		for _, rec := range recommendations {
 			recDTOs = append(recDTOs, RecommendationDTO{
+				RuleID:         rec.RuleID,
 				Type:           rec.Type,
 				DDL:            rec.DDL,
 				RewriteSQL:     rec.RewriteSQL,
@@ -204,8 +388,8 @@ func (h *Handlers) GetBottlenecks(c *fiber.Ctx) error {
 			})
 		}
 
-		// Generate plan facts
-		planFacts := h.generatePlanFacts(query, tables)
+		// Explain the query for plan facts
+		planFacts := h.planFacts(i, query, tables)
 
 		// Generate fingerprint
 		fingerprint := h.generateFingerprint(query.Query)
@@ -284,14 +468,16 @@ func (h *Handlers) GetQueryDetail(c *fiber.Ctx) error {
 			"error": "Failed to retrieve index information",
 		})
 	}
+	inputs := h.ruleInputs()
 
 	// Generate recommendations
-	recommendations := h.ruleEngine.AnalyzeQuery(*targetQuery, tables, indexes)
+	recommendations := h.ruleEngine.AnalyzeQuery(*targetQuery, tables, indexes, inputs)
 
 	// Convert recommendations to DTOs
 	var recDTOs []RecommendationDTO
 	for _, rec := range recommendations {
 		recDTOs = append(recDTOs, RecommendationDTO{
+			RuleID:         rec.RuleID,
 			Type:           rec.Type,
 			DDL:            rec.DDL,
 			RewriteSQL:     rec.RewriteSQL,
@@ -302,8 +488,8 @@ func (h *Handlers) GetQueryDetail(c *fiber.Ctx) error {
 		})
 	}
 
-	// Generate plan facts
-	planFacts := h.generatePlanFacts(*targetQuery, tables)
+	// Explain the query for plan facts
+	planFacts := h.planFacts(0, *targetQuery, tables)
 
 	// Extract table names
 	tableNames := h.extractTableNames(targetQuery.Query)
@@ -316,12 +502,22 @@ func (h *Handlers) GetQueryDetail(c *fiber.Ctx) error {
 		Query:       targetQuery.Query,
 		Fingerprint: fingerprint,
 		Stats: QueryStatsDTO{
-			Calls:          targetQuery.Calls,
-			MeanExecTime:   targetQuery.MeanExecTime,
-			TotalTime:      targetQuery.TotalTime,
-			Rows:           targetQuery.Rows,
-			SharedBlksHit:  targetQuery.SharedBlksHit,
-			SharedBlksRead: targetQuery.SharedBlksRead,
+			QueryID:         targetQuery.QueryID,
+			Calls:           targetQuery.Calls,
+			MeanExecTime:    targetQuery.MeanExecTime,
+			TotalTime:       targetQuery.TotalTime,
+			MinExecTime:     targetQuery.MinExecTime,
+			MaxExecTime:     targetQuery.MaxExecTime,
+			StddevExecTime:  targetQuery.StddevExecTime,
+			MeanPlanTime:    targetQuery.MeanPlanTime,
+			Rows:            targetQuery.Rows,
+			SharedBlksHit:   targetQuery.SharedBlksHit,
+			SharedBlksRead:  targetQuery.SharedBlksRead,
+			TempBlksRead:    targetQuery.TempBlksRead,
+			TempBlksWritten: targetQuery.TempBlksWritten,
+			BlkReadTime:     targetQuery.BlkReadTime,
+			BlkWriteTime:    targetQuery.BlkWriteTime,
+			WALBytes:        targetQuery.WALBytes,
 		},
 		Recommendations: recDTOs,
 		PlanFacts:       planFacts,
@@ -334,9 +530,8 @@ func (h *Handlers) GetQueryDetail(c *fiber.Ctx) error {
 
 // Helper functions
 func (h *Handlers) generateFingerprint(query string) string {
-	// Simple MD5-based fingerprint
-	hash := md5.Sum([]byte(query))
-	return fmt.Sprintf("%x", hash)
+	// Same normalized fingerprint the CLI and meta store use
+	return h.parser.GenerateFingerprint(query)
 }
 
 // GetScanResults returns scan results similar to CLI scan command
@@ -381,19 +576,27 @@ func (h *Handlers) GetScanResults(c *fiber.Ctx) error {
 			"error": "Failed to retrieve index information",
 		})
 	}
+	inputs := h.ruleInputs()
 
 	// Convert to scan results
 	var scanResults []ScanResultDTO
+	var analyzed []store.SnapshotQuery
 	for i, query := range queryStats {
 		if i >= limit {
 			break
 		}
 
 		// Generate recommendations
-		recommendations := h.ruleEngine.AnalyzeQuery(query, tables, indexes)
+		recommendations := h.ruleEngine.AnalyzeQuery(query, tables, indexes, inputs)
 
 		// Generate fingerprint
 		fingerprint := h.generateFingerprint(query.Query)
+		analyzed = append(analyzed, store.SnapshotQuery{
+			Fingerprint:     fingerprint,
+			NormSQL:         h.parser.NormalizeQuery(query.Query),
+			Stats:           query,
+			Recommendations: recommendations,
+		})
 
 		scanResult := ScanResultDTO{
 			QueryID:         fingerprint[:12],
@@ -407,11 +610,23 @@ func (h *Handlers) GetScanResults(c *fiber.Ctx) error {
 		scanResults = append(scanResults, scanResult)
 	}
 
+	// Persist the scan when the meta store is available
+	var snapshotID int64
+	if h.repo != nil {
+		snapshot, err := h.repo.SaveSnapshot("http_scan", analyzed, tables, indexes)
+		if err != nil {
+			logger.LogErrorf("Failed to save scan snapshot: %v", err)
+		} else {
+			snapshotID = snapshot.ID
+		}
+	}
+
 	logger.LogInfof("HTTP: Returning %d scan results", len(scanResults))
 	return c.JSON(fiber.Map{
-		"results": scanResults,
-		"total":   len(scanResults),
-		"limit":   limit,
+		"results":     scanResults,
+		"total":       len(scanResults),
+		"limit":       limit,
+		"snapshot_id": snapshotID,
 	})
 }
 
@@ -509,71 +724,8 @@ func (h *Handlers) getAIStatus() string {
 	return "disabled"
 }
 
-func (h *Handlers) generatePlanFacts(query store.QueryStats, tables []store.TableInfo) PlanFactsDTO {
-	// Simple heuristics for plan facts
-	hasSeqScan := query.MeanExecTime > 1.0 && query.SharedBlksRead > 0
-	hasIndexScan := query.SharedBlksHit > query.SharedBlksRead
-
-	// Estimate vs actual rows (simplified)
-	estimatedRows := int64(float64(query.Rows) * 1.2) // Rough estimate
-	actualRows := query.Rows
-
-	selectivity := 0.0
-	if len(tables) > 0 {
-		// Find largest table for selectivity calculation
-		maxRows := int64(0)
-		for _, table := range tables {
-			if table.RowCount > maxRows {
-				maxRows = table.RowCount
-			}
-		}
-		if maxRows > 0 {
-			selectivity = float64(actualRows) / float64(maxRows)
-		}
-	}
-
-	return PlanFactsDTO{
-		HasSeqScan:    hasSeqScan,
-		HasIndexScan:  hasIndexScan,
-		EstimatedRows: estimatedRows,
-		ActualRows:    actualRows,
-		BuffersHit:    query.SharedBlksHit,
-		BuffersRead:   query.SharedBlksRead,
-		Selectivity:   selectivity,
-	}
-}
-
 func (h *Handlers) extractTableNames(query string) []string {
-	// Simple regex-based table extraction
-	var tables []string
-	patterns := []*regexp.Regexp{
-		regexp.MustCompile(`(?i)\bFROM\s+([a-zA-Z_][a-zA-Z0-9_]*)`),
-		regexp.MustCompile(`(?i)\bJOIN\s+([a-zA-Z_][a-zA-Z0-9_]*)`),
-		regexp.MustCompile(`(?i)\bUPDATE\s+([a-zA-Z_][a-zA-Z0-9_]*)`),
-	}
-
-	for _, pattern := range patterns {
-		matches := pattern.FindAllStringSubmatch(query, -1)
-		for _, match := range matches {
-			if len(match) > 1 {
-				table := strings.ToLower(match[1])
-				if !contains(tables, table) {
-					tables = append(tables, table)
-				}
-			}
-		}
-	}
-
-	return tables
-}
-
-func contains(slice []string, item string) bool {
-	for _, s := range slice {
-		if s == item {
-			return true
-		}
-	}
-	return false
+	return h.parser.ExtractTables(query)
 }
 
 // renderBottlenecksHTML renders bottlenecks as HTML for HTMX
@@ -676,7 +828,7 @@ func (h *Handlers) calculatePerformanceScoreFromBottleneck(bottleneck Bottleneck
 	}
 
 	// Bonus for good buffer hit ratio
-	if bottleneck.PlanFacts.BuffersHit > bottleneck.PlanFacts.BuffersRead {
+	if bottleneck.PlanFacts.Analyzed && bottleneck.PlanFacts.BuffersHit > bottleneck.PlanFacts.BuffersRead {
 		score += 10
 	}
 
@@ -705,26 +857,33 @@ func (h *Handlers) getScoreColor(score int) string {
 func (h *Handlers) renderPlanFactsChips(facts PlanFactsDTO) string {
 	chips := ""
 
+	if !facts.Available {
+		return `<span class="px-2 py-1 text-xs rounded-full bg-gray-500/20 text-gray-300">No Plan</span>`
+	}
+
 	if facts.HasSeqScan {
 		chips += `<span class="px-2 py-1 text-xs rounded-full bg-red-500/20 text-red-300">Seq Scan</span>`
 	}
 	if facts.HasIndexScan {
 		chips += `<span class="px-2 py-1 text-xs rounded-full bg-green-500/20 text-green-300">Index Scan</span>`
 	}
-
-	// Row estimation accuracy
-	accuracy := float64(facts.ActualRows) / float64(facts.EstimatedRows)
-	if accuracy > 0.8 && accuracy < 1.2 {
-		chips += `<span class="px-2 py-1 text-xs rounded-full bg-blue-500/20 text-blue-300">Good Est</span>`
-	} else {
-		chips += `<span class="px-2 py-1 text-xs rounded-full bg-orange-500/20 text-orange-300">Poor Est</span>`
+	for _, joinType := range facts.JoinTypes {
+		chips += fmt.Sprintf(`<span class="px-2 py-1 text-xs rounded-full bg-purple-500/20 text-purple-300">%s</span>`, joinType)
 	}
 
-	// Buffer efficiency
-	if facts.BuffersHit > facts.BuffersRead {
-		chips += `<span class="px-2 py-1 text-xs rounded-full bg-green-500/20 text-green-300">Cache Hit</span>`
-	} else {
-		chips += `<span class="px-2 py-1 text-xs rounded-full bg-red-500/20 text-red-300">Disk Read</span>`
+	// Row estimation accuracy and buffers are only known for analyzed plans
+	if facts.Analyzed {
+		if facts.MaxRowSkew < 2 {
+			chips += `<span class="px-2 py-1 text-xs rounded-full bg-blue-500/20 text-blue-300">Good Est</span>`
+		} else {
+			chips += fmt.Sprintf(`<span class="px-2 py-1 text-xs rounded-full bg-orange-500/20 text-orange-300">Poor Est (%.0fx)</span>`, facts.MaxRowSkew)
+		}
+
+		if facts.BuffersHit > facts.BuffersRead {
+			chips += `<span class="px-2 py-1 text-xs rounded-full bg-green-500/20 text-green-300">Cache Hit</span>`
+		} else if facts.BuffersRead > 0 {
+			chips += `<span class="px-2 py-1 text-xs rounded-full bg-red-500/20 text-red-300">Disk Read</span>`
+		}
 	}
 
 	return chips
@@ -0,0 +1,127 @@
+package http
+
+import (
+	"errors"
+	"strconv"
+
+	"cli/internal/logger"
+	"cli/internal/store"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// QueryHistoryDTO represents a query's stored metric and recommendation history
+type QueryHistoryDTO struct {
+	Query           store.Query            `json:"query"`
+	Metrics         []store.QueryMetrics   `json:"metrics"`
+	Recommendations []store.Recommendation `json:"recommendations"`
+}
+
+// GetSnapshots lists persisted scan snapshots, newest first
+func (h *Handlers) GetSnapshots(c *fiber.Ctx) error {
+	logger.LogInfo("HTTP: Getting snapshots")
+
+	if h.repo == nil {
+		return c.Status(503).JSON(fiber.Map{
+			"error": "Meta store is not available, configure it in database.meta",
+		})
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit", "50"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+
+	snapshots, err := h.repo.ListSnapshots(limit)
+	if err != nil {
+		logger.LogErrorf("Failed to list snapshots: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to retrieve snapshots",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"snapshots": snapshots,
+		"total":     len(snapshots),
+	})
+}
+
+// GetQueryHistory returns first/last seen, metric history and recommendation
+// history for a fingerprint (or fingerprint prefix)
+func (h *Handlers) GetQueryHistory(c *fiber.Ctx) error {
+	queryID := c.Params("id")
+	logger.LogInfof("HTTP: Getting query history for ID: %s", queryID)
+
+	if h.repo == nil {
+		return c.Status(503).JSON(fiber.Map{
+			"error": "Meta store is not available, configure it in database.meta",
+		})
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit", "100"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+
+	query, err := h.repo.FindQueryByFingerprint(queryID)
+	if errors.Is(err, store.ErrAmbiguousFingerprint) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		logger.LogErrorf("Failed to find query: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to retrieve query",
+		})
+	}
+	if query == nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Query not found",
+		})
+	}
+
+	metrics, err := h.repo.GetMetricHistory(query.ID, limit)
+	if err != nil {
+		logger.LogErrorf("Failed to get metric history: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to retrieve metric history",
+		})
+	}
+
+	recommendations, err := h.repo.GetRecommendationHistory(query.ID, limit)
+	if err != nil {
+		logger.LogErrorf("Failed to get recommendation history: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to retrieve recommendation history",
+		})
+	}
+
+	return c.JSON(QueryHistoryDTO{
+		Query:           *query,
+		Metrics:         metrics,
+		Recommendations: recommendations,
+	})
+}
+
+// GetDeltas returns per-statement activity in the most recent sampling window
+func (h *Handlers) GetDeltas(c *fiber.Ctx) error {
+	logger.LogInfo("HTTP: Getting statement deltas")
+
+	limit, err := strconv.Atoi(c.Query("limit", "20"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+
+	deltas := h.collector.LatestDeltas()
+	total := len(deltas)
+	if len(deltas) > limit {
+		deltas = deltas[:limit]
+	}
+
+	return c.JSON(fiber.Map{
+		"deltas": deltas,
+		"total":  total,
+		"limit":  limit,
+	})
+}
@@ -0,0 +1,55 @@
+package http
+
+import (
+	"time"
+
+	"cli/internal/hygiene"
+	"cli/internal/logger"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetIndexHygiene returns the duplicate, redundant and unused indexes of
+// the schema and the foreign keys without one (CLI: optidb indexes)
+func (h *Handlers) GetIndexHygiene(c *fiber.Ctx) error {
+	logger.LogInfo("HTTP: Analyzing index hygiene")
+
+	opts := hygiene.DefaultOptions()
+	opts.Engine = h.collector.Engine()
+	if value := c.Query("min_observation"); value != "" {
+		observation, err := time.ParseDuration(value)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid min_observation, expected a duration such as 168h",
+			})
+		}
+		opts.MinObservation = observation
+	}
+
+	indexes, err := h.collector.GetIndexInfo()
+	if err != nil {
+		logger.LogErrorf("Failed to get index info: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to retrieve index information",
+		})
+	}
+
+	tables, err := h.collector.GetTableInfo()
+	if err != nil {
+		logger.LogErrorf("Failed to get table info: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to retrieve table information",
+		})
+	}
+	keys, err := h.collector.GetForeignKeys()
+	if err != nil {
+		logger.LogErrorf("Failed to get foreign keys: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to retrieve foreign keys",
+		})
+	}
+
+	report := hygiene.Analyze(indexes, opts)
+	report.UnindexedForeignKeys = hygiene.UnindexedForeignKeys(keys, tables, indexes, opts.Engine)
+	return c.JSON(report)
+}
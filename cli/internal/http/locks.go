@@ -0,0 +1,150 @@
+package http
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"cli/internal/format"
+	"cli/internal/locks"
+	"cli/internal/logger"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// activityRetention is how much session history the server keeps for
+// /locks and the lock_contention rule
+const activityRetention = 15 * time.Minute
+
+// lockReport analyzes the recorded activity samples of the last window,
+// or of the whole retention period when window is zero. It returns nil
+// when the server does not sample activity.
+func (h *Handlers) lockReport(window, minWait time.Duration) *locks.Report {
+	if h.activity == nil {
+		return nil
+	}
+	samples, interval := h.activity.Samples(window)
+	opts := locks.DefaultOptions()
+	opts.Interval = interval
+	if minWait >= 0 {
+		opts.MinWait = minWait
+	}
+	return locks.Analyze(samples, opts)
+}
+
+// GetLocks returns the blocking trees and lock waits seen by the server's
+// activity sampling (CLI: optidb locks)
+func (h *Handlers) GetLocks(c *fiber.Ctx) error {
+	logger.LogInfo("HTTP: Analyzing lock waits")
+
+	if h.activity == nil {
+		return c.Status(503).JSON(fiber.Map{
+			"error": "Lock sampling needs a live database and server.activity_interval above zero",
+		})
+	}
+
+	var window time.Duration
+	if value := c.Query("window"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid window, expected a duration such as 5m",
+			})
+		}
+		window = d
+	}
+	minWait := time.Duration(-1)
+	if value := c.Query("min_wait"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid min_wait, expected a duration such as 1s",
+			})
+		}
+		minWait = d
+	}
+
+	report := h.lockReport(window, minWait)
+
+	if c.Get("HX-Request") == "true" {
+		return c.SendString(h.renderLocksHTML(report))
+	}
+
+	return c.JSON(report)
+}
+
+// renderLocksHTML renders the blocking trees and the waits they caused as
+// HTML for HTMX
+func (h *Handlers) renderLocksHTML(report *locks.Report) string {
+	if report.Samples == 0 {
+		return `<div class="text-center py-8 text-gray-500"><i class="fas fa-hourglass-start text-3xl text-gray-400 mb-2"></i><p class="text-sm">No activity samples yet</p></div>`
+	}
+	if len(report.Trees) == 0 && len(report.Waits) == 0 {
+		return fmt.Sprintf(`<div class="text-center py-8 text-gray-500"><i class="fas fa-check-circle text-3xl text-green-500 mb-2"></i><p class="text-sm">No lock waits in the last %s</p></div>`,
+			report.Window.Round(time.Second))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<div class="p-6">
+		<p class="text-sm text-gray-600 mb-4">%d blocking trees and %d blocked statement pairs in the last %s</p>
+		<div class="space-y-3">`, len(report.Trees), len(report.Waits), report.Window.Round(time.Second))
+	for i, t := range report.Trees {
+		if i == 5 {
+			break
+		}
+		fmt.Fprintf(&b, `
+			<div class="bg-gray-50 rounded-lg p-4 border border-gray-100">
+				<div class="flex items-center justify-between mb-2">
+					<span class="text-sm font-semibold text-gray-800">PID %d blocked %d sessions</span>
+					<span class="text-xs text-gray-500">at %s</span>
+				</div>`, t.Root.PID, t.Blocked, t.CapturedAt.Local().Format("15:04:05"))
+		renderLockNode(&b, t.Root, 0)
+		b.WriteString(`</div>`)
+	}
+	for _, w := range report.Waits {
+		risk := "low"
+		if w.LongestWait >= 10*time.Second {
+			risk = "medium"
+		}
+		fmt.Fprintf(&b, `
+			<div class="bg-gray-50 rounded-lg p-4 border border-gray-100">
+				<div class="flex items-center justify-between mb-2">
+					<span class="text-sm font-semibold text-gray-800">%s</span>
+					<span class="plan-fact-chip risk-%s">%s waited</span>
+				</div>
+				<p class="text-xs text-gray-600 mb-2">%s</p>
+				<p class="text-xs text-gray-600">%s</p>
+			</div>`,
+			html.EscapeString(w.Relation), risk, w.WaitTime.Round(100*time.Millisecond),
+			html.EscapeString(w.Describe()), html.EscapeString(w.Remedy()))
+	}
+	b.WriteString(`</div></div>`)
+	return b.String()
+}
+
+// renderLockNode writes a session and, indented, the sessions waiting for it
+func renderLockNode(b *strings.Builder, n *locks.Node, depth int) {
+	detail := n.State
+	if depth > 0 {
+		detail = fmt.Sprintf("waits %s for %s", n.Waiting.Round(100*time.Millisecond), n.LockMode)
+		if n.Relation != "" {
+			detail += " on " + n.Relation
+		}
+	} else if n.XactAge > 0 {
+		detail += fmt.Sprintf(", transaction open %s", n.XactAge.Round(time.Second))
+	}
+	fmt.Fprintf(b, `
+				<div class="text-xs font-mono text-gray-800" style="padding-left: %drem">%sPID %d <span class="text-gray-500">(%s)</span> %s</div>`,
+		depth*2, branch(depth), n.PID, html.EscapeString(detail), html.EscapeString(format.Truncate(n.Query, 100)))
+	for _, child := range n.Blocked {
+		renderLockNode(b, child, depth+1)
+	}
+}
+
+func branch(depth int) string {
+	if depth == 0 {
+		return ""
+	}
+	return "└─ "
+}
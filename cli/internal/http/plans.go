@@ -0,0 +1,116 @@
+package http
+
+import (
+	"sync"
+	"time"
+
+	"cli/internal/explain"
+	"cli/internal/logger"
+	"cli/internal/store"
+)
+
+// planExplainTopK bounds how many statements per request are explained; the
+// rest are rendered without plan facts.
+const planExplainTopK = 10
+
+// planCacheTTL keeps dashboard refreshes from re-running EXPLAIN every poll.
+const planCacheTTL = 5 * time.Minute
+
+type cachedPlan struct {
+	facts      PlanFactsDTO
+	capturedAt time.Time
+}
+
+// planCache holds plan facts by fingerprint.
+type planCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedPlan
+}
+
+func newPlanCache() *planCache {
+	return &planCache{entries: make(map[string]cachedPlan)}
+}
+
+func (pc *planCache) get(fingerprint string) (PlanFactsDTO, bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	entry, ok := pc.entries[fingerprint]
+	if !ok || time.Since(entry.capturedAt) > planCacheTTL {
+		return PlanFactsDTO{}, false
+	}
+	return entry.facts, true
+}
+
+func (pc *planCache) put(fingerprint string, facts PlanFactsDTO) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.entries[fingerprint] = cachedPlan{facts: facts, capturedAt: time.Now()}
+}
+
+// planFacts returns facts from a real EXPLAIN of the statement. Statements
+// ranked beyond planExplainTopK, or that cannot be explained, come back with
+// Available unset rather than with guessed values.
+func (h *Handlers) planFacts(rank int, query store.QueryStats, tables []store.TableInfo) PlanFactsDTO {
+	if h.explainer == nil || rank >= planExplainTopK {
+		return PlanFactsDTO{}
+	}
+
+	fingerprint := h.generateFingerprint(query.Query)
+	if facts, ok := h.plans.get(fingerprint); ok {
+		return facts
+	}
+
+	plan, err := h.explainer.Explain(query.Query)
+	if err != nil {
+		logger.LogDebugf("No plan facts for %s: %v", fingerprint[:12], err)
+		h.plans.put(fingerprint, PlanFactsDTO{Error: err.Error()})
+		return PlanFactsDTO{Error: err.Error()}
+	}
+
+	facts := plan.Facts()
+	dto := PlanFactsDTO{
+		Available:        true,
+		Analyzed:         facts.Analyzed,
+		HasSeqScan:       facts.HasSeqScan,
+		HasIndexScan:     facts.HasIndexScan || facts.HasBitmapScan,
+		SeqScanRelations: facts.SeqScanRelations,
+		IndexesUsed:      facts.IndexesUsed,
+		JoinTypes:        facts.JoinTypes,
+		TotalCost:        facts.TotalCost,
+		EstimatedRows:    facts.EstimatedRows,
+		ActualRows:       facts.ActualRows,
+		MaxRowSkew:       facts.MaxRowSkew,
+		BuffersHit:       facts.BuffersHit,
+		BuffersRead:      facts.BuffersRead,
+		Selectivity:      planSelectivity(facts, tables),
+		Nodes:            facts.Nodes,
+	}
+
+	h.plans.put(fingerprint, dto)
+	return dto
+}
+
+// planSelectivity is the fraction of the largest sequentially scanned table
+// the plan expects to return.
+func planSelectivity(facts explain.Facts, tables []store.TableInfo) float64 {
+	rows := facts.EstimatedRows
+	if facts.Analyzed {
+		rows = facts.ActualRows
+	}
+
+	maxRows := int64(0)
+	for _, table := range tables {
+		for _, rel := range facts.SeqScanRelations {
+			if rel == table.TableName || rel == table.SchemaName+"."+table.TableName {
+				if table.RowCount > maxRows {
+					maxRows = table.RowCount
+				}
+			}
+		}
+	}
+	if maxRows == 0 {
+		return 0
+	}
+	return float64(rows) / float64(maxRows)
+}
@@ -1,7 +1,11 @@
 package http
 
 import (
+	"time"
+
+	"cli/internal/config"
 	"cli/internal/db"
+	"cli/internal/ingest"
 	"cli/internal/logger"
 
 	"github.com/gofiber/fiber/v2"
@@ -11,8 +15,9 @@ import (
 )
 
 type Server struct {
-	app      *fiber.App
-	handlers *Handlers
+	app          *fiber.App
+	handlers     *Handlers
+	stopSampling chan struct{}
 }
 
 func NewServer() *Server {
@@ -26,6 +31,16 @@ func NewServer() *Server {
 		return nil
 	}
 
+	return newServer(handlers)
+}
+
+// NewSnapshotServer serves the dashboard and API from a snapshot export
+// instead of a live database.
+func NewSnapshotServer(collector *ingest.FileCollector) *Server {
+	return newServer(NewSnapshotHandlers(collector))
+}
+
+func newServer(handlers *Handlers) *Server {
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
@@ -46,7 +61,7 @@ func NewServer() *Server {
 		Format: "[${time}] ${status} - ${method} ${path} (${ip})\n",
 	}))
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
+		AllowOrigins: config.Get().Server.AllowOrigins,
 		AllowMethods: "GET,POST,HEAD,PUT,DELETE,PATCH",
 		AllowHeaders: "Origin,Content-Type,Accept,Authorization",
 	}))
@@ -72,6 +87,26 @@ func (s *Server) setupRoutes() {
 	api.Get("/bottlenecks", s.handlers.GetBottlenecks) // CLI: optidb bottlenecks
 	api.Get("/queries/:id", s.handlers.GetQueryDetail) // Query detail view
 
+	// Meta store history
+	api.Get("/snapshots", s.handlers.GetSnapshots)              // Persisted scans
+	api.Get("/queries/:id/history", s.handlers.GetQueryHistory) // Metric + recommendation history
+
+	// Hypothetical index simulation (hypopg)
+	api.Post("/simulate", s.handlers.PostSimulate)
+
+	// Workload-wide index plan
+	api.Get("/index-plan", s.handlers.GetIndexPlan) // CLI: optidb advise
+	api.Get("/indexes", s.handlers.GetIndexHygiene) // CLI: optidb indexes
+	api.Get("/bloat", s.handlers.GetBloat)          // CLI: optidb bloat
+	api.Get("/vacuum", s.handlers.GetVacuumHealth)  // CLI: optidb vacuum
+	api.Get("/locks", s.handlers.GetLocks)          // CLI: optidb locks
+	api.Get("/waits", s.handlers.GetWaits)          // CLI: optidb waits
+	api.Get("/sessions", s.handlers.GetSessions)    // CLI: optidb sessions
+	api.Get("/cache", s.handlers.GetCache)          // CLI: optidb cache
+
+	// Windowed activity from periodic pg_stat_statements snapshots
+	api.Get("/deltas", s.handlers.GetDeltas)
+
 	// System status and monitoring
 	api.Get("/status", s.handlers.GetSystemStatus) // System overview
 	api.Get("/health", func(c *fiber.Ctx) error {
@@ -90,18 +125,43 @@ func (s *Server) setupRoutes() {
 	s.app.Get("/docs", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{
 			"endpoints": map[string]interface{}{
-				"GET /api/v1/scan":        "Scan database for slow queries (CLI: optidb scan)",
-				"GET /api/v1/bottlenecks": "Get performance bottlenecks (CLI: optidb bottlenecks)",
-				"GET /api/v1/queries/:id": "Get detailed query analysis",
-				"GET /api/v1/status":      "Get system status and metrics",
-				"GET /api/v1/health":      "Health check endpoint",
-				"GET /":                   "Main dashboard",
-				"GET /dashboard":          "Dashboard (alias)",
+				"GET /api/v1/scan":                "Scan database for slow queries (CLI: optidb scan)",
+				"GET /api/v1/bottlenecks":         "Get performance bottlenecks (CLI: optidb bottlenecks)",
+				"GET /api/v1/queries/:id":         "Get detailed query analysis",
+				"GET /api/v1/queries/:id/history": "Get stored metric and recommendation history",
+				"GET /api/v1/snapshots":           "List persisted scan snapshots",
+				"GET /api/v1/deltas":              "Get per-statement activity in the latest sampling window",
+				"POST /api/v1/simulate":           "Simulate index recommendations with hypopg (CLI: optidb simulate)",
+				"GET /api/v1/index-plan":          "Get a workload-wide index plan within a storage budget (CLI: optidb advise)",
+				"GET /api/v1/indexes":             "Get duplicate, redundant and unused indexes and unindexed foreign keys (CLI: optidb indexes)",
+				"GET /api/v1/bloat":               "Get bloated tables and indexes with VACUUM, pg_repack or REINDEX remedies (CLI: optidb bloat)",
+				"GET /api/v1/vacuum":              "Get transaction ID wraparound alerts and autovacuum tuning (CLI: optidb vacuum)",
+				"GET /api/v1/locks":               "Get blocking trees and lock waits from session sampling (CLI: optidb locks)",
+				"GET /api/v1/waits":               "Get active session history: database time by wait event, over time and per statement (CLI: optidb waits)",
+				"GET /api/v1/sessions":            "Get long and idle-in-transaction sessions, slots and prepared transactions holding back vacuum (CLI: optidb sessions)",
+				"GET /api/v1/cache":               "Get buffer cache hit ratios per table and index, the working set against shared_buffers and prewarm candidates (CLI: optidb cache)",
+				"GET /api/v1/status":              "Get system status and metrics",
+				"GET /api/v1/health":              "Health check endpoint",
+				"GET /":                           "Main dashboard",
+				"GET /dashboard":                  "Dashboard (alias)",
 			},
 			"parameters": map[string]interface{}{
-				"limit":        "Number of results to return (default: 10-20)",
-				"min_duration": "Minimum query duration in ms (default: 0.1)",
-				"type":         "Filter by analysis type (all, missing_index, correlated_subquery, etc.)",
+				"limit":            "Number of results to return (default: 10-20)",
+				"min_duration":     "Minimum query duration in ms (default: 0.1)",
+				"type":             "Filter by analysis type (all, missing_index, correlated_subquery, etc.)",
+				"budget":           "Storage budget for /index-plan, e.g. 500MB (default: unlimited)",
+				"min_observation":  "How long scans must have been counted before /indexes reports unused indexes (default: 168h)",
+				"min_size":         "Smallest waste /bloat reports, e.g. 100MB (default: 10MB)",
+				"min_ratio":        "Smallest wasted fraction /bloat reports (default: 0.2)",
+				"exact":            "Measure bloated relations with pgstattuple in /bloat when installed (default: false)",
+				"wraparound":       "Share of the ID space in use that makes /vacuum raise an alert (default: 0.5)",
+				"window":           "How far back /locks and /waits look, e.g. 5m (default: 15m)",
+				"bucket":           "Width of one /waits timeline point, e.g. 30s (default: about 30 points)",
+				"min_wait":         "Smallest total wait of a statement pair /locks reports (default: 1s)",
+				"idle":             "How long a session may idle in a transaction before /sessions flags it (default: 5m)",
+				"long_transaction": "Transaction age /sessions flags (default: 1h)",
+				"long_statement":   "Statement run time /sessions flags (default: 15m)",
+				"min_hit_ratio":    "Hit ratio below which /cache flags tables and indexes (default: 0.99)",
 			},
 		})
 	})
@@ -116,7 +176,38 @@ func (s *Server) Start(port string) error {
 	return s.app.Listen(":" + port)
 }
 
+// StartSampling snapshots pg_stat_statements every interval so /deltas can
+// report recent activity instead of totals since the last stats reset, and
+// refreshes the rule inputs on the same interval. It samples sessions and
+// their locks every activityInterval for /locks and wait events every
+// waitInterval for /waits. A zero interval disables any of them.
+func (s *Server) StartSampling(interval, activityInterval, waitInterval time.Duration) {
+	if s.stopSampling != nil {
+		return
+	}
+	s.stopSampling = make(chan struct{})
+	if interval > 0 {
+		s.handlers.collector.StartSampling(interval, s.stopSampling)
+		go s.handlers.refreshRuleInputsEvery(interval, s.stopSampling)
+	}
+	// A recorder that never samples would report an empty history, so
+	// drop it and let /locks and /waits say that sampling is off
+	if activityInterval <= 0 {
+		s.handlers.activity = nil
+	} else if s.handlers.activity != nil {
+		s.handlers.activity.Record(activityInterval, s.stopSampling)
+	}
+	if waitInterval <= 0 {
+		s.handlers.waits = nil
+	} else if s.handlers.waits != nil {
+		s.handlers.waits.Record(waitInterval, s.stopSampling)
+	}
+}
+
 func (s *Server) Stop() error {
 	logger.LogInfo("Stopping HTTP server")
+	if s.stopSampling != nil {
+		close(s.stopSampling)
+	}
 	return s.app.Shutdown()
 }
@@ -0,0 +1,54 @@
+package http
+
+import (
+	"time"
+
+	"cli/internal/config"
+	"cli/internal/horizon"
+	"cli/internal/logger"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetSessions returns the long and idle-in-transaction sessions, slots and
+// prepared transactions holding back vacuum, with per-role timeouts (CLI:
+// optidb sessions). It never terminates anything; the guarded statements
+// are in each finding.
+func (h *Handlers) GetSessions(c *fiber.Ctx) error {
+	logger.LogInfo("HTTP: Analyzing open transactions")
+
+	if h.collector.Engine() == config.EngineMySQL {
+		return c.Status(503).JSON(fiber.Map{
+			"error": "Session horizon monitoring is only available for PostgreSQL",
+		})
+	}
+
+	opts := horizon.DefaultOptions()
+	for param, target := range map[string]*time.Duration{
+		"idle":             &opts.IdleInTransaction,
+		"long_transaction": &opts.LongTransaction,
+		"long_statement":   &opts.LongStatement,
+	} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid " + param + ", expected a duration such as 5m",
+			})
+		}
+		*target = d
+	}
+
+	state, err := h.collector.GetTransactionHorizon()
+	if err != nil {
+		logger.LogErrorf("Failed to get open transactions: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to retrieve open transactions",
+		})
+	}
+
+	return c.JSON(horizon.Analyze(state, opts))
+}
@@ -0,0 +1,196 @@
+package http
+
+import (
+	"fmt"
+	"strings"
+
+	"cli/internal/logger"
+	"cli/internal/simulate"
+	"cli/internal/store"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SimulateRequest selects the query by fingerprint prefix (query_id) or by
+// SQL text. Without ddl, every index recommendation for the query is simulated.
+type SimulateRequest struct {
+	QueryID string `json:"query_id"`
+	Query   string `json:"query"`
+	DDL     string `json:"ddl"`
+	Mode    string `json:"mode"`
+}
+
+// SimulateResultDTO pairs a recommendation with its simulation outcome
+type SimulateResultDTO struct {
+	Recommendation RecommendationDTO `json:"recommendation"`
+	Result         *simulate.Result  `json:"result,omitempty"`
+	Error          string            `json:"error,omitempty"`
+}
+
+// PostSimulate estimates index recommendations with hypopg
+func (h *Handlers) PostSimulate(c *fiber.Ctx) error {
+	var req SimulateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	logger.LogInfof("HTTP: Simulating for query %s", req.QueryID)
+
+	if req.Mode != "" && req.Mode != "hypopg" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Only mode \"hypopg\" is supported",
+		})
+	}
+	if h.simulator == nil {
+		return c.Status(503).JSON(fiber.Map{
+			"error": "Simulation is not available (profiler_sb connection or hypopg missing)",
+		})
+	}
+	if req.QueryID == "" && (req.Query == "" || req.DDL == "") {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Provide query_id, or query and ddl",
+		})
+	}
+
+	query := req.Query
+	var recommendations []store.Recommendation
+	if req.DDL != "" {
+		recommendations = []store.Recommendation{{Type: "manual", DDL: req.DDL, RiskLevel: "low"}}
+	}
+
+	if req.QueryID != "" {
+		target, recs, err := h.indexRecommendationsFor(req.QueryID)
+		if err != nil {
+			logger.LogErrorf("Failed to load query for simulation: %v", err)
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to retrieve query",
+			})
+		}
+		if target == nil {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Query not found",
+			})
+		}
+		query = target.Query
+		if req.DDL == "" {
+			recommendations = recs
+		}
+	}
+
+	var results []SimulateResultDTO
+	for _, rec := range recommendations {
+		dto := SimulateResultDTO{
+			Recommendation: RecommendationDTO{
+				RuleID:         rec.RuleID,
+				Type:           rec.Type,
+				DDL:            rec.DDL,
+				Rationale:      rec.Rationale,
+				Confidence:     rec.Confidence,
+				ImpactEstimate: rec.ImpactEstimate,
+				RiskLevel:      rec.RiskLevel,
+			},
+		}
+
+		result, err := h.simulator.Simulate(query, rec)
+		if err != nil {
+			logger.LogErrorf("Simulation failed: %v", err)
+			dto.Error = err.Error()
+		} else {
+			dto.Result = result
+		}
+		results = append(results, dto)
+	}
+
+	if c.Get("HX-Request") == "true" {
+		return c.SendString(h.renderSimulationHTML(results))
+	}
+
+	return c.JSON(fiber.Map{
+		"query":   query,
+		"results": results,
+		"total":   len(results),
+	})
+}
+
+// indexRecommendationsFor finds a query by fingerprint prefix and returns its
+// simulatable recommendations. A nil query means no match.
+func (h *Handlers) indexRecommendationsFor(fingerprint string) (*store.QueryStats, []store.Recommendation, error) {
+	queryStats, err := h.collector.GetSlowQueries(0.0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var target *store.QueryStats
+	for i := range queryStats {
+		if strings.HasPrefix(h.generateFingerprint(queryStats[i].Query), fingerprint) {
+			target = &queryStats[i]
+			break
+		}
+	}
+	if target == nil {
+		return nil, nil, nil
+	}
+
+	tables, err := h.collector.GetTableInfo()
+	if err != nil {
+		return nil, nil, err
+	}
+	indexes, err := h.collector.GetIndexInfo()
+	if err != nil {
+		return nil, nil, err
+	}
+	inputs := h.ruleInputs()
+
+	var recs []store.Recommendation
+	for _, rec := range h.ruleEngine.AnalyzeQuery(*target, tables, indexes, inputs) {
+		if simulate.Supports(rec) {
+			recs = append(recs, rec)
+		}
+	}
+	return target, recs, nil
+}
+
+// renderSimulationHTML renders before/after cards for HTMX
+func (h *Handlers) renderSimulationHTML(results []SimulateResultDTO) string {
+	if len(results) == 0 {
+		return `<div class="text-center py-4 text-gray-400"><p class="text-sm">No index recommendations to simulate</p></div>`
+	}
+
+	html := `<div class="mt-4 space-y-3">`
+	for _, r := range results {
+		if r.Result == nil {
+			html += fmt.Sprintf(`
+			<div class="bg-red-500/10 rounded-lg p-4 border border-red-500/20">
+				<div class="text-sm font-mono text-gray-300 mb-2">%s</div>
+				<div class="text-sm text-red-300">Simulation failed: %s</div>
+			</div>`, r.Recommendation.DDL, r.Error)
+			continue
+		}
+
+		badgeColor := "bg-green-500/20 text-green-300"
+		if r.Result.ImprovementPct <= 0 {
+			badgeColor = "bg-gray-500/20 text-gray-300"
+		}
+
+		changes := ""
+		for _, change := range r.Result.PlanChanges {
+			changes += fmt.Sprintf(`<span class="px-2 py-1 text-xs rounded-full bg-purple-500/20 text-purple-300">%s</span>`, change)
+		}
+
+		html += fmt.Sprintf(`
+		<div class="bg-white/5 rounded-lg p-4 border border-white/10">
+			<div class="flex items-center justify-between mb-2">
+				<span class="text-sm font-mono text-gray-300">%s</span>
+				<span class="px-2 py-1 text-xs rounded-full %s">%.1f%%</span>
+			</div>
+			<div class="text-sm text-gray-400 mb-2">Cost %.2f → %.2f</div>
+			<div class="flex flex-wrap gap-2">%s</div>
+		</div>`,
+			r.Result.DDL, badgeColor, r.Result.ImprovementPct,
+			r.Result.BeforeCost, r.Result.AfterCost, changes,
+		)
+	}
+	html += `</div>`
+	return html
+}
@@ -0,0 +1,44 @@
+package http
+
+import (
+	"strconv"
+
+	"cli/internal/config"
+	"cli/internal/logger"
+	"cli/internal/vacuum"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetVacuumHealth returns the wraparound and autovacuum state with its
+// alerts and per-table tuning (CLI: optidb vacuum)
+func (h *Handlers) GetVacuumHealth(c *fiber.Ctx) error {
+	logger.LogInfo("HTTP: Analyzing vacuum health")
+
+	if h.collector.Engine() == config.EngineMySQL {
+		return c.Status(503).JSON(fiber.Map{
+			"error": "Vacuum monitoring is only available for PostgreSQL",
+		})
+	}
+
+	opts := vacuum.DefaultOptions()
+	if value := c.Query("wraparound"); value != "" {
+		ratio, err := strconv.ParseFloat(value, 64)
+		if err != nil || ratio <= 0 || ratio > 1 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid wraparound, expected a fraction between 0 and 1",
+			})
+		}
+		opts.WraparoundRatio = ratio
+	}
+
+	health, err := h.collector.GetVacuumHealth()
+	if err != nil {
+		logger.LogErrorf("Failed to get vacuum state: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to retrieve vacuum state",
+		})
+	}
+
+	return c.JSON(vacuum.Analyze(health, opts))
+}
@@ -0,0 +1,145 @@
+package http
+
+import (
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"time"
+
+	"cli/internal/ash"
+	"cli/internal/format"
+	"cli/internal/logger"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// waitReport builds the active session history of the last window, or of
+// the whole retention period when window is zero. It returns nil when the
+// server does not sample activity.
+func (h *Handlers) waitReport(window, bucket time.Duration) *ash.Report {
+	if h.waits == nil {
+		return nil
+	}
+	samples, interval := h.waits.Samples(window)
+	opts := ash.DefaultOptions()
+	opts.Interval = interval
+	opts.Bucket = bucket
+	return ash.Analyze(samples, opts)
+}
+
+// GetWaits returns the active session history: database time by wait
+// event, over time and per statement (CLI: optidb waits)
+func (h *Handlers) GetWaits(c *fiber.Ctx) error {
+	logger.LogInfo("HTTP: Building active session history")
+
+	if h.waits == nil {
+		return c.Status(503).JSON(fiber.Map{
+			"error": "Session sampling needs a live database and server.wait_interval above zero",
+		})
+	}
+
+	var window, bucket time.Duration
+	if value := c.Query("window"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid window, expected a duration such as 5m",
+			})
+		}
+		window = d
+	}
+	if value := c.Query("bucket"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid bucket, expected a duration such as 30s",
+			})
+		}
+		bucket = d
+	}
+
+	report := h.waitReport(window, bucket)
+
+	if c.Get("HX-Request") == "true" {
+		return c.SendString(h.renderWaitsHTML(report))
+	}
+
+	return c.JSON(report)
+}
+
+// renderWaitsHTML renders the timeline and the busiest statements as HTML
+// for HTMX
+func (h *Handlers) renderWaitsHTML(report *ash.Report) string {
+	if len(report.Events) == 0 {
+		return `<div class="text-center py-8 text-gray-500"><i class="fas fa-hourglass-start text-3xl text-gray-400 mb-2"></i><p class="text-sm">No active sessions sampled yet</p></div>`
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<div class="p-6">
+		<p class="text-sm text-gray-600 mb-4">%s of database time in the last %s, %.2f active sessions on average</p>
+		<div class="flex flex-wrap gap-2 mb-4">`,
+		report.DBTime.Round(100*time.Millisecond), report.Window.Round(time.Second), report.ActiveSessions())
+	for i, e := range report.Events {
+		if i == 6 {
+			break
+		}
+		fmt.Fprintf(&b, `<span class="plan-fact-chip">%s %.0f%%</span>`, html.EscapeString(e.Event), e.Share*100)
+	}
+	b.WriteString(`</div>
+		<div class="flex items-end space-x-1 h-24 mb-6">`)
+
+	peak := 0.0
+	for _, bucket := range report.Timeline {
+		peak = max(peak, bucket.ActiveSessions)
+	}
+	for _, bucket := range report.Timeline {
+		height := 0.0
+		if peak > 0 {
+			height = bucket.ActiveSessions / peak * 100
+		}
+		fmt.Fprintf(&b, `<div class="flex-1 bg-blue-500 rounded-t" style="height: %.0f%%" title="%s: %.2f sessions (%s)"></div>`,
+			height, bucket.Start.Local().Format("15:04:05"), bucket.ActiveSessions, html.EscapeString(busiest(bucket.Events)))
+	}
+	b.WriteString(`</div>
+		<div class="space-y-3">`)
+
+	for i, p := range report.Statements {
+		if i == 5 {
+			break
+		}
+		advice := ""
+		if p.Samples >= report.MinSamples {
+			advice = ash.Advice(p.Dominant().Event)
+		}
+		fmt.Fprintf(&b, `
+			<div class="bg-gray-50 rounded-lg p-4 border border-gray-100">
+				<div class="flex items-center justify-between mb-2">
+					<span class="text-xs font-mono text-gray-800">%s</span>
+					<span class="text-xs text-gray-500">%s</span>
+				</div>
+				<p class="text-sm text-gray-600">%s</p>
+				<p class="text-xs text-gray-600 mt-1">%s</p>
+			</div>`,
+			html.EscapeString(format.Truncate(p.Query, 120)), p.DBTime.Round(100*time.Millisecond),
+			html.EscapeString(p.Describe()), html.EscapeString(advice))
+	}
+	b.WriteString(`</div></div>`)
+	return b.String()
+}
+
+// busiest names the event with the most sessions in a timeline point
+func busiest(events map[string]float64) string {
+	names := make([]string, 0, len(events))
+	for name := range events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	top := ""
+	for _, name := range names {
+		if top == "" || events[name] > events[top] {
+			top = name
+		}
+	}
+	return top
+}
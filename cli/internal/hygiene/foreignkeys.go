@@ -0,0 +1,139 @@
+package hygiene
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"cli/internal/config"
+	"cli/internal/format"
+	"cli/internal/store"
+)
+
+// UnindexedForeignKey is a foreign key whose columns do not lead any index
+// on the referencing table. Every DELETE on the parent, and every UPDATE of
+// its referenced key, then scans the child table for referencing rows.
+// Weight ranks findings by parent writes times child rows.
+type UnindexedForeignKey struct {
+	Schema       string   `json:"schema,omitempty"`
+	Table        string   `json:"table"`
+	Constraint   string   `json:"constraint"`
+	Columns      []string `json:"columns"`
+	RefSchema    string   `json:"ref_schema,omitempty"`
+	RefTable     string   `json:"ref_table"`
+	OnDelete     string   `json:"on_delete,omitempty"`
+	ChildRows    int64    `json:"child_rows"`
+	ChildBytes   int64    `json:"child_bytes"`
+	ParentWrites int64    `json:"parent_writes"` // updates and deletes since the stats reset
+	Weight       float64  `json:"weight"`
+	Severity     string   `json:"severity"` // high, medium or low
+	DDL          string   `json:"ddl"`
+	Rationale    string   `json:"rationale"`
+}
+
+// UnindexedForeignKeys finds the foreign keys without a supporting index,
+// heaviest first.
+func UnindexedForeignKeys(keys []store.ForeignKey, tables []store.TableInfo, indexes []store.IndexInfo, engine string) []UnindexedForeignKey {
+	tableInfo := make(map[string]store.TableInfo, len(tables))
+	for _, t := range tables {
+		tableInfo[format.Qualified(t.SchemaName, t.TableName)] = t
+	}
+	byTable := make(map[string][]store.IndexInfo)
+	for _, idx := range indexes {
+		key := format.Qualified(idx.SchemaName, idx.TableName)
+		byTable[key] = append(byTable[key], idx)
+	}
+
+	var findings []UnindexedForeignKey
+	for _, fk := range keys {
+		if supported(fk, byTable[format.Qualified(fk.SchemaName, fk.TableName)]) {
+			continue
+		}
+
+		child := tableInfo[format.Qualified(fk.SchemaName, fk.TableName)]
+		parent := tableInfo[format.Qualified(fk.RefSchemaName, fk.RefTableName)]
+		f := UnindexedForeignKey{
+			Schema:       fk.SchemaName,
+			Table:        fk.TableName,
+			Constraint:   fk.ConstraintName,
+			Columns:      fk.Columns,
+			RefSchema:    fk.RefSchemaName,
+			RefTable:     fk.RefTableName,
+			OnDelete:     fk.OnDelete,
+			ChildRows:    child.RowCount,
+			ChildBytes:   child.SizeBytes,
+			ParentWrites: parent.Updates + parent.Deletes,
+			DDL:          foreignKeyIndexDDL(fk, engine),
+		}
+		// Tables that are never written still pay on the first purge
+		f.Weight = float64(f.ParentWrites+1) * float64(f.ChildRows)
+		f.Severity = foreignKeySeverity(f)
+		f.Rationale = foreignKeyRationale(f)
+		findings = append(findings, f)
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Weight > findings[j].Weight })
+	return findings
+}
+
+// supported reports whether an index can look up the foreign key's
+// columns: its leading key columns are exactly those columns, in any order,
+// and it is a valid, non-partial B-tree (or hash, for one column).
+func supported(fk store.ForeignKey, indexes []store.IndexInfo) bool {
+	want := normalize(fk.Columns)
+	sort.Strings(want)
+
+	for _, idx := range indexes {
+		if idx.Invalid || idx.Predicate != "" {
+			continue
+		}
+		if !isBtree(idx) && !(strings.EqualFold(idx.Method, "hash") && len(want) == 1) {
+			continue
+		}
+		keys := normalize(idx.Keys())
+		if len(keys) < len(want) {
+			continue
+		}
+		leading := append([]string(nil), keys[:len(want)]...)
+		sort.Strings(leading)
+		if strings.Join(leading, ",") == strings.Join(want, ",") {
+			return true
+		}
+	}
+	return false
+}
+
+func foreignKeySeverity(f UnindexedForeignKey) string {
+	cascades := f.OnDelete == "CASCADE" || f.OnDelete == "SET NULL" || f.OnDelete == "SET DEFAULT"
+	switch {
+	case f.ChildRows >= 100000 && (f.ParentWrites > 0 || cascades):
+		return "high"
+	case f.ChildRows >= 10000:
+		return "medium"
+	}
+	return "low"
+}
+
+func foreignKeyRationale(f UnindexedForeignKey) string {
+	rationale := fmt.Sprintf("Foreign key '%s' on '%s' (%s) references '%s' but no index leads with its columns, so each delete on '%s', or update of its key, scans all %d rows of '%s'.",
+		f.Constraint, f.Table, strings.Join(f.Columns, ", "), f.RefTable, f.RefTable, f.ChildRows, f.Table)
+	if f.ParentWrites > 0 {
+		rationale += fmt.Sprintf(" '%s' has had %d updates and deletes since the statistics were reset.", f.RefTable, f.ParentWrites)
+	}
+	if f.OnDelete == "CASCADE" || f.OnDelete == "SET NULL" || f.OnDelete == "SET DEFAULT" {
+		rationale += fmt.Sprintf(" With ON DELETE %s, the same scan finds the rows of '%s' to change.", f.OnDelete, f.Table)
+	}
+	return rationale
+}
+
+// foreignKeyIndexDDL builds the supporting index online, since the child
+// table is in use while it is created
+func foreignKeyIndexDDL(fk store.ForeignKey, engine string) string {
+	name := fmt.Sprintf("idx_%s_%s", fk.TableName, strings.Join(fk.Columns, "_"))
+	table := format.Qualified(fk.SchemaName, fk.TableName)
+	columns := strings.Join(fk.Columns, ", ")
+	if engine == config.EngineMySQL {
+		return fmt.Sprintf("CREATE INDEX %s ON %s (%s) ALGORITHM=INPLACE LOCK=NONE;", name, table, columns)
+	}
+	return fmt.Sprintf("CREATE INDEX CONCURRENTLY %s ON %s (%s);", name, table, columns)
+}
@@ -0,0 +1,410 @@
+package hygiene
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cli/internal/config"
+	"cli/internal/format"
+	"cli/internal/logger"
+	"cli/internal/store"
+)
+
+// Finding kinds
+const (
+	KindDuplicate = "duplicate" // same definition as another index
+	KindRedundant = "redundant" // its key columns lead another index
+	KindUnused    = "unused"    // never scanned since the stats reset
+	KindInvalid   = "invalid"   // left behind by a failed concurrent build
+)
+
+// Options tune the analysis.
+type Options struct {
+	// MinObservation is how long scans must have been counted before an
+	// index with none is reported as unused
+	MinObservation time.Duration
+	// MinUnusedBytes skips unused indexes too small to be worth a change
+	MinUnusedBytes int64
+	Engine         string // DDL dialect; empty means PostgreSQL
+}
+
+func DefaultOptions() Options {
+	return Options{
+		MinObservation: 7 * 24 * time.Hour,
+		MinUnusedBytes: 1024 * 1024,
+	}
+}
+
+// Finding is one index that can be dropped. Keep names the index that
+// serves its queries instead, for duplicates and redundant prefixes.
+type Finding struct {
+	Kind       string   `json:"kind"`
+	Schema     string   `json:"schema,omitempty"`
+	Table      string   `json:"table"`
+	Index      string   `json:"index"`
+	Columns    []string `json:"columns"`
+	Keep       string   `json:"keep,omitempty"`
+	SizeBytes  int64    `json:"size_bytes"`
+	IndexScans int64    `json:"index_scans"`
+	DDL        string   `json:"ddl,omitempty"`
+	RestoreDDL string   `json:"restore_ddl,omitempty"` // recreates the index if dropping it was a mistake
+	Rationale  string   `json:"rationale"`
+	RiskLevel  string   `json:"risk_level"`
+}
+
+// Report is the index hygiene of a schema. ReclaimableBytes counts each
+// index once, even when it is both unused and redundant.
+type Report struct {
+	Findings         []Finding  `json:"findings"`
+	ReclaimableBytes int64      `json:"reclaimable_bytes"`
+	IndexesAnalyzed  int        `json:"indexes_analyzed"`
+	Protected        int        `json:"protected"` // back constraints or the replica identity
+	StatsReset       *time.Time `json:"stats_reset,omitempty"`
+	Replicas         []string   `json:"replicas,omitempty"`
+	// UnusedSkipped explains why unused indexes were not reported
+	UnusedSkipped string `json:"unused_skipped,omitempty"`
+
+	// UnindexedForeignKeys are the indexes missing rather than surplus,
+	// filled in by the caller from UnindexedForeignKeys
+	UnindexedForeignKeys []UnindexedForeignKey `json:"unindexed_foreign_keys,omitempty"`
+}
+
+// Analyze looks for duplicate, redundant, unused and invalid indexes
+// across every table. Indexes that enforce a constraint or are the replica
+// identity are never proposed for dropping, and unique indexes are only
+// proposed when an identical unique index remains.
+func Analyze(indexes []store.IndexInfo, opts Options) *Report {
+	logger.LogInfof("Analyzing index hygiene of %d indexes", len(indexes))
+
+	report := &Report{IndexesAnalyzed: len(indexes)}
+	found := make(map[string]bool)
+	add := func(f Finding) {
+		key := format.Qualified(f.Schema, f.Index)
+		if found[key] {
+			return
+		}
+		found[key] = true
+		report.Findings = append(report.Findings, f)
+		report.ReclaimableBytes += f.SizeBytes
+	}
+
+	byTable := make(map[string][]store.IndexInfo)
+	var tables []string
+	for _, idx := range indexes {
+		if protected(idx) != "" {
+			report.Protected++
+		}
+		if idx.StatsReset != nil && (report.StatsReset == nil || idx.StatsReset.Before(*report.StatsReset)) {
+			report.StatsReset = idx.StatsReset
+		}
+		key := format.Qualified(idx.SchemaName, idx.TableName)
+		if _, ok := byTable[key]; !ok {
+			tables = append(tables, key)
+		}
+		byTable[key] = append(byTable[key], idx)
+	}
+	sort.Strings(tables)
+
+	for _, table := range tables {
+		group := byTable[table]
+		for _, idx := range group {
+			if idx.Invalid && protected(idx) == "" {
+				add(newFinding(KindInvalid, idx, nil, opts,
+					fmt.Sprintf("Index '%s' is invalid, left behind by a failed CREATE INDEX CONCURRENTLY or REINDEX. Queries cannot use it, but every write still maintains it.", idx.IndexName)))
+			}
+		}
+		dropped := make(map[string]bool)
+		for _, f := range duplicates(group, opts) {
+			dropped[f.Index] = true
+			add(f)
+		}
+		for _, f := range redundantPrefixes(group, dropped, opts) {
+			add(f)
+		}
+	}
+
+	report.UnusedSkipped = unusedSkipped(report.StatsReset, opts.MinObservation)
+	if report.UnusedSkipped == "" {
+		for _, table := range tables {
+			for _, idx := range byTable[table] {
+				if idx.IndexScans > 0 || idx.UsageUnknown || idx.Invalid || idx.IsUnique || protected(idx) != "" || idx.SizeBytes < opts.MinUnusedBytes {
+					continue
+				}
+				add(newFinding(KindUnused, idx, nil, opts,
+					fmt.Sprintf("Index '%s' on '%s' has not been scanned%s, yet every write to the table maintains it.", idx.IndexName, idx.TableName, since(report.StatsReset))))
+			}
+		}
+	}
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		return report.Findings[i].SizeBytes > report.Findings[j].SizeBytes
+	})
+
+	logger.LogInfof("Found %d droppable indexes, %d bytes reclaimable", len(report.Findings), report.ReclaimableBytes)
+	return report
+}
+
+// ForTables returns the findings on the named tables
+func (r *Report) ForTables(tables []string) []Finding {
+	var findings []Finding
+	for _, f := range r.Findings {
+		for _, t := range tables {
+			if f.Table == t {
+				findings = append(findings, f)
+				break
+			}
+		}
+	}
+	return findings
+}
+
+// AddReplicaUsage adds the scans a standby recorded to the matching
+// indexes. Standbys count their own scans, so an index the primary never
+// uses may still serve the read replicas.
+func AddReplicaUsage(indexes []store.IndexInfo, replica []store.IndexInfo) {
+	scans := make(map[string]store.IndexInfo, len(replica))
+	for _, idx := range replica {
+		scans[format.Qualified(idx.SchemaName, idx.IndexName)] = idx
+	}
+	for i := range indexes {
+		r, ok := scans[format.Qualified(indexes[i].SchemaName, indexes[i].IndexName)]
+		if !ok {
+			continue
+		}
+		indexes[i].IndexScans += r.IndexScans
+		indexes[i].TuplesRead += r.TuplesRead
+		indexes[i].TuplesFetch += r.TuplesFetch
+		if r.UsageUnknown {
+			indexes[i].UsageUnknown = true
+		}
+		// Usage is only complete since the later of the two resets
+		if r.StatsReset != nil && (indexes[i].StatsReset == nil || r.StatsReset.After(*indexes[i].StatsReset)) {
+			indexes[i].StatsReset = r.StatsReset
+		}
+	}
+}
+
+// protected explains why an index must not be dropped, or returns ""
+func protected(idx store.IndexInfo) string {
+	switch {
+	case idx.IsPrimary:
+		return "primary key"
+	case idx.Constraint != "":
+		return fmt.Sprintf("constraint %s", idx.Constraint)
+	case idx.ReplicaIdentity:
+		return "replica identity"
+	}
+	return ""
+}
+
+// signature is what makes two indexes interchangeable: the access method,
+// key columns and their operator classes, and the partial index predicate.
+func signature(idx store.IndexInfo) string {
+	return strings.Join([]string{
+		strings.ToLower(idx.Method),
+		strings.Join(normalize(idx.Keys()), ","),
+		strings.Join(normalize(idx.OpClasses), ","),
+		normalizeSQL(idx.Predicate),
+	}, "|")
+}
+
+// duplicates finds indexes with the same signature and INCLUDE columns.
+// One of each set is kept: the one backing a constraint, then a unique
+// one, then the most scanned.
+func duplicates(group []store.IndexInfo, opts Options) []Finding {
+	sets := make(map[string][]store.IndexInfo)
+	var order []string
+	for _, idx := range group {
+		if idx.Invalid {
+			continue
+		}
+		included := normalize(idx.Included())
+		sort.Strings(included)
+		key := signature(idx) + "|" + strings.Join(included, ",")
+		if _, ok := sets[key]; !ok {
+			order = append(order, key)
+		}
+		sets[key] = append(sets[key], idx)
+	}
+
+	var findings []Finding
+	for _, key := range order {
+		set := sets[key]
+		if len(set) < 2 {
+			continue
+		}
+		sort.SliceStable(set, func(i, j int) bool { return preferred(set[i], set[j]) })
+		keep := set[0]
+		for _, idx := range set[1:] {
+			if reason := protected(idx); reason != "" {
+				logger.LogDebugf("Keeping duplicate index %s: %s", idx.IndexName, reason)
+				continue
+			}
+			if idx.IsUnique && !keep.IsUnique {
+				continue
+			}
+			findings = append(findings, newFinding(KindDuplicate, idx, &keep, opts,
+				fmt.Sprintf("Index '%s' on '%s' is identical to '%s' (%s). Both are maintained on every write but only one can serve a query.", idx.IndexName, idx.TableName, keep.IndexName, strings.Join(keep.Columns, ", "))))
+		}
+	}
+	return findings
+}
+
+// preferred orders the indexes of a duplicate set by which to keep
+func preferred(a, b store.IndexInfo) bool {
+	if (protected(a) != "") != (protected(b) != "") {
+		return protected(a) != ""
+	}
+	if a.IsUnique != b.IsUnique {
+		return a.IsUnique
+	}
+	if a.IndexScans != b.IndexScans {
+		return a.IndexScans > b.IndexScans
+	}
+	return a.IndexName < b.IndexName
+}
+
+// redundantPrefixes finds B-tree indexes whose key columns are a strict
+// left prefix of another index's with the same predicate, which can serve
+// every query the shorter one does. Unique indexes are kept, since the
+// longer index does not enforce their uniqueness. The widest covering
+// index that is not itself being dropped is named as the replacement.
+func redundantPrefixes(group []store.IndexInfo, dropped map[string]bool, opts Options) []Finding {
+	widest := append([]store.IndexInfo(nil), group...)
+	sort.SliceStable(widest, func(i, j int) bool { return len(widest[i].Keys()) > len(widest[j].Keys()) })
+
+	var findings []Finding
+	for _, short := range group {
+		if short.IsUnique || short.Invalid || dropped[short.IndexName] || protected(short) != "" || !isBtree(short) {
+			continue
+		}
+		for _, long := range widest {
+			if long.IndexName == short.IndexName || long.Invalid || dropped[long.IndexName] || !isBtree(long) {
+				continue
+			}
+			if !coversPrefix(short, long) {
+				continue
+			}
+
+			rationale := fmt.Sprintf("Index '%s' (%s) on '%s' is a left prefix of '%s' (%s), which can serve the same lookups and ordering.",
+				short.IndexName, strings.Join(short.Columns, ", "), short.TableName, long.IndexName, strings.Join(long.Columns, ", "))
+			if short.IndexScans > 0 {
+				rationale += fmt.Sprintf(" Its %d scans would move to the larger index, which reads somewhat more pages per lookup.", short.IndexScans)
+			}
+			findings = append(findings, newFinding(KindRedundant, short, &long, opts, rationale))
+			break
+		}
+	}
+	return findings
+}
+
+// coversPrefix reports whether long can replace short: short's keys and
+// opclasses lead long's, long has more keys, both have the same predicate,
+// and long has every INCLUDE column of short.
+func coversPrefix(short, long store.IndexInfo) bool {
+	shortKeys, longKeys := normalize(short.Keys()), normalize(long.Keys())
+	if len(shortKeys) == 0 || len(shortKeys) >= len(longKeys) {
+		return false
+	}
+	if normalizeSQL(short.Predicate) != normalizeSQL(long.Predicate) {
+		return false
+	}
+	for i, c := range shortKeys {
+		if longKeys[i] != c || opclass(short, i) != opclass(long, i) {
+			return false
+		}
+	}
+	longColumns := normalize(long.Columns)
+	for _, c := range normalize(short.Included()) {
+		if !contains(longColumns, c) {
+			return false
+		}
+	}
+	return true
+}
+
+func isBtree(idx store.IndexInfo) bool {
+	return idx.Method == "" || strings.EqualFold(idx.Method, "btree")
+}
+
+func opclass(idx store.IndexInfo, i int) string {
+	if i < len(idx.OpClasses) {
+		return strings.ToLower(idx.OpClasses[i])
+	}
+	return ""
+}
+
+func newFinding(kind string, idx store.IndexInfo, keep *store.IndexInfo, opts Options, rationale string) Finding {
+	f := Finding{
+		Kind:       kind,
+		Schema:     idx.SchemaName,
+		Table:      idx.TableName,
+		Index:      idx.IndexName,
+		Columns:    idx.Columns,
+		SizeBytes:  idx.SizeBytes,
+		IndexScans: idx.IndexScans,
+		DDL:        dropDDL(idx, opts.Engine),
+		RestoreDDL: idx.Definition,
+		Rationale:  rationale,
+		RiskLevel:  "low",
+	}
+	if keep != nil {
+		f.Keep = keep.IndexName
+	}
+	// Dropping an index that queries use changes their plans
+	if idx.IndexScans > 0 && kind != KindDuplicate {
+		f.RiskLevel = "medium"
+	}
+	return f
+}
+
+func dropDDL(idx store.IndexInfo, engine string) string {
+	if engine == config.EngineMySQL {
+		return fmt.Sprintf("DROP INDEX %s ON %s;", idx.IndexName, format.Qualified(idx.SchemaName, idx.TableName))
+	}
+	return fmt.Sprintf("DROP INDEX CONCURRENTLY %s;", format.Qualified(idx.SchemaName, idx.IndexName))
+}
+
+// unusedSkipped explains why scan counts are too recent to call an index
+// unused, or returns ""
+func unusedSkipped(reset *time.Time, minObservation time.Duration) string {
+	if reset == nil || minObservation <= 0 {
+		return ""
+	}
+	if observed := time.Since(*reset); observed < minObservation {
+		return fmt.Sprintf("statistics were reset %s ago, less than %s, so indexes only used by periodic jobs would look unused",
+			observed.Round(time.Minute), minObservation)
+	}
+	return ""
+}
+
+func since(reset *time.Time) string {
+	if reset == nil {
+		return " since the statistics were last reset"
+	}
+	return fmt.Sprintf(" since the statistics were reset on %s", reset.Local().Format("2006-01-02"))
+}
+
+func normalize(columns []string) []string {
+	out := make([]string, len(columns))
+	for i, c := range columns {
+		out[i] = normalizeSQL(c)
+	}
+	return out
+}
+
+// normalizeSQL makes expressions comparable across spacing and case
+func normalizeSQL(expr string) string {
+	return strings.ToLower(strings.Join(strings.Fields(expr), " "))
+}
+
+func contains(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package hygiene
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"cli/internal/config"
+	"cli/internal/store"
+)
+
+func TestAnalyze(t *testing.T) {
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	recent := time.Now().Add(-time.Hour)
+
+	// Indexes under MinUnusedBytes, so only the case under test reports
+	index := func(name string, columns ...string) store.IndexInfo {
+		return store.IndexInfo{
+			SchemaName: "public", TableName: "orders", IndexName: name, Columns: columns,
+			Method: "btree", SizeBytes: 8192, IndexScans: 10,
+		}
+	}
+	with := func(idx store.IndexInfo, change func(*store.IndexInfo)) store.IndexInfo {
+		change(&idx)
+		return idx
+	}
+
+	tests := []struct {
+		name        string
+		indexes     []store.IndexInfo
+		engine      string
+		want        []string // kind index keep
+		wantDDL     string
+		wantSkipped bool
+	}{
+		{
+			name: "duplicate keeps the most scanned",
+			indexes: []store.IndexInfo{
+				index("orders_customer_idx", "customer_id"),
+				with(index("orders_customer_idx2", "customer_id"), func(i *store.IndexInfo) { i.IndexScans = 500 }),
+			},
+			want:    []string{"duplicate orders_customer_idx orders_customer_idx2"},
+			wantDDL: "DROP INDEX CONCURRENTLY public.orders_customer_idx;",
+		},
+		{
+			name: "duplicate of a constraint index keeps the constraint",
+			indexes: []store.IndexInfo{
+				with(index("orders_pkey", "id"), func(i *store.IndexInfo) { i.IsPrimary, i.IsUnique, i.Constraint = true, true, "orders_pkey" }),
+				with(index("orders_id_idx", "id"), func(i *store.IndexInfo) { i.IndexScans = 900 }),
+			},
+			want: []string{"duplicate orders_id_idx orders_pkey"},
+		},
+		{
+			name: "left prefix is redundant",
+			indexes: []store.IndexInfo{
+				index("orders_customer_idx", "customer_id"),
+				index("orders_customer_created_idx", "customer_id", "created_at"),
+			},
+			want: []string{"redundant orders_customer_idx orders_customer_created_idx"},
+		},
+		{
+			name: "unique prefix is kept",
+			indexes: []store.IndexInfo{
+				with(index("orders_number_key", "number"), func(i *store.IndexInfo) { i.IsUnique = true }),
+				index("orders_number_created_idx", "number", "created_at"),
+			},
+		},
+		{
+			name: "prefix with another predicate is kept",
+			indexes: []store.IndexInfo{
+				with(index("orders_open_idx", "customer_id"), func(i *store.IndexInfo) { i.Predicate = "(status = 'open'::text)" }),
+				index("orders_customer_created_idx", "customer_id", "created_at"),
+			},
+		},
+		{
+			name: "prefix of another access method is kept",
+			indexes: []store.IndexInfo{
+				with(index("orders_tags_idx", "tags"), func(i *store.IndexInfo) { i.Method = "gin" }),
+				index("orders_tags_created_idx", "tags", "created_at"),
+			},
+		},
+		{
+			name: "invalid index",
+			indexes: []store.IndexInfo{
+				with(index("orders_total_idx", "total"), func(i *store.IndexInfo) { i.Invalid = true }),
+			},
+			want: []string{"invalid orders_total_idx "},
+		},
+		{
+			name: "unused index",
+			indexes: []store.IndexInfo{
+				with(index("orders_note_idx", "note"), func(i *store.IndexInfo) {
+					i.IndexScans, i.SizeBytes, i.StatsReset = 0, 64<<20, &old
+				}),
+			},
+			want: []string{"unused orders_note_idx "},
+		},
+		{
+			name: "unused index under the size floor",
+			indexes: []store.IndexInfo{
+				with(index("orders_note_idx", "note"), func(i *store.IndexInfo) { i.IndexScans, i.StatsReset = 0, &old }),
+			},
+		},
+		{
+			name: "unused index after a recent stats reset",
+			indexes: []store.IndexInfo{
+				with(index("orders_note_idx", "note"), func(i *store.IndexInfo) {
+					i.IndexScans, i.SizeBytes, i.StatsReset = 0, 64<<20, &recent
+				}),
+			},
+			wantSkipped: true,
+		},
+		{
+			name: "MySQL drop syntax",
+			indexes: []store.IndexInfo{
+				index("orders_customer_idx", "customer_id"),
+				index("orders_customer_created_idx", "customer_id", "created_at"),
+			},
+			engine:  config.EngineMySQL,
+			want:    []string{"redundant orders_customer_idx orders_customer_created_idx"},
+			wantDDL: "DROP INDEX orders_customer_idx ON public.orders;",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.Engine = tt.engine
+			report := Analyze(tt.indexes, opts)
+
+			var got []string
+			for _, f := range report.Findings {
+				got = append(got, f.Kind+" "+f.Index+" "+f.Keep)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findings = %q, want %q", got, tt.want)
+			}
+			if tt.wantDDL != "" && (len(report.Findings) == 0 || report.Findings[0].DDL != tt.wantDDL) {
+				t.Errorf("DDL of %+v, want %q", report.Findings, tt.wantDDL)
+			}
+			if (report.UnusedSkipped != "") != tt.wantSkipped {
+				t.Errorf("UnusedSkipped = %q, want skipped %v", report.UnusedSkipped, tt.wantSkipped)
+			}
+			if report.IndexesAnalyzed != len(tt.indexes) {
+				t.Errorf("IndexesAnalyzed = %d, want %d", report.IndexesAnalyzed, len(tt.indexes))
+			}
+		})
+	}
+}
+
+func TestReportForTables(t *testing.T) {
+	report := &Report{Findings: []Finding{
+		{Kind: KindDuplicate, Table: "orders", Index: "orders_customer_idx2"},
+		{Kind: KindRedundant, Table: "customers", Index: "customers_email_idx"},
+		{Kind: KindUnused, Table: "events", Index: "events_kind_idx"},
+	}}
+
+	tests := []struct {
+		name   string
+		tables []string
+		want   []string
+	}{
+		{name: "one table", tables: []string{"orders"}, want: []string{"orders_customer_idx2"}},
+		{name: "two tables", tables: []string{"events", "customers"}, want: []string{"customers_email_idx", "events_kind_idx"}},
+		{name: "no findings", tables: []string{"payments"}},
+		{name: "no tables"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, f := range report.ForTables(tt.tables) {
+				got = append(got, f.Index)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ForTables(%q) = %q, want %q", tt.tables, got, tt.want)
+			}
+		})
+	}
+}
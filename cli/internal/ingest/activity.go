@@ -0,0 +1,256 @@
+package ingest
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+
+	"cli/internal/logger"
+	"cli/internal/store"
+)
+
+// SampleActivity reads every session that is not idle, with the lock it
+// waits for and the sessions blocking it. Idle sessions are included only
+// when they hold advisory locks, which outlive transactions.
+//
+// query_id (14+) and pg_locks.waitstart (14+) are read through to_jsonb so
+// that older servers return NULL instead of failing.
+func (sc *StatsCollector) SampleActivity() (*store.ActivitySample, error) {
+	sample := &store.ActivitySample{}
+	if err := sc.db.QueryRow(`SELECT now()`).Scan(&sample.CapturedAt); err != nil {
+		logger.LogErrorf("Failed to read server clock: %v", err)
+		return nil, fmt.Errorf("failed to read server clock: %w", err)
+	}
+
+	rows, err := sc.db.Query(`
+		SELECT
+			a.pid,
+			coalesce(a.backend_type, ''),
+			coalesce(a.usename, ''),
+			coalesce(a.datname, ''),
+			coalesce(a.application_name, ''),
+			coalesce(a.state, ''),
+			coalesce(a.wait_event_type, ''),
+			coalesce(a.wait_event, ''),
+			coalesce((to_jsonb(a)->>'query_id')::bigint, 0),
+			coalesce(a.query, ''),
+			a.xact_start,
+			a.query_start,
+			a.state_change,
+			CASE WHEN a.wait_event_type = 'Lock' THEN pg_blocking_pids(a.pid) ELSE '{}' END,
+			coalesce(w.locktype, ''),
+			coalesce(w.mode, ''),
+			CASE WHEN a.datname = current_database() THEN coalesce(w.relation, t.relation)::regclass::text END,
+			(to_jsonb(w)->>'waitstart')::timestamptz
+		FROM pg_stat_activity a
+		LEFT JOIN LATERAL (
+			SELECT l.* FROM pg_locks l WHERE l.pid = a.pid AND NOT l.granted LIMIT 1
+		) w ON true
+		-- A row lock waiter holds the tuple lock and queues on the holder's
+		-- transaction ID, so the table comes from the tuple lock
+		LEFT JOIN LATERAL (
+			SELECT l.relation FROM pg_locks l WHERE l.pid = a.pid AND l.granted AND l.locktype = 'tuple' LIMIT 1
+		) t ON true
+		WHERE a.pid <> pg_backend_pid()
+		  AND (a.state IS DISTINCT FROM 'idle'
+		       OR EXISTS (SELECT 1 FROM pg_locks l WHERE l.pid = a.pid AND l.locktype = 'advisory'))
+		ORDER BY a.pid
+	`)
+	if err != nil {
+		logger.LogErrorf("Failed to sample pg_stat_activity: %v", err)
+		return nil, fmt.Errorf("failed to sample pg_stat_activity: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s store.Session
+		var blockedBy []int64
+		var relation sql.NullString
+		err := rows.Scan(
+			&s.PID, &s.BackendType, &s.User, &s.Database, &s.Application,
+			&s.State, &s.WaitEventType, &s.WaitEvent, &s.QueryID, &s.Query,
+			&s.XactStart, &s.QueryStart, &s.StateChange,
+			pq.Array(&blockedBy), &s.LockType, &s.LockMode, &relation, &s.WaitStart,
+		)
+		if err != nil {
+			logger.LogErrorf("Failed to scan activity row: %v", err)
+			return nil, fmt.Errorf("failed to scan activity row: %w", err)
+		}
+		for _, pid := range blockedBy {
+			s.BlockedBy = append(s.BlockedBy, int(pid))
+		}
+		s.Relation = relation.String
+		sample.Sessions = append(sample.Sessions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read activity rows: %w", err)
+	}
+
+	logger.LogDebugf("Sampled %d sessions", len(sample.Sessions))
+	return sample, nil
+}
+
+// SampleWaits reads the sessions that are not idle and what they wait on,
+// from pg_stat_activity alone. Unlike SampleActivity it reads no locks and
+// no blocking PIDs, so it is cheap enough to poll every few hundred
+// milliseconds for active session history.
+func (sc *StatsCollector) SampleWaits() (*store.ActivitySample, error) {
+	sample := &store.ActivitySample{}
+	if err := sc.db.QueryRow(`SELECT now()`).Scan(&sample.CapturedAt); err != nil {
+		logger.LogErrorf("Failed to read server clock: %v", err)
+		return nil, fmt.Errorf("failed to read server clock: %w", err)
+	}
+
+	rows, err := sc.db.Query(`
+		SELECT
+			pid,
+			coalesce(backend_type, ''),
+			coalesce(usename, ''),
+			coalesce(datname, ''),
+			coalesce(application_name, ''),
+			coalesce(state, ''),
+			coalesce(wait_event_type, ''),
+			coalesce(wait_event, ''),
+			coalesce((to_jsonb(a)->>'query_id')::bigint, 0),
+			coalesce(query, ''),
+			xact_start,
+			query_start,
+			state_change
+		FROM pg_stat_activity a
+		WHERE pid <> pg_backend_pid()
+		  AND state IS DISTINCT FROM 'idle'
+		ORDER BY pid
+	`)
+	if err != nil {
+		logger.LogErrorf("Failed to sample pg_stat_activity: %v", err)
+		return nil, fmt.Errorf("failed to sample pg_stat_activity: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s store.Session
+		err := rows.Scan(
+			&s.PID, &s.BackendType, &s.User, &s.Database, &s.Application,
+			&s.State, &s.WaitEventType, &s.WaitEvent, &s.QueryID, &s.Query,
+			&s.XactStart, &s.QueryStart, &s.StateChange,
+		)
+		if err != nil {
+			logger.LogErrorf("Failed to scan activity row: %v", err)
+			return nil, fmt.Errorf("failed to scan activity row: %w", err)
+		}
+		sample.Sessions = append(sample.Sessions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read activity rows: %w", err)
+	}
+
+	logger.LogDebugf("Sampled %d sessions", len(sample.Sessions))
+	return sample, nil
+}
+
+// Sampler takes one activity sample, such as Collector.SampleActivity for
+// lock analysis or Collector.SampleWaits for active session history.
+type Sampler func() (*store.ActivitySample, error)
+
+// SampleActivityFor samples the sessions every interval for duration, for
+// commands that watch the server for a while and then report.
+func SampleActivityFor(sample Sampler, duration, interval time.Duration) ([]store.ActivitySample, error) {
+	logger.LogInfof("Sampling session activity every %s for %s", interval, duration)
+
+	var samples []store.ActivitySample
+	deadline := time.Now().Add(duration)
+	for {
+		s, err := sample()
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, *s)
+
+		if time.Now().Add(interval).After(deadline) {
+			break
+		}
+		time.Sleep(interval)
+	}
+
+	logger.LogInfof("Took %d activity samples", len(samples))
+	return samples, nil
+}
+
+// ActivityRecorder keeps the activity samples of the last retention period,
+// so the server can report on locks and waits without sampling on request.
+type ActivityRecorder struct {
+	sample    Sampler
+	retention time.Duration
+
+	mu       sync.Mutex
+	interval time.Duration
+	samples  []store.ActivitySample
+}
+
+func NewActivityRecorder(sample Sampler, retention time.Duration) *ActivityRecorder {
+	return &ActivityRecorder{sample: sample, retention: retention}
+}
+
+// Record samples the sessions every interval until stop is closed, dropping
+// samples older than the retention period.
+func (ar *ActivityRecorder) Record(interval time.Duration, stop <-chan struct{}) {
+	logger.LogInfof("Starting activity sampling every %s, keeping %s", interval, ar.retention)
+
+	ar.mu.Lock()
+	ar.interval = interval
+	ar.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				sample, err := ar.sample()
+				if err != nil {
+					logger.LogErrorf("Failed to sample activity: %v", err)
+					continue
+				}
+				ar.add(*sample)
+			case <-stop:
+				logger.LogInfo("Stopped activity sampling")
+				return
+			}
+		}
+	}()
+}
+
+func (ar *ActivityRecorder) add(sample store.ActivitySample) {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	cutoff := sample.CapturedAt.Add(-ar.retention)
+	keep := 0
+	for keep < len(ar.samples) && ar.samples[keep].CapturedAt.Before(cutoff) {
+		keep++
+	}
+	ar.samples = append(ar.samples[keep:], sample)
+}
+
+// Samples returns the samples taken in the last window, or all retained
+// ones when window is zero, with the interval they were taken at.
+func (ar *ActivityRecorder) Samples(window time.Duration) ([]store.ActivitySample, time.Duration) {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	if len(ar.samples) == 0 {
+		return nil, ar.interval
+	}
+	start := 0
+	if window > 0 {
+		cutoff := ar.samples[len(ar.samples)-1].CapturedAt.Add(-window)
+		for start < len(ar.samples) && ar.samples[start].CapturedAt.Before(cutoff) {
+			start++
+		}
+	}
+	return append([]store.ActivitySample(nil), ar.samples[start:]...), ar.interval
+}
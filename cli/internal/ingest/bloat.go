@@ -0,0 +1,266 @@
+package ingest
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"cli/internal/logger"
+	"cli/internal/store"
+)
+
+// tableBloatQuery is the widely used statistical estimate of table bloat
+// (ioguix/pgsql-bloat-estimation): the pages the live rows need, from
+// reltuples and the average column widths in pg_stats, against relpages.
+// Tables with columns ANALYZE has no width for are flagged unreliable.
+const tableBloatQuery = `
+	SELECT schemaname, tblname, bs * tblpages, fillfactor,
+		CASE WHEN tblpages - est_tblpages_ff > 0 THEN (tblpages - est_tblpages_ff) * bs ELSE 0 END,
+		is_na
+	FROM (
+		SELECT
+			ceil(reltuples / ((bs - page_hdr) * fillfactor / (tpl_size * 100))) + ceil(toasttuples / 4) AS est_tblpages_ff,
+			tblpages, fillfactor, bs, schemaname, tblname, is_na
+		FROM (
+			SELECT
+				(4 + tpl_hdr_size + tpl_data_size + (2 * ma)
+					- CASE WHEN tpl_hdr_size % ma = 0 THEN ma ELSE tpl_hdr_size % ma END
+					- CASE WHEN ceil(tpl_data_size)::int % ma = 0 THEN ma ELSE ceil(tpl_data_size)::int % ma END
+				) AS tpl_size,
+				heappages + toastpages AS tblpages,
+				reltuples, toasttuples, bs, page_hdr, schemaname, tblname, fillfactor, is_na
+			FROM (
+				SELECT
+					ns.nspname AS schemaname,
+					tbl.relname AS tblname,
+					tbl.reltuples,
+					tbl.relpages AS heappages,
+					coalesce(toast.relpages, 0) AS toastpages,
+					coalesce(toast.reltuples, 0) AS toasttuples,
+					coalesce(substring(array_to_string(tbl.reloptions, ' ') FROM 'fillfactor=([0-9]+)')::smallint, 100) AS fillfactor,
+					current_setting('block_size')::numeric AS bs,
+					CASE WHEN version() ~ 'mingw32|64-bit|x86_64|ppc64|ia64|amd64' THEN 8 ELSE 4 END AS ma,
+					24 AS page_hdr,
+					23 + CASE WHEN max(coalesce(s.null_frac, 0)) > 0 THEN (7 + count(s.attname)) / 8 ELSE 0::int END AS tpl_hdr_size,
+					sum((1 - coalesce(s.null_frac, 0)) * coalesce(s.avg_width, 0)) AS tpl_data_size,
+					bool_or(att.atttypid = 'pg_catalog.name'::regtype)
+						OR sum(CASE WHEN att.attnum > 0 THEN 1 ELSE 0 END) <> count(s.attname) AS is_na
+				FROM pg_attribute att
+				JOIN pg_class tbl ON tbl.oid = att.attrelid
+				JOIN pg_namespace ns ON ns.oid = tbl.relnamespace
+				LEFT JOIN pg_stats s ON s.schemaname = ns.nspname
+					AND s.tablename = tbl.relname
+					AND s.inherited = false
+					AND s.attname = att.attname
+				LEFT JOIN pg_class toast ON toast.oid = tbl.reltoastrelid
+				WHERE NOT att.attisdropped
+				  AND att.attnum > 0
+				  AND tbl.relkind IN ('r', 'm')
+				  AND ns.nspname NOT IN ('pg_catalog', 'information_schema')
+				  AND ns.nspname NOT LIKE 'pg_toast%'
+				GROUP BY 1, 2, 3, 4, 5, 6, 7, 8, 9, 10
+			) AS s
+		) AS s2
+	) AS s3
+	ORDER BY schemaname, tblname
+`
+
+// btreeBloatQuery is the matching estimate for B-tree indexes: the leaf
+// pages the index tuples need, from the widths of the indexed columns (or
+// expressions), against relpages. Other access methods are not estimated.
+const btreeBloatQuery = `
+	SELECT nspname, tblname, idxname, bs * relpages, fillfactor,
+		CASE WHEN relpages > est_pages_ff THEN bs * (relpages - est_pages_ff) ELSE 0 END,
+		is_na
+	FROM (
+		SELECT
+			coalesce(1 + ceil(reltuples / floor((bs - pageopqdata - pagehdr) * fillfactor / (100 * (4 + nulldatahdrwidth)::float))), 0) AS est_pages_ff,
+			bs, nspname, tblname, idxname, relpages, fillfactor, is_na
+		FROM (
+			SELECT maxalign, bs, nspname, tblname, idxname, reltuples, relpages, fillfactor,
+				(index_tuple_hdr_bm
+					+ maxalign - CASE WHEN index_tuple_hdr_bm % maxalign = 0 THEN maxalign ELSE index_tuple_hdr_bm % maxalign END
+					+ nulldatawidth + maxalign - CASE
+						WHEN nulldatawidth = 0 THEN 0
+						WHEN nulldatawidth::integer % maxalign = 0 THEN maxalign
+						ELSE nulldatawidth::integer % maxalign
+					END
+				)::numeric AS nulldatahdrwidth,
+				pagehdr, pageopqdata, is_na
+			FROM (
+				SELECT n.nspname, i.tblname, i.idxname, i.reltuples, i.relpages, i.fillfactor,
+					current_setting('block_size')::numeric AS bs,
+					CASE WHEN version() ~ 'mingw32|64-bit|x86_64|ppc64|ia64|amd64' THEN 8 ELSE 4 END AS maxalign,
+					24 AS pagehdr,
+					16 AS pageopqdata,
+					CASE WHEN max(coalesce(s.null_frac, 0)) = 0 THEN 8 ELSE 8 + ((32 + 8 - 1) / 8) END AS index_tuple_hdr_bm,
+					sum((1 - coalesce(s.null_frac, 0)) * coalesce(s.avg_width, 1024)) AS nulldatawidth,
+					max(CASE WHEN i.atttypid = 'pg_catalog.name'::regtype THEN 1 ELSE 0 END) > 0 AS is_na
+				FROM (
+					SELECT ct.relname AS tblname, ct.relnamespace, ic.idxname, ic.reltuples, ic.relpages, ic.fillfactor,
+						coalesce(a1.attname, a2.attname) AS attname,
+						coalesce(a1.atttypid, a2.atttypid) AS atttypid,
+						CASE WHEN a1.attnum IS NULL THEN ic.idxname ELSE ct.relname END AS attrelname
+					FROM (
+						SELECT ci.relname AS idxname, ci.reltuples, ci.relpages,
+							i.indrelid AS tbloid, i.indexrelid AS idxoid,
+							coalesce(substring(array_to_string(ci.reloptions, ' ') FROM 'fillfactor=([0-9]+)')::smallint, 90) AS fillfactor,
+							string_to_array(textin(int2vectorout(i.indkey)), ' ')::int[] AS indkey,
+							generate_series(1, i.indnatts) AS attpos
+						FROM pg_index i
+						JOIN pg_class ci ON ci.oid = i.indexrelid
+						WHERE ci.relam = (SELECT oid FROM pg_am WHERE amname = 'btree')
+						  AND ci.relpages > 0
+					) AS ic
+					JOIN pg_class ct ON ct.oid = ic.tbloid
+					LEFT JOIN pg_attribute a1 ON ic.indkey[ic.attpos] <> 0
+						AND a1.attrelid = ic.tbloid
+						AND a1.attnum = ic.indkey[ic.attpos]
+					LEFT JOIN pg_attribute a2 ON ic.indkey[ic.attpos] = 0
+						AND a2.attrelid = ic.idxoid
+						AND a2.attnum = ic.attpos
+				) i
+				JOIN pg_namespace n ON n.oid = i.relnamespace
+				JOIN pg_stats s ON s.schemaname = n.nspname
+					AND s.tablename = i.attrelname
+					AND s.attname = i.attname
+				WHERE n.nspname NOT IN ('pg_catalog', 'information_schema')
+				  AND n.nspname NOT LIKE 'pg_toast%'
+				GROUP BY 1, 2, 3, 4, 5, 6
+			) AS rows_data_stats
+		) AS rows_hdr_pdg_stats
+	) AS relation_stats
+	ORDER BY nspname, tblname, idxname
+`
+
+// GetBloat estimates the bloat of every table and B-tree index from the
+// planner statistics. With exact set and the pgstattuple extension
+// installed, the relations the estimate finds bloated, or cannot estimate,
+// are measured instead; this reads them, so it is opt-in.
+func (sc *StatsCollector) GetBloat(exact bool) ([]store.BloatEstimate, error) {
+	logger.LogInfo("Estimating table and index bloat")
+
+	var estimates []store.BloatEstimate
+	var unreliable []bool
+	scan := func(query string, index bool) error {
+		rows, err := sc.db.Query(query)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var b store.BloatEstimate
+			var size, wasted float64
+			var isNA bool
+			var err error
+			if index {
+				err = rows.Scan(&b.SchemaName, &b.TableName, &b.IndexName, &size, &b.FillFactor, &wasted, &isNA)
+			} else {
+				err = rows.Scan(&b.SchemaName, &b.TableName, &size, &b.FillFactor, &wasted, &isNA)
+			}
+			if err != nil {
+				return err
+			}
+			b.SizeBytes, b.WastedBytes = int64(size), int64(wasted)
+			b.Source = store.BloatEstimated
+			estimates = append(estimates, b)
+			unreliable = append(unreliable, isNA)
+		}
+		return rows.Err()
+	}
+
+	if err := scan(tableBloatQuery, false); err != nil {
+		logger.LogErrorf("Failed to estimate table bloat: %v", err)
+		return nil, fmt.Errorf("failed to estimate table bloat: %w", err)
+	}
+	if err := scan(btreeBloatQuery, true); err != nil {
+		logger.LogErrorf("Failed to estimate index bloat: %v", err)
+		return nil, fmt.Errorf("failed to estimate index bloat: %w", err)
+	}
+
+	measure := false
+	if exact {
+		if err := sc.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pgstattuple')`).Scan(&measure); err != nil {
+			logger.LogErrorf("Failed to check for pgstattuple: %v", err)
+			return nil, fmt.Errorf("failed to check for pgstattuple: %w", err)
+		}
+		if !measure {
+			logger.LogInfo("pgstattuple is not installed, keeping the statistical estimates")
+		}
+	}
+
+	// Without column widths the estimate can be wildly off, so relations
+	// pgstattuple does not measure are left out
+	kept := estimates[:0]
+	measured := 0
+	for i, b := range estimates {
+		if measure && (b.WastedBytes > 0 || unreliable[i]) {
+			if err := sc.measureBloat(&b); err != nil {
+				logger.LogDebugf("pgstattuple failed for %s.%s: %v", b.SchemaName, relationName(b), err)
+			} else {
+				measured++
+				unreliable[i] = false
+			}
+		}
+		if unreliable[i] {
+			logger.LogDebugf("Skipping bloat estimate for %s.%s, its columns have no statistics", b.SchemaName, relationName(b))
+			continue
+		}
+		kept = append(kept, b)
+	}
+	estimates = kept
+	if measure {
+		logger.LogInfof("Measured %d relations with pgstattuple", measured)
+	}
+
+	logger.LogInfof("Collected %d bloat estimates", len(estimates))
+	return estimates, nil
+}
+
+// measureBloat replaces an estimate with pgstattuple's figures. Tables use
+// pgstattuple_approx, which skips all-visible pages; the free space a fill
+// factor reserves on purpose is not counted as waste.
+func (sc *StatsCollector) measureBloat(b *store.BloatEstimate) error {
+	relation := pq.QuoteIdentifier(b.SchemaName) + "." + pq.QuoteIdentifier(relationName(*b))
+
+	if b.IndexName != "" {
+		var size int64
+		var density sql.NullFloat64
+		err := sc.db.QueryRow(`SELECT index_size, avg_leaf_density FROM pgstatindex($1::regclass)`, relation).Scan(&size, &density)
+		if err != nil {
+			return err
+		}
+		b.SizeBytes = size
+		b.WastedBytes = 0
+		if density.Valid && b.FillFactor > 0 {
+			// avg_leaf_density is a percentage, the fill factor its target
+			if used := density.Float64 / float64(b.FillFactor); used < 1 {
+				b.WastedBytes = int64(float64(size) * (1 - used))
+			}
+		}
+		b.Source = store.BloatPgstattuple
+		return nil
+	}
+
+	var size, dead int64
+	var free float64
+	err := sc.db.QueryRow(`SELECT table_len, dead_tuple_len, approx_free_space FROM pgstattuple_approx($1::regclass)`, relation).Scan(&size, &dead, &free)
+	if err != nil {
+		return err
+	}
+	reserved := float64(size) * float64(100-b.FillFactor) / 100
+	b.SizeBytes = size
+	b.DeadTupleBytes = dead
+	b.WastedBytes = dead + int64(max(free-reserved, 0))
+	b.Source = store.BloatPgstattuple
+	return nil
+}
+
+func relationName(b store.BloatEstimate) string {
+	if b.IndexName != "" {
+		return b.IndexName
+	}
+	return b.TableName
+}
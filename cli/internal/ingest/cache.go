@@ -0,0 +1,110 @@
+package ingest
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"cli/internal/logger"
+	"cli/internal/store"
+)
+
+// GetCacheStats reads the buffer cache hits and reads of every user table
+// and index, with how much of each is in shared_buffers now when
+// pg_buffercache is installed.
+func (sc *StatsCollector) GetCacheStats() (*store.CacheUsage, error) {
+	logger.LogInfo("Collecting buffer cache statistics")
+
+	usage := &store.CacheUsage{CapturedAt: time.Now().UTC()}
+
+	var statsReset sql.NullTime
+	var preload string
+	err := sc.db.QueryRow(`
+		SELECT
+			(SELECT stats_reset FROM pg_stat_database WHERE datname = current_database()),
+			EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_buffercache'),
+			EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_prewarm'),
+			current_setting('shared_preload_libraries')
+	`).Scan(&statsReset, &usage.Buffercache, &usage.Prewarm, &preload)
+	if err != nil {
+		logger.LogErrorf("Failed to read cache settings: %v", err)
+		return nil, fmt.Errorf("failed to read cache settings: %w", err)
+	}
+	if statsReset.Valid {
+		usage.StatsReset = &statsReset.Time
+	}
+	for _, lib := range strings.Split(preload, ",") {
+		if strings.TrimSpace(lib) == "pg_prewarm" {
+			usage.Autoprewarm = true
+		}
+	}
+
+	// Reading pg_buffercache needs pg_monitor; without it the hit ratios
+	// are still worth reporting
+	cached := map[int64]int64{}
+	if usage.Buffercache {
+		if cached, err = sc.cachedBytes(); err != nil {
+			logger.LogInfof("Could not read pg_buffercache, reporting without cached sizes: %v", err)
+			usage.Buffercache = false
+		}
+	}
+
+	rows, err := sc.db.Query(`
+		SELECT relid::bigint, schemaname, relname, '',
+			coalesce(heap_blks_read, 0), coalesce(heap_blks_hit, 0),
+			pg_relation_size(relid)
+		FROM pg_statio_user_tables
+		UNION ALL
+		SELECT indexrelid::bigint, schemaname, relname, indexrelname,
+			coalesce(idx_blks_read, 0), coalesce(idx_blks_hit, 0),
+			pg_relation_size(indexrelid)
+		FROM pg_statio_user_indexes
+	`)
+	if err != nil {
+		logger.LogErrorf("Failed to read buffer cache statistics: %v", err)
+		return nil, fmt.Errorf("failed to read buffer cache statistics: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var oid int64
+		var c store.CacheStats
+		if err := rows.Scan(&oid, &c.SchemaName, &c.TableName, &c.IndexName, &c.BlksRead, &c.BlksHit, &c.SizeBytes); err != nil {
+			return nil, fmt.Errorf("failed to scan buffer cache statistics: %w", err)
+		}
+		c.CachedBytes = cached[oid]
+		usage.Relations = append(usage.Relations, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read buffer cache statistics: %w", err)
+	}
+
+	logger.LogInfof("Collected buffer cache statistics of %d relations", len(usage.Relations))
+	return usage, nil
+}
+
+// cachedBytes sums the shared buffers each relation of this database holds
+func (sc *StatsCollector) cachedBytes() (map[int64]int64, error) {
+	rows, err := sc.db.Query(`
+		SELECT c.oid::bigint, count(*) * current_setting('block_size')::bigint
+		FROM pg_buffercache b
+		JOIN pg_class c ON b.relfilenode = pg_relation_filenode(c.oid)
+		WHERE b.reldatabase = (SELECT oid FROM pg_database WHERE datname = current_database())
+		GROUP BY c.oid
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cached := make(map[int64]int64)
+	for rows.Next() {
+		var oid, bytes int64
+		if err := rows.Scan(&oid, &bytes); err != nil {
+			return nil, err
+		}
+		cached[oid] = bytes
+	}
+	return cached, rows.Err()
+}
@@ -0,0 +1,73 @@
+package ingest
+
+import (
+	"database/sql"
+	"time"
+
+	"cli/internal/config"
+	"cli/internal/store"
+)
+
+// Collector reads workload and schema statistics from one database engine
+// and maps them into the store types the rule engine and advisor consume.
+type Collector interface {
+	// Engine is config.EnginePostgres or config.EngineMySQL
+	Engine() string
+
+	GetQueryStats() ([]store.QueryStats, error)
+	GetSlowQueries(minDurationMS float64) ([]store.QueryStats, error)
+	GetWorkload(limit int) ([]store.QueryStats, error)
+	GetTableInfo() ([]store.TableInfo, error)
+	GetIndexInfo() ([]store.IndexInfo, error)
+	// GetColumnStats reads planner statistics for the columns of the named
+	// tables, or of every table when tables is empty
+	GetColumnStats(tables []string) ([]store.ColumnStats, error)
+	GetForeignKeys() ([]store.ForeignKey, error)
+	// GetBloat estimates the space tables and indexes waste; exact asks for
+	// measurements where the engine can take them, at the cost of reading
+	// the relations
+	GetBloat(exact bool) ([]store.BloatEstimate, error)
+	// GetVacuumHealth reads freeze ages and autovacuum state; PostgreSQL only
+	GetVacuumHealth() (*store.VacuumHealth, error)
+	// SampleActivity reads the sessions that are working or holding locks
+	// now; it needs a live database
+	SampleActivity() (*store.ActivitySample, error)
+	// SampleWaits reads the sessions that are working and what they wait
+	// on, without locks; it needs a live database
+	SampleWaits() (*store.ActivitySample, error)
+	// GetTransactionHorizon reads open transactions, replication slots and
+	// prepared transactions; PostgreSQL only
+	GetTransactionHorizon() (*store.TransactionHorizon, error)
+	// GetMemorySettings reads work_mem and the roles that override it;
+	// PostgreSQL only
+	GetMemorySettings() (*store.MemorySettings, error)
+	// GetCacheStats reads the buffer cache hits and reads of every table and
+	// index; PostgreSQL only
+	GetCacheStats() (*store.CacheUsage, error)
+
+	// Windowed statistics, see delta.go
+	TakeSnapshot() (*StatsSnapshot, error)
+	CollectDeltas() ([]store.QueryDelta, error)
+	LatestDeltas() []store.QueryDelta
+	SampleDeltas(window time.Duration) ([]store.QueryDelta, error)
+	GetSlowQueriesInWindow(minDurationMS float64, window time.Duration) ([]store.QueryStats, error)
+	GetWorkloadInWindow(limit int, window time.Duration) ([]store.QueryStats, error)
+	StartSampling(interval time.Duration, stop <-chan struct{})
+}
+
+var (
+	_ Collector = (*StatsCollector)(nil)
+	_ Collector = (*MySQLCollector)(nil)
+)
+
+// NewCollector returns the collector for the engine of the active target
+func NewCollector(db *sql.DB) Collector {
+	if config.Get().Database.Engine == config.EngineMySQL {
+		return NewMySQLCollector(db)
+	}
+	return NewStatsCollector(db)
+}
+
+func (sc *StatsCollector) Engine() string {
+	return config.EnginePostgres
+}
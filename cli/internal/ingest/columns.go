@@ -0,0 +1,166 @@
+package ingest
+
+import (
+	"fmt"
+	"strings"
+
+	"cli/internal/logger"
+)
+
+// statementField maps one logical pg_stat_statements metric to the column
+// names it has had across PostgreSQL versions, newest first. Fields whose
+// columns are all missing are selected as Fallback.
+type statementField struct {
+	Alias      string
+	Candidates []string
+	Fallback   string
+}
+
+// statementFields is the column set read by every pg_stat_statements query,
+// in the order scanQueryStats expects.
+//
+//	13: total_time/mean_time split into *_exec_time and *_plan_time; wal_* added
+//	14: toplevel added
+//	17: blk_read_time/blk_write_time renamed to shared_blk_read_time/shared_blk_write_time
+//
+// Servers before 13 only have total_time/mean_time and no planning stats.
+var statementFields = []statementField{
+	{Alias: "queryid", Candidates: []string{"queryid"}, Fallback: "0"},
+	{Alias: "userid", Candidates: []string{"userid"}, Fallback: "0"},
+	{Alias: "dbid", Candidates: []string{"dbid"}, Fallback: "0"},
+	{Alias: "toplevel", Candidates: []string{"toplevel"}, Fallback: "true"},
+	{Alias: "query", Candidates: []string{"query"}, Fallback: "''"},
+	{Alias: "calls", Candidates: []string{"calls"}, Fallback: "0"},
+	{Alias: "mean_exec_time", Candidates: []string{"mean_exec_time", "mean_time"}, Fallback: "0"},
+	{Alias: "total_exec_time", Candidates: []string{"total_exec_time", "total_time"}, Fallback: "0"},
+	{Alias: "min_exec_time", Candidates: []string{"min_exec_time", "min_time"}, Fallback: "0"},
+	{Alias: "max_exec_time", Candidates: []string{"max_exec_time", "max_time"}, Fallback: "0"},
+	{Alias: "stddev_exec_time", Candidates: []string{"stddev_exec_time", "stddev_time"}, Fallback: "0"},
+	{Alias: "rows", Candidates: []string{"rows"}, Fallback: "0"},
+	{Alias: "plans", Candidates: []string{"plans"}, Fallback: "0"},
+	{Alias: "total_plan_time", Candidates: []string{"total_plan_time"}, Fallback: "0"},
+	{Alias: "mean_plan_time", Candidates: []string{"mean_plan_time"}, Fallback: "0"},
+	{Alias: "shared_blks_hit", Candidates: []string{"shared_blks_hit"}, Fallback: "0"},
+	{Alias: "shared_blks_read", Candidates: []string{"shared_blks_read"}, Fallback: "0"},
+	{Alias: "shared_blks_dirtied", Candidates: []string{"shared_blks_dirtied"}, Fallback: "0"},
+	{Alias: "shared_blks_written", Candidates: []string{"shared_blks_written"}, Fallback: "0"},
+	{Alias: "local_blks_hit", Candidates: []string{"local_blks_hit"}, Fallback: "0"},
+	{Alias: "local_blks_read", Candidates: []string{"local_blks_read"}, Fallback: "0"},
+	{Alias: "local_blks_dirtied", Candidates: []string{"local_blks_dirtied"}, Fallback: "0"},
+	{Alias: "local_blks_written", Candidates: []string{"local_blks_written"}, Fallback: "0"},
+	{Alias: "temp_blks_read", Candidates: []string{"temp_blks_read"}, Fallback: "0"},
+	{Alias: "temp_blks_written", Candidates: []string{"temp_blks_written"}, Fallback: "0"},
+	{Alias: "blk_read_time", Candidates: []string{"shared_blk_read_time", "blk_read_time"}, Fallback: "0"},
+	{Alias: "blk_write_time", Candidates: []string{"shared_blk_write_time", "blk_write_time"}, Fallback: "0"},
+	{Alias: "wal_records", Candidates: []string{"wal_records"}, Fallback: "0"},
+	{Alias: "wal_fpi", Candidates: []string{"wal_fpi"}, Fallback: "0"},
+	{Alias: "wal_bytes", Candidates: []string{"wal_bytes"}, Fallback: "0"},
+}
+
+// StatementColumns is the pg_stat_statements layout detected on the server.
+type StatementColumns struct {
+	ServerVersion int
+	Available     map[string]bool
+	selectList    string
+}
+
+// detectStatementColumns inspects the pg_stat_statements view rather than
+// trusting the server version alone, since the extension can lag behind the
+// server after an upgrade until ALTER EXTENSION ... UPDATE is run.
+func (sc *StatsCollector) detectStatementColumns() (*StatementColumns, error) {
+	sc.mu.Lock()
+	cached := sc.columns
+	sc.mu.Unlock()
+	if cached != nil {
+		return cached, nil
+	}
+
+	cols := &StatementColumns{Available: make(map[string]bool)}
+
+	if err := sc.db.QueryRow(`SELECT current_setting('server_version_num')::int`).Scan(&cols.ServerVersion); err != nil {
+		logger.LogErrorf("Failed to read server version: %v", err)
+		return nil, fmt.Errorf("failed to read server version: %w", err)
+	}
+
+	rows, err := sc.db.Query(`
+		SELECT attname
+		FROM pg_attribute
+		WHERE attrelid = 'pg_stat_statements'::regclass
+		  AND attnum > 0
+		  AND NOT attisdropped
+	`)
+	if err != nil {
+		logger.LogErrorf("Failed to inspect pg_stat_statements columns: %v", err)
+		return nil, fmt.Errorf("failed to inspect pg_stat_statements columns: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan column name: %w", err)
+		}
+		cols.Available[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read column names: %w", err)
+	}
+
+	cols.selectList = buildSelectList(cols.Available)
+	logger.LogInfof("Detected pg_stat_statements with %d columns on server version %d", len(cols.Available), cols.ServerVersion)
+
+	sc.mu.Lock()
+	sc.columns = cols
+	sc.mu.Unlock()
+	return cols, nil
+}
+
+func buildSelectList(available map[string]bool) string {
+	exprs := make([]string, 0, len(statementFields))
+	for _, f := range statementFields {
+		expr := f.Fallback
+		for _, candidate := range f.Candidates {
+			if available[candidate] {
+				expr = candidate
+				break
+			}
+		}
+
+		// Normalize types so every version scans into the same Go fields:
+		// wal_bytes is numeric and oids are unsigned.
+		switch f.Alias {
+		case "queryid", "userid", "dbid", "wal_bytes":
+			expr = fmt.Sprintf("COALESCE(%s, 0)::bigint", expr)
+		}
+
+		exprs = append(exprs, fmt.Sprintf("%s AS %s", expr, f.Alias))
+	}
+	return strings.Join(exprs, ",\n\t\t\t")
+}
+
+// statementsQuery wraps pg_stat_statements in a subquery exposing the
+// normalized aliases, so callers can filter and order by them on any version.
+func (sc *StatsCollector) statementsQuery(where, orderBy string, limit int) (string, error) {
+	cols, err := sc.detectStatementColumns()
+	if err != nil {
+		return "", err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT * FROM (
+			SELECT
+			%s
+			FROM pg_stat_statements
+		) s
+		WHERE query NOT LIKE '%%pg_stat_statements%%'`, cols.selectList)
+	if where != "" {
+		query += "\n\t\t  AND " + where
+	}
+	if orderBy != "" {
+		query += "\n\t\tORDER BY " + orderBy
+	}
+	if limit > 0 {
+		query += fmt.Sprintf("\n\t\tLIMIT %d", limit)
+	}
+	return query, nil
+}
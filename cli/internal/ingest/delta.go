@@ -0,0 +1,312 @@
+package ingest
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"cli/internal/config"
+	"cli/internal/logger"
+	"cli/internal/store"
+)
+
+// StatsSnapshot is a point-in-time copy of the cumulative pg_stat_statements
+// counters. Two snapshots give the activity in the window between them.
+type StatsSnapshot struct {
+	CapturedAt      time.Time
+	PostmasterStart time.Time
+	StatsReset      time.Time
+	Statements      map[string]store.QueryStats
+}
+
+// statementKey identifies a statement across snapshots. pg_stat_statements
+// keys entries by (userid, dbid, queryid, toplevel); the text is only a
+// fallback for servers where queryid is unavailable.
+func statementKey(s store.QueryStats) string {
+	if s.QueryID == 0 {
+		return s.Query
+	}
+	return fmt.Sprintf("%d/%d/%d/%t", s.UserID, s.DBID, s.QueryID, s.TopLevel)
+}
+
+// TakeSnapshot reads every pg_stat_statements entry. Unlike GetSlowQueries it
+// applies no threshold or limit, since an entry dropping out of a top-N list
+// would otherwise look like a new statement in the next window.
+func (sc *StatsCollector) TakeSnapshot() (*StatsSnapshot, error) {
+	logger.LogDebug("Taking pg_stat_statements snapshot")
+
+	snapshot := &StatsSnapshot{
+		Statements: make(map[string]store.QueryStats),
+	}
+
+	err := sc.db.QueryRow(`SELECT now(), pg_postmaster_start_time()`).
+		Scan(&snapshot.CapturedAt, &snapshot.PostmasterStart)
+	if err != nil {
+		logger.LogErrorf("Failed to read server clock: %v", err)
+		return nil, fmt.Errorf("failed to read server clock: %w", err)
+	}
+
+	// pg_stat_statements_info only exists on PostgreSQL 14+; older servers
+	// rely on counter decreases alone to detect resets.
+	var statsReset sql.NullTime
+	if err := sc.db.QueryRow(`SELECT stats_reset FROM pg_stat_statements_info`).Scan(&statsReset); err != nil {
+		logger.LogDebugf("pg_stat_statements_info unavailable: %v", err)
+	} else if statsReset.Valid {
+		snapshot.StatsReset = statsReset.Time
+	}
+
+	query, err := sc.statementsQuery("", "", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := sc.db.Query(query)
+	if err != nil {
+		logger.LogErrorf("Failed to snapshot pg_stat_statements: %v", err)
+		return nil, fmt.Errorf("failed to snapshot pg_stat_statements: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		s, err := scanQueryStats(rows)
+		if err != nil {
+			logger.LogErrorf("Failed to scan snapshot row: %v", err)
+			return nil, fmt.Errorf("failed to scan snapshot row: %w", err)
+		}
+
+		// Without a queryid the same text can appear once per user/database;
+		// fold them together
+		key := statementKey(s)
+		if existing, ok := snapshot.Statements[key]; ok {
+			s.Calls += existing.Calls
+			s.TotalTime += existing.TotalTime
+			s.Rows += existing.Rows
+			s.TotalPlanTime += existing.TotalPlanTime
+			s.SharedBlksHit += existing.SharedBlksHit
+			s.SharedBlksRead += existing.SharedBlksRead
+			s.TempBlksRead += existing.TempBlksRead
+			s.TempBlksWritten += existing.TempBlksWritten
+			s.BlkReadTime += existing.BlkReadTime
+			s.WALBytes += existing.WALBytes
+		}
+		if s.Calls > 0 {
+			s.MeanExecTime = s.TotalTime / float64(s.Calls)
+		}
+		snapshot.Statements[key] = s
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read snapshot rows: %w", err)
+	}
+
+	logger.LogDebugf("Snapshot captured %d statements", len(snapshot.Statements))
+	return snapshot, nil
+}
+
+// ComputeDeltas returns per-statement activity between two snapshots, ordered
+// by time spent in the window. A server restart, a pg_stat_statements_reset()
+// or any counter going backwards means the current counters started from zero
+// inside the window, so they are used as the delta and the entry is marked
+// Reset. Statements with no calls in the window are omitted.
+func ComputeDeltas(prev, curr *StatsSnapshot) []store.QueryDelta {
+	interval := curr.CapturedAt.Sub(prev.CapturedAt).Seconds()
+	globalReset := !prev.PostmasterStart.Equal(curr.PostmasterStart) || !prev.StatsReset.Equal(curr.StatsReset)
+	if globalReset {
+		logger.LogInfo("Statement statistics were reset or the server restarted between snapshots")
+	}
+
+	var deltas []store.QueryDelta
+	for key, c := range curr.Statements {
+		var base store.QueryStats
+		reset := globalReset
+
+		if p, seen := prev.Statements[key]; seen && !reset {
+			if countersDecreased(p, c) {
+				logger.LogDebugf("Counter decrease detected, treating as reset: %s", c.Query[:min(50, len(c.Query))])
+				reset = true
+			} else {
+				base = p
+			}
+		}
+
+		d := store.QueryDelta{
+			QueryID:         c.QueryID,
+			Query:           c.Query,
+			Calls:           c.Calls - base.Calls,
+			TotalTime:       c.TotalTime - base.TotalTime,
+			Rows:            c.Rows - base.Rows,
+			TotalPlanTime:   c.TotalPlanTime - base.TotalPlanTime,
+			SharedBlksHit:   c.SharedBlksHit - base.SharedBlksHit,
+			SharedBlksRead:  c.SharedBlksRead - base.SharedBlksRead,
+			TempBlksRead:    c.TempBlksRead - base.TempBlksRead,
+			TempBlksWritten: c.TempBlksWritten - base.TempBlksWritten,
+			BlkReadTime:     c.BlkReadTime - base.BlkReadTime,
+			WALBytes:        c.WALBytes - base.WALBytes,
+			WindowStart:     prev.CapturedAt,
+			WindowEnd:       curr.CapturedAt,
+			IntervalSeconds: interval,
+			Reset:           reset,
+		}
+		if d.Calls <= 0 {
+			continue
+		}
+
+		d.MeanExecTime = d.TotalTime / float64(d.Calls)
+		if interval > 0 {
+			d.CallsPerSec = float64(d.Calls) / interval
+		}
+		deltas = append(deltas, d)
+	}
+
+	sort.Slice(deltas, func(i, j int) bool {
+		return deltas[i].TotalTime > deltas[j].TotalTime
+	})
+	return deltas
+}
+
+func countersDecreased(prev, curr store.QueryStats) bool {
+	return curr.Calls < prev.Calls ||
+		curr.TotalTime < prev.TotalTime ||
+		curr.Rows < prev.Rows ||
+		curr.SharedBlksHit < prev.SharedBlksHit ||
+		curr.SharedBlksRead < prev.SharedBlksRead ||
+		curr.TempBlksWritten < prev.TempBlksWritten
+}
+
+// sampler turns successive snapshots into deltas. Each collector embeds it
+// and points take at its own TakeSnapshot.
+type sampler struct {
+	take func() (*StatsSnapshot, error)
+
+	mu           sync.Mutex
+	lastSnapshot *StatsSnapshot
+	lastDeltas   []store.QueryDelta
+}
+
+// CollectDeltas takes a snapshot and returns the deltas since the previous
+// call. The first call only records a baseline and returns no deltas.
+func (sc *sampler) CollectDeltas() ([]store.QueryDelta, error) {
+	curr, err := sc.take()
+	if err != nil {
+		return nil, err
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	prev := sc.lastSnapshot
+	sc.lastSnapshot = curr
+	if prev == nil {
+		logger.LogInfo("Recorded baseline statement snapshot")
+		return nil, nil
+	}
+
+	sc.lastDeltas = ComputeDeltas(prev, curr)
+	logger.LogInfof("Computed %d statement deltas over %.1fs", len(sc.lastDeltas), curr.CapturedAt.Sub(prev.CapturedAt).Seconds())
+	return sc.lastDeltas, nil
+}
+
+// LatestDeltas returns the most recent window computed by CollectDeltas or
+// StartSampling.
+func (sc *sampler) LatestDeltas() []store.QueryDelta {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.lastDeltas
+}
+
+// SampleDeltas takes two snapshots window apart and returns the activity
+// between them.
+func (sc *sampler) SampleDeltas(window time.Duration) ([]store.QueryDelta, error) {
+	logger.LogInfof("Sampling statement statistics over a %s window", window)
+
+	prev, err := sc.take()
+	if err != nil {
+		return nil, err
+	}
+
+	time.Sleep(window)
+
+	curr, err := sc.take()
+	if err != nil {
+		return nil, err
+	}
+
+	return ComputeDeltas(prev, curr), nil
+}
+
+// GetSlowQueriesInWindow is the windowed counterpart of GetSlowQueries: it
+// ranks statements by their mean time within the sampled window, so a query
+// that was slow before the window but is fine now no longer tops the list.
+func (sc *sampler) GetSlowQueriesInWindow(minDurationMS float64, window time.Duration) ([]store.QueryStats, error) {
+	deltas, err := sc.SampleDeltas(window)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats []store.QueryStats
+	for _, d := range deltas {
+		if d.MeanExecTime > minDurationMS {
+			stats = append(stats, d.AsQueryStats())
+		}
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].MeanExecTime > stats[j].MeanExecTime
+	})
+	if limit := config.Get().Rules.SlowQueryLimit; len(stats) > limit {
+		stats = stats[:limit]
+	}
+
+	logger.LogInfof("Collected %d slow queries in window", len(stats))
+	return stats, nil
+}
+
+// GetWorkloadInWindow is GetWorkload over a sampling window.
+func (sc *sampler) GetWorkloadInWindow(limit int, window time.Duration) ([]store.QueryStats, error) {
+	deltas, err := sc.SampleDeltas(window)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]store.QueryStats, 0, len(deltas))
+	for _, d := range deltas {
+		stats = append(stats, d.AsQueryStats())
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].TotalTime > stats[j].TotalTime
+	})
+	if limit > 0 && len(stats) > limit {
+		stats = stats[:limit]
+	}
+
+	logger.LogInfof("Collected %d workload statements in window", len(stats))
+	return stats, nil
+}
+
+// StartSampling calls CollectDeltas every interval until stop is closed.
+func (sc *sampler) StartSampling(interval time.Duration, stop <-chan struct{}) {
+	logger.LogInfof("Starting statement sampling every %s", interval)
+
+	go func() {
+		if _, err := sc.CollectDeltas(); err != nil {
+			logger.LogErrorf("Failed to take baseline snapshot: %v", err)
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := sc.CollectDeltas(); err != nil {
+					logger.LogErrorf("Failed to collect statement deltas: %v", err)
+				}
+			case <-stop:
+				logger.LogInfo("Stopped statement sampling")
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,367 @@
+package ingest
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"cli/internal/logger"
+	"cli/internal/store"
+)
+
+// ExportFormatVersion is bumped whenever the export layout changes in a way
+// older readers cannot load.
+const ExportFormatVersion = 1
+
+// Export is everything the analysis commands read from a live database,
+// captured so it can be analyzed elsewhere with --from-snapshot.
+type Export struct {
+	FormatVersion int       `json:"format_version"`
+	Engine        string    `json:"engine"`
+	Source        string    `json:"source"` // target description, never credentials
+	ExportedAt    time.Time `json:"exported_at"`
+
+	// Baseline is only set when the export sampled a window; the activity
+	// between it and Statements is what --window analyses read.
+	Baseline   *ExportedSnapshot `json:"baseline,omitempty"`
+	Statements ExportedSnapshot  `json:"statements"`
+
+	Tables      []store.TableInfo     `json:"tables"`
+	Indexes     []store.IndexInfo     `json:"indexes"`
+	ColumnStats []store.ColumnStats   `json:"column_stats,omitempty"`
+	ForeignKeys []store.ForeignKey    `json:"foreign_keys,omitempty"`
+	Bloat       []store.BloatEstimate `json:"bloat,omitempty"`
+	Vacuum      *store.VacuumHealth   `json:"vacuum,omitempty"`
+	Memory      *store.MemorySettings `json:"memory,omitempty"`
+	Cache       *store.CacheUsage     `json:"cache,omitempty"`
+
+	// Plans holds EXPLAIN (FORMAT JSON) output keyed by query fingerprint
+	Plans map[string]json.RawMessage `json:"plans,omitempty"`
+}
+
+// ExportedSnapshot is the serialized form of a StatsSnapshot.
+type ExportedSnapshot struct {
+	CapturedAt      time.Time          `json:"captured_at"`
+	PostmasterStart time.Time          `json:"postmaster_start"`
+	StatsReset      time.Time          `json:"stats_reset"`
+	Statements      []store.QueryStats `json:"statements"`
+}
+
+// NewExportedSnapshot flattens a snapshot, busiest statements first so the
+// file reads sensibly.
+func NewExportedSnapshot(snapshot *StatsSnapshot) ExportedSnapshot {
+	es := ExportedSnapshot{
+		CapturedAt:      snapshot.CapturedAt,
+		PostmasterStart: snapshot.PostmasterStart,
+		StatsReset:      snapshot.StatsReset,
+		Statements:      make([]store.QueryStats, 0, len(snapshot.Statements)),
+	}
+	for _, s := range snapshot.Statements {
+		es.Statements = append(es.Statements, s)
+	}
+	sort.Slice(es.Statements, func(i, j int) bool {
+		return es.Statements[i].TotalTime > es.Statements[j].TotalTime
+	})
+	return es
+}
+
+// Snapshot rebuilds the keyed snapshot the delta code works on.
+func (es ExportedSnapshot) Snapshot() *StatsSnapshot {
+	snapshot := &StatsSnapshot{
+		CapturedAt:      es.CapturedAt,
+		PostmasterStart: es.PostmasterStart,
+		StatsReset:      es.StatsReset,
+		Statements:      make(map[string]store.QueryStats, len(es.Statements)),
+	}
+	for _, s := range es.Statements {
+		snapshot.Statements[statementKey(s)] = s
+	}
+	return snapshot
+}
+
+// IsTarball reports whether path names a gzipped tar export rather than a
+// single JSON document.
+func IsTarball(path string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz")
+}
+
+// WriteExportFile writes e as JSON, or as a tarball when the name ends in
+// .tar.gz or .tgz.
+func WriteExportFile(path string, e *Export) error {
+	logger.LogInfof("Writing snapshot export to %s", path)
+
+	file, err := os.Create(path)
+	if err != nil {
+		logger.LogErrorf("Failed to create export file: %v", err)
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+
+	if IsTarball(path) {
+		err = writeExportTarball(file, e)
+	} else {
+		err = writeExportJSON(file, e)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	return nil
+}
+
+func writeExportJSON(w io.Writer, e *Export) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(e)
+}
+
+// The tarball splits the export into one member per section, with plans as
+// individual EXPLAIN documents that other plan viewers can open:
+//
+//	manifest.json        format_version, engine, source, exported_at
+//	baseline.json        only for windowed exports
+//	statements.json
+//	tables.json
+//	indexes.json
+//	column_stats.json    only when column statistics were readable
+//	foreign_keys.json
+//	bloat.json           only when bloat could be estimated
+//	vacuum.json          only for PostgreSQL
+//	memory.json          only for PostgreSQL
+//	cache.json           only for PostgreSQL
+//	plans/<fingerprint>.json
+const (
+	tarManifest    = "manifest.json"
+	tarBaseline    = "baseline.json"
+	tarStatements  = "statements.json"
+	tarTables      = "tables.json"
+	tarIndexes     = "indexes.json"
+	tarColumns     = "column_stats.json"
+	tarForeignKeys = "foreign_keys.json"
+	tarBloat       = "bloat.json"
+	tarVacuum      = "vacuum.json"
+	tarMemory      = "memory.json"
+	tarCache       = "cache.json"
+	tarPlansDir    = "plans/"
+)
+
+func writeExportTarball(w io.Writer, e *Export) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	add := func(name string, v interface{}) error {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", name, err)
+		}
+		header := &tar.Header{
+			Name:    name,
+			Mode:    0o644,
+			Size:    int64(len(data)),
+			ModTime: e.ExportedAt,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	}
+
+	manifest := Export{
+		FormatVersion: e.FormatVersion,
+		Engine:        e.Engine,
+		Source:        e.Source,
+		ExportedAt:    e.ExportedAt,
+	}
+	if err := add(tarManifest, manifest); err != nil {
+		return err
+	}
+	if e.Baseline != nil {
+		if err := add(tarBaseline, e.Baseline); err != nil {
+			return err
+		}
+	}
+	if err := add(tarStatements, e.Statements); err != nil {
+		return err
+	}
+	if err := add(tarTables, e.Tables); err != nil {
+		return err
+	}
+	if err := add(tarIndexes, e.Indexes); err != nil {
+		return err
+	}
+	if len(e.ColumnStats) > 0 {
+		if err := add(tarColumns, e.ColumnStats); err != nil {
+			return err
+		}
+	}
+	if err := add(tarForeignKeys, e.ForeignKeys); err != nil {
+		return err
+	}
+	if len(e.Bloat) > 0 {
+		if err := add(tarBloat, e.Bloat); err != nil {
+			return err
+		}
+	}
+	if e.Vacuum != nil {
+		if err := add(tarVacuum, e.Vacuum); err != nil {
+			return err
+		}
+	}
+	if e.Memory != nil {
+		if err := add(tarMemory, e.Memory); err != nil {
+			return err
+		}
+	}
+	if e.Cache != nil {
+		if err := add(tarCache, e.Cache); err != nil {
+			return err
+		}
+	}
+
+	fingerprints := make([]string, 0, len(e.Plans))
+	for fp := range e.Plans {
+		fingerprints = append(fingerprints, fp)
+	}
+	sort.Strings(fingerprints)
+	for _, fp := range fingerprints {
+		if err := add(tarPlansDir+fp+".json", e.Plans[fp]); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// ReadExportFile loads an export written by WriteExportFile, telling the
+// two layouts apart by content rather than by name.
+func ReadExportFile(path string) (*Export, error) {
+	logger.LogInfof("Reading snapshot export %s", path)
+
+	file, err := os.Open(path)
+	if err != nil {
+		logger.LogErrorf("Failed to open snapshot export: %v", err)
+		return nil, fmt.Errorf("failed to open snapshot export: %w", err)
+	}
+	defer file.Close()
+
+	buf := bufio.NewReader(file)
+	magic, _ := buf.Peek(2)
+
+	var e *Export
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		e, err = readExportTarball(buf)
+	} else {
+		e = &Export{}
+		err = json.NewDecoder(buf).Decode(e)
+	}
+	if err != nil {
+		logger.LogErrorf("Failed to read snapshot export: %v", err)
+		return nil, fmt.Errorf("failed to read snapshot export %s: %w", path, err)
+	}
+
+	switch {
+	case e.FormatVersion == 0:
+		return nil, fmt.Errorf("%s is not an optidb snapshot export", path)
+	case e.FormatVersion > ExportFormatVersion:
+		return nil, fmt.Errorf("%s uses export format %d, this optidb reads up to %d", path, e.FormatVersion, ExportFormatVersion)
+	}
+
+	logger.LogInfof("Loaded export of %s from %s: %d statements, %d tables, %d indexes, %d plans",
+		e.Source, e.ExportedAt.Format(time.RFC3339), len(e.Statements.Statements), len(e.Tables), len(e.Indexes), len(e.Plans))
+	return e, nil
+}
+
+func readExportTarball(r io.Reader) (*Export, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	e := &Export{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		name := path.Clean(header.Name)
+		decode := func(target interface{}) error {
+			if err := json.NewDecoder(tr).Decode(target); err != nil {
+				return fmt.Errorf("failed to decode %s: %w", header.Name, err)
+			}
+			return nil
+		}
+
+		switch {
+		case name == tarManifest:
+			var manifest Export
+			if err := decode(&manifest); err != nil {
+				return nil, err
+			}
+			e.FormatVersion = manifest.FormatVersion
+			e.Engine = manifest.Engine
+			e.Source = manifest.Source
+			e.ExportedAt = manifest.ExportedAt
+		case name == tarBaseline:
+			e.Baseline = &ExportedSnapshot{}
+			err = decode(e.Baseline)
+		case name == tarStatements:
+			err = decode(&e.Statements)
+		case name == tarTables:
+			err = decode(&e.Tables)
+		case name == tarIndexes:
+			err = decode(&e.Indexes)
+		case name == tarColumns:
+			err = decode(&e.ColumnStats)
+		case name == tarForeignKeys:
+			err = decode(&e.ForeignKeys)
+		case name == tarBloat:
+			err = decode(&e.Bloat)
+		case name == tarVacuum:
+			e.Vacuum = &store.VacuumHealth{}
+			err = decode(e.Vacuum)
+		case name == tarMemory:
+			e.Memory = &store.MemorySettings{}
+			err = decode(e.Memory)
+		case name == tarCache:
+			e.Cache = &store.CacheUsage{}
+			err = decode(e.Cache)
+		case strings.HasPrefix(name, tarPlansDir) && strings.HasSuffix(name, ".json"):
+			var plan json.RawMessage
+			if err := decode(&plan); err != nil {
+				return nil, err
+			}
+			if e.Plans == nil {
+				e.Plans = map[string]json.RawMessage{}
+			}
+			e.Plans[strings.TrimSuffix(strings.TrimPrefix(name, tarPlansDir), ".json")] = plan
+		default:
+			logger.LogDebugf("Ignoring unknown export member %s", header.Name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
@@ -0,0 +1,164 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testExport = "testdata/export.json"
+
+// compactPlans re-encodes the plans without indentation, since the tarball
+// stores each plan as its own indented document
+func compactPlans(t *testing.T, e *Export) {
+	t.Helper()
+	for fp, raw := range e.Plans {
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, raw); err != nil {
+			t.Fatalf("plan %s is not valid JSON: %v", fp, err)
+		}
+		e.Plans[fp] = buf.Bytes()
+	}
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+	}{
+		{name: "json", file: "export.json"},
+		{name: "tarball", file: "export.tar.gz"},
+		{name: "tgz", file: "export.tgz"},
+	}
+
+	want, err := ReadExportFile(testExport)
+	if err != nil {
+		t.Fatalf("ReadExportFile(%s): %v", testExport, err)
+	}
+	compactPlans(t, want)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := WriteExportFile(path, want); err != nil {
+				t.Fatalf("WriteExportFile: %v", err)
+			}
+			got, err := ReadExportFile(path)
+			if err != nil {
+				t.Fatalf("ReadExportFile: %v", err)
+			}
+			compactPlans(t, got)
+
+			if !reflect.DeepEqual(got, want) {
+				gotJSON, _ := json.MarshalIndent(got, "", "  ")
+				wantJSON, _ := json.MarshalIndent(want, "", "  ")
+				t.Errorf("export changed in a round trip through %s:\ngot  %s\nwant %s", tt.file, gotJSON, wantJSON)
+			}
+		})
+	}
+}
+
+func TestReadExportFileRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "not an export", content: `{"tables": []}`, wantErr: "not an optidb snapshot export"},
+		{name: "newer format", content: `{"format_version": 99}`, wantErr: "uses export format 99"},
+		{name: "invalid JSON", content: `{"format_version": 1,`, wantErr: "failed to read snapshot export"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "export.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ReadExportFile(path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ReadExportFile() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFileCollectorExplain(t *testing.T) {
+	export, err := ReadExportFile(testExport)
+	if err != nil {
+		t.Fatalf("ReadExportFile(%s): %v", testExport, err)
+	}
+	fc := NewFileCollector(export)
+
+	tests := []struct {
+		name     string
+		query    string
+		wantRoot string
+		wantErr  error
+	}{
+		{
+			name:     "exported plan",
+			query:    "SELECT customer_id, sum(total) FROM orders GROUP BY customer_id ORDER BY 2 DESC",
+			wantRoot: "Sort",
+		},
+		{
+			name:     "same statement with other literals and spacing",
+			query:    "select customer_id,  sum(total) from orders group by customer_id order by 2 desc",
+			wantRoot: "Sort",
+		},
+		{
+			name:    "statement without a plan",
+			query:   "SELECT * FROM orders WHERE customer_id = $1",
+			wantErr: ErrPlanNotExported,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := fc.Explain(tt.query)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Explain() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Explain() error = %v", err)
+			}
+			if plan.Root.NodeType != tt.wantRoot {
+				t.Errorf("Explain() root = %q, want %q", plan.Root.NodeType, tt.wantRoot)
+			}
+		})
+	}
+}
+
+func TestFileCollectorWindow(t *testing.T) {
+	export, err := ReadExportFile(testExport)
+	if err != nil {
+		t.Fatalf("ReadExportFile(%s): %v", testExport, err)
+	}
+	fc := NewFileCollector(export)
+
+	deltas, err := fc.CollectDeltas()
+	if err != nil {
+		t.Fatalf("CollectDeltas() error = %v", err)
+	}
+	calls := map[string]int64{}
+	for _, d := range deltas {
+		calls[d.Query] = d.Calls
+	}
+
+	want := map[string]int64{
+		"SELECT * FROM orders WHERE customer_id = $1":                                     200,
+		"SELECT customer_id, sum(total) FROM orders GROUP BY customer_id ORDER BY 2 DESC": 10,
+		"DELETE FROM customers WHERE id = $1":                                             15,
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("CollectDeltas() calls = %v, want %v", calls, want)
+	}
+}
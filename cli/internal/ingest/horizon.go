@@ -0,0 +1,153 @@
+package ingest
+
+import (
+	"fmt"
+	"time"
+
+	"cli/internal/logger"
+	"cli/internal/store"
+)
+
+// GetTransactionHorizon reads the session timeouts, every session with a
+// transaction or snapshot open, the replication slots and the prepared
+// transactions: everything that can keep vacuum from removing dead rows.
+func (sc *StatsCollector) GetTransactionHorizon() (*store.TransactionHorizon, error) {
+	logger.LogInfo("Collecting open transactions and xmin horizon holders")
+
+	horizon := &store.TransactionHorizon{}
+
+	// Timeouts are in milliseconds; idle_session_timeout is new in 14
+	var idleInTransaction, statement, idleSession int64
+	err := sc.db.QueryRow(`
+		SELECT
+			now(),
+			(SELECT setting::bigint FROM pg_settings WHERE name = 'idle_in_transaction_session_timeout'),
+			(SELECT setting::bigint FROM pg_settings WHERE name = 'statement_timeout'),
+			coalesce((SELECT setting::bigint FROM pg_settings WHERE name = 'idle_session_timeout'), 0)
+	`).Scan(&horizon.CapturedAt, &idleInTransaction, &statement, &idleSession)
+	if err != nil {
+		logger.LogErrorf("Failed to read session timeouts: %v", err)
+		return nil, fmt.Errorf("failed to read session timeouts: %w", err)
+	}
+	horizon.Settings = store.TimeoutSettings{
+		IdleInTransaction: time.Duration(idleInTransaction) * time.Millisecond,
+		Statement:         time.Duration(statement) * time.Millisecond,
+		IdleSession:       time.Duration(idleSession) * time.Millisecond,
+	}
+
+	if horizon.Sessions, err = sc.openTransactions(); err != nil {
+		logger.LogErrorf("Failed to read open transactions: %v", err)
+		return nil, fmt.Errorf("failed to read open transactions: %w", err)
+	}
+	if horizon.Slots, err = sc.replicationSlots(); err != nil {
+		logger.LogErrorf("Failed to read replication slots: %v", err)
+		return nil, fmt.Errorf("failed to read replication slots: %w", err)
+	}
+	if horizon.Prepared, err = sc.preparedTransactions(); err != nil {
+		logger.LogErrorf("Failed to read prepared transactions: %v", err)
+		return nil, fmt.Errorf("failed to read prepared transactions: %w", err)
+	}
+
+	logger.LogInfof("Collected %d open transactions, %d replication slots and %d prepared transactions",
+		len(horizon.Sessions), len(horizon.Slots), len(horizon.Prepared))
+	return horizon, nil
+}
+
+// openTransactions lists the sessions in a transaction or holding a
+// snapshot, oldest transaction first
+func (sc *StatsCollector) openTransactions() ([]store.Session, error) {
+	rows, err := sc.db.Query(`
+		SELECT
+			a.pid,
+			coalesce(a.backend_type, ''),
+			coalesce(a.usename, ''),
+			coalesce(a.datname, ''),
+			coalesce(a.application_name, ''),
+			coalesce(a.state, ''),
+			coalesce(a.wait_event_type, ''),
+			coalesce(a.wait_event, ''),
+			coalesce(a.query, ''),
+			a.xact_start,
+			a.query_start,
+			a.state_change,
+			greatest(coalesce(age(a.backend_xmin), 0), coalesce(age(a.backend_xid), 0))
+		FROM pg_stat_activity a
+		WHERE a.pid <> pg_backend_pid()
+		  AND (a.xact_start IS NOT NULL OR a.backend_xmin IS NOT NULL OR a.backend_xid IS NOT NULL)
+		ORDER BY a.xact_start NULLS LAST
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []store.Session
+	for rows.Next() {
+		var s store.Session
+		err := rows.Scan(
+			&s.PID, &s.BackendType, &s.User, &s.Database, &s.Application,
+			&s.State, &s.WaitEventType, &s.WaitEvent, &s.Query,
+			&s.XactStart, &s.QueryStart, &s.StateChange, &s.XminAge,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// replicationSlots reads the slots with how much WAL each one keeps; a
+// standby measures against the WAL it has received
+func (sc *StatsCollector) replicationSlots() ([]store.ReplicationSlot, error) {
+	rows, err := sc.db.Query(`
+		SELECT
+			slot_name,
+			slot_type,
+			coalesce(database, ''),
+			active,
+			coalesce(age(xmin), 0),
+			coalesce(age(catalog_xmin), 0),
+			coalesce(pg_wal_lsn_diff(
+				CASE WHEN pg_is_in_recovery() THEN pg_last_wal_receive_lsn() ELSE pg_current_wal_lsn() END,
+				restart_lsn), 0)::bigint
+		FROM pg_replication_slots
+		ORDER BY slot_name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var slots []store.ReplicationSlot
+	for rows.Next() {
+		var s store.ReplicationSlot
+		if err := rows.Scan(&s.Name, &s.Type, &s.Database, &s.Active, &s.XminAge, &s.CatalogXminAge, &s.RetainedWALBytes); err != nil {
+			return nil, err
+		}
+		slots = append(slots, s)
+	}
+	return slots, rows.Err()
+}
+
+func (sc *StatsCollector) preparedTransactions() ([]store.PreparedXact, error) {
+	rows, err := sc.db.Query(`
+		SELECT gid, prepared, owner, database, age(transaction)
+		FROM pg_prepared_xacts
+		ORDER BY prepared
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prepared []store.PreparedXact
+	for rows.Next() {
+		var p store.PreparedXact
+		if err := rows.Scan(&p.GID, &p.Prepared, &p.Owner, &p.Database, &p.XIDAge); err != nil {
+			return nil, err
+		}
+		prepared = append(prepared, p)
+	}
+	return prepared, rows.Err()
+}
@@ -0,0 +1,407 @@
+package ingest
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"cli/internal/explain"
+	"cli/internal/logger"
+	"cli/internal/parse"
+)
+
+// LogFormat is a PostgreSQL log_destination format.
+type LogFormat string
+
+const (
+	LogFormatStderr LogFormat = "stderr"
+	LogFormatCSV    LogFormat = "csvlog"
+	LogFormatJSON   LogFormat = "jsonlog"
+)
+
+var (
+	// Matches the severity that ends log_line_prefix, e.g.
+	// "2025-01-02 10:11:12.345 UTC [42] LOG:  duration: ..."
+	stderrLinePattern = regexp.MustCompile(`^(.*?)\b(LOG|ERROR|WARNING|FATAL|PANIC|NOTICE|INFO|DEBUG[1-5]?|DETAIL|HINT|CONTEXT|STATEMENT):  (.*)$`)
+	prefixTimePattern = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?(?: [A-Za-z]+|[+-]\d{2}(?::?\d{2})?)?)`)
+	prefixPIDPattern  = regexp.MustCompile(`\[(\d+)\]`)
+	prefixUserPattern = regexp.MustCompile(`user=([^,\s]+)`)
+	prefixDBPattern   = regexp.MustCompile(`db=([^,\s]+)`)
+	prefixAtPattern   = regexp.MustCompile(`\s([^@\s\[\]]+)@([^@\s\[\]]+)\s`)
+
+	durationPattern  = regexp.MustCompile(`(?s)^duration: ([\d.]+) ms(?:\s+(statement|execute [^:]*|plan):\s*(.*))?$`)
+	parameterPattern = regexp.MustCompile(`\$\d+ = (?:'(?:[^']|'')*'|NULL)`)
+)
+
+var logTimeLayouts = []string{
+	"2006-01-02 15:04:05.000 MST",
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05.000-07",
+	"2006-01-02 15:04:05-07",
+	"2006-01-02 15:04:05.000",
+	"2006-01-02 15:04:05",
+}
+
+// LogEntry is one server log message with its continuation lines and any
+// DETAIL that followed it folded in.
+type LogEntry struct {
+	Time     time.Time
+	PID      int
+	User     string
+	Database string
+	Severity string
+	Message  string
+	Detail   string
+}
+
+// LogStatement is a statement execution recovered from the log, either from
+// log_min_duration_statement or from auto_explain. Plan is only set for
+// auto_explain messages and is the plan that actually ran.
+type LogStatement struct {
+	LoggedAt    time.Time
+	PID         int
+	User        string
+	Database    string
+	DurationMS  float64
+	Query       string
+	Parameters  []string
+	Plan        *explain.Plan
+	PlanFormat  string
+	Fingerprint string
+	SourceFile  string
+}
+
+// DetectLogFormat guesses the format from the file extension, falling back
+// to sniffing the first line.
+func DetectLogFormat(path string) (LogFormat, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return LogFormatCSV, nil
+	case ".json":
+		return LogFormatJSON, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "{") {
+			return LogFormatJSON, nil
+		}
+		return LogFormatStderr, nil
+	}
+	return LogFormatStderr, nil
+}
+
+// LogReader turns raw log lines into statements. Lines must be fed in file
+// order; entries are only emitted once the next entry starts or Flush is
+// called, since stderr messages continue on the following lines.
+type LogReader struct {
+	format     LogFormat
+	sourceFile string
+	parser     *parse.QueryParser
+	current    *LogEntry
+	csvPending string
+}
+
+func NewLogReader(format LogFormat, sourceFile string) *LogReader {
+	return &LogReader{
+		format:     format,
+		sourceFile: sourceFile,
+		parser:     parse.NewQueryParser(),
+	}
+}
+
+// Feed consumes one line (without its trailing newline) and calls emit for
+// every statement completed by it.
+func (lr *LogReader) Feed(line string, emit func(LogStatement)) {
+	switch lr.format {
+	case LogFormatCSV:
+		lr.feedCSV(line, emit)
+	case LogFormatJSON:
+		lr.feedJSON(line, emit)
+	default:
+		lr.feedStderr(line, emit)
+	}
+}
+
+// Flush emits the entry still being assembled.
+func (lr *LogReader) Flush(emit func(LogStatement)) {
+	if lr.current != nil {
+		lr.emitEntry(*lr.current, emit)
+		lr.current = nil
+	}
+}
+
+func (lr *LogReader) feedStderr(line string, emit func(LogStatement)) {
+	// Continuation lines of a multi-line message start with a tab
+	if strings.HasPrefix(line, "\t") {
+		if lr.current != nil {
+			lr.current.Message += "\n" + line[1:]
+		}
+		return
+	}
+
+	m := stderrLinePattern.FindStringSubmatch(line)
+	if m == nil {
+		return
+	}
+
+	entry := LogEntry{Severity: m[2], Message: m[3]}
+	parseLinePrefix(m[1], &entry)
+
+	switch entry.Severity {
+	case "DETAIL":
+		if lr.current != nil && (entry.PID == 0 || entry.PID == lr.current.PID) {
+			lr.current.Detail = entry.Message
+		}
+		return
+	case "HINT", "CONTEXT", "STATEMENT":
+		return
+	}
+
+	lr.Flush(emit)
+	lr.current = &entry
+}
+
+// feedCSV buffers lines until the quotes balance, since csvlog messages with
+// embedded newlines span several physical lines.
+func (lr *LogReader) feedCSV(line string, emit func(LogStatement)) {
+	if lr.csvPending != "" {
+		line = lr.csvPending + "\n" + line
+	}
+	if strings.Count(line, `"`)%2 != 0 {
+		lr.csvPending = line
+		return
+	}
+	lr.csvPending = ""
+
+	reader := csv.NewReader(strings.NewReader(line))
+	reader.FieldsPerRecord = -1
+	record, err := reader.Read()
+	if err != nil || len(record) < 15 {
+		logger.LogDebugf("Skipping malformed csvlog record: %v", err)
+		return
+	}
+
+	entry := LogEntry{
+		Time:     parseLogTime(record[0]),
+		User:     record[1],
+		Database: record[2],
+		Severity: record[11],
+		Message:  record[13],
+		Detail:   record[14],
+	}
+	entry.PID, _ = strconv.Atoi(record[3])
+	lr.emitEntry(entry, emit)
+}
+
+func (lr *LogReader) feedJSON(line string, emit func(LogStatement)) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+
+	var record struct {
+		Timestamp string `json:"timestamp"`
+		User      string `json:"user"`
+		DBName    string `json:"dbname"`
+		PID       int    `json:"pid"`
+		Severity  string `json:"error_severity"`
+		Message   string `json:"message"`
+		Detail    string `json:"detail"`
+	}
+	if err := json.Unmarshal([]byte(line), &record); err != nil {
+		logger.LogDebugf("Skipping malformed jsonlog record: %v", err)
+		return
+	}
+
+	lr.emitEntry(LogEntry{
+		Time:     parseLogTime(record.Timestamp),
+		PID:      record.PID,
+		User:     record.User,
+		Database: record.DBName,
+		Severity: record.Severity,
+		Message:  record.Message,
+		Detail:   record.Detail,
+	}, emit)
+}
+
+// emitEntry converts a duration message into a statement. Plain
+// "statement:" log lines without a duration, bind/parse phases of the
+// extended protocol and other messages are ignored.
+func (lr *LogReader) emitEntry(entry LogEntry, emit func(LogStatement)) {
+	if entry.Severity != "LOG" {
+		return
+	}
+
+	m := durationPattern.FindStringSubmatch(entry.Message)
+	if m == nil || m[2] == "" {
+		return
+	}
+
+	stmt := LogStatement{
+		LoggedAt:   entry.Time,
+		PID:        entry.PID,
+		User:       entry.User,
+		Database:   entry.Database,
+		SourceFile: lr.sourceFile,
+	}
+	stmt.DurationMS, _ = strconv.ParseFloat(m[1], 64)
+
+	kind, body := m[2], m[3]
+	switch {
+	case kind == "plan":
+		ae, err := explain.ParseAutoExplain(body)
+		if err != nil {
+			logger.LogDebugf("Skipping unparseable auto_explain plan: %v", err)
+			return
+		}
+		stmt.Query = ae.QueryText
+		stmt.Parameters = parameterPattern.FindAllString(ae.Parameters, -1)
+		stmt.Plan = ae.Plan
+		stmt.PlanFormat = ae.Format
+	case kind == "statement", strings.HasPrefix(kind, "execute"):
+		stmt.Query = strings.TrimSpace(body)
+		stmt.Parameters = parameterPattern.FindAllString(entry.Detail, -1)
+	default:
+		return
+	}
+
+	if stmt.Query == "" {
+		return
+	}
+	stmt.Fingerprint = lr.parser.GenerateFingerprint(stmt.Query)
+	emit(stmt)
+}
+
+func parseLinePrefix(prefix string, entry *LogEntry) {
+	if m := prefixTimePattern.FindStringSubmatch(prefix); m != nil {
+		entry.Time = parseLogTime(m[1])
+	}
+	if m := prefixPIDPattern.FindStringSubmatch(prefix); m != nil {
+		entry.PID, _ = strconv.Atoi(m[1])
+	}
+	if m := prefixUserPattern.FindStringSubmatch(prefix); m != nil {
+		entry.User = m[1]
+	}
+	if m := prefixDBPattern.FindStringSubmatch(prefix); m != nil {
+		entry.Database = m[1]
+	}
+	if entry.User == "" {
+		if m := prefixAtPattern.FindStringSubmatch(" " + prefix + " "); m != nil {
+			entry.User, entry.Database = m[1], m[2]
+		}
+	}
+}
+
+func parseLogTime(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range logTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// ParseLogFile reads a whole log file and returns every statement in it.
+func ParseLogFile(path string, format LogFormat) ([]LogStatement, error) {
+	logger.LogInfof("Parsing %s log file %s", format, path)
+
+	file, err := os.Open(path)
+	if err != nil {
+		logger.LogErrorf("Failed to open log file: %v", err)
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer file.Close()
+
+	var statements []LogStatement
+	collect := func(s LogStatement) { statements = append(statements, s) }
+
+	reader := NewLogReader(format, path)
+	buf := bufio.NewReader(file)
+	for {
+		line, err := buf.ReadString('\n')
+		if line != "" {
+			reader.Feed(strings.TrimRight(line, "\r\n"), collect)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read log file: %w", err)
+		}
+	}
+	reader.Flush(collect)
+
+	logger.LogInfof("Parsed %d statements from %s", len(statements), path)
+	return statements, nil
+}
+
+// TailLogFile follows a log file like tail -f, calling fn for each statement
+// as it is completed, until stop is closed. fromStart controls whether
+// existing content is read first. Partial lines at the end of the file are
+// held until the server finishes writing them.
+func TailLogFile(path string, format LogFormat, fromStart bool, interval time.Duration, stop <-chan struct{}, fn func(LogStatement)) error {
+	logger.LogInfof("Tailing %s log file %s", format, path)
+
+	file, err := os.Open(path)
+	if err != nil {
+		logger.LogErrorf("Failed to open log file: %v", err)
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer file.Close()
+
+	if !fromStart {
+		if _, err := file.Seek(0, io.SeekEnd); err != nil {
+			return fmt.Errorf("failed to seek log file: %w", err)
+		}
+	}
+
+	reader := NewLogReader(format, path)
+	buf := bufio.NewReader(file)
+	partial := ""
+
+	for {
+		line, err := buf.ReadString('\n')
+		partial += line
+
+		if err == nil {
+			reader.Feed(strings.TrimRight(partial, "\r\n"), fn)
+			partial = ""
+			continue
+		}
+		if err != io.EOF {
+			return fmt.Errorf("failed to read log file: %w", err)
+		}
+
+		// A quiet period means the last stderr message is complete
+		if partial == "" {
+			reader.Flush(fn)
+		}
+
+		select {
+		case <-stop:
+			reader.Flush(fn)
+			logger.LogInfof("Stopped tailing %s", path)
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package ingest
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogReader(t *testing.T) {
+	type statement struct {
+		loggedAt   string
+		pid        int
+		user       string
+		database   string
+		durationMS float64
+		query      string
+		parameters []string
+	}
+
+	tests := []struct {
+		name   string
+		format LogFormat
+		log    string
+		want   []statement
+	}{
+		{
+			name:   "stderr statement continued on the next lines",
+			format: LogFormatStderr,
+			log: "2026-03-02 10:15:01.123 UTC [42] app@shop LOG:  duration: 12.500 ms  statement: SELECT *\n" +
+				"\tFROM orders\n" +
+				"\tWHERE id = 1\n" +
+				"2026-03-02 10:15:02.000 UTC [43] app@shop LOG:  connection received: host=10.0.0.5",
+			want: []statement{{
+				loggedAt: "2026-03-02T10:15:01.123Z", pid: 42, user: "app", database: "shop",
+				durationMS: 12.5, query: "SELECT *\nFROM orders\nWHERE id = 1",
+			}},
+		},
+		{
+			name:   "stderr execute with its parameters in DETAIL",
+			format: LogFormatStderr,
+			log: "2026-03-02 10:15:01 UTC [42] user=app,db=shop LOG:  duration: 3.2 ms  execute <unnamed>: SELECT * FROM users WHERE id = $1 AND email = $2\n" +
+				"2026-03-02 10:15:01 UTC [42] user=app,db=shop DETAIL:  parameters: $1 = '7', $2 = 'o''brien@example.com'",
+			want: []statement{{
+				loggedAt: "2026-03-02T10:15:01Z", pid: 42, user: "app", database: "shop",
+				durationMS: 3.2, query: "SELECT * FROM users WHERE id = $1 AND email = $2",
+				parameters: []string{"$1 = '7'", "$2 = 'o''brien@example.com'"},
+			}},
+		},
+		{
+			name:   "stderr messages without a duration",
+			format: LogFormatStderr,
+			log: "2026-03-02 10:15:01 UTC [42] app@shop LOG:  statement: SELECT 1\n" +
+				"2026-03-02 10:15:01 UTC [42] app@shop ERROR:  relation \"missing\" does not exist\n" +
+				"2026-03-02 10:15:01 UTC [42] app@shop STATEMENT:  SELECT * FROM missing\n" +
+				"2026-03-02 10:15:01 UTC [42] app@shop LOG:  duration: 0.5 ms  bind <unnamed>: SELECT 1",
+		},
+		{
+			name:   "csvlog message spanning lines",
+			format: LogFormatCSV,
+			log: `2026-03-02 10:15:01.123 UTC,"app","shop",42,"10.0.0.5:51234",65e2f1a1.2a,3,"SELECT",2026-03-02 10:14:00 UTC,3/17,0,LOG,00000,"duration: 8.000 ms  statement: SELECT *` + "\n" +
+				`FROM orders WHERE status = 'paid'",,,,,,,,,"psql","client backend",,0`,
+			want: []statement{{
+				loggedAt: "2026-03-02T10:15:01.123Z", pid: 42, user: "app", database: "shop",
+				durationMS: 8, query: "SELECT *\nFROM orders WHERE status = 'paid'",
+			}},
+		},
+		{
+			name:   "csvlog record too short",
+			format: LogFormatCSV,
+			log:    `2026-03-02 10:15:01.123 UTC,"app","shop",42,LOG,"duration: 8.000 ms  statement: SELECT 1"`,
+		},
+		{
+			name:   "jsonlog execute with parameters",
+			format: LogFormatJSON,
+			log: `{"timestamp":"2026-03-02 10:15:01.123 UTC","user":"app","dbname":"shop","pid":42,"error_severity":"LOG","message":"duration: 1.750 ms  execute S_1: SELECT * FROM orders WHERE id = $1","detail":"parameters: $1 = NULL"}` + "\n" +
+				"\n" +
+				`{"timestamp":"2026-03-02 10:15:02.000 UTC","pid":43,"error_severity":"ERROR","message":"canceling statement due to user request"}` + "\n" +
+				`not json`,
+			want: []statement{{
+				loggedAt: "2026-03-02T10:15:01.123Z", pid: 42, user: "app", database: "shop",
+				durationMS: 1.75, query: "SELECT * FROM orders WHERE id = $1", parameters: []string{"$1 = NULL"},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := NewLogReader(tt.format, "postgresql.log")
+			var got []LogStatement
+			emit := func(s LogStatement) { got = append(got, s) }
+			for _, line := range strings.Split(tt.log, "\n") {
+				reader.Feed(line, emit)
+			}
+			reader.Flush(emit)
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d statements, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, want := range tt.want {
+				s := got[i]
+				if loggedAt := s.LoggedAt.Format(time.RFC3339Nano); loggedAt != want.loggedAt {
+					t.Errorf("statement %d: LoggedAt = %s, want %s", i, loggedAt, want.loggedAt)
+				}
+				if s.PID != want.pid || s.User != want.user || s.Database != want.database {
+					t.Errorf("statement %d: PID, User, Database = %d, %q, %q, want %d, %q, %q",
+						i, s.PID, s.User, s.Database, want.pid, want.user, want.database)
+				}
+				if s.DurationMS != want.durationMS || s.Query != want.query {
+					t.Errorf("statement %d = %.3f ms %q, want %.3f ms %q", i, s.DurationMS, s.Query, want.durationMS, want.query)
+				}
+				if !reflect.DeepEqual(s.Parameters, want.parameters) {
+					t.Errorf("statement %d: Parameters = %q, want %q", i, s.Parameters, want.parameters)
+				}
+				if s.Fingerprint == "" || s.SourceFile != "postgresql.log" {
+					t.Errorf("statement %d: Fingerprint, SourceFile = %q, %q", i, s.Fingerprint, s.SourceFile)
+				}
+			}
+		})
+	}
+}
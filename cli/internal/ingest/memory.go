@@ -0,0 +1,72 @@
+package ingest
+
+import (
+	"fmt"
+
+	"cli/internal/logger"
+	"cli/internal/store"
+)
+
+// GetMemorySettings reads work_mem, hash_mem_multiplier, the cache sizes and
+// the login roles with the work_mem each one sets for all databases or for
+// this one.
+func (sc *StatsCollector) GetMemorySettings() (*store.MemorySettings, error) {
+	logger.LogInfo("Collecting memory settings")
+
+	settings := &store.MemorySettings{}
+	err := sc.db.QueryRow(`
+		SELECT
+			pg_size_bytes(current_setting('work_mem')),
+			coalesce((SELECT setting::float8 FROM pg_settings WHERE name = 'hash_mem_multiplier'), 1),
+			current_setting('max_connections')::int,
+			current_setting('block_size')::bigint,
+			pg_size_bytes(current_setting('shared_buffers')),
+			pg_size_bytes(current_setting('effective_cache_size'))
+	`).Scan(&settings.WorkMem, &settings.HashMemMultiplier, &settings.MaxConnections, &settings.BlockSize,
+		&settings.SharedBuffers, &settings.EffectiveCacheSize)
+	if err != nil {
+		logger.LogErrorf("Failed to read memory settings: %v", err)
+		return nil, fmt.Errorf("failed to read memory settings: %w", err)
+	}
+
+	// A bare number in setconfig is in kB, the unit of work_mem; a database
+	// specific setting wins over one for all databases
+	rows, err := sc.db.Query(`
+		SELECT
+			r.oid::bigint,
+			r.rolname,
+			coalesce((
+				SELECT CASE WHEN v.value ~ '^[0-9]+$' THEN v.value::bigint * 1024 ELSE pg_size_bytes(v.value) END
+				FROM pg_db_role_setting s
+				CROSS JOIN LATERAL unnest(s.setconfig) AS c(entry)
+				CROSS JOIN LATERAL (SELECT substring(c.entry FROM '^work_mem=(.*)$') AS value) v
+				WHERE s.setrole = r.oid
+				  AND s.setdatabase IN (0, (SELECT oid FROM pg_database WHERE datname = current_database()))
+				  AND v.value IS NOT NULL
+				ORDER BY s.setdatabase DESC
+				LIMIT 1
+			), 0)
+		FROM pg_roles r
+		WHERE r.rolcanlogin
+		ORDER BY r.rolname
+	`)
+	if err != nil {
+		logger.LogErrorf("Failed to read role settings: %v", err)
+		return nil, fmt.Errorf("failed to read role settings: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r store.RoleMemory
+		if err := rows.Scan(&r.UserID, &r.Name, &r.WorkMem); err != nil {
+			return nil, fmt.Errorf("failed to scan role settings: %w", err)
+		}
+		settings.Roles = append(settings.Roles, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read role settings: %w", err)
+	}
+
+	logger.LogInfof("work_mem is %d bytes, %d login roles", settings.WorkMem, len(settings.Roles))
+	return settings, nil
+}
@@ -0,0 +1,915 @@
+package ingest
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+
+	"cli/internal/config"
+	"cli/internal/logger"
+	"cli/internal/store"
+)
+
+// MySQLCollector is the Collector for MySQL 8.0+ and MariaDB 10.5+. It reads
+// performance_schema.events_statements_summary_by_digest, information_schema
+// and the sys schema, so the profiler role needs SELECT on
+// performance_schema.*, sys.* and information_schema.
+type MySQLCollector struct {
+	db *sql.DB
+
+	// Delta sampling state, see delta.go
+	sampler
+}
+
+func NewMySQLCollector(db *sql.DB) *MySQLCollector {
+	mc := &MySQLCollector{db: db}
+	mc.take = mc.TakeSnapshot
+	return mc
+}
+
+func (mc *MySQLCollector) Engine() string {
+	return config.EngineMySQL
+}
+
+// Timers in performance_schema are in picoseconds; the queries below divide
+// by the same factor.
+const picosPerMS = 1e9
+
+// mysqlSystemSchemas are never profiled
+const mysqlSystemSchemas = `'mysql', 'performance_schema', 'information_schema', 'sys'`
+
+// digestQuery selects from the digest summary, limited to the connected
+// schema when there is one. The columns match scanDigest.
+func digestQuery(where, orderBy string, limit int) string {
+	query := fmt.Sprintf(`
+		SELECT
+			COALESCE(SCHEMA_NAME, ''),
+			DIGEST,
+			DIGEST_TEXT,
+			COUNT_STAR,
+			AVG_TIMER_WAIT / 1000000000,
+			SUM_TIMER_WAIT / 1000000000,
+			MIN_TIMER_WAIT / 1000000000,
+			MAX_TIMER_WAIT / 1000000000,
+			SUM_ROWS_SENT + SUM_ROWS_AFFECTED,
+			SUM_CREATED_TMP_DISK_TABLES
+		FROM performance_schema.events_statements_summary_by_digest
+		WHERE DIGEST_TEXT IS NOT NULL
+		  AND (DATABASE() IS NULL OR SCHEMA_NAME = DATABASE())
+		  AND (SCHEMA_NAME IS NULL OR SCHEMA_NAME NOT IN (%s))`, mysqlSystemSchemas)
+	if where != "" {
+		query += " AND " + where
+	}
+	if orderBy != "" {
+		query += " ORDER BY " + orderBy
+	}
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	return query
+}
+
+func scanDigest(rows *sql.Rows) (store.QueryStats, error) {
+	var s store.QueryStats
+	var schema, digest string
+	var tmpDiskTables int64
+	err := rows.Scan(
+		&schema,
+		&digest,
+		&s.Query,
+		&s.Calls,
+		&s.MeanExecTime,
+		&s.TotalTime,
+		&s.MinExecTime,
+		&s.MaxExecTime,
+		&s.Rows,
+		&tmpDiskTables,
+	)
+	if err != nil {
+		return s, err
+	}
+
+	// Digests are per schema; fold both into the numeric ID the rest of
+	// optidb keys statements by.
+	h := fnv.New64a()
+	h.Write([]byte(schema + "/" + digest))
+	s.QueryID = int64(h.Sum64())
+	s.TopLevel = true
+	s.Query = digestToSQL(s.Query)
+	// Each on-disk temporary table is at least one spilled block
+	s.TempBlksWritten = tmpDiskTables
+	return s, nil
+}
+
+// digestToSQL turns a normalized digest such as
+//
+//	SELECT * FROM `orders` WHERE `user_id` = ?
+//
+// into text the PostgreSQL-grammar parser accepts, by dropping identifier
+// quotes and numbering the placeholders. Digests contain no literals, so no
+// quoting context needs to be tracked.
+func digestToSQL(digest string) string {
+	var b strings.Builder
+	param := 0
+	for _, r := range digest {
+		switch r {
+		case '`':
+		case '?':
+			param++
+			b.WriteString("$" + strconv.Itoa(param))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func (mc *MySQLCollector) queryDigests(query string, args ...interface{}) ([]store.QueryStats, error) {
+	rows, err := mc.db.Query(query, args...)
+	if err != nil {
+		logger.LogErrorf("Failed to query statement digests: %v", err)
+		return nil, fmt.Errorf("failed to query performance_schema digests: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []store.QueryStats
+	for rows.Next() {
+		s, err := scanDigest(rows)
+		if err != nil {
+			logger.LogErrorf("Failed to scan digest row: %v", err)
+			return nil, fmt.Errorf("failed to scan statement digest: %w", err)
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+func (mc *MySQLCollector) GetQueryStats() ([]store.QueryStats, error) {
+	logger.LogInfo("Collecting query statistics from performance_schema")
+
+	stats, err := mc.queryDigests(digestQuery("COUNT_STAR > 1", "AVG_TIMER_WAIT DESC", 100))
+	if err != nil {
+		return nil, err
+	}
+
+	logger.LogInfof("Collected %d query statistics records", len(stats))
+	return stats, nil
+}
+
+func (mc *MySQLCollector) GetSlowQueries(minDurationMS float64) ([]store.QueryStats, error) {
+	logger.LogInfof("Collecting slow queries with min duration: %.2fms", minDurationMS)
+
+	query := digestQuery("AVG_TIMER_WAIT > ? AND COUNT_STAR > 1", "AVG_TIMER_WAIT DESC", config.Get().Rules.SlowQueryLimit)
+	stats, err := mc.queryDigests(query, minDurationMS*picosPerMS)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.LogInfof("Collected %d slow queries", len(stats))
+	return stats, nil
+}
+
+func (mc *MySQLCollector) GetWorkload(limit int) ([]store.QueryStats, error) {
+	logger.LogInfof("Collecting top %d statements by total time", limit)
+
+	stats, err := mc.queryDigests(digestQuery("COUNT_STAR > 0", "SUM_TIMER_WAIT DESC", limit))
+	if err != nil {
+		return nil, err
+	}
+
+	logger.LogInfof("Collected %d workload statements", len(stats))
+	return stats, nil
+}
+
+// TakeSnapshot reads every digest. MySQL has no stats_reset timestamp and
+// its uptime is only precise to the second, so resets and restarts are
+// detected from counters going backwards.
+func (mc *MySQLCollector) TakeSnapshot() (*StatsSnapshot, error) {
+	logger.LogDebug("Taking performance_schema digest snapshot")
+
+	snapshot := &StatsSnapshot{
+		Statements: make(map[string]store.QueryStats),
+	}
+	if err := mc.db.QueryRow(`SELECT NOW(6)`).Scan(&snapshot.CapturedAt); err != nil {
+		logger.LogErrorf("Failed to read server clock: %v", err)
+		return nil, fmt.Errorf("failed to read server clock: %w", err)
+	}
+
+	stats, err := mc.queryDigests(digestQuery("", "", 0))
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range stats {
+		snapshot.Statements[statementKey(s)] = s
+	}
+
+	logger.LogDebugf("Snapshot captured %d statements", len(snapshot.Statements))
+	return snapshot, nil
+}
+
+func (mc *MySQLCollector) GetTableInfo() ([]store.TableInfo, error) {
+	logger.LogInfo("Collecting table information from information_schema.TABLES")
+
+	query := fmt.Sprintf(`
+		SELECT
+			TABLE_SCHEMA,
+			TABLE_NAME,
+			COALESCE(TABLE_ROWS, 0),
+			COALESCE(DATA_LENGTH, 0) + COALESCE(INDEX_LENGTH, 0) AS size_bytes
+		FROM information_schema.TABLES
+		WHERE TABLE_TYPE = 'BASE TABLE'
+		  AND (DATABASE() IS NULL OR TABLE_SCHEMA = DATABASE())
+		  AND TABLE_SCHEMA NOT IN (%s)
+		ORDER BY size_bytes DESC
+	`, mysqlSystemSchemas)
+
+	rows, err := mc.db.Query(query)
+	if err != nil {
+		logger.LogErrorf("Failed to query table info: %v", err)
+		return nil, fmt.Errorf("failed to query table info: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []store.TableInfo
+	for rows.Next() {
+		var t store.TableInfo
+		if err := rows.Scan(&t.SchemaName, &t.TableName, &t.RowCount, &t.SizeBytes); err != nil {
+			logger.LogErrorf("Failed to scan table info row: %v", err)
+			return nil, fmt.Errorf("failed to scan table info: %w", err)
+		}
+		// TABLE_ROWS is InnoDB's sampled estimate, the only count there is
+		t.LiveTuples = t.RowCount
+		t.RelTuples = float64(t.RowCount)
+		tables = append(tables, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read table info: %w", err)
+	}
+
+	mc.optionalQuery("table writes", `
+		SELECT OBJECT_SCHEMA, OBJECT_NAME, COUNT_INSERT, COUNT_UPDATE, COUNT_DELETE
+		FROM performance_schema.table_io_waits_summary_by_table`,
+		func(rows *sql.Rows) error {
+			var schema, table string
+			var inserts, updates, deletes int64
+			if err := rows.Scan(&schema, &table, &inserts, &updates, &deletes); err != nil {
+				return err
+			}
+			for i := range tables {
+				if tables[i].SchemaName == schema && tables[i].TableName == table {
+					tables[i].Inserts, tables[i].Updates, tables[i].Deletes = inserts, updates, deletes
+					break
+				}
+			}
+			return nil
+		})
+
+	logger.LogInfof("Collected %d table info records", len(tables))
+	return tables, nil
+}
+
+// indexKey identifies an index across the information_schema,
+// performance_schema and sys queries
+func indexKey(schema, table, index string) string {
+	return schema + "." + table + "." + index
+}
+
+// GetIndexInfo reads index definitions from information_schema.STATISTICS.
+// Usage comes from performance_schema.table_io_waits_summary_by_index_usage
+// (fetches through the index, since MySQL does not count scans), sizes from
+// mysql.innodb_index_stats, and sys.schema_unused_indexes has the final say
+// on which indexes are unused. Those three are optional: without the
+// privileges the indexes are still listed, marked UsageUnknown.
+func (mc *MySQLCollector) GetIndexInfo() ([]store.IndexInfo, error) {
+	logger.LogInfo("Collecting index information from information_schema.STATISTICS")
+
+	query := fmt.Sprintf(`
+		SELECT
+			TABLE_SCHEMA,
+			TABLE_NAME,
+			INDEX_NAME,
+			COALESCE(GROUP_CONCAT(COLUMN_NAME ORDER BY SEQ_IN_INDEX SEPARATOR ','), ''),
+			MIN(NON_UNIQUE) = 0,
+			INDEX_NAME = 'PRIMARY',
+			LOWER(MAX(INDEX_TYPE))
+		FROM information_schema.STATISTICS
+		WHERE (DATABASE() IS NULL OR TABLE_SCHEMA = DATABASE())
+		  AND TABLE_SCHEMA NOT IN (%s)
+		GROUP BY TABLE_SCHEMA, TABLE_NAME, INDEX_NAME
+	`, mysqlSystemSchemas)
+
+	rows, err := mc.db.Query(query)
+	if err != nil {
+		logger.LogErrorf("Failed to query index info: %v", err)
+		return nil, fmt.Errorf("failed to query index info: %w", err)
+	}
+	defer rows.Close()
+
+	var indexes []store.IndexInfo
+	positions := map[string]int{}
+	for rows.Next() {
+		var idx store.IndexInfo
+		var colsStr string
+		if err := rows.Scan(&idx.SchemaName, &idx.TableName, &idx.IndexName, &colsStr, &idx.IsUnique, &idx.IsPrimary, &idx.Method); err != nil {
+			logger.LogErrorf("Failed to scan index info row: %v", err)
+			return nil, fmt.Errorf("failed to scan index info: %w", err)
+		}
+		if colsStr != "" {
+			idx.Columns = strings.Split(colsStr, ",")
+		}
+		// In MySQL a unique constraint is its index
+		if idx.IsUnique {
+			idx.Constraint = idx.IndexName
+		}
+		idx.UsageUnknown = true
+		positions[indexKey(idx.SchemaName, idx.TableName, idx.IndexName)] = len(indexes)
+		indexes = append(indexes, idx)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read index info: %w", err)
+	}
+
+	lookup := func(schema, table, index string) *store.IndexInfo {
+		if i, ok := positions[indexKey(schema, table, index)]; ok {
+			return &indexes[i]
+		}
+		return nil
+	}
+
+	mc.optionalQuery("index usage", `
+		SELECT OBJECT_SCHEMA, OBJECT_NAME, INDEX_NAME, COUNT_FETCH, COUNT_READ
+		FROM performance_schema.table_io_waits_summary_by_index_usage
+		WHERE INDEX_NAME IS NOT NULL`,
+		func(rows *sql.Rows) error {
+			var schema, table, index string
+			var fetches, reads int64
+			if err := rows.Scan(&schema, &table, &index, &fetches, &reads); err != nil {
+				return err
+			}
+			if idx := lookup(schema, table, index); idx != nil {
+				idx.IndexScans = fetches
+				idx.TuplesRead = reads
+				idx.TuplesFetch = fetches
+				idx.UsageUnknown = false
+			}
+			return nil
+		})
+
+	// performance_schema counts from server start
+	mc.optionalQuery("server start", `
+		SELECT VARIABLE_VALUE
+		FROM performance_schema.global_status
+		WHERE VARIABLE_NAME = 'Uptime'`,
+		func(rows *sql.Rows) error {
+			var uptime int64
+			if err := rows.Scan(&uptime); err != nil {
+				return err
+			}
+			started := time.Now().Add(-time.Duration(uptime) * time.Second)
+			for i := range indexes {
+				indexes[i].StatsReset = &started
+			}
+			return nil
+		})
+
+	// InnoDB refuses to drop the index a foreign key uses, which is any
+	// index that leads with the foreign key's columns
+	mc.optionalQuery("foreign keys", fmt.Sprintf(`
+		SELECT TABLE_SCHEMA, TABLE_NAME, CONSTRAINT_NAME,
+			GROUP_CONCAT(COLUMN_NAME ORDER BY ORDINAL_POSITION SEPARATOR ',')
+		FROM information_schema.KEY_COLUMN_USAGE
+		WHERE REFERENCED_TABLE_NAME IS NOT NULL
+		  AND (DATABASE() IS NULL OR TABLE_SCHEMA = DATABASE())
+		  AND TABLE_SCHEMA NOT IN (%s)
+		GROUP BY TABLE_SCHEMA, TABLE_NAME, CONSTRAINT_NAME`, mysqlSystemSchemas),
+		func(rows *sql.Rows) error {
+			var schema, table, constraint, columns string
+			if err := rows.Scan(&schema, &table, &constraint, &columns); err != nil {
+				return err
+			}
+			fkColumns := strings.Split(columns, ",")
+			for i := range indexes {
+				idx := &indexes[i]
+				if idx.SchemaName == schema && idx.TableName == table && idx.Constraint == "" && leadsWith(idx.Columns, fkColumns) {
+					idx.Constraint = constraint
+				}
+			}
+			return nil
+		})
+
+	mc.optionalQuery("index sizes", `
+		SELECT database_name, table_name, index_name, stat_value * @@innodb_page_size
+		FROM mysql.innodb_index_stats
+		WHERE stat_name = 'size'`,
+		func(rows *sql.Rows) error {
+			var schema, table, index string
+			var size int64
+			if err := rows.Scan(&schema, &table, &index, &size); err != nil {
+				return err
+			}
+			if idx := lookup(schema, table, index); idx != nil {
+				idx.SizeBytes = size
+			}
+			return nil
+		})
+
+	mc.optionalQuery("unused indexes", `
+		SELECT object_schema, object_name, index_name
+		FROM sys.schema_unused_indexes`,
+		func(rows *sql.Rows) error {
+			var schema, table, index string
+			if err := rows.Scan(&schema, &table, &index); err != nil {
+				return err
+			}
+			if idx := lookup(schema, table, index); idx != nil {
+				idx.IndexScans = 0
+				idx.TuplesRead = 0
+				idx.TuplesFetch = 0
+				idx.UsageUnknown = false
+			}
+			return nil
+		})
+
+	logger.LogInfof("Collected %d index info records", len(indexes))
+	return indexes, nil
+}
+
+// leadsWith reports whether an index's columns start with the given ones
+func leadsWith(columns, leading []string) bool {
+	if len(leading) > len(columns) {
+		return false
+	}
+	for i, c := range leading {
+		if !strings.EqualFold(columns[i], c) {
+			return false
+		}
+	}
+	return true
+}
+
+// optionalQuery runs a query that enriches the index or column lists,
+// logging rather than failing when it is not permitted or not supported.
+func (mc *MySQLCollector) optionalQuery(what, query string, scan func(*sql.Rows) error) {
+	rows, err := mc.db.Query(query)
+	if err != nil {
+		logger.LogInfof("Skipping %s: %v", what, err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			logger.LogErrorf("Failed to scan %s row: %v", what, err)
+			return
+		}
+	}
+}
+
+// GetColumnStats reads what MySQL and MariaDB keep per column: the
+// cardinality of leading index columns, MySQL 8.0 histograms (built by
+// ANALYZE TABLE ... UPDATE HISTOGRAM) and MariaDB engine-independent
+// statistics. Columns with none of these are not returned.
+func (mc *MySQLCollector) GetColumnStats(tables []string) ([]store.ColumnStats, error) {
+	logger.LogInfof("Collecting column statistics for %d tables", len(tables))
+
+	wanted := map[string]bool{}
+	for _, t := range tables {
+		wanted[t] = true
+	}
+
+	var stats []store.ColumnStats
+	positions := map[string]int{}
+	column := func(schema, table, name string) *store.ColumnStats {
+		if len(wanted) > 0 && !wanted[table] {
+			return nil
+		}
+		key := indexKey(schema, table, name)
+		if i, ok := positions[key]; ok {
+			return &stats[i]
+		}
+		positions[key] = len(stats)
+		stats = append(stats, store.ColumnStats{SchemaName: schema, TableName: table, ColumnName: name})
+		return &stats[len(stats)-1]
+	}
+
+	mc.optionalQuery("index cardinality", fmt.Sprintf(`
+		SELECT TABLE_SCHEMA, TABLE_NAME, COLUMN_NAME, MAX(CARDINALITY)
+		FROM information_schema.STATISTICS
+		WHERE SEQ_IN_INDEX = 1
+		  AND CARDINALITY IS NOT NULL
+		  AND (DATABASE() IS NULL OR TABLE_SCHEMA = DATABASE())
+		  AND TABLE_SCHEMA NOT IN (%s)
+		GROUP BY TABLE_SCHEMA, TABLE_NAME, COLUMN_NAME`, mysqlSystemSchemas),
+		func(rows *sql.Rows) error {
+			var schema, table, name string
+			var cardinality int64
+			if err := rows.Scan(&schema, &table, &name, &cardinality); err != nil {
+				return err
+			}
+			if c := column(schema, table, name); c != nil {
+				c.NDistinct = float64(cardinality)
+			}
+			return nil
+		})
+
+	mc.optionalQuery("column histograms", fmt.Sprintf(`
+		SELECT SCHEMA_NAME, TABLE_NAME, COLUMN_NAME, HISTOGRAM
+		FROM information_schema.COLUMN_STATISTICS
+		WHERE (DATABASE() IS NULL OR SCHEMA_NAME = DATABASE())
+		  AND SCHEMA_NAME NOT IN (%s)`, mysqlSystemSchemas),
+		func(rows *sql.Rows) error {
+			var schema, table, name, histogram string
+			if err := rows.Scan(&schema, &table, &name, &histogram); err != nil {
+				return err
+			}
+			if c := column(schema, table, name); c != nil {
+				applyMySQLHistogram(c, histogram)
+			}
+			return nil
+		})
+
+	mc.optionalQuery("MariaDB column statistics", `
+		SELECT db_name, table_name, column_name, COALESCE(nulls_ratio, 0), COALESCE(avg_frequency, 0)
+		FROM mysql.column_stats
+		WHERE (DATABASE() IS NULL OR db_name = DATABASE())`,
+		func(rows *sql.Rows) error {
+			var schema, table, name string
+			var nullsRatio, avgFrequency float64
+			if err := rows.Scan(&schema, &table, &name, &nullsRatio, &avgFrequency); err != nil {
+				return err
+			}
+			if c := column(schema, table, name); c != nil {
+				c.NullFrac = nullsRatio
+				// Rows per distinct value, i.e. the reciprocal of a
+				// negative n_distinct
+				if avgFrequency > 0 {
+					c.NDistinct = -1 / avgFrequency
+				}
+			}
+			return nil
+		})
+
+	logger.LogInfof("Collected statistics for %d columns", len(stats))
+	return stats, nil
+}
+
+func (mc *MySQLCollector) GetForeignKeys() ([]store.ForeignKey, error) {
+	logger.LogInfo("Collecting foreign keys from information_schema.KEY_COLUMN_USAGE")
+
+	query := fmt.Sprintf(`
+		SELECT
+			k.TABLE_SCHEMA,
+			k.TABLE_NAME,
+			k.CONSTRAINT_NAME,
+			GROUP_CONCAT(k.COLUMN_NAME ORDER BY k.ORDINAL_POSITION SEPARATOR ','),
+			k.REFERENCED_TABLE_SCHEMA,
+			k.REFERENCED_TABLE_NAME,
+			GROUP_CONCAT(k.REFERENCED_COLUMN_NAME ORDER BY k.ORDINAL_POSITION SEPARATOR ','),
+			MAX(rc.DELETE_RULE),
+			MAX(rc.UPDATE_RULE)
+		FROM information_schema.KEY_COLUMN_USAGE k
+		JOIN information_schema.REFERENTIAL_CONSTRAINTS rc
+		  ON rc.CONSTRAINT_SCHEMA = k.CONSTRAINT_SCHEMA AND rc.CONSTRAINT_NAME = k.CONSTRAINT_NAME
+		WHERE k.REFERENCED_TABLE_NAME IS NOT NULL
+		  AND (DATABASE() IS NULL OR k.TABLE_SCHEMA = DATABASE())
+		  AND k.TABLE_SCHEMA NOT IN (%s)
+		GROUP BY k.TABLE_SCHEMA, k.TABLE_NAME, k.CONSTRAINT_NAME, k.REFERENCED_TABLE_SCHEMA, k.REFERENCED_TABLE_NAME
+		ORDER BY k.TABLE_SCHEMA, k.TABLE_NAME, k.CONSTRAINT_NAME
+	`, mysqlSystemSchemas)
+
+	rows, err := mc.db.Query(query)
+	if err != nil {
+		logger.LogErrorf("Failed to query foreign keys: %v", err)
+		return nil, fmt.Errorf("failed to query foreign keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []store.ForeignKey
+	for rows.Next() {
+		var fk store.ForeignKey
+		var columns, refColumns string
+		err := rows.Scan(
+			&fk.SchemaName, &fk.TableName, &fk.ConstraintName, &columns,
+			&fk.RefSchemaName, &fk.RefTableName, &refColumns,
+			&fk.OnDelete, &fk.OnUpdate,
+		)
+		if err != nil {
+			logger.LogErrorf("Failed to scan foreign key row: %v", err)
+			return nil, fmt.Errorf("failed to scan foreign key: %w", err)
+		}
+		fk.Columns = strings.Split(columns, ",")
+		fk.RefColumns = strings.Split(refColumns, ",")
+		keys = append(keys, fk)
+	}
+
+	logger.LogInfof("Collected %d foreign keys", len(keys))
+	return keys, rows.Err()
+}
+
+// GetBloat reports the free space InnoDB keeps in each table's tablespace,
+// which only a rebuild returns to the file system. InnoDB has nothing like
+// pgstattuple, so exact is ignored, and index pages are counted with their
+// table. Tables in the shared system tablespace all report its free space,
+// so nothing is reported when innodb_file_per_table is off.
+func (mc *MySQLCollector) GetBloat(exact bool) ([]store.BloatEstimate, error) {
+	logger.LogInfo("Collecting table free space from information_schema.TABLES")
+
+	var filePerTable bool
+	if err := mc.db.QueryRow(`SELECT @@innodb_file_per_table`).Scan(&filePerTable); err != nil {
+		logger.LogErrorf("Failed to read innodb_file_per_table: %v", err)
+		return nil, fmt.Errorf("failed to read innodb_file_per_table: %w", err)
+	}
+	if !filePerTable {
+		logger.LogInfo("innodb_file_per_table is off, table free space is not per table")
+		return nil, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT
+			TABLE_SCHEMA,
+			TABLE_NAME,
+			COALESCE(DATA_LENGTH, 0) + COALESCE(INDEX_LENGTH, 0),
+			COALESCE(DATA_FREE, 0)
+		FROM information_schema.TABLES
+		WHERE TABLE_TYPE = 'BASE TABLE'
+		  AND ENGINE = 'InnoDB'
+		  AND (DATABASE() IS NULL OR TABLE_SCHEMA = DATABASE())
+		  AND TABLE_SCHEMA NOT IN (%s)
+		ORDER BY TABLE_SCHEMA, TABLE_NAME
+	`, mysqlSystemSchemas)
+
+	rows, err := mc.db.Query(query)
+	if err != nil {
+		logger.LogErrorf("Failed to query table free space: %v", err)
+		return nil, fmt.Errorf("failed to query table free space: %w", err)
+	}
+	defer rows.Close()
+
+	var estimates []store.BloatEstimate
+	for rows.Next() {
+		b := store.BloatEstimate{Source: store.BloatDataFree}
+		if err := rows.Scan(&b.SchemaName, &b.TableName, &b.SizeBytes, &b.WastedBytes); err != nil {
+			logger.LogErrorf("Failed to scan table free space row: %v", err)
+			return nil, fmt.Errorf("failed to scan table free space: %w", err)
+		}
+		// DATA_FREE is free space beyond the data, so it counts in the size
+		b.SizeBytes += b.WastedBytes
+		estimates = append(estimates, b)
+	}
+
+	logger.LogInfof("Collected %d bloat estimates", len(estimates))
+	return estimates, rows.Err()
+}
+
+// GetVacuumHealth fails: InnoDB purges old row versions itself and has no
+// transaction ID wraparound.
+func (mc *MySQLCollector) GetVacuumHealth() (*store.VacuumHealth, error) {
+	return nil, fmt.Errorf("vacuum monitoring is only available for PostgreSQL")
+}
+
+// GetTransactionHorizon fails: InnoDB's purge lag has no per-session
+// horizon, replication slots or prepared transactions to report.
+func (mc *MySQLCollector) GetTransactionHorizon() (*store.TransactionHorizon, error) {
+	return nil, fmt.Errorf("transaction horizon monitoring is only available for PostgreSQL")
+}
+
+// GetMemorySettings fails: MySQL sizes sort buffers and temporary tables
+// with settings the work_mem rules do not model.
+func (mc *MySQLCollector) GetMemorySettings() (*store.MemorySettings, error) {
+	return nil, fmt.Errorf("memory settings are only available for PostgreSQL")
+}
+
+// GetCacheStats fails: the InnoDB buffer pool keeps no per-table hit and
+// read counters to compare with pg_statio.
+func (mc *MySQLCollector) GetCacheStats() (*store.CacheUsage, error) {
+	return nil, fmt.Errorf("buffer cache statistics are only available for PostgreSQL")
+}
+
+// SampleActivity reads the process list, the open InnoDB transactions and,
+// from the sys schema when it is installed, the row and metadata lock
+// waits. Sleeping connections are kept only while they hold a transaction
+// open, reported as "idle in transaction" like PostgreSQL does.
+func (mc *MySQLCollector) SampleActivity() (*store.ActivitySample, error) {
+	sample := &store.ActivitySample{}
+	if err := mc.db.QueryRow(`SELECT NOW(6)`).Scan(&sample.CapturedAt); err != nil {
+		logger.LogErrorf("Failed to read server clock: %v", err)
+		return nil, fmt.Errorf("failed to read server clock: %w", err)
+	}
+
+	sessions, order, err := mc.processList(sample.CapturedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	mc.optionalQuery("open transactions", `
+		SELECT trx_mysql_thread_id, trx_started
+		FROM information_schema.INNODB_TRX`,
+		func(rows *sql.Rows) error {
+			var pid int
+			var started time.Time
+			if err := rows.Scan(&pid, &started); err != nil {
+				return err
+			}
+			if s, ok := sessions[pid]; ok {
+				s.XactStart = &started
+				if s.State == "idle" {
+					s.State = "idle in transaction"
+				}
+			}
+			return nil
+		})
+
+	wait := func(pid, blocker int, lockType, mode, relation string, age int64) {
+		s, ok := sessions[pid]
+		if !ok {
+			return
+		}
+		s.BlockedBy = append(s.BlockedBy, blocker)
+		s.WaitEventType = "Lock"
+		s.LockType, s.LockMode, s.Relation = lockType, mode, relation
+		started := sample.CapturedAt.Add(-time.Duration(age) * time.Second)
+		s.WaitStart = &started
+	}
+	mc.optionalQuery("row lock waits", `
+		SELECT waiting_pid, blocking_pid, LOWER(locked_type), waiting_lock_mode, REPLACE(locked_table, CHAR(96), ''), wait_age_secs
+		FROM sys.innodb_lock_waits`,
+		func(rows *sql.Rows) error {
+			var pid, blocker int
+			var lockType, mode, relation string
+			var age int64
+			if err := rows.Scan(&pid, &blocker, &lockType, &mode, &relation, &age); err != nil {
+				return err
+			}
+			wait(pid, blocker, lockType, mode, relation, age)
+			return nil
+		})
+	mc.optionalQuery("metadata lock waits", `
+		SELECT waiting_pid, blocking_pid, waiting_lock_type, CONCAT(object_schema, '.', object_name), waiting_query_secs
+		FROM sys.schema_table_lock_waits`,
+		func(rows *sql.Rows) error {
+			var pid, blocker int
+			var mode, relation string
+			var age int64
+			if err := rows.Scan(&pid, &blocker, &mode, &relation, &age); err != nil {
+				return err
+			}
+			wait(pid, blocker, "metadata", mode, relation, age)
+			return nil
+		})
+
+	blockers := map[int]bool{}
+	for _, s := range sessions {
+		for _, pid := range s.BlockedBy {
+			blockers[pid] = true
+		}
+	}
+	for _, pid := range order {
+		s := sessions[pid]
+		if s.State == "idle" && !blockers[pid] {
+			continue
+		}
+		sample.Sessions = append(sample.Sessions, *s)
+	}
+
+	logger.LogDebugf("Sampled %d sessions", len(sample.Sessions))
+	return sample, nil
+}
+
+// SampleWaits reads the process list alone, keeping the connections that
+// are running a command; its state is the wait event. It reads no lock
+// tables, so it is cheap enough to poll often.
+func (mc *MySQLCollector) SampleWaits() (*store.ActivitySample, error) {
+	sample := &store.ActivitySample{}
+	if err := mc.db.QueryRow(`SELECT NOW(6)`).Scan(&sample.CapturedAt); err != nil {
+		logger.LogErrorf("Failed to read server clock: %v", err)
+		return nil, fmt.Errorf("failed to read server clock: %w", err)
+	}
+
+	sessions, order, err := mc.processList(sample.CapturedAt)
+	if err != nil {
+		return nil, err
+	}
+	for _, pid := range order {
+		if s := sessions[pid]; s.State != "idle" {
+			sample.Sessions = append(sample.Sessions, *s)
+		}
+	}
+
+	logger.LogDebugf("Sampled %d sessions", len(sample.Sessions))
+	return sample, nil
+}
+
+// processList reads the connections other than this one, sleeping ones as
+// "idle", keyed by ID and in ID order
+func (mc *MySQLCollector) processList(now time.Time) (map[int]*store.Session, []int, error) {
+	rows, err := mc.db.Query(`
+		SELECT ID, USER, COALESCE(DB, ''), COMMAND, COALESCE(TIME, 0), COALESCE(STATE, ''), COALESCE(INFO, '')
+		FROM information_schema.PROCESSLIST
+		WHERE ID <> CONNECTION_ID()
+		  AND COMMAND NOT IN ('Daemon', 'Binlog Dump', 'Binlog Dump GTID')
+		ORDER BY ID
+	`)
+	if err != nil {
+		logger.LogErrorf("Failed to read the process list: %v", err)
+		return nil, nil, fmt.Errorf("failed to read the process list: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := map[int]*store.Session{}
+	var order []int
+	for rows.Next() {
+		var s store.Session
+		var seconds int64
+		if err := rows.Scan(&s.PID, &s.User, &s.Database, &s.State, &seconds, &s.WaitEvent, &s.Query); err != nil {
+			logger.LogErrorf("Failed to scan process list row: %v", err)
+			return nil, nil, fmt.Errorf("failed to scan process list row: %w", err)
+		}
+		s.BackendType = "client backend"
+		since := now.Add(-time.Duration(seconds) * time.Second)
+		s.StateChange = &since
+		if s.State == "Sleep" {
+			s.State = "idle"
+		} else {
+			s.State = "active"
+			s.QueryStart = &since
+		}
+		sessions[s.PID] = &s
+		order = append(order, s.PID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read process list rows: %w", err)
+	}
+	return sessions, order, nil
+}
+
+// mysqlHistogram is the JSON document in COLUMN_STATISTICS.HISTOGRAM.
+// Singleton buckets are [value, cumulative frequency]; equi-height buckets
+// are [lower, upper, cumulative frequency, distinct values].
+type mysqlHistogram struct {
+	Type       string              `json:"histogram-type"`
+	NullValues float64             `json:"null-values"`
+	Buckets    [][]json.RawMessage `json:"buckets"`
+}
+
+func applyMySQLHistogram(c *store.ColumnStats, document string) {
+	var h mysqlHistogram
+	if err := json.Unmarshal([]byte(document), &h); err != nil {
+		logger.LogDebugf("Skipping histogram of %s.%s: %v", c.TableName, c.ColumnName, err)
+		return
+	}
+	c.NullFrac = h.NullValues
+
+	switch h.Type {
+	case "singleton":
+		// Every value has its own bucket, so they are all common values
+		previous := 0.0
+		c.MostCommonVals, c.MostCommonFreqs = nil, nil
+		for _, b := range h.Buckets {
+			if len(b) < 2 {
+				continue
+			}
+			cumulative, _ := strconv.ParseFloat(string(b[1]), 64)
+			c.MostCommonVals = append(c.MostCommonVals, histogramValue(b[0]))
+			c.MostCommonFreqs = append(c.MostCommonFreqs, cumulative-previous)
+			previous = cumulative
+		}
+		c.NDistinct = float64(len(c.MostCommonVals))
+	case "equi-height":
+		distinct := 0.0
+		c.HistogramBounds = nil
+		for i, b := range h.Buckets {
+			if len(b) < 4 {
+				continue
+			}
+			c.HistogramBounds = append(c.HistogramBounds, histogramValue(b[0]))
+			if i == len(h.Buckets)-1 {
+				c.HistogramBounds = append(c.HistogramBounds, histogramValue(b[1]))
+			}
+			n, _ := strconv.ParseFloat(string(b[3]), 64)
+			distinct += n
+		}
+		c.NDistinct = distinct
+	}
+}
+
+// histogramValue renders a bucket value. Strings are stored as
+// "base64:type<N>:<data>".
+func histogramValue(raw json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(raw, &text); err != nil {
+		return string(raw)
+	}
+	if strings.HasPrefix(text, "base64:") {
+		if parts := strings.SplitN(text, ":", 3); len(parts) == 3 {
+			if decoded, err := base64.StdEncoding.DecodeString(parts[2]); err == nil {
+				return string(decoded)
+			}
+		}
+	}
+	return text
+}
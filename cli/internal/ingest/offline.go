@@ -0,0 +1,248 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"cli/internal/config"
+	"cli/internal/explain"
+	"cli/internal/logger"
+	"cli/internal/parse"
+	"cli/internal/store"
+)
+
+// FileCollector serves the statistics recorded in an Export, so the analysis
+// commands run without a database. Windowed methods return the activity
+// between the export's baseline and final snapshots, whatever window is
+// asked for, since no new samples can be taken.
+type FileCollector struct {
+	export *Export
+	parser *parse.QueryParser
+
+	mu         sync.Mutex
+	lastDeltas []store.QueryDelta
+}
+
+var _ Collector = (*FileCollector)(nil)
+
+// ErrPlanNotExported is returned by FileCollector.Explain for statements
+// beyond the --explain-top of the export.
+var ErrPlanNotExported = errors.New("no plan was exported for this statement")
+
+func NewFileCollector(export *Export) *FileCollector {
+	return &FileCollector{export: export, parser: parse.NewQueryParser()}
+}
+
+func (fc *FileCollector) Engine() string {
+	if fc.export.Engine == "" {
+		return config.EnginePostgres
+	}
+	return fc.export.Engine
+}
+
+// Export returns the export the collector reads
+func (fc *FileCollector) Export() *Export {
+	return fc.export
+}
+
+// statements returns a copy of the final snapshot's statements matching keep,
+// ordered by less and cut to limit when limit > 0.
+func (fc *FileCollector) statements(keep func(store.QueryStats) bool, less func(a, b store.QueryStats) bool, limit int) []store.QueryStats {
+	var stats []store.QueryStats
+	for _, s := range fc.export.Statements.Statements {
+		if keep(s) {
+			stats = append(stats, s)
+		}
+	}
+	sort.SliceStable(stats, func(i, j int) bool { return less(stats[i], stats[j]) })
+	if limit > 0 && len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return stats
+}
+
+func byMeanTime(a, b store.QueryStats) bool  { return a.MeanExecTime > b.MeanExecTime }
+func byTotalTime(a, b store.QueryStats) bool { return a.TotalTime > b.TotalTime }
+
+func (fc *FileCollector) GetQueryStats() ([]store.QueryStats, error) {
+	stats := fc.statements(func(s store.QueryStats) bool { return s.Calls > 1 }, byMeanTime, 100)
+	logger.LogInfof("Read %d query statistics records from export", len(stats))
+	return stats, nil
+}
+
+func (fc *FileCollector) GetSlowQueries(minDurationMS float64) ([]store.QueryStats, error) {
+	stats := fc.statements(func(s store.QueryStats) bool {
+		return s.MeanExecTime > minDurationMS && s.Calls > 1
+	}, byMeanTime, config.Get().Rules.SlowQueryLimit)
+	logger.LogInfof("Read %d slow queries from export", len(stats))
+	return stats, nil
+}
+
+func (fc *FileCollector) GetWorkload(limit int) ([]store.QueryStats, error) {
+	stats := fc.statements(func(s store.QueryStats) bool { return s.Calls > 0 }, byTotalTime, limit)
+	logger.LogInfof("Read %d workload statements from export", len(stats))
+	return stats, nil
+}
+
+func (fc *FileCollector) GetTableInfo() ([]store.TableInfo, error) {
+	return fc.export.Tables, nil
+}
+
+func (fc *FileCollector) GetIndexInfo() ([]store.IndexInfo, error) {
+	return fc.export.Indexes, nil
+}
+
+func (fc *FileCollector) GetColumnStats(tables []string) ([]store.ColumnStats, error) {
+	if len(tables) == 0 {
+		return fc.export.ColumnStats, nil
+	}
+	var stats []store.ColumnStats
+	for _, c := range fc.export.ColumnStats {
+		if slices.Contains(tables, c.TableName) {
+			stats = append(stats, c)
+		}
+	}
+	return stats, nil
+}
+
+func (fc *FileCollector) GetForeignKeys() ([]store.ForeignKey, error) {
+	return fc.export.ForeignKeys, nil
+}
+
+// GetBloat returns the exported estimates, measured or not as they were at
+// export time.
+func (fc *FileCollector) GetBloat(exact bool) ([]store.BloatEstimate, error) {
+	return fc.export.Bloat, nil
+}
+
+func (fc *FileCollector) GetVacuumHealth() (*store.VacuumHealth, error) {
+	if fc.export.Vacuum == nil {
+		return nil, fmt.Errorf("the snapshot export has no vacuum state")
+	}
+	return fc.export.Vacuum, nil
+}
+
+// SampleActivity fails: sessions come and go too quickly to export.
+func (fc *FileCollector) SampleActivity() (*store.ActivitySample, error) {
+	return nil, fmt.Errorf("activity sampling needs a live database, not a snapshot export")
+}
+
+func (fc *FileCollector) SampleWaits() (*store.ActivitySample, error) {
+	return nil, fmt.Errorf("activity sampling needs a live database, not a snapshot export")
+}
+
+func (fc *FileCollector) GetTransactionHorizon() (*store.TransactionHorizon, error) {
+	return nil, fmt.Errorf("transaction horizon monitoring needs a live database, not a snapshot export")
+}
+
+func (fc *FileCollector) GetMemorySettings() (*store.MemorySettings, error) {
+	if fc.export.Memory == nil {
+		return nil, fmt.Errorf("the snapshot export has no memory settings")
+	}
+	return fc.export.Memory, nil
+}
+
+func (fc *FileCollector) GetCacheStats() (*store.CacheUsage, error) {
+	if fc.export.Cache == nil {
+		return nil, fmt.Errorf("the snapshot export has no buffer cache statistics")
+	}
+	return fc.export.Cache, nil
+}
+
+func (fc *FileCollector) TakeSnapshot() (*StatsSnapshot, error) {
+	return fc.export.Statements.Snapshot(), nil
+}
+
+// CollectDeltas returns the exported window, or an error when the export
+// has no baseline.
+func (fc *FileCollector) CollectDeltas() ([]store.QueryDelta, error) {
+	if fc.export.Baseline == nil {
+		return nil, fmt.Errorf("the snapshot export has no baseline; export it with --window to analyze a window")
+	}
+
+	deltas := ComputeDeltas(fc.export.Baseline.Snapshot(), fc.export.Statements.Snapshot())
+	fc.mu.Lock()
+	fc.lastDeltas = deltas
+	fc.mu.Unlock()
+	return deltas, nil
+}
+
+func (fc *FileCollector) LatestDeltas() []store.QueryDelta {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.lastDeltas
+}
+
+func (fc *FileCollector) SampleDeltas(window time.Duration) ([]store.QueryDelta, error) {
+	deltas, err := fc.CollectDeltas()
+	if err != nil {
+		return nil, err
+	}
+	exported := fc.export.Statements.CapturedAt.Sub(fc.export.Baseline.CapturedAt)
+	if window != exported {
+		logger.LogInfof("Using the exported %s window instead of %s", exported.Round(time.Second), window)
+	}
+	return deltas, nil
+}
+
+func (fc *FileCollector) GetSlowQueriesInWindow(minDurationMS float64, window time.Duration) ([]store.QueryStats, error) {
+	deltas, err := fc.SampleDeltas(window)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats []store.QueryStats
+	for _, d := range deltas {
+		if d.MeanExecTime > minDurationMS {
+			stats = append(stats, d.AsQueryStats())
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool { return byMeanTime(stats[i], stats[j]) })
+	if limit := config.Get().Rules.SlowQueryLimit; len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return stats, nil
+}
+
+func (fc *FileCollector) GetWorkloadInWindow(limit int, window time.Duration) ([]store.QueryStats, error) {
+	deltas, err := fc.SampleDeltas(window)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]store.QueryStats, 0, len(deltas))
+	for _, d := range deltas {
+		stats = append(stats, d.AsQueryStats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return byTotalTime(stats[i], stats[j]) })
+	if limit > 0 && len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return stats, nil
+}
+
+// StartSampling publishes the exported window once, if there is one, so
+// the deltas endpoint has something to show.
+func (fc *FileCollector) StartSampling(interval time.Duration, stop <-chan struct{}) {
+	if fc.export.Baseline == nil {
+		logger.LogInfo("Snapshot export has no baseline, deltas unavailable")
+		return
+	}
+	if _, err := fc.CollectDeltas(); err != nil {
+		logger.LogErrorf("Failed to compute exported deltas: %v", err)
+	}
+}
+
+// Explain returns the plan recorded for query at export time. It lets the
+// export stand in for an explain.Explainer.
+func (fc *FileCollector) Explain(query string) (*explain.Plan, error) {
+	raw, ok := fc.export.Plans[fc.parser.GenerateFingerprint(query)]
+	if !ok {
+		return nil, ErrPlanNotExported
+	}
+	return explain.Parse(string(raw))
+}
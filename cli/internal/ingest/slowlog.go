@@ -0,0 +1,365 @@
+package ingest
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cli/internal/logger"
+	"cli/internal/parse"
+	"cli/internal/store"
+)
+
+var (
+	slowTimePattern      = regexp.MustCompile(`^# Time: (.+)$`)
+	slowUserHostPattern  = regexp.MustCompile(`^# User@Host: ([^\[\s]*)\[[^\]]*\] @ (\S*) ?\[([^\]]*)\]`)
+	slowFieldPattern     = regexp.MustCompile(`(\w+): (\S+)`)
+	slowUsePattern       = regexp.MustCompile("(?i)^use `?([^`;]+)`?;$")
+	slowTimestampPattern = regexp.MustCompile(`(?i)^SET timestamp=(\d+)(?:\.\d+)?;$`)
+
+	// Written at startup and after every FLUSH LOGS, between entries
+	slowPreamblePattern = regexp.MustCompile(`^(\S.*, Version: .*started with:|Tcp port: \d+|Time\s+Id\s+Command\s+Argument)`)
+)
+
+// slowTimeLayouts covers MySQL 5.7+ (ISO 8601) and MySQL 5.6/MariaDB
+// (yymmdd with an unpadded hour).
+var slowTimeLayouts = []string{
+	time.RFC3339Nano,
+	"060102 15:04:05",
+}
+
+// SlowLogEntry is one statement from a MySQL or MariaDB slow query log.
+type SlowLogEntry struct {
+	LoggedAt     time.Time
+	User         string
+	Host         string
+	Database     string
+	QueryTimeMS  float64
+	LockTimeMS   float64
+	RowsSent     int64
+	RowsExamined int64
+	Query        string
+	Fingerprint  string
+	SourceFile   string
+}
+
+// SlowLogReader turns slow log lines into entries. Like LogReader, lines
+// must be fed in file order and an entry is only emitted once the next one
+// starts or Flush is called.
+type SlowLogReader struct {
+	sourceFile string
+	parser     *parse.QueryParser
+	current    *SlowLogEntry
+	body       []string
+	// MySQL only writes "use db;" when the database changes, so it carries
+	// over to the entries that follow
+	database string
+}
+
+func NewSlowLogReader(sourceFile string) *SlowLogReader {
+	return &SlowLogReader{
+		sourceFile: sourceFile,
+		parser:     parse.NewQueryParser(),
+	}
+}
+
+// Feed consumes one line (without its trailing newline) and calls emit for
+// the entry it completes, if any.
+func (sr *SlowLogReader) Feed(line string, emit func(SlowLogEntry)) {
+	if slowPreamblePattern.MatchString(line) {
+		return
+	}
+
+	if strings.HasPrefix(line, "# administrator command:") {
+		// The command, such as Quit or Ping, is the body of its entry and
+		// ends it. Dropping the entry here makes the next header start a
+		// new one, instead of running into it and ignoring its SET
+		// timestamp when there is no "# Time:" line.
+		if len(sr.body) > 0 {
+			sr.Flush(emit)
+		}
+		sr.current = nil
+		return
+	}
+
+	if strings.HasPrefix(line, "# ") {
+		// A header after statement text starts the next entry
+		if sr.current != nil && len(sr.body) > 0 {
+			sr.Flush(emit)
+		}
+		if sr.current == nil {
+			sr.current = &SlowLogEntry{Database: sr.database, SourceFile: sr.sourceFile}
+		}
+		sr.parseHeader(line)
+		return
+	}
+
+	if sr.current == nil {
+		return
+	}
+
+	trimmed := strings.TrimSpace(line)
+	if len(sr.body) == 0 {
+		if m := slowUsePattern.FindStringSubmatch(trimmed); m != nil {
+			sr.database = m[1]
+			sr.current.Database = m[1]
+			return
+		}
+		if m := slowTimestampPattern.FindStringSubmatch(trimmed); m != nil {
+			if sr.current.LoggedAt.IsZero() {
+				if secs, err := strconv.ParseInt(m[1], 10, 64); err == nil {
+					sr.current.LoggedAt = time.Unix(secs, 0).UTC()
+				}
+			}
+			return
+		}
+		if trimmed == "" {
+			return
+		}
+	}
+	sr.body = append(sr.body, line)
+}
+
+func (sr *SlowLogReader) parseHeader(line string) {
+	entry := sr.current
+
+	if m := slowTimePattern.FindStringSubmatch(line); m != nil {
+		entry.LoggedAt = parseSlowLogTime(m[1])
+		return
+	}
+	if m := slowUserHostPattern.FindStringSubmatch(line); m != nil {
+		entry.User = m[1]
+		entry.Host = m[2]
+		if entry.Host == "" {
+			entry.Host = m[3]
+		}
+	}
+
+	for _, m := range slowFieldPattern.FindAllStringSubmatch(line, -1) {
+		switch m[1] {
+		case "Query_time":
+			entry.QueryTimeMS = parseSeconds(m[2])
+		case "Lock_time":
+			entry.LockTimeMS = parseSeconds(m[2])
+		case "Rows_sent":
+			entry.RowsSent, _ = strconv.ParseInt(m[2], 10, 64)
+		case "Rows_examined":
+			entry.RowsExamined, _ = strconv.ParseInt(m[2], 10, 64)
+		case "Schema":
+			// MariaDB names the database on every entry
+			entry.Database = m[2]
+			sr.database = m[2]
+		}
+	}
+}
+
+// Flush emits the entry in progress. Entries without statement text are
+// dropped, like those of administrator commands.
+func (sr *SlowLogReader) Flush(emit func(SlowLogEntry)) {
+	entry, body := sr.current, sr.body
+	sr.current, sr.body = nil, nil
+	if entry == nil {
+		return
+	}
+
+	query := strings.TrimSpace(strings.Join(body, "\n"))
+	query = strings.TrimSpace(strings.TrimSuffix(query, ";"))
+	if query == "" {
+		return
+	}
+
+	entry.Query = stripIdentifierQuotes(query)
+	entry.Fingerprint = sr.parser.GenerateFingerprint(entry.Query)
+	emit(*entry)
+}
+
+func parseSlowLogTime(value string) time.Time {
+	value = strings.Join(strings.Fields(value), " ")
+	for _, layout := range slowTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	logger.LogDebugf("Unrecognized slow log time %q", value)
+	return time.Time{}
+}
+
+// parseSeconds converts a slow log duration in seconds to milliseconds
+func parseSeconds(value string) float64 {
+	secs, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return secs * 1000
+}
+
+// stripIdentifierQuotes drops MySQL backtick quoting outside string literals,
+// so statements fingerprint the same either way and parse with the
+// PostgreSQL grammar.
+func stripIdentifierQuotes(query string) string {
+	var b strings.Builder
+	var quote rune
+	escaped := false
+	for _, r := range query {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0 && r == '\\':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '\'' || r == '"'):
+			quote = r
+		case quote == 0 && r == '`':
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// ParseSlowLogFile reads a whole slow query log.
+func ParseSlowLogFile(path string) ([]SlowLogEntry, error) {
+	logger.LogInfof("Parsing slow query log %s", path)
+
+	file, err := os.Open(path)
+	if err != nil {
+		logger.LogErrorf("Failed to open slow log: %v", err)
+		return nil, fmt.Errorf("failed to open slow log: %w", err)
+	}
+	defer file.Close()
+
+	var entries []SlowLogEntry
+	collect := func(e SlowLogEntry) { entries = append(entries, e) }
+
+	reader := NewSlowLogReader(path)
+	buf := bufio.NewReader(file)
+	for {
+		line, err := buf.ReadString('\n')
+		if line != "" {
+			reader.Feed(strings.TrimRight(line, "\r\n"), collect)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read slow log: %w", err)
+		}
+	}
+	reader.Flush(collect)
+
+	logger.LogInfof("Parsed %d statements from %s", len(entries), path)
+	return entries, nil
+}
+
+// SlowLogStats aggregates the executions of one fingerprint. Stats carries
+// the pg_stat_statements-style counters the rule engine reads; lock time and
+// rows examined have no counterpart there.
+type SlowLogStats struct {
+	Fingerprint     string
+	Database        string
+	Stats           store.QueryStats
+	LockTimeMS      float64
+	RowsExamined    int64
+	MaxRowsExamined int64
+}
+
+// AggregateSlowLog groups entries by fingerprint, slowest total first. The
+// query text is that of the first execution, as in pg_stat_statements.
+func AggregateSlowLog(entries []SlowLogEntry) []SlowLogStats {
+	groups := map[string]*SlowLogStats{}
+	sumSquares := map[string]float64{}
+	var order []string
+
+	for _, e := range entries {
+		g, ok := groups[e.Fingerprint]
+		if !ok {
+			h := fnv.New64a()
+			h.Write([]byte(e.Fingerprint))
+			g = &SlowLogStats{
+				Fingerprint: e.Fingerprint,
+				Database:    e.Database,
+				Stats: store.QueryStats{
+					QueryID:     int64(h.Sum64()),
+					TopLevel:    true,
+					Query:       e.Query,
+					MinExecTime: e.QueryTimeMS,
+				},
+			}
+			groups[e.Fingerprint] = g
+			order = append(order, e.Fingerprint)
+		}
+
+		s := &g.Stats
+		s.Calls++
+		s.TotalTime += e.QueryTimeMS
+		s.MinExecTime = math.Min(s.MinExecTime, e.QueryTimeMS)
+		s.MaxExecTime = math.Max(s.MaxExecTime, e.QueryTimeMS)
+		s.Rows += e.RowsSent
+		sumSquares[e.Fingerprint] += e.QueryTimeMS * e.QueryTimeMS
+		g.LockTimeMS += e.LockTimeMS
+		g.RowsExamined += e.RowsExamined
+		g.MaxRowsExamined = max(g.MaxRowsExamined, e.RowsExamined)
+	}
+
+	stats := make([]SlowLogStats, 0, len(order))
+	for _, fp := range order {
+		g := groups[fp]
+		s := &g.Stats
+		s.MeanExecTime = s.TotalTime / float64(s.Calls)
+		// Population standard deviation, as pg_stat_statements reports
+		variance := sumSquares[fp]/float64(s.Calls) - s.MeanExecTime*s.MeanExecTime
+		s.StddevExecTime = math.Sqrt(math.Max(variance, 0))
+		stats = append(stats, *g)
+	}
+
+	sort.SliceStable(stats, func(i, j int) bool {
+		return stats[i].Stats.TotalTime > stats[j].Stats.TotalTime
+	})
+	return stats
+}
+
+// SlowLogTables infers table sizes from rows examined, since an offline log
+// has no catalog to read. A single-table statement that scanned the table
+// examined every row, so the largest count is a lower bound on its size;
+// joins split their count evenly across the tables involved.
+func SlowLogTables(stats []SlowLogStats) []store.TableInfo {
+	parser := parse.NewQueryParser()
+	rows := map[string]int64{}
+	schemas := map[string]string{}
+
+	for _, s := range stats {
+		tables := parser.ExtractTables(s.Stats.Query)
+		if len(tables) == 0 {
+			continue
+		}
+		share := s.MaxRowsExamined / int64(len(tables))
+		for _, table := range tables {
+			rows[table] = max(rows[table], share)
+			if schemas[table] == "" {
+				schemas[table] = s.Database
+			}
+		}
+	}
+
+	tables := make([]store.TableInfo, 0, len(rows))
+	for name, count := range rows {
+		tables = append(tables, store.TableInfo{
+			SchemaName: schemas[name],
+			TableName:  name,
+			RowCount:   count,
+		})
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		return tables[i].RowCount > tables[j].RowCount
+	})
+	return tables
+}
@@ -0,0 +1,143 @@
+package ingest
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlowLogReader(t *testing.T) {
+	type entry struct {
+		loggedAt    string
+		user        string
+		host        string
+		database    string
+		queryTimeMS float64
+		rowsSent    int64
+		query       string
+	}
+
+	tests := []struct {
+		name string
+		log  string
+		want []entry
+	}{
+		{
+			name: "MySQL 8.0 entry",
+			log: `/usr/sbin/mysqld, Version: 8.0.36 (MySQL Community Server - GPL). started with:
+Tcp port: 3306  Unix socket: /var/run/mysqld/mysqld.sock
+Time                 Id Command    Argument
+# Time: 2026-03-02T10:15:01.123456Z
+# User@Host: app[app] @ web-1 [10.0.0.5]  Id:    42
+# Query_time: 1.250000  Lock_time: 0.000100 Rows_sent: 3  Rows_examined: 120000
+use shop;
+SET timestamp=1772446501;
+SELECT * FROM ` + "`orders`" + ` WHERE customer_id = 7;`,
+			want: []entry{{
+				loggedAt: "2026-03-02T10:15:01.123456Z", user: "app", host: "web-1", database: "shop",
+				queryTimeMS: 1250, rowsSent: 3, query: "SELECT * FROM orders WHERE customer_id = 7",
+			}},
+		},
+		{
+			name: "multi-line statements and the database carried over",
+			log: `# Time: 2026-03-02T10:15:01Z
+# User@Host: app[app] @  [10.0.0.5]
+# Query_time: 2.0  Lock_time: 0.0 Rows_sent: 1  Rows_examined: 500000
+use shop;
+SET timestamp=1772446501;
+SELECT customer_id, sum(total)
+FROM orders
+GROUP BY customer_id;
+# Time: 2026-03-02T10:15:09Z
+# User@Host: app[app] @  [10.0.0.5]
+# Query_time: 0.5  Lock_time: 0.0 Rows_sent: 0  Rows_examined: 1
+SET timestamp=1772446509;
+DELETE FROM customers WHERE id = 12;`,
+			want: []entry{
+				{
+					loggedAt: "2026-03-02T10:15:01Z", user: "app", host: "10.0.0.5", database: "shop",
+					queryTimeMS: 2000, rowsSent: 1, query: "SELECT customer_id, sum(total)\nFROM orders\nGROUP BY customer_id",
+				},
+				{
+					loggedAt: "2026-03-02T10:15:09Z", user: "app", host: "10.0.0.5", database: "shop",
+					queryTimeMS: 500, query: "DELETE FROM customers WHERE id = 12",
+				},
+			},
+		},
+		{
+			name: "administrator command ends its entry",
+			log: `# User@Host: app[app] @ web-1 []
+# Query_time: 0.000010  Lock_time: 0.0 Rows_sent: 0  Rows_examined: 0
+SET timestamp=1772446500;
+# administrator command: Quit;
+# User@Host: app[app] @ web-1 []
+# Query_time: 3.0  Lock_time: 0.0 Rows_sent: 10  Rows_examined: 900000
+SET timestamp=1772446560;
+SELECT count(*) FROM orders;`,
+			want: []entry{{
+				loggedAt: "2026-03-02T10:16:00Z", user: "app", host: "web-1",
+				queryTimeMS: 3000, rowsSent: 10, query: "SELECT count(*) FROM orders",
+			}},
+		},
+		{
+			name: "MariaDB entry with a schema and a 5.6 time",
+			log: `# Time: 260302  9:05:03
+# User@Host: report[report] @ localhost []
+# Thread_id: 8  Schema: analytics  QC_hit: No
+# Query_time: 12.5  Lock_time: 0.001  Rows_sent: 20  Rows_examined: 4000000
+SET timestamp=1772442303;
+SELECT region, count(*) FROM visits GROUP BY region;`,
+			want: []entry{{
+				loggedAt: "2026-03-02T09:05:03Z", user: "report", host: "localhost", database: "analytics",
+				queryTimeMS: 12500, rowsSent: 20, query: "SELECT region, count(*) FROM visits GROUP BY region",
+			}},
+		},
+		{
+			name: "entry without a statement",
+			log: `# Time: 2026-03-02T10:15:01Z
+# User@Host: app[app] @ web-1 []
+# Query_time: 0.1  Lock_time: 0.0 Rows_sent: 0  Rows_examined: 0
+SET timestamp=1772446501;`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := NewSlowLogReader("slow.log")
+			var got []SlowLogEntry
+			emit := func(e SlowLogEntry) { got = append(got, e) }
+			for _, line := range strings.Split(tt.log, "\n") {
+				reader.Feed(line, emit)
+			}
+			reader.Flush(emit)
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d entries, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, want := range tt.want {
+				e := got[i]
+				loggedAt, err := time.Parse(time.RFC3339Nano, want.loggedAt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !e.LoggedAt.Equal(loggedAt) {
+					t.Errorf("entry %d: LoggedAt = %s, want %s", i, e.LoggedAt, loggedAt)
+				}
+				if e.User != want.user || e.Host != want.host || e.Database != want.database {
+					t.Errorf("entry %d: user, host, database = %q, %q, %q, want %q, %q, %q",
+						i, e.User, e.Host, e.Database, want.user, want.host, want.database)
+				}
+				if e.QueryTimeMS != want.queryTimeMS || e.RowsSent != want.rowsSent {
+					t.Errorf("entry %d: QueryTimeMS, RowsSent = %v, %d, want %v, %d",
+						i, e.QueryTimeMS, e.RowsSent, want.queryTimeMS, want.rowsSent)
+				}
+				if e.Query != want.query {
+					t.Errorf("entry %d: Query = %q, want %q", i, e.Query, want.query)
+				}
+				if e.Fingerprint == "" || e.SourceFile != "slow.log" {
+					t.Errorf("entry %d: Fingerprint = %q, SourceFile = %q", i, e.Fingerprint, e.SourceFile)
+				}
+			}
+		})
+	}
+}
@@ -5,36 +5,38 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/lib/pq"
+
+	"cli/internal/config"
 	"cli/internal/logger"
 	"cli/internal/store"
 )
 
+// StatsCollector is the PostgreSQL Collector, reading pg_stat_statements
+// and the pg_stat_user_* views.
 type StatsCollector struct {
 	db *sql.DB
+
+	// Delta sampling state, see delta.go
+	sampler
+
+	// Detected pg_stat_statements layout, see columns.go
+	columns *StatementColumns
 }
 
 func NewStatsCollector(db *sql.DB) *StatsCollector {
-	return &StatsCollector{db: db}
+	sc := &StatsCollector{db: db}
+	sc.take = sc.TakeSnapshot
+	return sc
 }
 
 func (sc *StatsCollector) GetQueryStats() ([]store.QueryStats, error) {
 	logger.LogInfo("Collecting query statistics from pg_stat_statements")
 
-	query := `
-		SELECT 
-			query,
-			calls,
-			mean_exec_time,
-			total_exec_time,
-			rows,
-			shared_blks_hit,
-			shared_blks_read
-		FROM pg_stat_statements 
-		WHERE query NOT LIKE '%pg_stat_statements%'
-		  AND calls > 1
-		ORDER BY mean_exec_time DESC
-		LIMIT 100
-	`
+	query, err := sc.statementsQuery("calls > 1", "mean_exec_time DESC", 100)
+	if err != nil {
+		return nil, err
+	}
 
 	rows, err := sc.db.Query(query)
 	if err != nil {
@@ -45,16 +47,7 @@ func (sc *StatsCollector) GetQueryStats() ([]store.QueryStats, error) {
 
 	var stats []store.QueryStats
 	for rows.Next() {
-		var s store.QueryStats
-		err := rows.Scan(
-			&s.Query,
-			&s.Calls,
-			&s.MeanExecTime,
-			&s.TotalTime,
-			&s.Rows,
-			&s.SharedBlksHit,
-			&s.SharedBlksRead,
-		)
+		s, err := scanQueryStats(rows)
 		if err != nil {
 			logger.LogErrorf("Failed to scan query stats row: %v", err)
 			return nil, fmt.Errorf("failed to scan query stats: %w", err)
@@ -66,16 +59,70 @@ func (sc *StatsCollector) GetQueryStats() ([]store.QueryStats, error) {
 	return stats, nil
 }
 
+// scanQueryStats reads one row produced by statementsQuery.
+func scanQueryStats(rows *sql.Rows) (store.QueryStats, error) {
+	var s store.QueryStats
+	err := rows.Scan(
+		&s.QueryID,
+		&s.UserID,
+		&s.DBID,
+		&s.TopLevel,
+		&s.Query,
+		&s.Calls,
+		&s.MeanExecTime,
+		&s.TotalTime,
+		&s.MinExecTime,
+		&s.MaxExecTime,
+		&s.StddevExecTime,
+		&s.Rows,
+		&s.Plans,
+		&s.TotalPlanTime,
+		&s.MeanPlanTime,
+		&s.SharedBlksHit,
+		&s.SharedBlksRead,
+		&s.SharedBlksDirtied,
+		&s.SharedBlksWritten,
+		&s.LocalBlksHit,
+		&s.LocalBlksRead,
+		&s.LocalBlksDirtied,
+		&s.LocalBlksWritten,
+		&s.TempBlksRead,
+		&s.TempBlksWritten,
+		&s.BlkReadTime,
+		&s.BlkWriteTime,
+		&s.WALRecords,
+		&s.WALFPI,
+		&s.WALBytes,
+	)
+	return s, err
+}
+
 func (sc *StatsCollector) GetTableInfo() ([]store.TableInfo, error) {
 	logger.LogInfo("Collecting table information from pg_stat_user_tables")
 
 	query := `
-		SELECT 
-			schemaname,
-			relname as tablename,
-			n_tup_ins + n_tup_upd + n_tup_del as row_count,
-			pg_total_relation_size(schemaname||'.'||relname) as size_bytes
-		FROM pg_stat_user_tables
+		SELECT
+			s.schemaname,
+			s.relname AS tablename,
+			s.n_live_tup,
+			s.n_dead_tup,
+			c.reltuples,
+			c.relpages,
+			pg_relation_size(c.oid) / current_setting('block_size')::bigint AS cur_pages,
+			COALESCE(s.seq_scan, 0),
+			COALESCE(s.seq_tup_read, 0),
+			COALESCE(s.idx_scan, 0),
+			s.n_tup_ins,
+			s.n_tup_upd,
+			s.n_tup_del,
+			s.last_vacuum,
+			s.last_autovacuum,
+			s.last_analyze,
+			s.last_autoanalyze,
+			pg_total_relation_size(c.oid) AS size_bytes,
+			COALESCE(pg_total_relation_size(NULLIF(c.reltoastrelid, 0)), 0) AS toast_bytes
+		FROM pg_stat_user_tables s
+		JOIN pg_class c ON c.oid = s.relid
 		ORDER BY size_bytes DESC
 	`
 
@@ -89,11 +136,20 @@ func (sc *StatsCollector) GetTableInfo() ([]store.TableInfo, error) {
 	var tables []store.TableInfo
 	for rows.Next() {
 		var t store.TableInfo
-		err := rows.Scan(&t.SchemaName, &t.TableName, &t.RowCount, &t.SizeBytes)
+		var curPages int64
+		err := rows.Scan(
+			&t.SchemaName, &t.TableName,
+			&t.LiveTuples, &t.DeadTuples, &t.RelTuples, &t.RelPages, &curPages,
+			&t.SeqScans, &t.SeqTupRead, &t.IdxScans,
+			&t.Inserts, &t.Updates, &t.Deletes,
+			&t.LastVacuum, &t.LastAutovacuum, &t.LastAnalyze, &t.LastAutoanalyze,
+			&t.SizeBytes, &t.ToastBytes,
+		)
 		if err != nil {
 			logger.LogErrorf("Failed to scan table info row: %v", err)
 			return nil, fmt.Errorf("failed to scan table info: %w", err)
 		}
+		t.RowCount = estimateRowCount(t, curPages)
 		tables = append(tables, t)
 	}
 
@@ -101,33 +157,67 @@ func (sc *StatsCollector) GetTableInfo() ([]store.TableInfo, error) {
 	return tables, nil
 }
 
+// estimateRowCount estimates a table's rows the way the planner does:
+// reltuples scaled by how much the table has grown since it was last
+// vacuumed or analyzed. Tables that have never been analyzed fall back to
+// n_live_tup, which is approximate and reset with the statistics.
+func estimateRowCount(t store.TableInfo, curPages int64) int64 {
+	if t.RelTuples < 0 || t.RelPages == 0 {
+		// reltuples is -1 on PostgreSQL 14+ until the first ANALYZE, and
+		// 0 with no pages on older versions
+		if t.RelTuples > 0 {
+			return int64(t.RelTuples)
+		}
+		return t.LiveTuples
+	}
+	density := t.RelTuples / float64(t.RelPages)
+	return int64(density*float64(curPages) + 0.5)
+}
+
 func (sc *StatsCollector) GetIndexInfo() ([]store.IndexInfo, error) {
 	logger.LogInfo("Collecting index information from pg_stat_user_indexes")
 
+	// Columns come back as a text array since expressions may contain
+	// commas. Opclasses are only named when they are not the default for
+	// the column type, as pg_get_indexdef shows them.
 	query := `
 		SELECT 
 			psi.schemaname,
 			psi.relname as tablename,
 			psi.indexrelname as indexname,
-			COALESCE(
-				array_to_string(
-					array(
-						SELECT pg_get_indexdef(psi.indexrelid, k + 1, true)
-						FROM generate_subscripts(pi.indkey, 1) as k
-						ORDER BY k
-					), 
-					','
-				), 
-				''
+			array(
+				SELECT pg_get_indexdef(psi.indexrelid, k + 1, true)
+				FROM generate_subscripts(pi.indkey, 1) as k
+				ORDER BY k
 			) as columns,
 			pi.indisunique,
 			pi.indisprimary,
 			pg_relation_size(psi.indexrelid) as size_bytes,
 			psi.idx_scan,
 			psi.idx_tup_read,
-			psi.idx_tup_fetch
+			psi.idx_tup_fetch,
+			am.amname,
+			pi.indnkeyatts,
+			array(
+				SELECT CASE WHEN opc.opcdefault THEN '' ELSE opc.opcname END
+				FROM generate_subscripts(pi.indclass, 1) as k
+				JOIN pg_opclass opc ON opc.oid = pi.indclass[k]
+				ORDER BY k
+			) as opclasses,
+			COALESCE(pg_get_expr(pi.indpred, pi.indrelid, true), '') as predicate,
+			pg_get_indexdef(psi.indexrelid) as definition,
+			COALESCE((
+				SELECT string_agg(con.conname, ', ' ORDER BY con.conname)
+				FROM pg_constraint con
+				WHERE con.conindid = psi.indexrelid
+			), '') as constraints,
+			pi.indisreplident,
+			NOT pi.indisvalid,
+			(SELECT stats_reset FROM pg_stat_database WHERE datname = current_database())
 		FROM pg_stat_user_indexes psi
 		JOIN pg_index pi ON psi.indexrelid = pi.indexrelid
+		JOIN pg_class ic ON ic.oid = psi.indexrelid
+		JOIN pg_am am ON am.oid = ic.relam
 		ORDER BY size_bytes DESC
 	`
 
@@ -141,31 +231,46 @@ func (sc *StatsCollector) GetIndexInfo() ([]store.IndexInfo, error) {
 	var indexes []store.IndexInfo
 	for rows.Next() {
 		var idx store.IndexInfo
-		var colsStr string
+		var opclasses pq.StringArray
+		var statsReset sql.NullTime
 		err := rows.Scan(
 			&idx.SchemaName,
 			&idx.TableName,
 			&idx.IndexName,
-			&colsStr,
+			pq.Array(&idx.Columns),
 			&idx.IsUnique,
 			&idx.IsPrimary,
 			&idx.SizeBytes,
 			&idx.IndexScans,
 			&idx.TuplesRead,
 			&idx.TuplesFetch,
+			&idx.Method,
+			&idx.KeyColumns,
+			&opclasses,
+			&idx.Predicate,
+			&idx.Definition,
+			&idx.Constraint,
+			&idx.ReplicaIdentity,
+			&idx.Invalid,
+			&statsReset,
 		)
 		if err != nil {
 			logger.LogErrorf("Failed to scan index info row: %v", err)
 			return nil, fmt.Errorf("failed to scan index info: %w", err)
 		}
 
-		// Parse column names
-		if colsStr != "" {
-			idx.Columns = strings.Split(colsStr, ",")
-			for i, col := range idx.Columns {
-				idx.Columns[i] = strings.TrimSpace(col)
+		if idx.KeyColumns == len(idx.Columns) {
+			idx.KeyColumns = 0
+		}
+		for _, opclass := range opclasses {
+			if opclass != "" {
+				idx.OpClasses = opclasses
+				break
 			}
 		}
+		if statsReset.Valid {
+			idx.StatsReset = &statsReset.Time
+		}
 
 		logger.LogDebugf("Found index: %s on %s.%s with columns [%s]",
 			idx.IndexName, idx.SchemaName, idx.TableName, strings.Join(idx.Columns, ", "))
@@ -173,29 +278,167 @@ func (sc *StatsCollector) GetIndexInfo() ([]store.IndexInfo, error) {
 	}
 
 	logger.LogInfof("Collected %d index info records", len(indexes))
-	return indexes, nil
+	return indexes, rows.Err()
 }
 
-func (sc *StatsCollector) GetSlowQueries(minDurationMS float64) ([]store.QueryStats, error) {
-	logger.LogInfof("Collecting slow queries with min duration: %.2fms", minDurationMS)
+func (sc *StatsCollector) GetColumnStats(tables []string) ([]store.ColumnStats, error) {
+	logger.LogInfof("Collecting column statistics from pg_stats for %d tables", len(tables))
 
+	// Value arrays are anyarray and read as text, since their element type
+	// differs per column. Partitioned tables only have inherited rows.
 	query := `
-		SELECT 
-			query,
-			calls,
-			mean_exec_time,
-			total_exec_time,
-			rows,
-			shared_blks_hit,
-			shared_blks_read
-		FROM pg_stat_statements 
-		WHERE query NOT LIKE '%pg_stat_statements%'
-		  AND mean_exec_time > $1
-		  AND calls > 1
-		ORDER BY mean_exec_time DESC
-		LIMIT 50
+		SELECT DISTINCT ON (schemaname, tablename, attname)
+			schemaname,
+			tablename,
+			attname,
+			null_frac,
+			n_distinct,
+			avg_width,
+			most_common_vals::text,
+			most_common_freqs::float8[],
+			histogram_bounds::text,
+			correlation
+		FROM pg_stats
+		WHERE schemaname NOT IN ('pg_catalog', 'information_schema')
+		  AND ($1::text[] IS NULL OR tablename = ANY($1))
+		ORDER BY schemaname, tablename, attname, inherited
 	`
 
+	var filter interface{}
+	if len(tables) > 0 {
+		filter = pq.Array(tables)
+	}
+
+	rows, err := sc.db.Query(query, filter)
+	if err != nil {
+		logger.LogErrorf("Failed to query column statistics: %v", err)
+		return nil, fmt.Errorf("failed to query column statistics: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []store.ColumnStats
+	for rows.Next() {
+		var c store.ColumnStats
+		var mcv, histogram sql.NullString
+		var correlation sql.NullFloat64
+		err := rows.Scan(
+			&c.SchemaName, &c.TableName, &c.ColumnName,
+			&c.NullFrac, &c.NDistinct, &c.AvgWidth,
+			&mcv, pq.Array(&c.MostCommonFreqs), &histogram, &correlation,
+		)
+		if err != nil {
+			logger.LogErrorf("Failed to scan column statistics row: %v", err)
+			return nil, fmt.Errorf("failed to scan column statistics: %w", err)
+		}
+		c.MostCommonVals = parseStatsArray(mcv)
+		c.HistogramBounds = parseStatsArray(histogram)
+		c.Correlation = correlation.Float64
+		stats = append(stats, c)
+	}
+
+	logger.LogInfof("Collected statistics for %d columns", len(stats))
+	return stats, rows.Err()
+}
+
+// GetForeignKeys reads foreign keys from pg_constraint. Partitioned tables
+// are skipped in favour of their partitions, which carry a copy of each
+// constraint and hold the indexes that pg_stat_user_indexes reports.
+func (sc *StatsCollector) GetForeignKeys() ([]store.ForeignKey, error) {
+	logger.LogInfo("Collecting foreign keys from pg_constraint")
+
+	query := `
+		SELECT
+			cn.nspname,
+			c.relname,
+			con.conname,
+			array(
+				SELECT a.attname
+				FROM unnest(con.conkey) WITH ORDINALITY AS k(attnum, n)
+				JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+				ORDER BY k.n
+			),
+			rn.nspname,
+			r.relname,
+			array(
+				SELECT a.attname
+				FROM unnest(con.confkey) WITH ORDINALITY AS k(attnum, n)
+				JOIN pg_attribute a ON a.attrelid = con.confrelid AND a.attnum = k.attnum
+				ORDER BY k.n
+			),
+			con.confdeltype,
+			con.confupdtype
+		FROM pg_constraint con
+		JOIN pg_class c ON c.oid = con.conrelid
+		JOIN pg_namespace cn ON cn.oid = c.relnamespace
+		JOIN pg_class r ON r.oid = con.confrelid
+		JOIN pg_namespace rn ON rn.oid = r.relnamespace
+		WHERE con.contype = 'f'
+		  AND c.relkind = 'r'
+		  AND cn.nspname NOT IN ('pg_catalog', 'information_schema')
+		ORDER BY cn.nspname, c.relname, con.conname
+	`
+
+	rows, err := sc.db.Query(query)
+	if err != nil {
+		logger.LogErrorf("Failed to query foreign keys: %v", err)
+		return nil, fmt.Errorf("failed to query foreign keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []store.ForeignKey
+	for rows.Next() {
+		var fk store.ForeignKey
+		var onDelete, onUpdate string
+		err := rows.Scan(
+			&fk.SchemaName, &fk.TableName, &fk.ConstraintName, pq.Array(&fk.Columns),
+			&fk.RefSchemaName, &fk.RefTableName, pq.Array(&fk.RefColumns),
+			&onDelete, &onUpdate,
+		)
+		if err != nil {
+			logger.LogErrorf("Failed to scan foreign key row: %v", err)
+			return nil, fmt.Errorf("failed to scan foreign key: %w", err)
+		}
+		fk.OnDelete = foreignKeyActions[onDelete]
+		fk.OnUpdate = foreignKeyActions[onUpdate]
+		keys = append(keys, fk)
+	}
+
+	logger.LogInfof("Collected %d foreign keys", len(keys))
+	return keys, rows.Err()
+}
+
+// foreignKeyActions maps pg_constraint.confdeltype and confupdtype
+var foreignKeyActions = map[string]string{
+	"a": "NO ACTION",
+	"r": "RESTRICT",
+	"c": "CASCADE",
+	"n": "SET NULL",
+	"d": "SET DEFAULT",
+}
+
+// parseStatsArray splits the text form of a pg_stats value array. Arrays of
+// arrays (the statistics of array columns) do not split into one value per
+// entry and are dropped.
+func parseStatsArray(text sql.NullString) []string {
+	if !text.Valid {
+		return nil
+	}
+	var values pq.StringArray
+	if err := values.Scan(text.String); err != nil {
+		logger.LogDebugf("Skipping unparseable statistics array: %v", err)
+		return nil
+	}
+	return values
+}
+
+func (sc *StatsCollector) GetSlowQueries(minDurationMS float64) ([]store.QueryStats, error) {
+	logger.LogInfof("Collecting slow queries with min duration: %.2fms", minDurationMS)
+
+	query, err := sc.statementsQuery("mean_exec_time > $1 AND calls > 1", "mean_exec_time DESC", config.Get().Rules.SlowQueryLimit)
+	if err != nil {
+		return nil, err
+	}
+
 	rows, err := sc.db.Query(query, minDurationMS)
 	if err != nil {
 		logger.LogErrorf("Failed to query slow queries: %v", err)
@@ -205,16 +448,7 @@ func (sc *StatsCollector) GetSlowQueries(minDurationMS float64) ([]store.QuerySt
 
 	var stats []store.QueryStats
 	for rows.Next() {
-		var s store.QueryStats
-		err := rows.Scan(
-			&s.Query,
-			&s.Calls,
-			&s.MeanExecTime,
-			&s.TotalTime,
-			&s.Rows,
-			&s.SharedBlksHit,
-			&s.SharedBlksRead,
-		)
+		s, err := scanQueryStats(rows)
 		if err != nil {
 			logger.LogErrorf("Failed to scan slow query row: %v", err)
 			return nil, fmt.Errorf("failed to scan slow query: %w", err)
@@ -228,6 +462,37 @@ func (sc *StatsCollector) GetSlowQueries(minDurationMS float64) ([]store.QuerySt
 	return stats, nil
 }
 
+// GetWorkload returns the statements that account for the most total
+// execution time, reads and writes alike, for workload-wide analysis.
+func (sc *StatsCollector) GetWorkload(limit int) ([]store.QueryStats, error) {
+	logger.LogInfof("Collecting top %d statements by total time", limit)
+
+	query, err := sc.statementsQuery("calls > 0", "total_exec_time DESC", limit)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := sc.db.Query(query)
+	if err != nil {
+		logger.LogErrorf("Failed to query workload: %v", err)
+		return nil, fmt.Errorf("failed to query workload: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []store.QueryStats
+	for rows.Next() {
+		s, err := scanQueryStats(rows)
+		if err != nil {
+			logger.LogErrorf("Failed to scan workload row: %v", err)
+			return nil, fmt.Errorf("failed to scan workload statement: %w", err)
+		}
+		stats = append(stats, s)
+	}
+
+	logger.LogInfof("Collected %d workload statements", len(stats))
+	return stats, nil
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -0,0 +1,212 @@
+package ingest
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"cli/internal/logger"
+	"cli/internal/store"
+)
+
+// GetVacuumHealth reads the freeze age of every database and of each table
+// in the current one, the dead tuples autovacuum has yet to clean and the
+// vacuums in progress.
+func (sc *StatsCollector) GetVacuumHealth() (*store.VacuumHealth, error) {
+	logger.LogInfo("Collecting vacuum state")
+
+	health := &store.VacuumHealth{CapturedAt: time.Now().UTC()}
+
+	err := sc.db.QueryRow(`
+		SELECT
+			current_setting('autovacuum')::bool,
+			current_setting('autovacuum_vacuum_scale_factor')::float8,
+			current_setting('autovacuum_vacuum_threshold')::bigint,
+			current_setting('autovacuum_freeze_max_age')::bigint,
+			current_setting('autovacuum_multixact_freeze_max_age')::bigint,
+			current_setting('autovacuum_max_workers')::int,
+			CASE current_setting('autovacuum_vacuum_cost_limit')
+				WHEN '-1' THEN current_setting('vacuum_cost_limit')::int
+				ELSE current_setting('autovacuum_vacuum_cost_limit')::int
+			END
+	`).Scan(
+		&health.Settings.Autovacuum, &health.Settings.ScaleFactor, &health.Settings.Threshold,
+		&health.Settings.FreezeMaxAge, &health.Settings.MultixactFreezeMaxAge,
+		&health.Settings.MaxWorkers, &health.Settings.CostLimit,
+	)
+	if err != nil {
+		logger.LogErrorf("Failed to read autovacuum settings: %v", err)
+		return nil, fmt.Errorf("failed to read autovacuum settings: %w", err)
+	}
+
+	if health.Databases, err = sc.databaseFreeze(); err != nil {
+		logger.LogErrorf("Failed to read database freeze ages: %v", err)
+		return nil, fmt.Errorf("failed to read database freeze ages: %w", err)
+	}
+	if health.Tables, err = sc.tableVacuum(); err != nil {
+		logger.LogErrorf("Failed to read table vacuum state: %v", err)
+		return nil, fmt.Errorf("failed to read table vacuum state: %w", err)
+	}
+	if health.Running, err = sc.vacuumProgress(); err != nil {
+		logger.LogErrorf("Failed to read vacuum progress: %v", err)
+		return nil, fmt.Errorf("failed to read vacuum progress: %w", err)
+	}
+
+	logger.LogInfof("Collected vacuum state of %d databases and %d tables, %d vacuums running",
+		len(health.Databases), len(health.Tables), len(health.Running))
+	return health, nil
+}
+
+func (sc *StatsCollector) databaseFreeze() ([]store.DatabaseFreeze, error) {
+	rows, err := sc.db.Query(`
+		SELECT datname, age(datfrozenxid), mxid_age(datminmxid)
+		FROM pg_database
+		ORDER BY age(datfrozenxid) DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var databases []store.DatabaseFreeze
+	for rows.Next() {
+		var d store.DatabaseFreeze
+		if err := rows.Scan(&d.Name, &d.XIDAge, &d.MXIDAge); err != nil {
+			return nil, err
+		}
+		databases = append(databases, d)
+	}
+	return databases, rows.Err()
+}
+
+// tableVacuum reads plain tables and materialized views; partitioned
+// tables hold no rows, so their partitions are listed instead
+func (sc *StatsCollector) tableVacuum() ([]store.TableVacuum, error) {
+	rows, err := sc.db.Query(`
+		SELECT
+			s.schemaname,
+			s.relname,
+			pg_total_relation_size(c.oid),
+			s.n_live_tup,
+			s.n_dead_tup,
+			s.n_mod_since_analyze,
+			greatest(age(c.relfrozenxid), age(t.relfrozenxid)),
+			mxid_age(c.relminmxid),
+			s.last_vacuum,
+			s.last_autovacuum,
+			s.last_analyze,
+			s.last_autoanalyze,
+			s.autovacuum_count,
+			coalesce(c.reloptions, '{}')
+		FROM pg_stat_user_tables s
+		JOIN pg_class c ON c.oid = s.relid
+		LEFT JOIN pg_class t ON t.oid = c.reltoastrelid
+		WHERE c.relkind IN ('r', 'm')
+		ORDER BY 7 DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []store.TableVacuum
+	for rows.Next() {
+		var t store.TableVacuum
+		var options []string
+		err := rows.Scan(
+			&t.SchemaName, &t.TableName, &t.SizeBytes,
+			&t.LiveTuples, &t.DeadTuples, &t.ModSinceAnalyze,
+			&t.XIDAge, &t.MXIDAge,
+			&t.LastVacuum, &t.LastAutovacuum, &t.LastAnalyze, &t.LastAutoanalyze,
+			&t.AutovacuumCount, pq.Array(&options),
+		)
+		if err != nil {
+			return nil, err
+		}
+		applyVacuumOptions(&t, options)
+		tables = append(tables, t)
+	}
+	return tables, rows.Err()
+}
+
+// applyVacuumOptions reads the autovacuum storage parameters out of
+// reloptions, which are name=value strings
+func applyVacuumOptions(t *store.TableVacuum, options []string) {
+	for _, option := range options {
+		name, value, ok := strings.Cut(option, "=")
+		if !ok {
+			continue
+		}
+		switch name {
+		case "autovacuum_enabled":
+			if enabled, err := strconv.ParseBool(value); err == nil {
+				t.AutovacuumEnabled = &enabled
+			}
+		case "autovacuum_vacuum_scale_factor":
+			if f, err := strconv.ParseFloat(value, 64); err == nil {
+				t.ScaleFactor = &f
+			}
+		case "autovacuum_vacuum_threshold":
+			if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+				t.Threshold = &n
+			}
+		case "autovacuum_vacuum_cost_limit":
+			if n, err := strconv.Atoi(value); err == nil {
+				t.CostLimit = &n
+			}
+		}
+	}
+}
+
+// vacuumProgress lists the running vacuums. Tables are named only in the
+// current database, since pg_class is per database.
+func (sc *StatsCollector) vacuumProgress() ([]store.VacuumProgress, error) {
+	rows, err := sc.db.Query(`
+		SELECT
+			p.pid,
+			p.datname,
+			n.nspname,
+			coalesce(c.relname, p.relid::text),
+			p.phase,
+			p.heap_blks_total,
+			p.heap_blks_scanned,
+			p.heap_blks_vacuumed,
+			p.index_vacuum_count,
+			a.xact_start,
+			coalesce(a.query, '')
+		FROM pg_stat_progress_vacuum p
+		LEFT JOIN pg_stat_activity a ON a.pid = p.pid
+		LEFT JOIN pg_class c ON c.oid = p.relid AND p.datname = current_database()
+		LEFT JOIN pg_namespace n ON n.oid = c.relnamespace
+		ORDER BY a.xact_start
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var running []store.VacuumProgress
+	for rows.Next() {
+		var p store.VacuumProgress
+		var schema sql.NullString
+		var query string
+		err := rows.Scan(
+			&p.PID, &p.Database, &schema, &p.TableName, &p.Phase,
+			&p.HeapBlksTotal, &p.HeapBlksScanned, &p.HeapBlksVacuumed, &p.IndexVacuumCount,
+			&p.Started, &query,
+		)
+		if err != nil {
+			return nil, err
+		}
+		p.SchemaName = schema.String
+		// Autovacuum workers show their task as the query
+		p.Autovacuum = strings.HasPrefix(query, "autovacuum:")
+		p.Wraparound = strings.Contains(query, "to prevent wraparound")
+		running = append(running, p)
+	}
+	return running, rows.Err()
+}
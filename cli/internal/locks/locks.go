@@ -0,0 +1,434 @@
+package locks
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cli/internal/format"
+	"cli/internal/logger"
+	"cli/internal/parse"
+	"cli/internal/store"
+)
+
+// Options tune the analysis.
+type Options struct {
+	// Interval is how far apart the samples were taken; a wait seen without
+	// a start time counts one interval per sample
+	Interval time.Duration
+	// MinWait is the total wait below which a pair of statements is not
+	// reported
+	MinWait time.Duration
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Interval: time.Second,
+		MinWait:  time.Second,
+	}
+}
+
+// Node is one session in a blocking tree. The lock fields describe what it
+// waits for, so they are empty on the root.
+type Node struct {
+	PID         int           `json:"pid"`
+	State       string        `json:"state"`
+	Query       string        `json:"query"`
+	Fingerprint string        `json:"fingerprint,omitempty"`
+	LockType    string        `json:"lock_type,omitempty"`
+	LockMode    string        `json:"lock_mode,omitempty"`
+	Relation    string        `json:"relation,omitempty"`
+	Waiting     time.Duration `json:"waiting_ns,omitempty"`
+	XactAge     time.Duration `json:"xact_age_ns,omitempty"`
+	Blocked     []*Node       `json:"blocked,omitempty"`
+}
+
+// Size counts the sessions waiting under the node, directly or not
+func (n *Node) Size() int {
+	size := 0
+	for _, child := range n.Blocked {
+		size += 1 + child.Size()
+	}
+	return size
+}
+
+// LongestWait is the longest wait of any session under the node
+func (n *Node) LongestWait() time.Duration {
+	var longest time.Duration
+	for _, child := range n.Blocked {
+		longest = max(longest, child.Waiting, child.LongestWait())
+	}
+	return longest
+}
+
+// Tree is a blocking tree as it was at one sample: a session that holds a
+// lock others wait for without waiting itself.
+type Tree struct {
+	CapturedAt time.Time `json:"captured_at"`
+	Root       *Node     `json:"root"`
+	Blocked    int       `json:"blocked"`
+}
+
+// Wait is the time one statement spent waiting for locks held by another.
+type Wait struct {
+	Fingerprint        string        `json:"fingerprint"`
+	Query              string        `json:"query"`
+	QueryID            int64         `json:"queryid,omitempty"`
+	BlockerFingerprint string        `json:"blocker_fingerprint,omitempty"`
+	BlockerQuery       string        `json:"blocker_query"`
+	BlockerState       string        `json:"blocker_state"`
+	LockType           string        `json:"lock_type"`
+	LockMode           string        `json:"lock_mode"`
+	Relation           string        `json:"relation,omitempty"`
+	WaitTime           time.Duration `json:"wait_time_ns"`
+	LongestWait        time.Duration `json:"longest_wait_ns"`
+	Episodes           int           `json:"episodes"`
+}
+
+// StatementWait is the lock wait time of one statement, as a waiter and as
+// a blocker.
+type StatementWait struct {
+	Fingerprint  string        `json:"fingerprint"`
+	Query        string        `json:"query"`
+	WaitTime     time.Duration `json:"wait_time_ns"`
+	BlockingTime time.Duration `json:"blocking_time_ns"`
+}
+
+// RelationWait is the lock wait time on one table or index.
+type RelationWait struct {
+	Relation   string        `json:"relation"`
+	WaitTime   time.Duration `json:"wait_time_ns"`
+	Statements int           `json:"statements"`
+}
+
+// Report is the lock contention seen over a series of samples, worst first.
+type Report struct {
+	Samples    int             `json:"samples"`
+	Window     time.Duration   `json:"window_ns"`
+	Trees      []Tree          `json:"trees"`
+	Waits      []Wait          `json:"waits"`
+	Statements []StatementWait `json:"statements"`
+	Relations  []RelationWait  `json:"relations"`
+}
+
+// ForStatement returns the waits of a statement as a waiter and as a
+// blocker. Statements are matched by query ID where the server reports
+// one, else by fingerprint.
+func (r *Report) ForStatement(fingerprint string, queryID int64) (waited, blocked []Wait) {
+	for _, w := range r.Waits {
+		if (queryID != 0 && w.QueryID == queryID) || w.Fingerprint == fingerprint {
+			waited = append(waited, w)
+		}
+		if w.BlockerFingerprint == fingerprint {
+			blocked = append(blocked, w)
+		}
+	}
+	return waited, blocked
+}
+
+// episode is one continuous wait of one session for one blocker
+type episode struct {
+	pid     int
+	blocker int
+	start   time.Time
+}
+
+// Analyze builds the blocking trees of every sample and attributes lock
+// wait time to the statements that waited, the statements that blocked
+// them and the relations involved.
+//
+// A wait with a known start (pg_locks.waitstart, PostgreSQL 14+) lasted at
+// least until the last sample that saw it. Without one, each sample that
+// sees it adds one interval, which misses waits shorter than the interval.
+func Analyze(samples []store.ActivitySample, opts Options) *Report {
+	logger.LogInfof("Analyzing lock waits in %d activity samples", len(samples))
+
+	report := &Report{Samples: len(samples)}
+	if len(samples) == 0 {
+		return report
+	}
+	report.Window = samples[len(samples)-1].CapturedAt.Sub(samples[0].CapturedAt) + opts.Interval
+
+	parser := parse.NewQueryParser()
+	fingerprints := map[string]string{}
+	fingerprint := func(query string) string {
+		if query == "" {
+			return ""
+		}
+		if fp, ok := fingerprints[query]; ok {
+			return fp
+		}
+		fp := parser.GenerateFingerprint(query)
+		fingerprints[query] = fp
+		return fp
+	}
+
+	waits := map[string]*Wait{}
+	var order []string
+	longest := map[episode]time.Duration{}
+	episodeKey := map[episode]string{}
+	trees := map[string]Tree{}
+
+	for _, sample := range samples {
+		sessions := make(map[int]store.Session, len(sample.Sessions))
+		for _, s := range sample.Sessions {
+			sessions[s.PID] = s
+		}
+
+		for _, s := range sample.Sessions {
+			for _, pid := range s.BlockedBy {
+				blocker, seen := sessions[pid]
+				if !seen {
+					// An idle session whose locks were not visible
+					blocker = store.Session{PID: pid, State: "unknown"}
+				}
+
+				key := fingerprint(s.Query) + "/" + fingerprint(blocker.Query) + "/" + s.LockMode + "/" + s.Relation
+				w, ok := waits[key]
+				if !ok {
+					w = &Wait{
+						Fingerprint:        fingerprint(s.Query),
+						Query:              s.Query,
+						QueryID:            s.QueryID,
+						BlockerFingerprint: fingerprint(blocker.Query),
+						BlockerQuery:       blocker.Query,
+						LockType:           s.LockType,
+						LockMode:           s.LockMode,
+						Relation:           s.Relation,
+					}
+					waits[key] = w
+					order = append(order, key)
+				}
+				w.BlockerState = blocker.State
+
+				start := waitStart(s)
+				if start == nil {
+					w.WaitTime += opts.Interval
+					w.LongestWait = max(w.LongestWait, opts.Interval)
+					w.Episodes++
+					continue
+				}
+				e := episode{pid: s.PID, blocker: pid, start: *start}
+				elapsed := sample.CapturedAt.Sub(*start)
+				if _, ok := longest[e]; !ok {
+					w.Episodes++
+					episodeKey[e] = key
+				}
+				longest[e] = max(longest[e], elapsed)
+			}
+		}
+
+		for _, root := range buildTrees(sample, sessions, fingerprint) {
+			// Keep the moment each blocking transaction blocked the most
+			id := fmt.Sprint(root.PID)
+			if xact := sessions[root.PID].XactStart; xact != nil {
+				id += "/" + xact.String()
+			}
+			tree := Tree{CapturedAt: sample.CapturedAt, Root: root, Blocked: root.Size()}
+			if existing, ok := trees[id]; !ok || tree.Blocked > existing.Blocked ||
+				(tree.Blocked == existing.Blocked && root.LongestWait() > existing.Root.LongestWait()) {
+				trees[id] = tree
+			}
+		}
+	}
+
+	for e, elapsed := range longest {
+		w := waits[episodeKey[e]]
+		w.WaitTime += elapsed
+		w.LongestWait = max(w.LongestWait, elapsed)
+	}
+
+	statements := map[string]*StatementWait{}
+	statement := func(fp, query string) *StatementWait {
+		s, ok := statements[fp]
+		if !ok {
+			s = &StatementWait{Fingerprint: fp, Query: query}
+			statements[fp] = s
+		}
+		return s
+	}
+	relations := map[string]*RelationWait{}
+	relationStatements := map[string]map[string]bool{}
+	for _, key := range order {
+		w := waits[key]
+		if w.WaitTime < opts.MinWait {
+			continue
+		}
+		report.Waits = append(report.Waits, *w)
+
+		statement(w.Fingerprint, w.Query).WaitTime += w.WaitTime
+		if w.BlockerFingerprint != "" {
+			statement(w.BlockerFingerprint, w.BlockerQuery).BlockingTime += w.WaitTime
+		}
+		if w.Relation != "" {
+			r, ok := relations[w.Relation]
+			if !ok {
+				r = &RelationWait{Relation: w.Relation}
+				relations[w.Relation] = r
+				relationStatements[w.Relation] = map[string]bool{}
+			}
+			r.WaitTime += w.WaitTime
+			relationStatements[w.Relation][w.Fingerprint] = true
+			r.Statements = len(relationStatements[w.Relation])
+		}
+	}
+
+	sort.SliceStable(report.Waits, func(i, j int) bool { return report.Waits[i].WaitTime > report.Waits[j].WaitTime })
+	for _, s := range statements {
+		report.Statements = append(report.Statements, *s)
+	}
+	sort.Slice(report.Statements, func(i, j int) bool {
+		a, b := report.Statements[i], report.Statements[j]
+		if a.WaitTime+a.BlockingTime != b.WaitTime+b.BlockingTime {
+			return a.WaitTime+a.BlockingTime > b.WaitTime+b.BlockingTime
+		}
+		return a.Fingerprint < b.Fingerprint
+	})
+	for _, r := range relations {
+		report.Relations = append(report.Relations, *r)
+	}
+	sort.Slice(report.Relations, func(i, j int) bool {
+		if report.Relations[i].WaitTime != report.Relations[j].WaitTime {
+			return report.Relations[i].WaitTime > report.Relations[j].WaitTime
+		}
+		return report.Relations[i].Relation < report.Relations[j].Relation
+	})
+	for _, t := range trees {
+		report.Trees = append(report.Trees, t)
+	}
+	sort.Slice(report.Trees, func(i, j int) bool {
+		a, b := report.Trees[i], report.Trees[j]
+		if a.Blocked != b.Blocked {
+			return a.Blocked > b.Blocked
+		}
+		if a.Root.LongestWait() != b.Root.LongestWait() {
+			return a.Root.LongestWait() > b.Root.LongestWait()
+		}
+		return a.CapturedAt.Before(b.CapturedAt)
+	})
+
+	logger.LogInfof("Found %d blocking trees and %d blocked statement pairs", len(report.Trees), len(report.Waits))
+	return report
+}
+
+// buildTrees links each waiting session under the sessions blocking it. A
+// session blocked by several others appears under each of them. Sessions
+// that wait in a cycle are a deadlock the server resolves by itself, so
+// they form no tree.
+func buildTrees(sample store.ActivitySample, sessions map[int]store.Session, fingerprint func(string) string) []*Node {
+	blocks := map[int][]store.Session{}
+	for _, s := range sample.Sessions {
+		for _, pid := range s.BlockedBy {
+			blocks[pid] = append(blocks[pid], s)
+		}
+	}
+
+	var build func(s store.Session, path map[int]bool) *Node
+	build = func(s store.Session, path map[int]bool) *Node {
+		n := &Node{
+			PID:         s.PID,
+			State:       s.State,
+			Query:       s.Query,
+			Fingerprint: fingerprint(s.Query),
+			LockType:    s.LockType,
+			LockMode:    s.LockMode,
+			Relation:    s.Relation,
+		}
+		if start := waitStart(s); start != nil && s.Waiting() {
+			n.Waiting = sample.CapturedAt.Sub(*start)
+		}
+		if s.XactStart != nil {
+			n.XactAge = sample.CapturedAt.Sub(*s.XactStart)
+		}
+
+		path[s.PID] = true
+		for _, child := range blocks[s.PID] {
+			if !path[child.PID] {
+				n.Blocked = append(n.Blocked, build(child, path))
+			}
+		}
+		delete(path, s.PID)
+		return n
+	}
+
+	var roots []*Node
+	for pid := range blocks {
+		s, seen := sessions[pid]
+		if !seen {
+			s = store.Session{PID: pid, State: "unknown"}
+		}
+		if s.Waiting() {
+			continue
+		}
+		roots = append(roots, build(s, map[int]bool{}))
+	}
+	return roots
+}
+
+// waitStart is when the session started waiting for its lock. Servers that
+// do not report it give the start of the statement, which is no later.
+func waitStart(s store.Session) *time.Time {
+	if s.WaitStart != nil {
+		return s.WaitStart
+	}
+	return s.QueryStart
+}
+
+// Describe says which statement blocked which, on what and for how long.
+func (w Wait) Describe() string {
+	on := ""
+	if w.Relation != "" {
+		on = fmt.Sprintf(" on %s", w.Relation)
+	}
+	blocker := fmt.Sprintf("'%s'", format.Truncate(w.BlockerQuery, 80))
+	if w.BlockerQuery == "" {
+		blocker = "a session whose statement is unknown"
+	}
+	times := fmt.Sprintf("%d times", w.Episodes)
+	if w.Episodes == 1 {
+		times = "once"
+	}
+	return fmt.Sprintf("'%s' waited %s in total (longest %s, %s) for its %s lock (%s)%s held by %s (%s).",
+		format.Truncate(w.Query, 80), formatDuration(w.WaitTime), formatDuration(w.LongestWait), times,
+		lockTypeName(w.LockType), w.LockMode, on, blocker, stateName(w.BlockerState))
+}
+
+// Remedy suggests how to stop the blocker holding the lock so long.
+func (w Wait) Remedy() string {
+	switch {
+	case strings.HasPrefix(w.BlockerState, "idle in transaction"):
+		return "The blocker kept its transaction open while idle: commit or roll back as soon as the work is done, and set idle_in_transaction_session_timeout so abandoned transactions release their locks."
+	case w.LockMode == "AccessExclusiveLock" || w.LockType == "metadata":
+		return "Schema changes need an exclusive lock and queue every later statement behind them: run them off-peak with a short lock_timeout and retry, and keep the transactions they wait for short."
+	case w.LockType == "transactionid" || w.LockType == "tuple" || w.LockType == "record":
+		return "Both statements write the same rows: keep the blocking transaction short, update rows in a consistent order, and for queue-like access use SELECT ... FOR UPDATE SKIP LOCKED."
+	}
+	return "Keep the blocking transaction short, or move the conflicting work apart in time."
+}
+
+func lockTypeName(lockType string) string {
+	switch lockType {
+	case "transactionid", "tuple", "record":
+		return "row"
+	case "relation", "table":
+		return "table"
+	case "":
+		return "heavyweight"
+	}
+	return lockType
+}
+
+func stateName(state string) string {
+	if state == "" {
+		return "state unknown"
+	}
+	return state
+}
+
+func formatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return d.Round(100 * time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
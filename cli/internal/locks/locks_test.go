@@ -0,0 +1,175 @@
+package locks
+
+import (
+	"testing"
+	"time"
+
+	"cli/internal/store"
+)
+
+func TestAnalyze(t *testing.T) {
+	base := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	at := func(seconds int) *time.Time {
+		t := base.Add(time.Duration(seconds) * time.Second)
+		return &t
+	}
+	sample := func(seconds int, sessions ...store.Session) store.ActivitySample {
+		return store.ActivitySample{CapturedAt: *at(seconds), Sessions: sessions}
+	}
+
+	const (
+		update = "UPDATE orders SET status = 'paid' WHERE id = 1"
+		alter  = "ALTER TABLE orders ADD COLUMN note text"
+		read   = "SELECT * FROM orders WHERE id = 1"
+	)
+	holder := store.Session{PID: 100, State: "idle in transaction", Query: update, XactStart: at(-60)}
+	waiter := func(pid int, query string, blockedBy ...int) store.Session {
+		return store.Session{
+			PID: pid, State: "active", Query: query, BlockedBy: blockedBy,
+			LockType: "relation", LockMode: "AccessExclusiveLock", Relation: "orders",
+		}
+	}
+	since := func(s store.Session, start int) store.Session {
+		s.WaitStart = at(start)
+		return s
+	}
+
+	type wait struct {
+		query    string
+		blocker  string
+		waitTime time.Duration
+		episodes int
+	}
+	tests := []struct {
+		name        string
+		samples     []store.ActivitySample
+		want        []wait
+		wantTrees   int
+		wantBlocked int // sessions under the worst tree
+		wantWindow  time.Duration
+	}{
+		{
+			name:       "no samples",
+			wantWindow: 0,
+		},
+		{
+			name: "wait without a start counts one interval per sample",
+			samples: []store.ActivitySample{
+				sample(0, holder, waiter(200, alter, 100)),
+				sample(1, holder, waiter(200, alter, 100)),
+				sample(2, holder, waiter(200, alter, 100)),
+			},
+			want:        []wait{{query: alter, blocker: update, waitTime: 3 * time.Second, episodes: 3}},
+			wantTrees:   1,
+			wantBlocked: 1,
+			wantWindow:  3 * time.Second,
+		},
+		{
+			name: "wait with a start lasts until the last sample that saw it",
+			samples: []store.ActivitySample{
+				sample(0, holder, since(waiter(200, alter, 100), -4)),
+				sample(1, holder, since(waiter(200, alter, 100), -4)),
+				sample(2, holder, since(waiter(200, alter, 100), -4)),
+			},
+			want:        []wait{{query: alter, blocker: update, waitTime: 6 * time.Second, episodes: 1}},
+			wantTrees:   1,
+			wantBlocked: 1,
+			wantWindow:  3 * time.Second,
+		},
+		{
+			name: "queue behind a waiter forms one tree",
+			samples: []store.ActivitySample{
+				sample(0, holder, since(waiter(200, alter, 100), -5), since(waiter(300, read, 200), -2)),
+			},
+			want: []wait{
+				{query: alter, blocker: update, waitTime: 5 * time.Second, episodes: 1},
+				{query: read, blocker: alter, waitTime: 2 * time.Second, episodes: 1},
+			},
+			wantTrees:   1,
+			wantBlocked: 2,
+			wantWindow:  time.Second,
+		},
+		{
+			name: "waits under the minimum are dropped",
+			samples: []store.ActivitySample{
+				sample(0, holder, since(waiter(200, alter, 100), 0)),
+			},
+			wantTrees:   1,
+			wantBlocked: 1,
+			wantWindow:  time.Second,
+		},
+		{
+			name: "deadlock forms no tree",
+			samples: []store.ActivitySample{
+				sample(0, since(waiter(200, alter, 300), -3), since(waiter(300, read, 200), -3)),
+			},
+			want: []wait{
+				{query: alter, blocker: read, waitTime: 3 * time.Second, episodes: 1},
+				{query: read, blocker: alter, waitTime: 3 * time.Second, episodes: 1},
+			},
+			wantWindow: time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := Analyze(tt.samples, DefaultOptions())
+
+			if report.Samples != len(tt.samples) || report.Window != tt.wantWindow {
+				t.Errorf("Samples, Window = %d, %s, want %d, %s", report.Samples, report.Window, len(tt.samples), tt.wantWindow)
+			}
+			if len(report.Waits) != len(tt.want) {
+				t.Fatalf("got %d waits, want %d: %+v", len(report.Waits), len(tt.want), report.Waits)
+			}
+			for i, want := range tt.want {
+				w := report.Waits[i]
+				if w.Query != want.query || w.BlockerQuery != want.blocker {
+					t.Errorf("wait %d: %q blocked by %q, want %q blocked by %q", i, w.Query, w.BlockerQuery, want.query, want.blocker)
+				}
+				if w.WaitTime != want.waitTime || w.Episodes != want.episodes {
+					t.Errorf("wait %d: WaitTime, Episodes = %s, %d, want %s, %d", i, w.WaitTime, w.Episodes, want.waitTime, want.episodes)
+				}
+			}
+			if len(report.Trees) != tt.wantTrees {
+				t.Fatalf("got %d trees, want %d", len(report.Trees), tt.wantTrees)
+			}
+			if tt.wantTrees > 0 {
+				tree := report.Trees[0]
+				if tree.Root.PID != holder.PID || tree.Blocked != tt.wantBlocked {
+					t.Errorf("worst tree: root %d with %d blocked, want %d with %d", tree.Root.PID, tree.Blocked, holder.PID, tt.wantBlocked)
+				}
+			}
+		})
+	}
+}
+
+func TestReportForStatement(t *testing.T) {
+	report := &Report{Waits: []Wait{
+		{Fingerprint: "alter", QueryID: 7, BlockerFingerprint: "update"},
+		{Fingerprint: "read", BlockerFingerprint: "alter"},
+		{Fingerprint: "other", QueryID: 9, BlockerFingerprint: "update"},
+	}}
+
+	tests := []struct {
+		name        string
+		fingerprint string
+		queryID     int64
+		wantWaited  int
+		wantBlocked int
+	}{
+		{name: "waiter and blocker", fingerprint: "alter", wantWaited: 1, wantBlocked: 1},
+		{name: "blocker only", fingerprint: "update", wantBlocked: 2},
+		{name: "matched by query ID", fingerprint: "renamed", queryID: 9, wantWaited: 1},
+		{name: "unknown statement", fingerprint: "missing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			waited, blocked := report.ForStatement(tt.fingerprint, tt.queryID)
+			if len(waited) != tt.wantWaited || len(blocked) != tt.wantBlocked {
+				t.Errorf("ForStatement(%q, %d) = %d waited, %d blocked, want %d, %d",
+					tt.fingerprint, tt.queryID, len(waited), len(blocked), tt.wantWaited, tt.wantBlocked)
+			}
+		})
+	}
+}
@@ -47,7 +47,16 @@ func (qp *QueryParser) GenerateFingerprint(query string) string {
 	return fmt.Sprintf("%x", hash)
 }
 
+// ExtractTables returns the base tables of a query from its parse tree,
+// falling back to matching FROM/JOIN/INTO/UPDATE when the query does not parse.
 func (qp *QueryParser) ExtractTables(query string) []string {
+	if shape, err := qp.Shape(query); err == nil {
+		return shape.Tables()
+	}
+	return extractTablesByPattern(query)
+}
+
+func extractTablesByPattern(query string) []string {
 	var tables []string
 
 	// Simple regex to find table names after FROM and JOIN
@@ -120,6 +129,10 @@ func (qp *QueryParser) HasSequentialScan(query string) bool {
 }
 
 func (qp *QueryParser) HasCorrelatedSubquery(query string) bool {
+	if shape, err := qp.Shape(query); err == nil {
+		return shape.HasCorrelatedSubquery()
+	}
+
 	// Simple detection of correlated subqueries
 	query = strings.ToUpper(query)
 
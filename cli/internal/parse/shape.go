@@ -0,0 +1,882 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+)
+
+// Relation kinds
+const (
+	RelationTable    = "table"
+	RelationCTE      = "cte"
+	RelationSubquery = "subquery"
+	RelationFunction = "function"
+)
+
+// Value kinds of the non-column side of a predicate
+const (
+	ValueConstant   = "constant"
+	ValueParameter  = "parameter"
+	ValueNull       = "null"
+	ValueColumn     = "column"
+	ValueSubquery   = "subquery"
+	ValueExpression = "expression"
+)
+
+// QueryShape is the structure of a statement taken from its PostgreSQL parse
+// tree. Predicates and joins found in subqueries and CTEs are included, with
+// every column bound to the base table it belongs to. ORDER BY, GROUP BY and
+// LIMIT describe the outermost query only.
+type QueryShape struct {
+	StatementType string          `json:"statement_type"`
+	Target        string          `json:"target,omitempty"` // table written by INSERT, UPDATE or DELETE
+	SetColumns    []string        `json:"set_columns,omitempty"`
+	Relations     []Relation      `json:"relations"`
+	Columns       []ColumnRef     `json:"columns,omitempty"`
+	CTEs          []string        `json:"ctes,omitempty"`
+	Predicates    []Predicate     `json:"predicates,omitempty"`
+	Joins         []JoinCondition `json:"joins,omitempty"`
+	OrderBy       []SortKey       `json:"order_by,omitempty"`
+	GroupBy       []ColumnRef     `json:"group_by,omitempty"`
+	HasLimit      bool            `json:"has_limit"`
+	Limit         int64           `json:"limit,omitempty"` // 0 unless LIMIT is a constant
+	Subqueries    []Subquery      `json:"subqueries,omitempty"`
+	SelectsAll    bool            `json:"selects_all"` // SELECT * or t.* in the outer query
+}
+
+// Relation is one entry of a FROM (or UPDATE/DELETE/INSERT target) list.
+type Relation struct {
+	Schema string `json:"schema,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Alias  string `json:"alias,omitempty"`
+	Kind   string `json:"kind"`
+}
+
+// ColumnRef is a column bound to a base table. Table is empty when the
+// reference is ambiguous (an unqualified column with several relations in
+// scope) or belongs to a subquery, CTE or function.
+type ColumnRef struct {
+	Table  string `json:"table,omitempty"`
+	Column string `json:"column"`
+}
+
+func (c ColumnRef) String() string {
+	if c.Table == "" {
+		return c.Column
+	}
+	return c.Table + "." + c.Column
+}
+
+// Predicate is a top-level AND-ed condition comparing a column with a value,
+// e.g. "orders.user_id = $1". Function is set when the column is wrapped in a
+// function call such as lower(email), which a plain index cannot serve.
+type Predicate struct {
+	Column    ColumnRef `json:"column"`
+	Operator  string    `json:"operator"`
+	ValueKind string    `json:"value_kind"`
+	Function  string    `json:"function,omitempty"`
+}
+
+// JoinCondition is a comparison between columns of two relations. Type is the
+// join type from an explicit JOIN, INNER for comma joins filtered in WHERE,
+// and CORRELATED when a subquery compares against an outer query's column.
+type JoinCondition struct {
+	Type     string    `json:"type"`
+	Left     ColumnRef `json:"left"`
+	Right    ColumnRef `json:"right"`
+	Operator string    `json:"operator"`
+}
+
+type SortKey struct {
+	Column     ColumnRef `json:"column"`
+	Descending bool      `json:"descending"`
+}
+
+// Subquery is a nested SELECT. Correlated subqueries reference a column of
+// an enclosing query, listed in OuterRefs, and run once per outer row unless
+// the planner can flatten them.
+type Subquery struct {
+	Kind       string      `json:"kind"` // EXISTS, IN, ANY, ALL, SCALAR, ARRAY, FROM, LATERAL or CTE
+	Correlated bool        `json:"correlated"`
+	OuterRefs  []ColumnRef `json:"outer_refs,omitempty"`
+}
+
+// ColumnsOf returns every column of a table the statement references.
+func (s *QueryShape) ColumnsOf(table string) []string {
+	var columns []string
+	for _, c := range s.Columns {
+		if c.Table == table {
+			columns = append(columns, c.Column)
+		}
+	}
+	return columns
+}
+
+// Tables returns the distinct base tables the statement reads or writes.
+func (s *QueryShape) Tables() []string {
+	var tables []string
+	for _, rel := range s.Relations {
+		if rel.Kind == RelationTable && !contains(tables, rel.Name) {
+			tables = append(tables, rel.Name)
+		}
+	}
+	return tables
+}
+
+// PredicatesOn returns the predicates bound to a table.
+func (s *QueryShape) PredicatesOn(table string) []Predicate {
+	var predicates []Predicate
+	for _, p := range s.Predicates {
+		if p.Column.Table == table {
+			predicates = append(predicates, p)
+		}
+	}
+	return predicates
+}
+
+// HasCorrelatedSubquery reports whether any subquery references an outer
+// query's columns.
+func (s *QueryShape) HasCorrelatedSubquery() bool {
+	for _, sq := range s.Subqueries {
+		if sq.Correlated {
+			return true
+		}
+	}
+	return false
+}
+
+// Shape parses a statement with the PostgreSQL grammar. Text that does not
+// parse, such as a pg_stat_statements entry truncated by
+// track_activity_query_size, returns an error; callers fall back to the
+// regex helpers.
+func (qp *QueryParser) Shape(query string) (*QueryShape, error) {
+	tree, err := pg_query.Parse(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query: %w", err)
+	}
+	if len(tree.Stmts) == 0 {
+		return nil, fmt.Errorf("query contains no statements")
+	}
+
+	b := &shapeBuilder{shape: &QueryShape{StatementType: statementType(tree.Stmts[0].Stmt)}}
+	if b.shape.StatementType == "" {
+		b.shape.StatementType = qp.DetectQueryType(query)
+	}
+	for _, raw := range tree.Stmts {
+		b.walkStatement(raw.Stmt)
+	}
+	return b.shape, nil
+}
+
+// statementType names the statement from its parse tree, so that queries
+// starting with WITH are classified by their main statement.
+func statementType(node *pg_query.Node) string {
+	switch {
+	case node.GetSelectStmt() != nil:
+		return "SELECT"
+	case node.GetInsertStmt() != nil:
+		return "INSERT"
+	case node.GetUpdateStmt() != nil:
+		return "UPDATE"
+	case node.GetDeleteStmt() != nil:
+		return "DELETE"
+	}
+	return ""
+}
+
+// scope holds the relations visible to one SELECT level. sub is the index
+// in QueryShape.Subqueries of the subquery the level belongs to, or -1 for
+// the outermost statement.
+type scope struct {
+	parent    *scope
+	relations []Relation
+	ctes      []string
+	sub       int
+}
+
+type shapeBuilder struct {
+	shape *QueryShape
+}
+
+func (b *shapeBuilder) walkStatement(node *pg_query.Node) {
+	switch {
+	case node.GetSelectStmt() != nil:
+		b.walkSelect(node.GetSelectStmt(), nil, -1, true)
+
+	case node.GetInsertStmt() != nil:
+		stmt := node.GetInsertStmt()
+		sc := &scope{sub: -1}
+		b.walkWith(stmt.WithClause, sc)
+		b.addRangeVar(stmt.Relation, sc)
+		b.setTarget(stmt.Relation)
+		if sel := stmt.SelectStmt.GetSelectStmt(); sel != nil {
+			b.walkSelect(sel, sc, -1, false)
+		}
+
+	case node.GetUpdateStmt() != nil:
+		stmt := node.GetUpdateStmt()
+		sc := &scope{sub: -1}
+		b.walkWith(stmt.WithClause, sc)
+		b.addRangeVar(stmt.Relation, sc)
+		b.setTarget(stmt.Relation)
+		for _, target := range stmt.TargetList {
+			if name := target.GetResTarget().GetName(); name != "" && !contains(b.shape.SetColumns, name) {
+				b.shape.SetColumns = append(b.shape.SetColumns, name)
+			}
+		}
+		for _, item := range stmt.FromClause {
+			b.walkFrom(item, sc)
+		}
+		b.walkQual(stmt.WhereClause, sc, "INNER")
+		for _, target := range stmt.TargetList {
+			b.walkExpr(target, sc)
+		}
+
+	case node.GetDeleteStmt() != nil:
+		stmt := node.GetDeleteStmt()
+		sc := &scope{sub: -1}
+		b.walkWith(stmt.WithClause, sc)
+		b.addRangeVar(stmt.Relation, sc)
+		b.setTarget(stmt.Relation)
+		for _, item := range stmt.UsingClause {
+			b.walkFrom(item, sc)
+		}
+		b.walkQual(stmt.WhereClause, sc, "INNER")
+	}
+}
+
+func (b *shapeBuilder) setTarget(rv *pg_query.RangeVar) {
+	if rv != nil && b.shape.Target == "" {
+		b.shape.Target = rv.Relname
+	}
+}
+
+func (b *shapeBuilder) walkSelect(stmt *pg_query.SelectStmt, parent *scope, sub int, outermost bool) {
+	if stmt == nil {
+		return
+	}
+
+	sc := &scope{parent: parent, sub: sub}
+	b.walkWith(stmt.WithClause, sc)
+
+	if stmt.Op != pg_query.SetOperation_SETOP_NONE && stmt.Op != pg_query.SetOperation_SET_OPERATION_UNDEFINED {
+		b.walkSelect(stmt.Larg, sc, sub, false)
+		b.walkSelect(stmt.Rarg, sc, sub, false)
+	}
+
+	for _, item := range stmt.FromClause {
+		b.walkFrom(item, sc)
+	}
+	b.walkQual(stmt.WhereClause, sc, "INNER")
+	b.walkExpr(stmt.HavingClause, sc)
+	for _, target := range stmt.TargetList {
+		if sub < 0 && selectsAll(target) {
+			b.shape.SelectsAll = true
+		}
+		b.walkExpr(target, sc)
+	}
+	for _, values := range stmt.ValuesLists {
+		b.walkExpr(values, sc)
+	}
+
+	if !outermost {
+		for _, item := range stmt.GroupClause {
+			b.walkExpr(item, sc)
+		}
+		for _, item := range stmt.SortClause {
+			b.walkExpr(item, sc)
+		}
+		return
+	}
+
+	for _, item := range stmt.GroupClause {
+		if col, ok := b.columnOf(item, sc); ok {
+			b.shape.GroupBy = append(b.shape.GroupBy, col)
+		} else {
+			b.walkExpr(item, sc)
+		}
+	}
+	for _, item := range stmt.SortClause {
+		sortBy := item.GetSortBy()
+		if sortBy == nil {
+			continue
+		}
+		if col, ok := b.columnOf(sortBy.Node, sc); ok {
+			b.shape.OrderBy = append(b.shape.OrderBy, SortKey{
+				Column:     col,
+				Descending: sortBy.SortbyDir == pg_query.SortByDir_SORTBY_DESC,
+			})
+		} else {
+			b.walkExpr(sortBy.Node, sc)
+		}
+	}
+	if stmt.LimitCount != nil {
+		if c := stmt.LimitCount.GetAConst(); c == nil || !c.Isnull {
+			b.shape.HasLimit = true
+			if c != nil && c.GetIval() != nil {
+				b.shape.Limit = int64(c.GetIval().Ival)
+			}
+		}
+	}
+}
+
+func (b *shapeBuilder) walkWith(with *pg_query.WithClause, sc *scope) {
+	if with == nil {
+		return
+	}
+	for _, node := range with.Ctes {
+		if cte := node.GetCommonTableExpr(); cte != nil {
+			sc.ctes = append(sc.ctes, cte.Ctename)
+			b.shape.CTEs = append(b.shape.CTEs, cte.Ctename)
+		}
+	}
+	for _, node := range with.Ctes {
+		if cte := node.GetCommonTableExpr(); cte != nil {
+			b.walkSubquery(cte.Ctequery, sc, "CTE")
+		}
+	}
+}
+
+// walkSubquery records a nested statement and walks it in its own scope.
+func (b *shapeBuilder) walkSubquery(node *pg_query.Node, sc *scope, kind string) {
+	b.shape.Subqueries = append(b.shape.Subqueries, Subquery{Kind: kind})
+	sub := len(b.shape.Subqueries) - 1
+
+	if sel := node.GetSelectStmt(); sel != nil {
+		b.walkSelect(sel, sc, sub, false)
+		return
+	}
+	// Data-modifying CTEs
+	inner := &scope{parent: sc, sub: sub}
+	switch {
+	case node.GetInsertStmt() != nil:
+		b.addRangeVar(node.GetInsertStmt().Relation, inner)
+	case node.GetUpdateStmt() != nil:
+		b.addRangeVar(node.GetUpdateStmt().Relation, inner)
+		b.walkQual(node.GetUpdateStmt().WhereClause, inner, "INNER")
+	case node.GetDeleteStmt() != nil:
+		b.addRangeVar(node.GetDeleteStmt().Relation, inner)
+		b.walkQual(node.GetDeleteStmt().WhereClause, inner, "INNER")
+	}
+}
+
+func (b *shapeBuilder) addRangeVar(rv *pg_query.RangeVar, sc *scope) {
+	if rv == nil {
+		return
+	}
+
+	rel := Relation{Schema: rv.Schemaname, Name: rv.Relname, Kind: RelationTable}
+	if rv.Alias != nil {
+		rel.Alias = rv.Alias.Aliasname
+	}
+	if rv.Schemaname == "" && sc.isCTE(rv.Relname) {
+		rel.Kind = RelationCTE
+	}
+
+	sc.relations = append(sc.relations, rel)
+	b.shape.Relations = append(b.shape.Relations, rel)
+}
+
+func (b *shapeBuilder) walkFrom(node *pg_query.Node, sc *scope) {
+	switch {
+	case node.GetRangeVar() != nil:
+		b.addRangeVar(node.GetRangeVar(), sc)
+
+	case node.GetJoinExpr() != nil:
+		join := node.GetJoinExpr()
+		joinType := joinTypeName(join)
+
+		b.walkFrom(join.Larg, sc)
+		mid := len(sc.relations)
+		b.walkFrom(join.Rarg, sc)
+
+		b.walkQual(join.Quals, sc, joinType)
+
+		// USING (col) compares the column of the nearest relation on each side
+		if len(join.UsingClause) > 0 && mid > 0 && len(sc.relations) > mid {
+			left, right := sc.relations[mid-1], sc.relations[mid]
+			for _, using := range join.UsingClause {
+				column := using.GetString_().GetSval()
+				cond := JoinCondition{
+					Type:     joinType,
+					Left:     boundColumn(left, column),
+					Right:    boundColumn(right, column),
+					Operator: "=",
+				}
+				b.recordColumn(cond.Left)
+				b.recordColumn(cond.Right)
+				b.shape.Joins = append(b.shape.Joins, cond)
+			}
+		}
+
+	case node.GetRangeSubselect() != nil:
+		subselect := node.GetRangeSubselect()
+		kind := "FROM"
+		if subselect.Lateral {
+			kind = "LATERAL"
+		}
+		b.walkSubquery(subselect.Subquery, sc, kind)
+
+		rel := Relation{Kind: RelationSubquery}
+		if subselect.Alias != nil {
+			rel.Alias = subselect.Alias.Aliasname
+		}
+		sc.relations = append(sc.relations, rel)
+		b.shape.Relations = append(b.shape.Relations, rel)
+
+	case node.GetRangeFunction() != nil:
+		fn := node.GetRangeFunction()
+		rel := Relation{Kind: RelationFunction}
+		if fn.Alias != nil {
+			rel.Alias = fn.Alias.Aliasname
+		}
+		for _, f := range fn.Functions {
+			b.walkExpr(f, sc)
+		}
+		sc.relations = append(sc.relations, rel)
+		b.shape.Relations = append(b.shape.Relations, rel)
+	}
+}
+
+func selectsAll(target *pg_query.Node) bool {
+	ref := target.GetResTarget().GetVal().GetColumnRef()
+	if ref == nil {
+		return false
+	}
+	for _, field := range ref.Fields {
+		if field.GetAStar() != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func joinTypeName(join *pg_query.JoinExpr) string {
+	switch join.Jointype {
+	case pg_query.JoinType_JOIN_LEFT:
+		return "LEFT"
+	case pg_query.JoinType_JOIN_RIGHT:
+		return "RIGHT"
+	case pg_query.JoinType_JOIN_FULL:
+		return "FULL"
+	}
+	if join.Quals == nil && len(join.UsingClause) == 0 && !join.IsNatural {
+		return "CROSS"
+	}
+	return "INNER"
+}
+
+// walkQual splits a condition on AND and records each conjunct as a
+// predicate or join condition. Conditions under OR and NOT are only walked
+// for subqueries and correlation, since no single index serves them.
+func (b *shapeBuilder) walkQual(node *pg_query.Node, sc *scope, joinType string) {
+	if node == nil {
+		return
+	}
+
+	if boolExpr := node.GetBoolExpr(); boolExpr != nil && boolExpr.Boolop == pg_query.BoolExprType_AND_EXPR {
+		for _, arg := range boolExpr.Args {
+			b.walkQual(arg, sc, joinType)
+		}
+		return
+	}
+
+	switch {
+	case node.GetAExpr() != nil:
+		b.walkComparison(node.GetAExpr(), sc, joinType)
+
+	case node.GetNullTest() != nil:
+		test := node.GetNullTest()
+		operator := "IS NULL"
+		if test.Nulltesttype == pg_query.NullTestType_IS_NOT_NULL {
+			operator = "IS NOT NULL"
+		}
+		if col, fn, ok := b.operandColumn(test.Arg, sc); ok {
+			b.addPredicate(col, operator, ValueNull, fn)
+		} else {
+			b.walkExpr(test.Arg, sc)
+		}
+
+	case node.GetSubLink() != nil:
+		link := node.GetSubLink()
+		if link.SubLinkType == pg_query.SubLinkType_ANY_SUBLINK && link.Testexpr != nil {
+			if col, fn, ok := b.operandColumn(link.Testexpr, sc); ok {
+				b.addPredicate(col, "IN", ValueSubquery, fn)
+			}
+		}
+		b.walkExpr(node, sc)
+
+	default:
+		b.walkExpr(node, sc)
+	}
+}
+
+func (b *shapeBuilder) walkComparison(expr *pg_query.A_Expr, sc *scope, joinType string) {
+	operator := comparisonOperator(expr)
+
+	leftCol, leftFn, leftOK := b.operandColumn(expr.Lexpr, sc)
+	rightCol, rightFn, rightOK := b.operandColumn(expr.Rexpr, sc)
+
+	switch {
+	case leftOK && rightOK:
+		if leftFn == "" && rightFn == "" {
+			typ := joinType
+			if b.isOuterColumn(expr.Lexpr, sc) || b.isOuterColumn(expr.Rexpr, sc) {
+				typ = "CORRELATED"
+			}
+			b.shape.Joins = append(b.shape.Joins, JoinCondition{Type: typ, Left: leftCol, Right: rightCol, Operator: operator})
+		}
+	case leftOK:
+		b.addPredicate(leftCol, operator, b.valueKind(expr.Rexpr, sc), leftFn)
+	case rightOK && expr.Kind == pg_query.A_Expr_Kind_AEXPR_OP:
+		b.addPredicate(rightCol, commute(operator), b.valueKind(expr.Lexpr, sc), rightFn)
+	default:
+		b.walkExpr(expr.Lexpr, sc)
+		b.walkExpr(expr.Rexpr, sc)
+	}
+}
+
+func (b *shapeBuilder) addPredicate(col ColumnRef, operator, valueKind, fn string) {
+	b.shape.Predicates = append(b.shape.Predicates, Predicate{
+		Column:    col,
+		Operator:  operator,
+		ValueKind: valueKind,
+		Function:  fn,
+	})
+}
+
+// operandColumn reports whether a comparison operand is a column, looking
+// through casts and single-argument function calls.
+func (b *shapeBuilder) operandColumn(node *pg_query.Node, sc *scope) (ColumnRef, string, bool) {
+	switch {
+	case node == nil:
+		return ColumnRef{}, "", false
+	case node.GetTypeCast() != nil:
+		return b.operandColumn(node.GetTypeCast().Arg, sc)
+	case node.GetFuncCall() != nil:
+		call := node.GetFuncCall()
+		if len(call.Args) != 1 {
+			return ColumnRef{}, "", false
+		}
+		col, _, ok := b.operandColumn(call.Args[0], sc)
+		return col, lastName(call.Funcname), ok
+	}
+
+	col, ok := b.columnOf(node, sc)
+	return col, "", ok
+}
+
+// valueKind classifies the value side of a predicate, walking it for
+// subqueries along the way.
+func (b *shapeBuilder) valueKind(node *pg_query.Node, sc *scope) string {
+	switch {
+	case node == nil:
+		return ValueExpression
+	case node.GetParamRef() != nil:
+		return ValueParameter
+	case node.GetAConst() != nil:
+		if node.GetAConst().Isnull {
+			return ValueNull
+		}
+		return ValueConstant
+	case node.GetTypeCast() != nil:
+		return b.valueKind(node.GetTypeCast().Arg, sc)
+	case node.GetSubLink() != nil:
+		b.walkExpr(node, sc)
+		return ValueSubquery
+	case node.GetList() != nil || node.GetAArrayExpr() != nil:
+		items := node.GetList().GetItems()
+		if node.GetAArrayExpr() != nil {
+			items = node.GetAArrayExpr().Elements
+		}
+		kind := ValueConstant
+		for _, item := range items {
+			switch b.valueKind(item, sc) {
+			case ValueConstant, ValueNull:
+			case ValueParameter:
+				kind = ValueParameter
+			default:
+				return ValueExpression
+			}
+		}
+		return kind
+	}
+
+	b.walkExpr(node, sc)
+	return ValueExpression
+}
+
+func comparisonOperator(expr *pg_query.A_Expr) string {
+	name := lastName(expr.Name)
+	switch expr.Kind {
+	case pg_query.A_Expr_Kind_AEXPR_IN:
+		if name == "<>" {
+			return "NOT IN"
+		}
+		return "IN"
+	case pg_query.A_Expr_Kind_AEXPR_LIKE:
+		if name == "!~~" {
+			return "NOT LIKE"
+		}
+		return "LIKE"
+	case pg_query.A_Expr_Kind_AEXPR_ILIKE:
+		if name == "!~~*" {
+			return "NOT ILIKE"
+		}
+		return "ILIKE"
+	case pg_query.A_Expr_Kind_AEXPR_SIMILAR:
+		return "SIMILAR TO"
+	case pg_query.A_Expr_Kind_AEXPR_BETWEEN, pg_query.A_Expr_Kind_AEXPR_BETWEEN_SYM:
+		return "BETWEEN"
+	case pg_query.A_Expr_Kind_AEXPR_NOT_BETWEEN, pg_query.A_Expr_Kind_AEXPR_NOT_BETWEEN_SYM:
+		return "NOT BETWEEN"
+	case pg_query.A_Expr_Kind_AEXPR_DISTINCT:
+		return "IS DISTINCT FROM"
+	case pg_query.A_Expr_Kind_AEXPR_NOT_DISTINCT:
+		return "IS NOT DISTINCT FROM"
+	case pg_query.A_Expr_Kind_AEXPR_OP_ANY:
+		return name + " ANY"
+	case pg_query.A_Expr_Kind_AEXPR_OP_ALL:
+		return name + " ALL"
+	}
+	return name
+}
+
+// commute flips an operator for "value op column" comparisons
+func commute(operator string) string {
+	switch operator {
+	case "<":
+		return ">"
+	case ">":
+		return "<"
+	case "<=":
+		return ">="
+	case ">=":
+		return "<="
+	}
+	return operator
+}
+
+// walkExpr descends into an expression to resolve column references (which
+// marks correlated subqueries) and to record subqueries.
+func (b *shapeBuilder) walkExpr(node *pg_query.Node, sc *scope) {
+	if node == nil {
+		return
+	}
+
+	switch {
+	case node.GetColumnRef() != nil:
+		b.columnOf(node, sc)
+	case node.GetSubLink() != nil:
+		link := node.GetSubLink()
+		b.walkExpr(link.Testexpr, sc)
+		b.walkSubquery(link.Subselect, sc, subLinkKind(link.SubLinkType))
+	case node.GetAExpr() != nil:
+		b.walkExpr(node.GetAExpr().Lexpr, sc)
+		b.walkExpr(node.GetAExpr().Rexpr, sc)
+	case node.GetBoolExpr() != nil:
+		b.walkList(node.GetBoolExpr().Args, sc)
+	case node.GetNullTest() != nil:
+		b.walkExpr(node.GetNullTest().Arg, sc)
+	case node.GetTypeCast() != nil:
+		b.walkExpr(node.GetTypeCast().Arg, sc)
+	case node.GetFuncCall() != nil:
+		b.walkList(node.GetFuncCall().Args, sc)
+		b.walkExpr(node.GetFuncCall().AggFilter, sc)
+	case node.GetResTarget() != nil:
+		b.walkExpr(node.GetResTarget().Val, sc)
+	case node.GetSortBy() != nil:
+		b.walkExpr(node.GetSortBy().Node, sc)
+	case node.GetCaseExpr() != nil:
+		c := node.GetCaseExpr()
+		b.walkExpr(c.Arg, sc)
+		for _, when := range c.Args {
+			if w := when.GetCaseWhen(); w != nil {
+				b.walkExpr(w.Expr, sc)
+				b.walkExpr(w.Result, sc)
+			}
+		}
+		b.walkExpr(c.Defresult, sc)
+	case node.GetCoalesceExpr() != nil:
+		b.walkList(node.GetCoalesceExpr().Args, sc)
+	case node.GetMinMaxExpr() != nil:
+		b.walkList(node.GetMinMaxExpr().Args, sc)
+	case node.GetRowExpr() != nil:
+		b.walkList(node.GetRowExpr().Args, sc)
+	case node.GetAArrayExpr() != nil:
+		b.walkList(node.GetAArrayExpr().Elements, sc)
+	case node.GetAIndirection() != nil:
+		b.walkExpr(node.GetAIndirection().Arg, sc)
+	case node.GetList() != nil:
+		b.walkList(node.GetList().Items, sc)
+	}
+}
+
+func (b *shapeBuilder) walkList(nodes []*pg_query.Node, sc *scope) {
+	for _, node := range nodes {
+		b.walkExpr(node, sc)
+	}
+}
+
+func subLinkKind(t pg_query.SubLinkType) string {
+	switch t {
+	case pg_query.SubLinkType_EXISTS_SUBLINK:
+		return "EXISTS"
+	case pg_query.SubLinkType_ANY_SUBLINK:
+		return "IN"
+	case pg_query.SubLinkType_ALL_SUBLINK:
+		return "ALL"
+	case pg_query.SubLinkType_ARRAY_SUBLINK:
+		return "ARRAY"
+	}
+	return "SCALAR"
+}
+
+// columnOf resolves a ColumnRef node and records it in QueryShape.Columns
+func (b *shapeBuilder) columnOf(node *pg_query.Node, sc *scope) (ColumnRef, bool) {
+	col, ok := b.resolveColumn(node, sc)
+	if ok {
+		b.recordColumn(col)
+	}
+	return col, ok
+}
+
+func (b *shapeBuilder) recordColumn(col ColumnRef) {
+	if col.Table == "" {
+		return
+	}
+	for _, existing := range b.shape.Columns {
+		if existing == col {
+			return
+		}
+	}
+	b.shape.Columns = append(b.shape.Columns, col)
+}
+
+// resolveColumn binds a ColumnRef node to a relation. A qualifier is looked up in the
+// current scope first and then in enclosing scopes; a match in an enclosing
+// scope marks every subquery in between as correlated. Unqualified columns
+// bind to the only relation in scope, or stay unbound.
+func (b *shapeBuilder) resolveColumn(node *pg_query.Node, sc *scope) (ColumnRef, bool) {
+	ref := node.GetColumnRef()
+	if ref == nil {
+		return ColumnRef{}, false
+	}
+
+	var names []string
+	for _, field := range ref.Fields {
+		if field.GetAStar() != nil {
+			return ColumnRef{}, false
+		}
+		names = append(names, field.GetString_().GetSval())
+	}
+	if len(names) == 0 {
+		return ColumnRef{}, false
+	}
+
+	column := names[len(names)-1]
+	if len(names) == 1 {
+		if len(sc.relations) == 1 {
+			return boundColumn(sc.relations[0], column), true
+		}
+		return ColumnRef{Column: column}, true
+	}
+
+	qualifier := names[len(names)-2]
+	schema := ""
+	if len(names) > 2 {
+		schema = names[len(names)-3]
+	}
+
+	var crossed []int
+	for s := sc; s != nil; s = s.parent {
+		if rel, ok := s.lookup(schema, qualifier); ok {
+			col := boundColumn(rel, column)
+			if len(crossed) > 0 {
+				b.markCorrelated(crossed, col)
+			}
+			return col, true
+		}
+		if s.parent != nil && s.sub != s.parent.sub && s.sub >= 0 {
+			crossed = append(crossed, s.sub)
+		}
+	}
+	return ColumnRef{Column: column}, true
+}
+
+// isOuterColumn reports whether a qualified column resolves outside the
+// current scope.
+func (b *shapeBuilder) isOuterColumn(node *pg_query.Node, sc *scope) bool {
+	ref := node.GetColumnRef()
+	if ref == nil || len(ref.Fields) < 2 {
+		return false
+	}
+	qualifier := ref.Fields[len(ref.Fields)-2].GetString_().GetSval()
+	if _, ok := sc.lookup("", qualifier); ok {
+		return false
+	}
+	for s := sc.parent; s != nil; s = s.parent {
+		if _, ok := s.lookup("", qualifier); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *shapeBuilder) markCorrelated(subs []int, col ColumnRef) {
+	for _, sub := range subs {
+		sq := &b.shape.Subqueries[sub]
+		sq.Correlated = true
+		found := false
+		for _, existing := range sq.OuterRefs {
+			if existing == col {
+				found = true
+				break
+			}
+		}
+		if !found {
+			sq.OuterRefs = append(sq.OuterRefs, col)
+		}
+	}
+}
+
+// lookup finds a relation by alias, or by name when it has no alias
+func (s *scope) lookup(schema, qualifier string) (Relation, bool) {
+	for _, rel := range s.relations {
+		if rel.Alias != "" {
+			if rel.Alias == qualifier && schema == "" {
+				return rel, true
+			}
+			continue
+		}
+		if rel.Name == qualifier && (schema == "" || rel.Schema == schema) {
+			return rel, true
+		}
+	}
+	return Relation{}, false
+}
+
+func (s *scope) isCTE(name string) bool {
+	for c := s; c != nil; c = c.parent {
+		if contains(c.ctes, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func boundColumn(rel Relation, column string) ColumnRef {
+	if rel.Kind != RelationTable {
+		return ColumnRef{Column: column}
+	}
+	return ColumnRef{Table: rel.Name, Column: column}
+}
+
+func lastName(nodes []*pg_query.Node) string {
+	if len(nodes) == 0 {
+		return ""
+	}
+	return strings.ToLower(nodes[len(nodes)-1].GetString_().GetSval())
+}
@@ -0,0 +1,112 @@
+package parse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestShape(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		wantType       string
+		wantTarget     string
+		wantTables     []string
+		wantPredicates []string // column operator value kind
+		wantJoins      []string // type left operator right
+		wantLimit      bool
+		wantSelectsAll bool
+		wantCorrelated bool
+	}{
+		{
+			name:           "filter with limit",
+			query:          "SELECT * FROM orders WHERE user_id = $1 AND created_at > now() LIMIT 10",
+			wantType:       "SELECT",
+			wantTables:     []string{"orders"},
+			wantPredicates: []string{"orders.user_id = parameter", "orders.created_at > expression"},
+			wantLimit:      true,
+			wantSelectsAll: true,
+		},
+		{
+			name:           "explicit join through aliases",
+			query:          "SELECT o.id, u.email FROM orders o JOIN users u ON u.id = o.user_id WHERE u.status = 'active'",
+			wantType:       "SELECT",
+			wantTables:     []string{"orders", "users"},
+			wantPredicates: []string{"users.status = constant"},
+			wantJoins:      []string{"INNER users.id = orders.user_id"},
+		},
+		{
+			name:           "comma join filtered in WHERE",
+			query:          "SELECT * FROM orders, users WHERE orders.user_id = users.id AND orders.total IS NULL",
+			wantType:       "SELECT",
+			wantTables:     []string{"orders", "users"},
+			wantPredicates: []string{"orders.total IS NULL null"},
+			wantJoins:      []string{"INNER orders.user_id = users.id"},
+			wantSelectsAll: true,
+		},
+		{
+			name:           "correlated subquery",
+			query:          "SELECT id FROM users u WHERE EXISTS (SELECT 1 FROM orders o WHERE o.user_id = u.id)",
+			wantType:       "SELECT",
+			wantTables:     []string{"users", "orders"},
+			wantJoins:      []string{"CORRELATED orders.user_id = users.id"},
+			wantCorrelated: true,
+		},
+		{
+			name:           "schema-qualified update",
+			query:          "UPDATE billing.invoices SET paid = true WHERE id = $1",
+			wantType:       "UPDATE",
+			wantTarget:     "invoices",
+			wantTables:     []string{"invoices"},
+			wantPredicates: []string{"invoices.id = parameter"},
+		},
+		{
+			name:           "delete",
+			query:          "DELETE FROM sessions WHERE expires_at < $1",
+			wantType:       "DELETE",
+			wantTarget:     "sessions",
+			wantTables:     []string{"sessions"},
+			wantPredicates: []string{"sessions.expires_at < parameter"},
+		},
+	}
+
+	parser := NewQueryParser()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shape, err := parser.Shape(tt.query)
+			if err != nil {
+				t.Fatalf("Shape: %v", err)
+			}
+
+			if shape.StatementType != tt.wantType || shape.Target != tt.wantTarget {
+				t.Errorf("StatementType, Target = %s, %q, want %s, %q", shape.StatementType, shape.Target, tt.wantType, tt.wantTarget)
+			}
+			if got := shape.Tables(); !reflect.DeepEqual(got, tt.wantTables) {
+				t.Errorf("Tables() = %v, want %v", got, tt.wantTables)
+			}
+
+			var predicates []string
+			for _, p := range shape.Predicates {
+				predicates = append(predicates, p.Column.String()+" "+p.Operator+" "+p.ValueKind)
+			}
+			if !reflect.DeepEqual(predicates, tt.wantPredicates) {
+				t.Errorf("Predicates = %q, want %q", predicates, tt.wantPredicates)
+			}
+
+			var joins []string
+			for _, j := range shape.Joins {
+				joins = append(joins, j.Type+" "+j.Left.String()+" "+j.Operator+" "+j.Right.String())
+			}
+			if !reflect.DeepEqual(joins, tt.wantJoins) {
+				t.Errorf("Joins = %q, want %q", joins, tt.wantJoins)
+			}
+
+			if shape.HasLimit != tt.wantLimit || shape.SelectsAll != tt.wantSelectsAll {
+				t.Errorf("HasLimit, SelectsAll = %t, %t, want %t, %t", shape.HasLimit, shape.SelectsAll, tt.wantLimit, tt.wantSelectsAll)
+			}
+			if got := shape.HasCorrelatedSubquery(); got != tt.wantCorrelated {
+				t.Errorf("HasCorrelatedSubquery() = %t, want %t", got, tt.wantCorrelated)
+			}
+		})
+	}
+}
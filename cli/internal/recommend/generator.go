@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"cli/internal/format"
 	"cli/internal/store"
 )
 
@@ -124,7 +125,7 @@ func (rg *RecommendationGenerator) GenerateJoinIndexRecommendation(tableName, co
 
 func (rg *RecommendationGenerator) GenerateRedundantIndexRecommendation(redundantIndex, existingIndex, tableName string, sizeBytes int64) store.Recommendation {
 	template := rg.templates["redundant_index"]
-	sizeStr := formatBytes(sizeBytes)
+	sizeStr := format.Bytes(sizeBytes)
 
 	return store.Recommendation{
 		Type:           "redundant_index",
@@ -162,14 +163,3 @@ func (rg *RecommendationGenerator) generateSubqueryRewrite(originalQuery string)
 
 	return "-- Consider rewriting subquery as JOIN or window function for better performance"
 }
-
-func formatBytes(bytes int64) string {
-	if bytes < 1024 {
-		return fmt.Sprintf("%d B", bytes)
-	} else if bytes < 1024*1024 {
-		return fmt.Sprintf("%.1f KB", float64(bytes)/1024)
-	} else if bytes < 1024*1024*1024 {
-		return fmt.Sprintf("%.1f MB", float64(bytes)/(1024*1024))
-	}
-	return fmt.Sprintf("%.1f GB", float64(bytes)/(1024*1024*1024))
-}
@@ -0,0 +1,181 @@
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"cli/internal/format"
+	"cli/internal/parse"
+	"cli/internal/store"
+)
+
+// minReadPerCall is the volume a statement reads from outside
+// shared_buffers per execution below which the cache_hit_ratio rule stays
+// quiet
+const minReadPerCall = 1 << 20
+
+// maxCoveringInclude bounds the INCLUDE list the cache_hit_ratio rule
+// proposes, since wide covering indexes cost more to maintain than the heap
+// reads they save
+const maxCoveringInclude = 3
+
+// detectCacheMisses finds statements that read a lot from outside
+// shared_buffers, from the hit and read counts pg_stat_statements keeps per
+// fingerprint, and explains them with the hit ratios and sizes of the
+// tables they read. It proposes a covering index when one would allow an
+// index-only scan, prewarming when the tables fit in the cache, and points
+// at the cache sizing otherwise.
+func (re *RuleEngine) detectCacheMisses(ctx *Context) *store.Recommendation {
+	query, report := ctx.Query, ctx.Cache
+	accesses := query.SharedBlksHit + query.SharedBlksRead
+	if query.Calls == 0 || accesses == 0 {
+		return nil
+	}
+	ratio := float64(query.SharedBlksHit) / float64(accesses)
+	readPerCall := query.SharedBlksRead * report.BlockSize / query.Calls
+	if ratio >= report.MinHitRatio || readPerCall < minReadPerCall {
+		return nil
+	}
+
+	rationale := fmt.Sprintf("shared_buffers served %.1f%% of the %d blocks this statement accessed over %d calls: it reads %s per call from the OS cache or disk.",
+		ratio*100, accesses, query.Calls, format.Bytes(readPerCall))
+	if query.BlkReadTime > 0 && query.TotalTime > 0 {
+		rationale += fmt.Sprintf(" Those reads took %.1f ms per call, %.0f%% of its execution time.",
+			query.BlkReadTime/float64(query.Calls), min(query.BlkReadTime/query.TotalTime, 1)*100)
+	}
+
+	// The statement's tables that are read from outside the cache too
+	var evidence, cold []string
+	exceeds := false
+	for _, name := range ctx.TableNames {
+		table, ok := report.Table(name)
+		if !ok {
+			continue
+		}
+		evidence = append(evidence, fmt.Sprintf("'%s' %s at %.1f%%", name, format.Bytes(table.SizeBytes), table.HitRatio*100))
+		if table.HitRatio < report.MinHitRatio {
+			cold = append(cold, name)
+		}
+		for _, index := range report.Indexes(name) {
+			if index.BlksRead > 0 && index.HitRatio < report.MinHitRatio {
+				evidence = append(evidence, fmt.Sprintf("index '%s' %s at %.1f%%", index.IndexName, format.Bytes(index.SizeBytes), index.HitRatio*100))
+			}
+		}
+		if report.SharedBuffers > 0 && table.SizeBytes > report.SharedBuffers {
+			exceeds = true
+		}
+	}
+	if len(evidence) > 0 {
+		rationale += fmt.Sprintf(" Hit ratios %s: %s, with %s of shared_buffers.", report.Since(), strings.Join(evidence, ", "), format.Bytes(report.SharedBuffers))
+	}
+
+	rec := &store.Recommendation{
+		Type:           "cache_hit_ratio",
+		Confidence:     0.6,
+		ImpactEstimate: fmt.Sprintf("Avoids up to %s of reads outside shared_buffers per call", format.Bytes(readPerCall)),
+		RiskLevel:      "low",
+	}
+
+	if table, key, include, ok := coveringColumns(ctx.Shape); ok {
+		if index, covered := coveringIndex(ctx.Indexes, table, key, include); covered {
+			rec.DDL = fmt.Sprintf("VACUUM (ANALYZE) %s;", table)
+			rec.Rationale = rationale + fmt.Sprintf(" Index '%s' already holds every column it reads, so it can use an index-only scan, but that still visits the heap for every page vacuum has not marked all-visible. Vacuuming the table more often keeps the visibility map current.", index)
+			return rec
+		}
+		rec.DDL = re.coveringIndexDDL(table, key, include)
+		rec.Confidence = 0.7
+		holds := fmt.Sprintf("An index on (%s)", strings.Join(key, ", "))
+		if len(include) > 0 {
+			holds += fmt.Sprintf(" that also holds %s", strings.Join(include, ", "))
+		}
+		rec.Rationale = rationale + fmt.Sprintf(" %s covers every column it reads: an index-only scan reads the smaller index instead of the heap blocks of '%s'.", holds, table)
+		return rec
+	}
+
+	if len(cold) > 0 && !exceeds && report.WorkingSetBytes <= report.SharedBuffers {
+		var warm []string
+		for _, name := range cold {
+			warm = append(warm, fmt.Sprintf("SELECT pg_prewarm('%s');", name))
+		}
+		rec.DDL = strings.Join(warm, " ")
+		rec.Rationale = rationale + " Its tables and the working set fit in shared_buffers, so they were evicted, by a restart or by large scans, and read back block by block. pg_prewarm loads them in one pass; optidb cache shows which relations this affects."
+		return rec
+	}
+
+	rec.Confidence = 0.5
+	rec.Rationale = rationale + " The statement reads more than shared_buffers keeps: check with optidb cache whether a larger shared_buffers can hold the working set, or make the statement read fewer blocks through a more selective index or by selecting only the columns it needs."
+	return rec
+}
+
+// coveringColumns finds the index a single-table SELECT needs for an
+// index-only scan: equality columns, then one range column, as the key and
+// the other columns it reads as INCLUDE columns.
+func coveringColumns(shape *parse.QueryShape) (string, []string, []string, bool) {
+	if shape == nil || shape.StatementType != "SELECT" || shape.SelectsAll ||
+		len(shape.Joins) > 0 || len(shape.Subqueries) > 0 {
+		return "", nil, nil, false
+	}
+	tables := shape.Tables()
+	if len(tables) != 1 || len(shape.Relations) != 1 {
+		return "", nil, nil, false
+	}
+	table := tables[0]
+
+	var key []string
+	var ranged string
+	for _, pred := range shape.PredicatesOn(table) {
+		column := pred.Column.Column
+		if pred.Function != "" || !indexableOperator(pred.Operator) || contains(key, column) {
+			continue
+		}
+		if isEquality(pred.Operator) {
+			key = append(key, column)
+		} else if ranged == "" {
+			ranged = column
+		}
+	}
+	if ranged != "" && !contains(key, ranged) {
+		key = append(key, ranged)
+	}
+	if len(key) == 0 {
+		return "", nil, nil, false
+	}
+
+	var include []string
+	for _, c := range shape.Columns {
+		if c.Table != table {
+			// Unbound columns may be expressions the index cannot hold
+			return "", nil, nil, false
+		}
+		if !contains(key, c.Column) && !contains(include, c.Column) {
+			include = append(include, c.Column)
+		}
+	}
+	if len(include) > maxCoveringInclude {
+		return "", nil, nil, false
+	}
+	sort.Strings(include)
+	return table, key, include, true
+}
+
+// coveringIndex finds an existing index that leads with one of the key
+// columns and holds every column the statement reads
+func coveringIndex(indexes []store.IndexInfo, table string, key, include []string) (string, bool) {
+	for _, index := range indexes {
+		if index.TableName != table || len(index.Columns) == 0 || !contains(key, index.Columns[0]) {
+			continue
+		}
+		covered := true
+		for _, column := range append(append([]string{}, key...), include...) {
+			if !contains(index.Columns, column) {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			return index.IndexName, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,38 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+
+	"cli/internal/config"
+)
+
+// The DDL the heuristic rules emit, in the dialect of the target engine.
+// MySQL builds indexes online with ALGORITHM=INPLACE; PostgreSQL keeps the
+// plain form so it can be simulated with hypopg.
+
+func (re *RuleEngine) createIndexDDL(table string, columns ...string) string {
+	name := fmt.Sprintf("idx_%s_%s", table, strings.Join(columns, "_"))
+	list := strings.Join(columns, ", ")
+	if re.engine == config.EngineMySQL {
+		return fmt.Sprintf("CREATE INDEX %s ON %s (%s) ALGORITHM=INPLACE LOCK=NONE;", name, table, list)
+	}
+	return fmt.Sprintf("CREATE INDEX %s ON %s (%s);", name, table, list)
+}
+
+// coveringIndexDDL creates an index whose INCLUDE columns let a statement
+// use an index-only scan. MySQL has no INCLUDE, so there they widen the key.
+func (re *RuleEngine) coveringIndexDDL(table string, key, include []string) string {
+	if len(include) == 0 || re.engine == config.EngineMySQL {
+		return re.createIndexDDL(table, append(append([]string{}, key...), include...)...)
+	}
+	name := fmt.Sprintf("idx_%s_%s_cov", table, strings.Join(key, "_"))
+	return fmt.Sprintf("CREATE INDEX %s ON %s (%s) INCLUDE (%s);", name, table, strings.Join(key, ", "), strings.Join(include, ", "))
+}
+
+func (re *RuleEngine) analyzeDDL(table string) string {
+	if re.engine == config.EngineMySQL {
+		return fmt.Sprintf("ANALYZE TABLE %s; -- or ANALYZE TABLE %s UPDATE HISTOGRAM ON <selective_column> WITH 1024 BUCKETS;", table, table)
+	}
+	return fmt.Sprintf("ANALYZE %s; -- or ALTER TABLE %s ALTER COLUMN <selective_column> SET STATISTICS 1000;", table, table)
+}
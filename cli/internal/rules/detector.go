@@ -4,9 +4,16 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	"cli/internal/ai"
+	"cli/internal/config"
+	"cli/internal/explain"
+	"cli/internal/format"
+	"cli/internal/hygiene"
 	"cli/internal/logger"
+	"cli/internal/parse"
 	"cli/internal/store"
 )
 
@@ -14,14 +21,27 @@ type RuleEngine struct {
 	minTableSize     int64
 	minSeqScanTime   float64
 	minCalls         int64
+	maxSelectivity   float64
 	correlationRegex *regexp.Regexp
+	parser           *parse.QueryParser
 	aiClient         *ai.OpenAIClient
 	useAI            bool
+	registry         *Registry
+	engine           string
+
+	statsMu sync.Mutex
+	stats   map[string]*RuleStats
 }
 
 func NewRuleEngine() *RuleEngine {
+	return NewRuleEngineFor(config.Get().Database.Engine)
+}
+
+// NewRuleEngineFor builds a rule engine that writes DDL for engine rather
+// than for the configured target, e.g. for statements from a MySQL slow log.
+func NewRuleEngineFor(engine string) *RuleEngine {
 	// initialize AI client
-	aiClient, err := ai.NewOpenAIClient()
+	aiClient, err := ai.NewOpenAIClient(engine)
 	useAI := err == nil
 
 	if useAI {
@@ -30,17 +50,121 @@ func NewRuleEngine() *RuleEngine {
 		logger.LogInfof("AI client initialization failed, using heuristic rules: %v", err)
 	}
 
-	return &RuleEngine{
-		minTableSize:     1000, // Minimum table size to suggest indexes
-		minSeqScanTime:   0.1,  // Minimum time (ms) to consider slow
-		minCalls:         5,    // Minimum calls to consider for optimization
+	thresholds := config.Get().Rules
+	re := &RuleEngine{
+		minTableSize:     thresholds.MinTableRows,  // Minimum table size to suggest indexes
+		minSeqScanTime:   thresholds.MinMeanTimeMS, // Minimum time (ms) to consider slow
+		minCalls:         thresholds.MinCalls,      // Minimum calls to consider for optimization
+		maxSelectivity:   thresholds.MaxSelectivity,
 		correlationRegex: regexp.MustCompile(`(?i)SELECT.*\(.*SELECT.*WHERE.*=.*\w+\.`),
+		parser:           parse.NewQueryParser(),
 		aiClient:         aiClient,
 		useAI:            useAI,
+		registry:         NewRegistry(),
+		engine:           engine,
+		stats:            make(map[string]*RuleStats),
+	}
+
+	for _, rule := range append(re.builtinRules(), registeredRules()...) {
+		if err := re.registry.Register(rule); err != nil {
+			logger.LogErrorf("Skipping rule: %v", err)
+		}
+	}
+	for _, id := range thresholds.Disabled {
+		if err := re.registry.Disable(id); err != nil {
+			logger.LogErrorf("Ignoring rules.disabled entry: %v", err)
+		}
 	}
+	return re
+}
+
+// builtinRules wraps the heuristic detectors as rules. Their IDs are
+// stable and used to enable or disable them.
+func (re *RuleEngine) builtinRules() []Rule {
+	return []Rule{
+		NewRule("missing_index", "Index for selective columns a slow query filters on in a large table",
+			[]Input{InputQuery, InputTables},
+			single(func(ctx *Context) *store.Recommendation {
+				return re.detectMissingIndex(ctx.Query, ctx.Shape, ctx.TableNames, ctx.Tables, ctx.Indexes, ctx.Columns)
+			})),
+		NewRule("correlated_subquery", "Subqueries that reference the outer query and run once per row",
+			[]Input{InputQuery},
+			single(func(ctx *Context) *store.Recommendation {
+				return re.detectCorrelatedSubquery(ctx.Query, ctx.Shape)
+			})),
+		NewRule("inefficient_join", "Join columns without an index on either side",
+			[]Input{InputQuery},
+			single(func(ctx *Context) *store.Recommendation {
+				return re.detectIneffientJoin(ctx.Query, ctx.Shape, ctx.TableNames, ctx.Indexes)
+			})),
+		NewRule("redundant_index", "Duplicate indexes and indexes that are a left prefix of another",
+			[]Input{InputHygiene},
+			func(ctx *Context) ([]store.Recommendation, error) {
+				return re.detectRedundantIndexes(ctx.Hygiene, ctx.TableNames), nil
+			}),
+		NewRule("unindexed_foreign_key", "Deletes and key updates on a parent table whose foreign keys have no index on the child",
+			// Not InputIndexes: a schema without indexes is the worst case
+			[]Input{InputQuery, InputShape, InputTables, InputForeignKeys},
+			func(ctx *Context) ([]store.Recommendation, error) {
+				return re.detectUnindexedForeignKeys(ctx), nil
+			}),
+		NewRule("lock_contention", "Statements that waited for locks held by other statements, and what blocked them",
+			[]Input{InputQuery, InputLocks},
+			func(ctx *Context) ([]store.Recommendation, error) {
+				return re.detectLockContention(ctx), nil
+			}),
+		NewRule("wait_profile", "Where a statement spends its active time, from active session history",
+			[]Input{InputQuery, InputWaits},
+			single(func(ctx *Context) *store.Recommendation {
+				return re.detectWaitProfile(ctx)
+			})),
+		NewRule("temp_spill", "Sorts and hashes that spill to temp files, and the work_mem that keeps them in memory",
+			[]Input{InputQuery, InputMemory},
+			single(func(ctx *Context) *store.Recommendation {
+				return re.detectTempSpill(ctx)
+			})),
+		NewRule("cache_hit_ratio", "Statements that read a lot from outside shared_buffers, and the index or cache change that avoids it",
+			[]Input{InputQuery, InputCache},
+			single(func(ctx *Context) *store.Recommendation {
+				return re.detectCacheMisses(ctx)
+			})),
+		NewRule("cardinality_issue", "Very selective queries on large tables that are still slow",
+			[]Input{InputQuery, InputTables},
+			single(func(ctx *Context) *store.Recommendation {
+				return re.detectCardinalityIssues(ctx.Query, ctx.TableNames, ctx.Tables)
+			})),
+	}
+}
+
+// Registry gives access to the engine's rules, e.g. to disable one by ID.
+func (re *RuleEngine) Registry() *Registry {
+	return re.registry
+}
+
+// Stats returns per-rule timing and error counts since the engine was
+// created, in registration order.
+func (re *RuleEngine) Stats() []RuleStats {
+	re.statsMu.Lock()
+	defer re.statsMu.Unlock()
+
+	var stats []RuleStats
+	for _, rule := range re.registry.Rules() {
+		if s, ok := re.stats[rule.ID()]; ok {
+			stats = append(stats, *s)
+		}
+	}
+	return stats
+}
+
+// AnalyzeQuery runs the enabled rules on a statement. Inputs may be nil,
+// which skips the rules that need any.
+func (re *RuleEngine) AnalyzeQuery(query store.QueryStats, tables []store.TableInfo, indexes []store.IndexInfo, inputs *Inputs) []store.Recommendation {
+	return re.AnalyzeQueryWithPlan(query, tables, indexes, nil, inputs)
 }
 
-func (re *RuleEngine) AnalyzeQuery(query store.QueryStats, tables []store.TableInfo, indexes []store.IndexInfo) []store.Recommendation {
+// AnalyzeQueryWithPlan also lets the rules read the statement's EXPLAIN
+// plan, which may be nil.
+func (re *RuleEngine) AnalyzeQueryWithPlan(query store.QueryStats, tables []store.TableInfo, indexes []store.IndexInfo, plan *explain.Plan, inputs *Inputs) []store.Recommendation {
 	logger.LogDebugf("Analyzing query with %d calls, %.2fms avg time", query.Calls, query.MeanExecTime)
 
 	var recommendations []store.Recommendation
@@ -51,78 +175,266 @@ func (re *RuleEngine) AnalyzeQuery(query store.QueryStats, tables []store.TableI
 		return recommendations
 	}
 
-	// AI-powered recommendations if available
+	// HARDCODE : heuristic rules
+
+	logger.LogInfo("Using heuristic rule-based recommendations")
+
+	// Parse the query once for all detectors. Text that does not parse (e.g.
+	// truncated by track_activity_query_size) falls back to the regex paths.
+	shape, err := re.parser.Shape(query.Query)
+	if err != nil {
+		logger.LogDebugf("Query did not parse, using pattern matching: %v", err)
+		shape = nil
+	}
+
+	// Extract table names from query
+	tableNames := re.extractTableNames(query.Query, shape)
+	logger.LogDebugf("Extracted table names from query: %v", tableNames)
+
+	ctx := &Context{
+		Query:      query,
+		Shape:      shape,
+		TableNames: tableNames,
+		Tables:     tables,
+		Indexes:    indexes,
+		Plan:       plan,
+	}
+	if inputs != nil {
+		ctx.Inputs = *inputs
+	}
+	for _, rule := range re.registry.Enabled() {
+		recommendations = append(recommendations, re.evaluate(rule, ctx)...)
+	}
+	re.addWaitEvidence(ctx, recommendations)
+
+	logger.LogDebugf("Generated %d heuristic recommendations for query", len(recommendations))
+
+	// AI-powered recommendations come on top of the rules, which still run
+	// so that disabled rules, rule timing and registered rules apply
 	if re.useAI && re.aiClient != nil {
 		logger.LogInfo("Using AI-powered recommendation generation")
 		aiRecs, err := re.aiClient.GenerateRecommendations(query, tables, indexes)
 		if err != nil {
-			logger.LogErrorf("AI recommendation failed, falling back to heuristics: %v", err)
+			logger.LogErrorf("AI recommendation failed, keeping the heuristic ones: %v", err)
 		} else {
 			logger.LogInfof("Generated %d AI-powered recommendations", len(aiRecs))
-			return aiRecs
+			for i := range aiRecs {
+				aiRecs[i].RuleID = "ai"
+			}
+			recommendations = append(recommendations, aiRecs...)
 		}
 	}
+	return recommendations
+}
 
-	// HARDCODE : heuristic rules
+// evaluate runs one rule with timing and panic isolation. A failing rule is
+// logged and contributes no recommendations; the others still run.
+func (re *RuleEngine) evaluate(rule Rule, ctx *Context) []store.Recommendation {
+	id := rule.ID()
 
-	logger.LogInfo("Using heuristic rule-based recommendations")
+	re.statsMu.Lock()
+	stats, ok := re.stats[id]
+	if !ok {
+		stats = &RuleStats{RuleID: id}
+		re.stats[id] = stats
+	}
+	re.statsMu.Unlock()
+
+	for _, input := range rule.Requires() {
+		if !ctx.Has(input) {
+			logger.LogDebugf("Skipping rule %s: %s unavailable", id, input)
+			re.statsMu.Lock()
+			stats.Skipped++
+			re.statsMu.Unlock()
+			return nil
+		}
+	}
 
-	// Extract table names from query
-	tableNames := re.extractTableNames(query.Query)
-	logger.LogDebugf("Extracted table names from query: %v", tableNames)
+	start := time.Now()
+	recs, panicked, err := evaluateSafely(rule, ctx)
+	elapsed := time.Since(start)
+
+	re.statsMu.Lock()
+	stats.Evaluations++
+	stats.TotalDuration += elapsed
+	if err != nil {
+		stats.Errors++
+		stats.LastError = err.Error()
+		if panicked {
+			stats.Panics++
+		}
+	} else {
+		stats.Recommendations += int64(len(recs))
+	}
+	re.statsMu.Unlock()
 
-	// Check for missing indexes
-	if rec := re.detectMissingIndex(query, tableNames, tables, indexes); rec != nil {
-		logger.LogInfof("Detected missing index recommendation for query")
-		recommendations = append(recommendations, *rec)
+	if err != nil {
+		logger.LogErrorf("Rule %s failed: %v", id, err)
+		return nil
 	}
 
-	// Check for correlated subqueries
-	if rec := re.detectCorrelatedSubquery(query); rec != nil {
-		logger.LogInfof("Detected correlated subquery recommendation for query")
-		recommendations = append(recommendations, *rec)
+	for i := range recs {
+		recs[i].RuleID = id
+	}
+	if len(recs) > 0 {
+		logger.LogInfof("Rule %s produced %d recommendations in %s", id, len(recs), elapsed)
+	} else {
+		logger.LogDebugf("Rule %s produced no recommendations in %s", id, elapsed)
 	}
+	return recs
+}
 
-	// Check for inefficient joins
-	if rec := re.detectIneffientJoin(query, tableNames, indexes); rec != nil {
-		logger.LogInfof("Detected inefficient join recommendation for query")
-		recommendations = append(recommendations, *rec)
+func (re *RuleEngine) detectMissingIndex(query store.QueryStats, shape *parse.QueryShape, tableNames []string, tables []store.TableInfo, indexes []store.IndexInfo, columns map[string]store.ColumnStats) *store.Recommendation {
+	// Only suggest indexes for slow queries on large tables
+	if query.MeanExecTime < re.minSeqScanTime {
+		return nil
+	}
+	if shape == nil {
+		return re.detectMissingIndexByPattern(query, tableNames, tables, indexes, columns)
 	}
 
-	// Check for redundant indexes
-	if rec := re.detectRedundantIndex(indexes, tableNames); rec != nil {
-		logger.LogInfof("Detected redundant index recommendation")
-		recommendations = append(recommendations, *rec)
+	// Group the indexable predicates by table, in query order
+	var filtered []string
+	predicates := make(map[string][]parse.Predicate)
+	for _, pred := range shape.Predicates {
+		// Unbound columns and columns wrapped in functions cannot use a plain index
+		if pred.Column.Table == "" || pred.Function != "" || !indexableOperator(pred.Operator) {
+			continue
+		}
+		tableName := pred.Column.Table
+		if _, ok := predicates[tableName]; !ok {
+			filtered = append(filtered, tableName)
+		}
+		predicates[tableName] = append(predicates[tableName], pred)
 	}
 
-	// Check for cardinality issues
-	if rec := re.detectCardinalityIssues(query, tables); rec != nil {
-		logger.LogInfof("Detected cardinality issue recommendation")
-		recommendations = append(recommendations, *rec)
+	for _, tableName := range filtered {
+		for _, table := range tables {
+			if table.TableName != tableName || table.RowCount <= re.minTableSize {
+				continue
+			}
+			if rec := re.indexForPredicates(table, predicates[tableName], indexes, columns); rec != nil {
+				return rec
+			}
+		}
 	}
 
-	logger.LogDebugf("Generated %d heuristic recommendations for query", len(recommendations))
-	return recommendations
+	return nil
 }
 
-func (re *RuleEngine) detectMissingIndex(query store.QueryStats, tableNames []string, tables []store.TableInfo, indexes []store.IndexInfo) *store.Recommendation {
-	// Only suggest indexes for slow queries on large tables
-	if query.MeanExecTime < re.minSeqScanTime {
+// indexForPredicates recommends an index for the predicates on one table.
+// With column statistics, the key columns are ordered by selectivity and
+// indexes expected to match more than maxSelectivity of the table are not
+// recommended; without them, the first unindexed column is.
+func (re *RuleEngine) indexForPredicates(table store.TableInfo, predicates []parse.Predicate, indexes []store.IndexInfo, columns map[string]store.ColumnStats) *store.Recommendation {
+	tableName := table.TableName
+
+	var candidates []indexColumn
+	seen := make(map[string]bool)
+	withStats := false
+	for _, pred := range predicates {
+		column := pred.Column.Column
+		if seen[column] {
+			continue
+		}
+		seen[column] = true
+
+		c := indexColumn{name: column, operator: pred.Operator}
+		if stats, ok := columns[columnKey(tableName, column)]; ok {
+			c.stats = &stats
+			c.sel = predicateSelectivity(pred.Operator, stats, table.RowCount)
+			withStats = true
+		} else {
+			c.sel = predicateSelectivity(pred.Operator, store.ColumnStats{}, table.RowCount)
+		}
+		candidates = append(candidates, c)
+	}
+
+	if !withStats {
+		for _, c := range candidates {
+			if re.hasIndexOnColumn(c.name, []string{tableName}, indexes) {
+				continue
+			}
+			return &store.Recommendation{
+				Type:           "missing_index",
+				DDL:            re.createIndexDDL(tableName, c.name),
+				Rationale:      fmt.Sprintf("Query performs sequential scan on table '%s' filtering by column '%s' (%s).%s An index would improve performance.", tableName, c.name, c.operator, seqScanEvidence(table)),
+				Confidence:     0.8,
+				ImpactEstimate: fmt.Sprintf("Expected 50-90%% performance improvement for queries filtering by %s", c.name),
+				RiskLevel:      "low",
+			}
+		}
+		return nil
+	}
+
+	key := orderIndexColumns(candidates, table.RowCount)
+	if len(key) == 0 || re.hasIndexOnColumn(key[0].name, []string{tableName}, indexes) {
+		return nil
+	}
+
+	combined := combinedSelectivity(key)
+	if combined.estimated && combined.fraction > re.maxSelectivity {
+		logger.LogDebugf("Not recommending an index on %s for columns matching %s of rows", tableName, format.Percent(combined.fraction))
 		return nil
 	}
 
+	names := make([]string, len(key))
+	evidence := make([]string, len(key))
+	for i, c := range key {
+		names[i] = c.name
+		evidence[i] = columnEvidence(c, table.RowCount)
+	}
+
+	rationale := fmt.Sprintf("Query performs sequential scan on table '%s' filtering by %s.", tableName, strings.Join(evidence, ", "))
+	if combined.estimated {
+		rationale += fmt.Sprintf(" The planner's statistics put the matching rows at about %s (%.0f of %d rows).", format.Percent(combined.fraction), combined.fraction*float64(table.RowCount), table.RowCount)
+	}
+	rationale += seqScanEvidence(table)
+	if len(key) > 1 {
+		rationale += " The index puts equality columns first, most selective first, and a range column last."
+	} else {
+		rationale += " An index would improve performance."
+	}
+
+	confidence := 0.8
+	if combined.estimated && combined.fraction <= 0.01 {
+		confidence = 0.9
+	}
+
+	return &store.Recommendation{
+		Type:           "missing_index",
+		DDL:            re.createIndexDDL(tableName, names...),
+		Rationale:      rationale,
+		Confidence:     confidence,
+		ImpactEstimate: fmt.Sprintf("Expected 50-90%% performance improvement for queries filtering by %s", strings.Join(names, ", ")),
+		RiskLevel:      "low",
+	}
+}
+
+// indexableOperator reports whether a B-tree index can serve a predicate
+// with this operator.
+func indexableOperator(operator string) bool {
+	switch operator {
+	case "=", "<", ">", "<=", ">=", "IN", "= ANY", "BETWEEN", "LIKE", "IS NULL":
+		return true
+	}
+	return false
+}
+
+// detectMissingIndexByPattern is the regex fallback for queries that do not parse
+func (re *RuleEngine) detectMissingIndexByPattern(query store.QueryStats, tableNames []string, tables []store.TableInfo, indexes []store.IndexInfo, columns map[string]store.ColumnStats) *store.Recommendation {
 	queryUpper := strings.ToUpper(query.Query)
 
 	// Look for WHERE clauses that might benefit from indexes
 	wherePatterns := []struct {
-		pattern string
-		column  string
+		pattern  string
+		operator string
 	}{
-		{`WHERE\s+(\w+)\s*=`, ""},
-		{`WHERE\s+(\w+)\s*IN`, ""},
-		{`WHERE\s+(\w+)\s*>`, ""},
-		{`WHERE\s+(\w+)\s*<`, ""},
-		{`WHERE\s+(\w+)\s*LIKE`, ""},
+		{`WHERE\s+(\w+)\s*=`, "="},
+		{`WHERE\s+(\w+)\s*IN`, "IN"},
+		{`WHERE\s+(\w+)\s*>`, ">"},
+		{`WHERE\s+(\w+)\s*<`, "<"},
+		{`WHERE\s+(\w+)\s*LIKE`, "LIKE"},
 	}
 
 	for _, pattern := range wherePatterns {
@@ -152,10 +464,17 @@ func (re *RuleEngine) detectMissingIndex(query store.QueryStats, tableNames []st
 				for _, tableName := range tableNames {
 					for _, table := range tables {
 						if table.TableName == tableName && table.RowCount > re.minTableSize {
+							if stats, ok := columns[columnKey(tableName, column)]; ok {
+								sel := predicateSelectivity(pattern.operator, stats, table.RowCount)
+								if sel.estimated && sel.fraction > re.maxSelectivity {
+									logger.LogDebugf("Not recommending an index on %s.%s matching %s of rows", tableName, column, format.Percent(sel.fraction))
+									continue
+								}
+							}
 							return &store.Recommendation{
 								Type:           "missing_index",
-								DDL:            fmt.Sprintf("CREATE INDEX idx_%s_%s ON %s (%s);", tableName, column, tableName, column),
-								Rationale:      fmt.Sprintf("Query performs sequential scan on table '%s' filtering by column '%s'. An index would improve performance.", tableName, column),
+								DDL:            re.createIndexDDL(tableName, column),
+								Rationale:      fmt.Sprintf("Query performs sequential scan on table '%s' filtering by column '%s'.%s An index would improve performance.", tableName, column, seqScanEvidence(table)),
 								Confidence:     0.8,
 								ImpactEstimate: fmt.Sprintf("Expected 50-90%% performance improvement for queries filtering by %s", column),
 								RiskLevel:      "low",
@@ -170,12 +489,19 @@ func (re *RuleEngine) detectMissingIndex(query store.QueryStats, tableNames []st
 	return nil
 }
 
-func (re *RuleEngine) detectCorrelatedSubquery(query store.QueryStats) *store.Recommendation {
+func (re *RuleEngine) detectCorrelatedSubquery(query store.QueryStats, shape *parse.QueryShape) *store.Recommendation {
 	if query.MeanExecTime < re.minSeqScanTime*2 { // Higher threshold for correlated subqueries
 		return nil
 	}
 
-	if re.correlationRegex.MatchString(query.Query) {
+	correlated := false
+	if shape != nil {
+		correlated = shape.HasCorrelatedSubquery()
+	} else {
+		correlated = re.correlationRegex.MatchString(query.Query)
+	}
+
+	if correlated {
 		return &store.Recommendation{
 			Type:           "correlated_subquery",
 			RewriteSQL:     "-- Consider rewriting correlated subquery as JOIN or EXISTS clause",
@@ -189,11 +515,44 @@ func (re *RuleEngine) detectCorrelatedSubquery(query store.QueryStats) *store.Re
 	return nil
 }
 
-func (re *RuleEngine) detectIneffientJoin(query store.QueryStats, tableNames []string, indexes []store.IndexInfo) *store.Recommendation {
+func (re *RuleEngine) detectIneffientJoin(query store.QueryStats, shape *parse.QueryShape, tableNames []string, indexes []store.IndexInfo) *store.Recommendation {
 	if query.MeanExecTime < re.minSeqScanTime {
 		return nil
 	}
+	if shape == nil {
+		return re.detectIneffientJoinByPattern(query, tableNames, indexes)
+	}
+
+	for _, join := range shape.Joins {
+		if join.Operator != "=" || join.Left.Table == "" || join.Right.Table == "" {
+			continue
+		}
+
+		hasLeftIndex := re.hasIndexOnColumn(join.Left.Column, []string{join.Left.Table}, indexes)
+		hasRightIndex := re.hasIndexOnColumn(join.Right.Column, []string{join.Right.Table}, indexes)
+
+		if !hasLeftIndex || !hasRightIndex {
+			missing := join.Left
+			if !hasRightIndex {
+				missing = join.Right
+			}
+
+			return &store.Recommendation{
+				Type:           "join_index",
+				DDL:            re.createIndexDDL(missing.Table, missing.Column),
+				Rationale:      fmt.Sprintf("JOIN operation lacks index on column '%s' in table '%s', causing slow nested loop joins.", missing.Column, missing.Table),
+				Confidence:     0.75,
+				ImpactEstimate: "Expected 40-80% improvement in join performance",
+				RiskLevel:      "low",
+			}
+		}
+	}
+
+	return nil
+}
 
+// detectIneffientJoinByPattern is the regex fallback for queries that do not parse
+func (re *RuleEngine) detectIneffientJoinByPattern(query store.QueryStats, tableNames []string, indexes []store.IndexInfo) *store.Recommendation {
 	queryUpper := strings.ToUpper(query.Query)
 
 	// Look for JOIN conditions
@@ -220,7 +579,7 @@ func (re *RuleEngine) detectIneffientJoin(query store.QueryStats, tableNames []s
 
 				return &store.Recommendation{
 					Type:           "join_index",
-					DDL:            fmt.Sprintf("CREATE INDEX idx_%s_%s ON %s (%s);", missingTable, missingCol, missingTable, missingCol),
+					DDL:            re.createIndexDDL(missingTable, missingCol),
 					Rationale:      fmt.Sprintf("JOIN operation lacks index on column '%s' in table '%s', causing slow nested loop joins.", missingCol, missingTable),
 					Confidence:     0.75,
 					ImpactEstimate: "Expected 40-80% improvement in join performance",
@@ -246,7 +605,11 @@ func (re *RuleEngine) hasIndexOnColumn(column string, tableNames []string, index
 	return false
 }
 
-func (re *RuleEngine) extractTableNames(query string) []string {
+func (re *RuleEngine) extractTableNames(query string, shape *parse.QueryShape) []string {
+	if shape != nil {
+		return shape.Tables()
+	}
+
 	var tables []string
 
 	patterns := []*regexp.Regexp{
@@ -270,72 +633,78 @@ func (re *RuleEngine) extractTableNames(query string) []string {
 	return tables
 }
 
-func (re *RuleEngine) detectRedundantIndex(indexes []store.IndexInfo, tableNames []string) *store.Recommendation {
-	// Look for indexes that are prefixes of other indexes on the same table
-	for i, idx1 := range indexes {
-		if !contains(tableNames, idx1.TableName) {
-			continue
-		}
-
-		for j, idx2 := range indexes {
-			if i >= j || idx1.TableName != idx2.TableName {
-				continue
-			}
-
-			// Check if idx1 is a prefix of idx2 and unused
-			if len(idx1.Columns) < len(idx2.Columns) && idx1.IndexScans < 10 {
-				isPrefix := true
-				for k, col := range idx1.Columns {
-					if k >= len(idx2.Columns) || strings.EqualFold(strings.ToLower(col),strings.ToLower(idx2.Columns[k])) {
-						isPrefix = false
-						break
-					}
-				}
+// IndexHygiene analyzes the schema's indexes once, in the engine's DDL
+// dialect, for the redundant_index rule, which looks up the findings on the
+// tables of each statement through Inputs.Hygiene.
+func (re *RuleEngine) IndexHygiene(indexes []store.IndexInfo) *hygiene.Report {
+	opts := hygiene.DefaultOptions()
+	opts.Engine = re.engine
+	return hygiene.Analyze(indexes, opts)
+}
 
-				if isPrefix {
-					return &store.Recommendation{
-						Type:           "redundant_index",
-						DDL:            fmt.Sprintf("DROP INDEX %s;", idx1.IndexName),
-						Rationale:      fmt.Sprintf("Index '%s' on table '%s' is redundant with '%s' and has low usage (%d scans). The larger index covers the same queries.", idx1.IndexName, idx1.TableName, idx2.IndexName, idx1.IndexScans),
-						Confidence:     0.85,
-						ImpactEstimate: fmt.Sprintf("Reclaim %s storage and reduce maintenance overhead", formatBytes(idx1.SizeBytes)),
-						RiskLevel:      "low",
-					}
-				}
-			}
+// detectRedundantIndexes reports the duplicate and left-prefix indexes on
+// the query's tables. 'optidb indexes' runs the same analysis across the
+// whole schema, with unused indexes as well.
+func (re *RuleEngine) detectRedundantIndexes(report *hygiene.Report, tableNames []string) []store.Recommendation {
+	var recommendations []store.Recommendation
+	for _, f := range report.ForTables(tableNames) {
+		confidence := 0.85
+		switch f.Kind {
+		case hygiene.KindDuplicate:
+			confidence = 0.95
+		case hygiene.KindRedundant:
+		default:
+			continue
 		}
+		recommendations = append(recommendations, store.Recommendation{
+			Type:           "redundant_index",
+			DDL:            f.DDL,
+			Rationale:      f.Rationale,
+			Confidence:     confidence,
+			ImpactEstimate: fmt.Sprintf("Reclaim %s storage and reduce maintenance overhead", format.Bytes(f.SizeBytes)),
+			RiskLevel:      f.RiskLevel,
+		})
 	}
-
-	return nil
+	return recommendations
 }
 
-func (re *RuleEngine) detectCardinalityIssues(query store.QueryStats, tables []store.TableInfo) *store.Recommendation {
+func (re *RuleEngine) detectCardinalityIssues(query store.QueryStats, tableNames []string, tables []store.TableInfo) *store.Recommendation {
 	// Simple heuristic: if a query returns way more or fewer rows than expected based on table size
-	if len(tables) == 0 || query.Rows == 0 {
+	if len(tableNames) == 0 || query.Rows == 0 || query.Calls == 0 {
 		return nil
 	}
 
-	// Find the largest table involved (rough estimate)
-	var maxTableSize int64
-	var tableName string
-	for _, table := range tables {
-		if table.RowCount > maxTableSize {
-			maxTableSize = table.RowCount
-			tableName = table.TableName
+	// Find the largest table the query reads
+	var largest *store.TableInfo
+	for i, table := range tables {
+		if contains(tableNames, table.TableName) && (largest == nil || table.RowCount > largest.RowCount) {
+			largest = &tables[i]
 		}
 	}
-
-	if maxTableSize == 0 {
+	if largest == nil || largest.RowCount <= 100000 || query.MeanExecTime <= 1.0 {
 		return nil
 	}
 
 	// If query returns a very small fraction of a large table, might need better statistics
-	selectivity := float64(query.Rows) / float64(maxTableSize)
-	if maxTableSize > 100000 && selectivity < 0.001 && query.MeanExecTime > 1.0 {
+	rowsPerCall := float64(query.Rows) / float64(query.Calls)
+	selectivity := rowsPerCall / float64(largest.RowCount)
+	stale := staleStatistics(*largest)
+
+	switch {
+	case stale != "":
+		return &store.Recommendation{
+			Type:           "cardinality_issue",
+			DDL:            re.analyzeDDL(largest.TableName),
+			Rationale:      fmt.Sprintf("Planner statistics for large table '%s' are out of date: %s. Row estimates for this query are likely wrong; refresh the statistics.", largest.TableName, stale),
+			Confidence:     0.75,
+			ImpactEstimate: "Expected 20-50% improvement with better statistics",
+			RiskLevel:      "low",
+		}
+	case selectivity < 0.001:
 		return &store.Recommendation{
 			Type:           "cardinality_issue",
-			DDL:            fmt.Sprintf("ANALYZE %s; -- or ALTER TABLE %s ALTER COLUMN <selective_column> SET STATISTICS 1000;", tableName, tableName),
-			Rationale:      fmt.Sprintf("Query has very low selectivity (%.4f%%) on large table '%s' but still slow. Consider updating table statistics or creating expression indexes.", selectivity*100, tableName),
+			DDL:            re.analyzeDDL(largest.TableName),
+			Rationale:      fmt.Sprintf("Query has very low selectivity (%.4f%%, %.0f of %d rows per call) on large table '%s' but still slow. Consider updating table statistics or creating expression indexes.", selectivity*100, rowsPerCall, largest.RowCount, largest.TableName),
 			Confidence:     0.60,
 			ImpactEstimate: "Expected 20-50% improvement with better statistics",
 			RiskLevel:      "low",
@@ -345,15 +714,29 @@ func (re *RuleEngine) detectCardinalityIssues(query store.QueryStats, tables []s
 	return nil
 }
 
-func formatBytes(bytes int64) string {
-	if bytes < 1024 {
-		return fmt.Sprintf("%d B", bytes)
-	} else if bytes < 1024*1024 {
-		return fmt.Sprintf("%.1f KB", float64(bytes)/1024)
-	} else if bytes < 1024*1024*1024 {
-		return fmt.Sprintf("%.1f MB", float64(bytes)/(1024*1024))
+// staleStatistics describes why a table's planner statistics cannot be
+// trusted, or returns "" when they look current. reltuples is what the
+// planner believes; n_live_tup tracks the table between ANALYZE runs.
+func staleStatistics(table store.TableInfo) string {
+	if table.RelTuples < 0 || (table.RelTuples == 0 && table.LiveTuples > 0 && table.LastAnalyzed() == nil) {
+		return "the table has never been analyzed"
+	}
+	if table.RelTuples > 0 && table.LiveTuples > 0 {
+		drift := float64(table.LiveTuples)/table.RelTuples - 1
+		if drift > 0.2 || drift < -0.2 {
+			return fmt.Sprintf("the planner expects %.0f rows but the table has about %d", table.RelTuples, table.LiveTuples)
+		}
+	}
+	return ""
+}
+
+// seqScanEvidence summarizes the sequential scans recorded for a table, for
+// appending to a rationale.
+func seqScanEvidence(table store.TableInfo) string {
+	if table.SeqScans == 0 {
+		return ""
 	}
-	return fmt.Sprintf("%.1f GB", float64(bytes)/(1024*1024*1024))
+	return fmt.Sprintf(" The table has had %d sequential scans reading %d rows, against %d index scans.", table.SeqScans, table.SeqTupRead, table.IdxScans)
 }
 
 func contains(slice []string, item string) bool {
@@ -0,0 +1,77 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+
+	"cli/internal/hygiene"
+	"cli/internal/store"
+)
+
+// detectUnindexedForeignKeys flags a DELETE on a parent table, or an UPDATE
+// of its referenced columns, when a child's foreign key has no index: the
+// constraint check then scans the whole child table once per affected row.
+// No indexes at all means no foreign key is supported.
+func (re *RuleEngine) detectUnindexedForeignKeys(ctx *Context) []store.Recommendation {
+	shape := ctx.Shape
+	if shape.Target == "" || (shape.StatementType != "DELETE" && shape.StatementType != "UPDATE") {
+		return nil
+	}
+
+	var affected []store.ForeignKey
+	for _, fk := range ctx.ForeignKeys {
+		if fk.RefTableName != shape.Target {
+			continue
+		}
+		if shape.StatementType == "UPDATE" && !updatesAny(shape.SetColumns, fk.RefColumns) {
+			continue
+		}
+		affected = append(affected, fk)
+	}
+	if len(affected) == 0 {
+		return nil
+	}
+
+	var recommendations []store.Recommendation
+	for _, f := range hygiene.UnindexedForeignKeys(affected, ctx.Tables, ctx.Indexes, re.engine) {
+		rationale := fmt.Sprintf("This %s on '%s' ran %d times and affected %d rows; ", shape.StatementType, f.RefTable, ctx.Query.Calls, ctx.Query.Rows)
+		rationale += fmt.Sprintf("for each row, the check of foreign key '%s' sequentially scans '%s' (%d rows) because no index leads with %s.",
+			f.Constraint, f.Table, f.ChildRows, strings.Join(f.Columns, ", "))
+		if f.ParentWrites > 0 {
+			rationale += fmt.Sprintf(" '%s' has had %d updates and deletes since the statistics were reset.", f.RefTable, f.ParentWrites)
+		}
+
+		confidence := 0.8
+		if f.Severity == "high" {
+			confidence = 0.95
+		} else if f.Severity == "low" {
+			confidence = 0.6
+		}
+
+		recommendations = append(recommendations, store.Recommendation{
+			Type:           "foreign_key_index",
+			DDL:            f.DDL,
+			Rationale:      rationale,
+			Confidence:     confidence,
+			ImpactEstimate: fmt.Sprintf("Replaces a %d-row scan of %s per %s row with an index lookup", f.ChildRows, f.Table, strings.ToLower(shape.StatementType)),
+			RiskLevel:      "low",
+		})
+	}
+	return recommendations
+}
+
+// updatesAny reports whether an UPDATE sets any of the columns. A nil set
+// list means the columns are unknown, so the update may touch them.
+func updatesAny(set, columns []string) bool {
+	if set == nil {
+		return true
+	}
+	for _, s := range set {
+		for _, c := range columns {
+			if strings.EqualFold(s, c) {
+				return true
+			}
+		}
+	}
+	return false
+}
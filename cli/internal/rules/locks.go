@@ -0,0 +1,64 @@
+package rules
+
+import (
+	"fmt"
+	"time"
+
+	"cli/internal/locks"
+	"cli/internal/store"
+)
+
+// maxLockRecommendations caps the blockers reported per statement; the
+// rest are in the full lock report
+const maxLockRecommendations = 3
+
+// detectLockContention explains the time a statement lost waiting for
+// locks: which statement held them, on what and for how long. A statement
+// that mostly blocks others gets one recommendation saying whom it held up.
+func (re *RuleEngine) detectLockContention(ctx *Context) []store.Recommendation {
+	fingerprint := re.parser.GenerateFingerprint(ctx.Query.Query)
+	waited, blocked := ctx.Locks.ForStatement(fingerprint, ctx.Query.QueryID)
+
+	var recommendations []store.Recommendation
+	for i, w := range waited {
+		if i == maxLockRecommendations {
+			break
+		}
+		confidence := 0.8
+		if w.BlockerQuery == "" {
+			confidence = 0.5
+		}
+		risk := "low"
+		if w.LongestWait >= 10*time.Second {
+			risk = "medium"
+		}
+		recommendations = append(recommendations, store.Recommendation{
+			Type:           "lock_contention",
+			Rationale:      fmt.Sprintf("Over the last %s of activity sampling, %s %s", window(ctx.Locks), w.Describe(), w.Remedy()),
+			Confidence:     confidence,
+			ImpactEstimate: fmt.Sprintf("Up to %s of lock wait per %s", w.WaitTime.Round(100*time.Millisecond), window(ctx.Locks)),
+			RiskLevel:      risk,
+		})
+	}
+
+	if len(blocked) > 0 {
+		var total time.Duration
+		for _, w := range blocked {
+			total += w.WaitTime
+		}
+		worst := blocked[0]
+		recommendations = append(recommendations, store.Recommendation{
+			Type: "lock_contention",
+			Rationale: fmt.Sprintf("Over the last %s of activity sampling, this statement held locks that %d other statements waited %s for in total. The longest: %s %s",
+				window(ctx.Locks), len(blocked), total.Round(100*time.Millisecond), worst.Describe(), worst.Remedy()),
+			Confidence:     0.8,
+			ImpactEstimate: fmt.Sprintf("Frees up to %s of lock wait in other sessions per %s", total.Round(100*time.Millisecond), window(ctx.Locks)),
+			RiskLevel:      "low",
+		})
+	}
+	return recommendations
+}
+
+func window(report *locks.Report) time.Duration {
+	return report.Window.Round(time.Second)
+}
@@ -0,0 +1,130 @@
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"cli/internal/logger"
+)
+
+// Registry holds rules in registration order and which of them are enabled.
+type Registry struct {
+	mu       sync.RWMutex
+	rules    []Rule
+	disabled map[string]bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{disabled: make(map[string]bool)}
+}
+
+// Register adds a rule, enabled. IDs must be unique.
+func (r *Registry) Register(rule Rule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if rule.ID() == "" {
+		return fmt.Errorf("rule has no ID")
+	}
+	for _, existing := range r.rules {
+		if existing.ID() == rule.ID() {
+			return fmt.Errorf("rule %s is already registered", rule.ID())
+		}
+	}
+	r.rules = append(r.rules, rule)
+	return nil
+}
+
+// Enable turns a rule back on
+func (r *Registry) Enable(id string) error {
+	return r.setEnabled(id, true)
+}
+
+// Disable stops a rule from being evaluated
+func (r *Registry) Disable(id string) error {
+	return r.setEnabled(id, false)
+}
+
+func (r *Registry) setEnabled(id string, enabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, rule := range r.rules {
+		if rule.ID() == id {
+			if enabled {
+				delete(r.disabled, id)
+			} else {
+				r.disabled[id] = true
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown rule %q (known: %v)", id, r.idsLocked())
+}
+
+// IsEnabled reports whether a registered rule is enabled
+func (r *Registry) IsEnabled(id string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return !r.disabled[id]
+}
+
+// Rules returns every registered rule, enabled or not
+func (r *Registry) Rules() []Rule {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]Rule(nil), r.rules...)
+}
+
+// Enabled returns the rules to evaluate, in registration order
+func (r *Registry) Enabled() []Rule {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var enabled []Rule
+	for _, rule := range r.rules {
+		if !r.disabled[rule.ID()] {
+			enabled = append(enabled, rule)
+		}
+	}
+	return enabled
+}
+
+func (r *Registry) idsLocked() []string {
+	ids := make([]string, 0, len(r.rules))
+	for _, rule := range r.rules {
+		ids = append(ids, rule.ID())
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// customRules are registered from Go code with Register, typically in an
+// init function, and are added to every rule engine created afterwards.
+var (
+	customMu    sync.Mutex
+	customRules []Rule
+)
+
+// Register adds a team rule to every RuleEngine created after the call. It
+// panics on a duplicate ID, like database/sql.Register, since that is a
+// programming error.
+func Register(rule Rule) {
+	customMu.Lock()
+	defer customMu.Unlock()
+
+	for _, existing := range customRules {
+		if existing.ID() == rule.ID() {
+			panic(fmt.Sprintf("rules: Register called twice for rule %s", rule.ID()))
+		}
+	}
+	customRules = append(customRules, rule)
+	logger.LogDebugf("Registered custom rule %s", rule.ID())
+}
+
+func registeredRules() []Rule {
+	customMu.Lock()
+	defer customMu.Unlock()
+	return append([]Rule(nil), customRules...)
+}
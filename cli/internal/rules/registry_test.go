@@ -0,0 +1,100 @@
+package rules
+
+import (
+	"reflect"
+	"testing"
+
+	"cli/internal/store"
+)
+
+func TestRegistry(t *testing.T) {
+	noop := func(*Context) ([]store.Recommendation, error) { return nil, nil }
+
+	type op struct {
+		enable  bool
+		id      string
+		wantErr bool
+	}
+	tests := []struct {
+		name        string
+		register    []string
+		wantErrs    []bool // per Register call
+		ops         []op
+		wantEnabled []string
+	}{
+		{
+			name:        "rules are enabled in registration order",
+			register:    []string{"missing_index", "temp_spill", "lock_contention"},
+			wantErrs:    []bool{false, false, false},
+			wantEnabled: []string{"missing_index", "temp_spill", "lock_contention"},
+		},
+		{
+			name:        "duplicate and empty IDs are rejected",
+			register:    []string{"missing_index", "missing_index", ""},
+			wantErrs:    []bool{false, true, true},
+			wantEnabled: []string{"missing_index"},
+		},
+		{
+			name:        "disable",
+			register:    []string{"missing_index", "temp_spill"},
+			wantErrs:    []bool{false, false},
+			ops:         []op{{id: "missing_index"}},
+			wantEnabled: []string{"temp_spill"},
+		},
+		{
+			name:     "enable again",
+			register: []string{"missing_index", "temp_spill"},
+			wantErrs: []bool{false, false},
+			ops: []op{
+				{id: "temp_spill"},
+				{id: "temp_spill"},
+				{enable: true, id: "temp_spill"},
+			},
+			wantEnabled: []string{"missing_index", "temp_spill"},
+		},
+		{
+			name:     "unknown rule",
+			register: []string{"missing_index"},
+			wantErrs: []bool{false},
+			ops: []op{
+				{id: "missing_indexes", wantErr: true},
+				{enable: true, id: "ai", wantErr: true},
+			},
+			wantEnabled: []string{"missing_index"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewRegistry()
+			for i, id := range tt.register {
+				err := registry.Register(NewRule(id, "", nil, noop))
+				if (err != nil) != tt.wantErrs[i] {
+					t.Errorf("Register(%q) error = %v, wantErr %t", id, err, tt.wantErrs[i])
+				}
+			}
+			for _, o := range tt.ops {
+				var err error
+				if o.enable {
+					err = registry.Enable(o.id)
+				} else {
+					err = registry.Disable(o.id)
+				}
+				if (err != nil) != o.wantErr {
+					t.Errorf("enable %t of %q: error = %v, wantErr %t", o.enable, o.id, err, o.wantErr)
+				}
+			}
+
+			var enabled []string
+			for _, rule := range registry.Enabled() {
+				enabled = append(enabled, rule.ID())
+				if !registry.IsEnabled(rule.ID()) {
+					t.Errorf("IsEnabled(%q) = false for an enabled rule", rule.ID())
+				}
+			}
+			if !reflect.DeepEqual(enabled, tt.wantEnabled) {
+				t.Errorf("Enabled() = %v, want %v", enabled, tt.wantEnabled)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package rules
+
+import (
+	"fmt"
+	"time"
+
+	"cli/internal/ash"
+	"cli/internal/cache"
+	"cli/internal/explain"
+	"cli/internal/hygiene"
+	"cli/internal/locks"
+	"cli/internal/parse"
+	"cli/internal/store"
+)
+
+// Input names data a rule needs. A rule is skipped, not failed, when one of
+// its required inputs is unavailable for a query.
+type Input string
+
+const (
+	InputQuery       Input = "query"        // pg_stat_statements row, always available
+	InputShape       Input = "shape"        // parse tree; missing when the SQL does not parse
+	InputTables      Input = "tables"       // table statistics
+	InputIndexes     Input = "indexes"      // index definitions and usage
+	InputColumns     Input = "columns"      // planner statistics from pg_stats
+	InputForeignKeys Input = "foreign_keys" // foreign key constraints
+	InputLocks       Input = "locks"        // lock waits from activity sampling
+	InputWaits       Input = "wait_events"  // active session history from activity sampling
+	InputPlan        Input = "plan"         // EXPLAIN plan, when one was captured for the query
+	InputMemory      Input = "memory"       // work_mem and the roles overriding it
+	InputCache       Input = "cache"        // buffer cache hit ratios per table and index
+	InputHygiene     Input = "hygiene"      // duplicate and redundant indexes of the schema
+)
+
+// Inputs are the schema and server facts the rules read besides the
+// statement. Callers collect them once and refresh them as they see fit;
+// the engine only reads the ones passed to each analysis, so analyses with
+// different inputs can run at the same time.
+type Inputs struct {
+	Columns     map[string]store.ColumnStats // keyed by table.column, see SetColumnStats
+	ForeignKeys []store.ForeignKey
+	Locks       *locks.Report
+	Waits       *ash.Report
+	Memory      *store.MemorySettings
+	Cache       *cache.Report
+	Hygiene     *hygiene.Report // see RuleEngine.IndexHygiene
+}
+
+// Context is everything a rule can look at for one query.
+type Context struct {
+	Query      store.QueryStats
+	Shape      *parse.QueryShape
+	TableNames []string
+	Tables     []store.TableInfo
+	Indexes    []store.IndexInfo
+	Plan       *explain.Plan
+	Inputs
+}
+
+// Column returns the planner statistics of a column, if they were collected
+func (ctx *Context) Column(table, column string) (store.ColumnStats, bool) {
+	c, ok := ctx.Columns[columnKey(table, column)]
+	return c, ok
+}
+
+// Has reports whether an input is available
+func (ctx *Context) Has(input Input) bool {
+	switch input {
+	case InputQuery:
+		return true
+	case InputShape:
+		return ctx.Shape != nil
+	case InputTables:
+		return len(ctx.Tables) > 0
+	case InputIndexes:
+		return len(ctx.Indexes) > 0
+	case InputColumns:
+		return len(ctx.Columns) > 0
+	case InputForeignKeys:
+		return len(ctx.ForeignKeys) > 0
+	case InputLocks:
+		return ctx.Locks != nil && len(ctx.Locks.Waits) > 0
+	case InputWaits:
+		return ctx.Waits != nil && len(ctx.Waits.Statements) > 0
+	case InputPlan:
+		return ctx.Plan != nil
+	case InputMemory:
+		return ctx.Memory != nil
+	case InputCache:
+		return ctx.Cache != nil
+	case InputHygiene:
+		return ctx.Hygiene != nil
+	}
+	return false
+}
+
+// Rule is one check of the rule engine. Rules must be safe for concurrent
+// use, since the HTTP server analyzes queries in parallel. The engine sets
+// RuleID on the recommendations a rule returns.
+type Rule interface {
+	ID() string
+	Description() string
+	Requires() []Input
+	Evaluate(ctx *Context) ([]store.Recommendation, error)
+}
+
+// RuleFunc is the signature of a rule's Evaluate method
+type RuleFunc func(ctx *Context) ([]store.Recommendation, error)
+
+type funcRule struct {
+	id          string
+	description string
+	requires    []Input
+	evaluate    RuleFunc
+}
+
+// NewRule builds a Rule from a function, e.g.
+//
+//	rules.Register(rules.NewRule("no_select_star", "Flags SELECT * on wide tables",
+//		[]rules.Input{rules.InputShape}, checkSelectStar))
+func NewRule(id, description string, requires []Input, fn RuleFunc) Rule {
+	return &funcRule{id: id, description: description, requires: requires, evaluate: fn}
+}
+
+func (r *funcRule) ID() string          { return r.id }
+func (r *funcRule) Description() string { return r.description }
+func (r *funcRule) Requires() []Input   { return r.requires }
+
+func (r *funcRule) Evaluate(ctx *Context) ([]store.Recommendation, error) {
+	return r.evaluate(ctx)
+}
+
+// single adapts the built-in detectors, which return at most one
+// recommendation, to RuleFunc.
+func single(detect func(ctx *Context) *store.Recommendation) RuleFunc {
+	return func(ctx *Context) ([]store.Recommendation, error) {
+		if rec := detect(ctx); rec != nil {
+			return []store.Recommendation{*rec}, nil
+		}
+		return nil, nil
+	}
+}
+
+// RuleStats accumulates how a rule has behaved across evaluations.
+type RuleStats struct {
+	RuleID          string        `json:"rule_id"`
+	Evaluations     int64         `json:"evaluations"`
+	Skipped         int64         `json:"skipped"`
+	Recommendations int64         `json:"recommendations"`
+	Errors          int64         `json:"errors"`
+	Panics          int64         `json:"panics"`
+	TotalDuration   time.Duration `json:"total_duration_ns"`
+	LastError       string        `json:"last_error,omitempty"`
+}
+
+// MeanDuration is the average time of one evaluation
+func (s RuleStats) MeanDuration() time.Duration {
+	if s.Evaluations == 0 {
+		return 0
+	}
+	return s.TotalDuration / time.Duration(s.Evaluations)
+}
+
+// evaluateSafely runs a rule, turning a panic into an error so that one
+// broken rule cannot abort a scan.
+func evaluateSafely(rule Rule, ctx *Context) (recs []store.Recommendation, panicked bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			recs = nil
+			panicked = true
+			err = fmt.Errorf("rule %s panicked: %v", rule.ID(), r)
+		}
+	}()
+
+	recs, err = rule.Evaluate(ctx)
+	return recs, false, err
+}
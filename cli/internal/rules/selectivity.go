@@ -0,0 +1,170 @@
+package rules
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"cli/internal/format"
+	"cli/internal/store"
+)
+
+// The planner's fallback selectivities (selfuncs.h), used for predicates
+// whose comparison value it cannot see, as with the parameters of a
+// normalized statement, or whose column has no statistics.
+const (
+	defaultEqSel        = 0.005
+	defaultIneqSel      = 1.0 / 3
+	defaultRangeIneqSel = 0.005
+	defaultMatchSel     = 0.005
+)
+
+// maxIndexColumns bounds the key columns of a recommended index
+const maxIndexColumns = 3
+
+func columnKey(table, column string) string {
+	return strings.ToLower(table) + "." + strings.ToLower(column)
+}
+
+// SetColumnStats replaces the column statistics the rules estimate
+// selectivity from, e.g. after each collection. Without them the index
+// rules recommend any filtered column, as they cannot tell a unique key
+// from a status flag.
+func (in *Inputs) SetColumnStats(stats []store.ColumnStats) {
+	columns := make(map[string]store.ColumnStats, len(stats))
+	for _, c := range stats {
+		key := columnKey(c.TableName, c.ColumnName)
+		if _, ok := columns[key]; !ok {
+			columns[key] = c
+		}
+	}
+	in.Columns = columns
+}
+
+// selectivity is the estimated fraction of a table's rows a predicate
+// keeps. Estimated is false for the planner's default guesses.
+type selectivity struct {
+	fraction  float64
+	estimated bool
+}
+
+// predicateSelectivity estimates a predicate the way the planner does when
+// the comparison value is a parameter. Equality and IS NULL follow from
+// n_distinct and null_frac; ranges and patterns depend on the value, so
+// they get the planner's defaults.
+func predicateSelectivity(operator string, c store.ColumnStats, rows int64) selectivity {
+	switch operator {
+	case "IS NULL":
+		return selectivity{fraction: c.NullFrac, estimated: true}
+	case "=", "IN", "= ANY":
+		return equalitySelectivity(c, rows)
+	case "BETWEEN":
+		return selectivity{fraction: defaultRangeIneqSel}
+	case "LIKE":
+		return selectivity{fraction: defaultMatchSel}
+	}
+	return selectivity{fraction: defaultIneqSel}
+}
+
+// equalitySelectivity follows var_eq_non_const: the non-null rows spread
+// evenly over the distinct values, capped at the most common value's share.
+func equalitySelectivity(c store.ColumnStats, rows int64) selectivity {
+	distinct := c.DistinctValues(rows)
+	if distinct <= 0 {
+		return selectivity{fraction: defaultEqSel}
+	}
+
+	fraction := (1 - c.NullFrac) / math.Max(distinct, 1)
+	if len(c.MostCommonFreqs) > 0 {
+		fraction = math.Min(fraction, c.MostCommonFreqs[0])
+	}
+	return selectivity{fraction: fraction, estimated: true}
+}
+
+// indexColumn is a filtered column considered as an index key
+type indexColumn struct {
+	name     string
+	operator string
+	sel      selectivity
+	stats    *store.ColumnStats
+}
+
+func isEquality(operator string) bool {
+	switch operator {
+	case "=", "IN", "= ANY", "IS NULL":
+		return true
+	}
+	return false
+}
+
+// orderIndexColumns chooses the key columns for the predicates on one
+// table: equality columns, most selective first, then the most selective
+// range column, since a B-tree cannot use the columns after a range.
+// Columns stop being added once the index is expected to find about one
+// row, since later columns only make it wider.
+func orderIndexColumns(columns []indexColumn, rows int64) []indexColumn {
+	var equality, ranges []indexColumn
+	for _, c := range columns {
+		if isEquality(c.operator) {
+			equality = append(equality, c)
+		} else {
+			ranges = append(ranges, c)
+		}
+	}
+	bySelectivity := func(cols []indexColumn) {
+		sort.SliceStable(cols, func(i, j int) bool { return cols[i].sel.fraction < cols[j].sel.fraction })
+	}
+	bySelectivity(equality)
+	bySelectivity(ranges)
+
+	candidates := equality
+	if len(ranges) > 0 {
+		candidates = append(candidates, ranges[0])
+	}
+
+	var key []indexColumn
+	fraction := 1.0
+	for _, c := range candidates {
+		if len(key) == maxIndexColumns || (len(key) > 0 && fraction*float64(rows) <= 1) {
+			break
+		}
+		key = append(key, c)
+		fraction *= c.sel.fraction
+	}
+	return key
+}
+
+// combinedSelectivity assumes the columns are independent, as the planner
+// does without extended statistics.
+func combinedSelectivity(key []indexColumn) selectivity {
+	combined := selectivity{fraction: 1, estimated: true}
+	for _, c := range key {
+		combined.fraction *= c.sel.fraction
+		combined.estimated = combined.estimated && c.sel.estimated
+	}
+	return combined
+}
+
+// columnEvidence explains what the statistics say about one key column, for
+// a rationale.
+func columnEvidence(c indexColumn, rows int64) string {
+	if c.stats == nil {
+		return fmt.Sprintf("'%s' (%s, no statistics)", c.name, c.operator)
+	}
+
+	var parts []string
+	if c.sel.estimated {
+		parts = append(parts, fmt.Sprintf("~%s of rows, %.0f distinct values", format.Percent(c.sel.fraction), c.stats.DistinctValues(rows)))
+	}
+	if len(c.stats.MostCommonFreqs) > 0 && c.stats.MostCommonFreqs[0] >= 0.2 && len(c.stats.MostCommonVals) > 0 {
+		parts = append(parts, fmt.Sprintf("'%s' is %s of rows", c.stats.MostCommonVals[0], format.Percent(c.stats.MostCommonFreqs[0])))
+	}
+	if !isEquality(c.operator) && math.Abs(c.stats.Correlation) >= 0.9 {
+		parts = append(parts, "rows are stored in nearly this order, so a range reads few pages")
+	}
+	if len(parts) == 0 {
+		return fmt.Sprintf("'%s' (%s)", c.name, c.operator)
+	}
+	return fmt.Sprintf("'%s' (%s: %s)", c.name, c.operator, strings.Join(parts, "; "))
+}
@@ -0,0 +1,145 @@
+package rules
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"cli/internal/store"
+)
+
+func TestPredicateSelectivity(t *testing.T) {
+	const rows = 1_000_000
+
+	tests := []struct {
+		name          string
+		operator      string
+		stats         store.ColumnStats
+		want          float64
+		wantEstimated bool
+	}{
+		{
+			name:          "unique column",
+			operator:      "=",
+			stats:         store.ColumnStats{NDistinct: -1},
+			want:          1.0 / rows,
+			wantEstimated: true,
+		},
+		{
+			name:          "distinct values exclude nulls",
+			operator:      "IN",
+			stats:         store.ColumnStats{NDistinct: 100, NullFrac: 0.5},
+			want:          0.005,
+			wantEstimated: true,
+		},
+		{
+			name:          "capped at the most common value",
+			operator:      "= ANY",
+			stats:         store.ColumnStats{NDistinct: 4, MostCommonVals: []string{"paid"}, MostCommonFreqs: []float64{0.1}},
+			want:          0.1,
+			wantEstimated: true,
+		},
+		{
+			name:     "equality without distinct values",
+			operator: "=",
+			want:     defaultEqSel,
+		},
+		{
+			name:          "is null",
+			operator:      "IS NULL",
+			stats:         store.ColumnStats{NullFrac: 0.02},
+			want:          0.02,
+			wantEstimated: true,
+		},
+		{
+			name:     "range",
+			operator: ">",
+			stats:    store.ColumnStats{NDistinct: -1},
+			want:     defaultIneqSel,
+		},
+		{
+			name:     "between",
+			operator: "BETWEEN",
+			want:     defaultRangeIneqSel,
+		},
+		{
+			name:     "pattern",
+			operator: "LIKE",
+			want:     defaultMatchSel,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := predicateSelectivity(tt.operator, tt.stats, rows)
+			if math.Abs(got.fraction-tt.want) > 1e-12 || got.estimated != tt.wantEstimated {
+				t.Errorf("predicateSelectivity(%s) = %v, %t, want %v, %t", tt.operator, got.fraction, got.estimated, tt.want, tt.wantEstimated)
+			}
+		})
+	}
+}
+
+func TestOrderIndexColumns(t *testing.T) {
+	column := func(name, operator string, fraction float64) indexColumn {
+		return indexColumn{name: name, operator: operator, sel: selectivity{fraction: fraction, estimated: true}}
+	}
+
+	tests := []struct {
+		name    string
+		rows    int64
+		columns []indexColumn
+		want    []string
+	}{
+		{
+			name: "equality columns most selective first",
+			rows: 1_000_000,
+			columns: []indexColumn{
+				column("status", "=", 0.25),
+				column("customer_id", "=", 0.001),
+			},
+			want: []string{"customer_id", "status"},
+		},
+		{
+			name: "one range column after the equality columns",
+			rows: 1_000_000,
+			columns: []indexColumn{
+				column("created_at", ">", 0.3),
+				column("total", "BETWEEN", 0.005),
+				column("status", "=", 0.25),
+			},
+			want: []string{"status", "total"},
+		},
+		{
+			name: "stops once about one row is left",
+			rows: 10_000,
+			columns: []indexColumn{
+				column("email", "=", 0.0001),
+				column("tenant_id", "=", 0.01),
+			},
+			want: []string{"email"},
+		},
+		{
+			name: "at most three columns",
+			rows: 100_000_000,
+			columns: []indexColumn{
+				column("a", "=", 0.5),
+				column("b", "=", 0.5),
+				column("c", "=", 0.5),
+				column("d", "=", 0.5),
+			},
+			want: []string{"a", "b", "c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, c := range orderIndexColumns(tt.columns, tt.rows) {
+				got = append(got, c.name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("orderIndexColumns() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+
+	"cli/internal/explain"
+	"cli/internal/format"
+	"cli/internal/store"
+)
+
+// sortMemoryFactor is roughly how much more memory a sort needs than it
+// wrote to disk: tuples on tape drop the bookkeeping an in-memory sort
+// keeps per tuple
+const sortMemoryFactor = 2
+
+// minSpillPerCall is the temp file volume per execution below which the
+// temp_spill rule stays quiet without a plan; small spills are usually
+// served from the OS cache
+const minSpillPerCall = 1 << 20
+
+// maxWorkMem is the most work_mem the temp_spill rule gives one statement;
+// past it, the statement should sort or hash less data instead
+const maxWorkMem = 1 << 30
+
+// detectTempSpill finds statements whose sorts and hashes do not fit
+// work_mem and write temp files, from the plan's spilling nodes when an
+// analyzed plan was captured and from the temp blocks pg_stat_statements
+// counts otherwise. It sizes work_mem for the largest spilling node and
+// recommends raising it for that statement only.
+func (re *RuleEngine) detectTempSpill(ctx *Context) *store.Recommendation {
+	query, memory := ctx.Query, ctx.Memory
+	blockSize := memory.BlockSize
+	if blockSize == 0 {
+		blockSize = 8192
+	}
+
+	var spillPerCall int64
+	if query.Calls > 0 {
+		spillPerCall = query.TempBlksWritten * blockSize / query.Calls
+	}
+	var spills []explain.Spill
+	if ctx.Plan != nil {
+		spills = ctx.Plan.Spills()
+	}
+	if len(spills) == 0 && spillPerCall < minSpillPerCall {
+		return nil
+	}
+
+	current := memory.WorkMemFor(query.UserID)
+	multiplier := max(memory.HashMemMultiplier, 1)
+	role, hasRole := memory.Role(query.UserID)
+
+	runsWith := format.Bytes(current)
+	if hasRole && role.WorkMem > 0 {
+		runsWith += fmt.Sprintf(", set for role '%s'", role.Name)
+	}
+
+	var needed int64
+	var rationale string
+	if len(spills) > 0 {
+		var nodes []string
+		for _, s := range spills {
+			needed = max(needed, spillNeed(s, multiplier))
+			nodes = append(nodes, describeSpill(s))
+		}
+		rationale = fmt.Sprintf("The plan spills to disk: %s.", strings.Join(nodes, "; "))
+		if spillPerCall > 0 {
+			rationale += fmt.Sprintf(" pg_stat_statements counts %s of temp files written per call.", format.Bytes(spillPerCall))
+		}
+		rationale += fmt.Sprintf(" About %s of work_mem would keep the largest in memory, against the %s it runs with.", format.Bytes(needed), runsWith)
+	} else {
+		needed = spillPerCall * sortMemoryFactor
+		rationale = fmt.Sprintf("pg_stat_statements counts %s of temp files written per call (%s over %d calls): sorts or hashes of this statement do not fit the %s of work_mem it runs with. As a single sort it would need about %s; if several nodes spill, each needs less.",
+			format.Bytes(spillPerCall), format.Bytes(query.TempBlksWritten*blockSize), query.Calls, runsWith, format.Bytes(needed))
+	}
+
+	rec := &store.Recommendation{
+		Type:       "temp_spill",
+		Confidence: 0.6,
+		RiskLevel:  "low",
+	}
+	if len(spills) > 0 {
+		rec.Confidence = 0.8
+	}
+	if spillPerCall > 0 {
+		rec.ImpactEstimate = fmt.Sprintf("Avoids about %s of temp file writes per call", format.Bytes(spillPerCall))
+	} else {
+		rec.ImpactEstimate = fmt.Sprintf("Keeps %d spilling plan nodes in memory", len(spills))
+	}
+
+	if needed > maxWorkMem {
+		// More memory is not the fix, so say what the spill costs instead
+		rec.Confidence = 0.5
+		if spillPerCall > 0 {
+			rec.ImpactEstimate = fmt.Sprintf("About %s of temp file writes per call", format.Bytes(spillPerCall))
+		}
+		rec.Rationale = rationale + " That is too much memory to give one operation. Sort or hash less data instead: an index matching the ORDER BY or GROUP BY can remove the sort, and selecting fewer columns or filtering before the join shrinks what is hashed."
+		return rec
+	}
+
+	suggested := roundWorkMem(max(needed, 2*current))
+	setting := pgSize(suggested)
+	rec.DDL = fmt.Sprintf("SET LOCAL work_mem = '%s'; -- in the statement's transaction, before it runs", setting)
+
+	nodes := max(len(spills), 1)
+	rationale += fmt.Sprintf(" Raise it for this statement only. work_mem is a limit per sort or hash node, not per session (hashes may use %g times it): every such node in every backend and parallel worker can take it at once. Server-wide, %s across max_connections = %d could claim up to %s",
+		multiplier, setting, memory.MaxConnections, format.Bytes(suggested*int64(memory.MaxConnections)))
+	if nodes > 1 {
+		rationale += fmt.Sprintf(", and this plan alone has %d such nodes", nodes)
+	}
+	rationale += "."
+	if hasRole {
+		rationale += fmt.Sprintf(" If most statements of role '%s' spill like this one, ALTER ROLE %s SET work_mem = '%s' covers them with the same risk confined to its connections.",
+			role.Name, quoteRole(role.Name), setting)
+	}
+	rec.Rationale = rationale
+	return rec
+}
+
+// spillNeed estimates the work_mem that keeps a spilling node in memory.
+// A hash join holding one batch at a time needs about all of them at once;
+// hash nodes get hash_mem_multiplier times work_mem.
+func spillNeed(s explain.Spill, multiplier float64) int64 {
+	switch s.Kind {
+	case "hash":
+		return int64(float64(s.MemoryKB*1024*s.Batches) / multiplier)
+	case "aggregate":
+		return int64(float64((s.MemoryKB+sortMemoryFactor*s.DiskKB)*1024) / multiplier)
+	}
+	return s.DiskKB * 1024 * sortMemoryFactor
+}
+
+func describeSpill(s explain.Spill) string {
+	switch s.Kind {
+	case "hash":
+		return fmt.Sprintf("%s split into %d batches of %s", s.Node, s.Batches, format.Bytes(s.MemoryKB*1024))
+	case "aggregate":
+		return fmt.Sprintf("%s wrote %s in %d batches", s.Node, format.Bytes(s.DiskKB*1024), s.Batches)
+	}
+	return fmt.Sprintf("%s wrote %s to disk", s.Node, format.Bytes(s.DiskKB*1024))
+}
+
+// roundWorkMem rounds up to a power of two megabytes, at least 4MB, the
+// server default
+func roundWorkMem(bytes int64) int64 {
+	size := int64(4 << 20)
+	for size < bytes {
+		size *= 2
+	}
+	return size
+}
+
+// pgSize writes a size in the units PostgreSQL accepts for memory settings
+func pgSize(bytes int64) string {
+	if bytes%(1<<30) == 0 {
+		return fmt.Sprintf("%dGB", bytes>>30)
+	}
+	return fmt.Sprintf("%dMB", bytes>>20)
+}
+
+func quoteRole(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,55 @@
+package rules
+
+import (
+	"fmt"
+	"time"
+
+	"cli/internal/ash"
+	"cli/internal/store"
+)
+
+// minDominantShare is the share of its active time a statement must spend
+// in one event before the wait_profile rule explains it
+const minDominantShare = 0.3
+
+// detectWaitProfile says what a statement waits on when one event takes a
+// large share of its active time, and what usually helps with that event
+func (re *RuleEngine) detectWaitProfile(ctx *Context) *store.Recommendation {
+	profile := ctx.Waits.ForStatement(re.parser.GenerateFingerprint(ctx.Query.Query), ctx.Query.QueryID)
+	if profile == nil {
+		return nil
+	}
+	dominant := profile.Dominant()
+	advice := ash.Advice(dominant.Event)
+	if dominant.Share < minDominantShare || advice == "" {
+		return nil
+	}
+
+	return &store.Recommendation{
+		Type: "wait_profile",
+		Rationale: fmt.Sprintf("Active session sampling saw this statement %d times over %s: it spends %s. %s",
+			profile.Samples, ctx.Waits.Window.Round(time.Second), profile.Describe(), advice),
+		Confidence:     min(0.9, 0.5+dominant.Share/2),
+		ImpactEstimate: fmt.Sprintf("About %s of database time in %s per %s", dominant.Time.Round(100*time.Millisecond), dominant.Event, ctx.Waits.Window.Round(time.Second)),
+		RiskLevel:      "low",
+	}
+}
+
+// addWaitEvidence appends where the statement spends its time to the
+// rationale of the other recommendations, so a suggested index can be
+// weighed against, say, a statement that mostly waits on locks.
+func (re *RuleEngine) addWaitEvidence(ctx *Context, recommendations []store.Recommendation) {
+	if !ctx.Has(InputWaits) {
+		return
+	}
+	profile := ctx.Waits.ForStatement(re.parser.GenerateFingerprint(ctx.Query.Query), ctx.Query.QueryID)
+	if profile == nil {
+		return
+	}
+	for i, rec := range recommendations {
+		if rec.Type == "wait_profile" {
+			continue
+		}
+		recommendations[i].Rationale += fmt.Sprintf(" Sampled activity: %s.", profile.Describe())
+	}
+}
@@ -0,0 +1,221 @@
+package simulate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"cli/internal/explain"
+	"cli/internal/logger"
+	"cli/internal/store"
+)
+
+// maxConcurrent caps simultaneous simulations so a burst of dashboard
+// requests cannot tie up the sandbox role's connections.
+const maxConcurrent = 3
+
+var (
+	createIndexPattern  = regexp.MustCompile(`(?is)^\s*CREATE\s+(UNIQUE\s+)?INDEX\b`)
+	concurrentlyPattern = regexp.MustCompile(`(?i)\s+CONCURRENTLY\b`)
+	ifNotExistsPattern  = regexp.MustCompile(`(?i)\s+IF\s+NOT\s+EXISTS\b`)
+)
+
+// Result compares the plan of a query before and after a hypothetical index.
+// Costs are planner cost units, not milliseconds: hypopg indexes only exist
+// for the planner, so the query is never executed.
+type Result struct {
+	Query          string        `json:"query"`
+	DDL            string        `json:"ddl"`
+	IndexName      string        `json:"index_name"`
+	IndexSizeBytes int64         `json:"index_size_bytes"`
+	BeforeCost     float64       `json:"before_cost"`
+	AfterCost      float64       `json:"after_cost"`
+	ImprovementPct float64       `json:"improvement_pct"`
+	IndexUsed      bool          `json:"index_used"`
+	PlanChanges    []string      `json:"plan_changes"`
+	Before         explain.Facts `json:"before"`
+	After          explain.Facts `json:"after"`
+	Notes          []string      `json:"notes,omitempty"`
+	DurationMS     float64       `json:"duration_ms"`
+}
+
+type Simulator struct {
+	db        *sql.DB
+	explainer *explain.Explainer
+	slots     chan struct{}
+}
+
+// NewSimulator expects a connection as profiler_sb with the hypopg
+// extension installed in the target database.
+func NewSimulator(db *sql.DB, timeout time.Duration) *Simulator {
+	return &Simulator{
+		db:        db,
+		explainer: explain.NewExplainer(db, explain.Options{StatementTimeout: timeout}),
+		slots:     make(chan struct{}, maxConcurrent),
+	}
+}
+
+// Available reports whether hypopg is installed in the connected database.
+func (s *Simulator) Available() error {
+	var installed bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'hypopg')`).Scan(&installed)
+	if err != nil {
+		return fmt.Errorf("failed to check for hypopg: %w", err)
+	}
+	if !installed {
+		return fmt.Errorf("hypopg extension is not installed (CREATE EXTENSION hypopg)")
+	}
+	return nil
+}
+
+// Simulate runs a baseline EXPLAIN, creates the recommendation's index with
+// hypopg_create_index, explains again and compares the two plans. All steps
+// run on one session, because hypothetical indexes are backend-local, and
+// hypopg_reset is always called before the connection goes back to the pool.
+func (s *Simulator) Simulate(query string, rec store.Recommendation) (*Result, error) {
+	ddl, err := hypotheticalDDL(rec.DDL)
+	if err != nil {
+		return nil, err
+	}
+
+	s.slots <- struct{}{}
+	defer func() { <-s.slots }()
+
+	start := time.Now()
+	logger.LogInfof("Simulating %s", ddl)
+
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		logger.LogErrorf("Failed to get sandbox connection: %v", err)
+		return nil, fmt.Errorf("failed to get sandbox connection: %w", err)
+	}
+	defer conn.Close()
+
+	// Clear anything a previous, interrupted run might have left behind
+	if _, err := conn.ExecContext(ctx, `SELECT hypopg_reset()`); err != nil {
+		logger.LogErrorf("hypopg_reset failed: %v", err)
+		return nil, fmt.Errorf("hypopg unavailable: %w", err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), `SELECT hypopg_reset()`); err != nil {
+			logger.LogErrorf("Failed to reset hypothetical indexes: %v", err)
+		}
+	}()
+
+	before, err := s.explainer.ExplainOn(conn, query)
+	if err != nil {
+		return nil, fmt.Errorf("baseline explain failed: %w", err)
+	}
+
+	result := &Result{Query: query, DDL: ddl}
+
+	var indexRelID int64
+	err = conn.QueryRowContext(ctx, `SELECT indexrelid, indexname FROM hypopg_create_index($1)`, ddl).
+		Scan(&indexRelID, &result.IndexName)
+	if err != nil {
+		logger.LogErrorf("hypopg_create_index failed: %v", err)
+		return nil, fmt.Errorf("failed to create hypothetical index: %w", err)
+	}
+
+	if err := conn.QueryRowContext(ctx, `SELECT hypopg_relation_size($1)`, indexRelID).Scan(&result.IndexSizeBytes); err != nil {
+		logger.LogDebugf("hypopg_relation_size failed: %v", err)
+	}
+
+	after, err := s.explainer.ExplainOn(conn, query)
+	if err != nil {
+		return nil, fmt.Errorf("explain with hypothetical index failed: %w", err)
+	}
+
+	result.Before = before.Facts()
+	result.After = after.Facts()
+	result.BeforeCost = result.Before.TotalCost
+	result.AfterCost = result.After.TotalCost
+	if result.BeforeCost > 0 {
+		result.ImprovementPct = (result.BeforeCost - result.AfterCost) / result.BeforeCost * 100
+	}
+	for _, idx := range result.After.IndexesUsed {
+		if idx == result.IndexName {
+			result.IndexUsed = true
+		}
+	}
+	result.PlanChanges = PlanChanges(before, after)
+
+	if !result.IndexUsed {
+		result.Notes = append(result.Notes, "The planner did not choose the hypothetical index")
+	}
+	if rec.RiskLevel == "medium" || rec.RiskLevel == "high" {
+		result.Notes = append(result.Notes, fmt.Sprintf("Recommendation risk is %s: the index adds write overhead on every insert and update", rec.RiskLevel))
+	}
+	result.DurationMS = float64(time.Since(start).Microseconds()) / 1000
+
+	logger.LogInfof("Simulation finished: cost %.2f -> %.2f (%.1f%%)", result.BeforeCost, result.AfterCost, result.ImprovementPct)
+	return result, nil
+}
+
+// Supports reports whether a recommendation's DDL can be simulated.
+func Supports(rec store.Recommendation) bool {
+	_, err := hypotheticalDDL(rec.DDL)
+	return err == nil
+}
+
+// hypotheticalDDL accepts a single CREATE INDEX statement and strips the
+// clauses hypopg does not understand.
+func hypotheticalDDL(ddl string) (string, error) {
+	ddl = strings.TrimSpace(ddl)
+	ddl = strings.TrimSpace(strings.TrimSuffix(ddl, ";"))
+	if ddl == "" {
+		return "", fmt.Errorf("recommendation has no DDL to simulate")
+	}
+	if strings.Contains(ddl, ";") {
+		return "", fmt.Errorf("only a single CREATE INDEX statement can be simulated")
+	}
+	if !createIndexPattern.MatchString(ddl) {
+		return "", fmt.Errorf("only CREATE INDEX statements can be simulated")
+	}
+
+	ddl = concurrentlyPattern.ReplaceAllString(ddl, "")
+	ddl = ifNotExistsPattern.ReplaceAllString(ddl, "")
+	return ddl, nil
+}
+
+// PlanChanges labels how the access path to each relation changed, e.g.
+// "Seq Scan → Index Scan on orders", plus a change of the plan's root node.
+func PlanChanges(before, after *explain.Plan) []string {
+	beforeScans := scanTypes(before)
+	afterScans := scanTypes(after)
+
+	var changes []string
+	for rel, from := range beforeScans {
+		if to, ok := afterScans[rel]; ok && to != from {
+			changes = append(changes, fmt.Sprintf("%s → %s on %s", from, to, rel))
+		}
+	}
+	sort.Strings(changes)
+
+	// Scan roots are already covered above
+	if before.Root.NodeType != after.Root.NodeType && before.Root.RelationName == "" {
+		changes = append(changes, fmt.Sprintf("%s → %s", before.Root.Label(), after.Root.Label()))
+	}
+	return changes
+}
+
+// scanTypes maps each relation to the node type used to read it. Bitmap
+// heap scans are attributed to their relation like any other scan.
+func scanTypes(plan *explain.Plan) map[string]string {
+	scans := make(map[string]string)
+	plan.Walk(func(n *explain.Node, depth int) {
+		if n.RelationName == "" {
+			return
+		}
+		rel := n.QualifiedRelation()
+		if _, seen := scans[rel]; !seen {
+			scans[rel] = n.NodeType
+		}
+	})
+	return scans
+}
@@ -0,0 +1,266 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+
+	"cli/internal/logger"
+)
+
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// migrations are applied in order and must never be edited once released;
+// schema changes go in a new entry with the next version number.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_core_tables",
+		SQL: `
+			CREATE TABLE optidb_meta.snapshots (
+				id          BIGSERIAL PRIMARY KEY,
+				source      TEXT NOT NULL,
+				captured_at TIMESTAMPTZ NOT NULL DEFAULT now()
+			);
+
+			CREATE TABLE optidb_meta.queries (
+				id          BIGSERIAL PRIMARY KEY,
+				fingerprint TEXT NOT NULL UNIQUE,
+				raw_sql     TEXT NOT NULL,
+				norm_sql    TEXT,
+				query_hash  BIGINT,
+				first_seen  TIMESTAMPTZ NOT NULL,
+				last_seen   TIMESTAMPTZ NOT NULL
+			);
+
+			CREATE TABLE optidb_meta.query_metrics (
+				id                BIGSERIAL PRIMARY KEY,
+				snapshot_id       BIGINT NOT NULL REFERENCES optidb_meta.snapshots(id) ON DELETE CASCADE,
+				query_id          BIGINT NOT NULL REFERENCES optidb_meta.queries(id) ON DELETE CASCADE,
+				mean_ms           DOUBLE PRECISION NOT NULL,
+				calls             BIGINT NOT NULL,
+				rows_returned     BIGINT NOT NULL DEFAULT 0,
+				total_ms          DOUBLE PRECISION NOT NULL,
+				shared_blks_hit   BIGINT NOT NULL DEFAULT 0,
+				shared_blks_read  BIGINT NOT NULL DEFAULT 0,
+				temp_blks_read    BIGINT NOT NULL DEFAULT 0,
+				temp_blks_written BIGINT NOT NULL DEFAULT 0,
+				captured_at       TIMESTAMPTZ NOT NULL
+			);
+			CREATE INDEX query_metrics_query_id_captured_at_idx
+				ON optidb_meta.query_metrics (query_id, captured_at DESC);
+
+			CREATE TABLE optidb_meta.query_plans (
+				id           BIGSERIAL PRIMARY KEY,
+				snapshot_id  BIGINT REFERENCES optidb_meta.snapshots(id) ON DELETE CASCADE,
+				query_id     BIGINT NOT NULL REFERENCES optidb_meta.queries(id) ON DELETE CASCADE,
+				plan_json    JSONB NOT NULL,
+				had_seq_scan BOOLEAN NOT NULL DEFAULT false,
+				est_rows     BIGINT NOT NULL DEFAULT 0,
+				act_rows     BIGINT NOT NULL DEFAULT 0,
+				buffers_hit  BIGINT NOT NULL DEFAULT 0,
+				buffers_read BIGINT NOT NULL DEFAULT 0,
+				captured_at  TIMESTAMPTZ NOT NULL
+			);
+			CREATE INDEX query_plans_query_id_captured_at_idx
+				ON optidb_meta.query_plans (query_id, captured_at DESC);
+
+			CREATE TABLE optidb_meta.schema_tables (
+				id            BIGSERIAL PRIMARY KEY,
+				snapshot_id   BIGINT NOT NULL REFERENCES optidb_meta.snapshots(id) ON DELETE CASCADE,
+				schema_name   TEXT NOT NULL,
+				table_name    TEXT NOT NULL,
+				rows_est      BIGINT NOT NULL DEFAULT 0,
+				bytes         BIGINT NOT NULL DEFAULT 0,
+				last_analyzed TIMESTAMPTZ,
+				captured_at   TIMESTAMPTZ NOT NULL
+			);
+
+			CREATE TABLE optidb_meta.schema_indexes (
+				id             BIGSERIAL PRIMARY KEY,
+				snapshot_id    BIGINT NOT NULL REFERENCES optidb_meta.snapshots(id) ON DELETE CASCADE,
+				schema_name    TEXT NOT NULL,
+				index_name     TEXT NOT NULL,
+				table_name     TEXT NOT NULL,
+				cols           TEXT[] NOT NULL DEFAULT '{}',
+				is_unique      BOOLEAN NOT NULL DEFAULT false,
+				is_primary     BOOLEAN NOT NULL DEFAULT false,
+				size_bytes     BIGINT NOT NULL DEFAULT 0,
+				scans          BIGINT NOT NULL DEFAULT 0,
+				tuples_read    BIGINT NOT NULL DEFAULT 0,
+				tuples_fetched BIGINT NOT NULL DEFAULT 0,
+				captured_at    TIMESTAMPTZ NOT NULL
+			);
+
+			CREATE TABLE optidb_meta.recommendations (
+				id              BIGSERIAL PRIMARY KEY,
+				snapshot_id     BIGINT REFERENCES optidb_meta.snapshots(id) ON DELETE CASCADE,
+				query_id        BIGINT REFERENCES optidb_meta.queries(id) ON DELETE CASCADE,
+				type            TEXT NOT NULL,
+				ddl             TEXT,
+				rewrite_sql     TEXT,
+				rationale       TEXT NOT NULL,
+				confidence      DOUBLE PRECISION NOT NULL,
+				impact_estimate TEXT,
+				risk_level      TEXT NOT NULL,
+				created_at      TIMESTAMPTZ NOT NULL
+			);
+			CREATE INDEX recommendations_query_id_created_at_idx
+				ON optidb_meta.recommendations (query_id, created_at DESC);
+		`,
+	},
+	{
+		Version: 2,
+		Name:    "add_full_statement_metrics",
+		SQL: `
+			ALTER TABLE optidb_meta.query_metrics
+				ADD COLUMN min_ms        DOUBLE PRECISION NOT NULL DEFAULT 0,
+				ADD COLUMN max_ms        DOUBLE PRECISION NOT NULL DEFAULT 0,
+				ADD COLUMN stddev_ms     DOUBLE PRECISION NOT NULL DEFAULT 0,
+				ADD COLUMN plans         BIGINT NOT NULL DEFAULT 0,
+				ADD COLUMN total_plan_ms DOUBLE PRECISION NOT NULL DEFAULT 0,
+				ADD COLUMN blk_read_ms   DOUBLE PRECISION NOT NULL DEFAULT 0,
+				ADD COLUMN blk_write_ms  DOUBLE PRECISION NOT NULL DEFAULT 0,
+				ADD COLUMN wal_records   BIGINT NOT NULL DEFAULT 0,
+				ADD COLUMN wal_bytes     BIGINT NOT NULL DEFAULT 0;
+
+			CREATE INDEX queries_query_hash_idx ON optidb_meta.queries (query_hash);
+		`,
+	},
+	{
+		Version: 3,
+		Name:    "add_plan_facts",
+		SQL: `
+			ALTER TABLE optidb_meta.query_plans
+				ADD COLUMN had_index_scan BOOLEAN NOT NULL DEFAULT false,
+				ADD COLUMN join_types     TEXT[] NOT NULL DEFAULT '{}',
+				ADD COLUMN total_cost     DOUBLE PRECISION NOT NULL DEFAULT 0,
+				ADD COLUMN max_row_skew   DOUBLE PRECISION NOT NULL DEFAULT 0,
+				ADD COLUMN temp_blocks    BIGINT NOT NULL DEFAULT 0,
+				ADD COLUMN analyzed       BOOLEAN NOT NULL DEFAULT false,
+				ADD COLUMN execution_ms   DOUBLE PRECISION NOT NULL DEFAULT 0;
+		`,
+	},
+	{
+		Version: 4,
+		Name:    "create_log_samples",
+		SQL: `
+			CREATE TABLE optidb_meta.log_samples (
+				id            BIGSERIAL PRIMARY KEY,
+				snapshot_id   BIGINT REFERENCES optidb_meta.snapshots(id) ON DELETE CASCADE,
+				query_id      BIGINT NOT NULL REFERENCES optidb_meta.queries(id) ON DELETE CASCADE,
+				logged_at     TIMESTAMPTZ NOT NULL,
+				duration_ms   DOUBLE PRECISION NOT NULL,
+				user_name     TEXT,
+				database_name TEXT,
+				parameters    TEXT[] NOT NULL DEFAULT '{}',
+				has_plan      BOOLEAN NOT NULL DEFAULT false,
+				source_file   TEXT
+			);
+			CREATE INDEX log_samples_query_id_logged_at_idx
+				ON optidb_meta.log_samples (query_id, logged_at DESC);
+		`,
+	},
+	{
+		Version: 5,
+		Name:    "add_recommendation_rule_id",
+		SQL: `
+			ALTER TABLE optidb_meta.recommendations
+				ADD COLUMN rule_id TEXT;
+		`,
+	},
+	{
+		Version: 6,
+		Name:    "add_schema_table_statistics",
+		SQL: `
+			ALTER TABLE optidb_meta.schema_tables
+				ADD COLUMN toast_bytes      BIGINT NOT NULL DEFAULT 0,
+				ADD COLUMN live_tuples      BIGINT NOT NULL DEFAULT 0,
+				ADD COLUMN dead_tuples      BIGINT NOT NULL DEFAULT 0,
+				ADD COLUMN reltuples        DOUBLE PRECISION NOT NULL DEFAULT 0,
+				ADD COLUMN relpages         BIGINT NOT NULL DEFAULT 0,
+				ADD COLUMN seq_scan         BIGINT NOT NULL DEFAULT 0,
+				ADD COLUMN seq_tup_read     BIGINT NOT NULL DEFAULT 0,
+				ADD COLUMN idx_scan         BIGINT NOT NULL DEFAULT 0,
+				ADD COLUMN last_vacuumed    TIMESTAMPTZ;
+		`,
+	},
+}
+
+// Migrate brings the meta store schema up to the latest version. Each
+// migration runs in its own transaction and is recorded in
+// optidb_meta.schema_migrations so it is only ever applied once.
+func Migrate(db *sql.DB) error {
+	logger.LogInfo("Running meta store migrations")
+
+	bootstrap := `
+		CREATE SCHEMA IF NOT EXISTS optidb_meta;
+		CREATE TABLE IF NOT EXISTS optidb_meta.schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+	`
+	if _, err := db.Exec(bootstrap); err != nil {
+		logger.LogErrorf("Failed to bootstrap meta schema: %v", err)
+		return fmt.Errorf("failed to bootstrap meta schema: %w", err)
+	}
+
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	applied := 0
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+
+		logger.LogInfof("Applying meta store migration %d (%s)", m.Version, m.Name)
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %d: %w", m.Version, err)
+		}
+
+		if _, err := tx.Exec(m.SQL); err != nil {
+			tx.Rollback()
+			logger.LogErrorf("Migration %d (%s) failed: %v", m.Version, m.Name, err)
+			return fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+
+		if _, err := tx.Exec(`INSERT INTO optidb_meta.schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %w", m.Version, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", m.Version, err)
+		}
+		applied++
+	}
+
+	logger.LogInfof("Meta store is at version %d (%d migrations applied)", LatestSchemaVersion(), applied)
+	return nil
+}
+
+// SchemaVersion returns the highest applied migration version, or 0 for a
+// fresh meta store.
+func SchemaVersion(db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM optidb_meta.schema_migrations`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read meta schema version: %w", err)
+	}
+	return version, nil
+}
+
+func LatestSchemaVersion() int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
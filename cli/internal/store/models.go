@@ -4,6 +4,12 @@ import (
 	"time"
 )
 
+type Snapshot struct {
+	ID         int64     `json:"id"`
+	Source     string    `json:"source"`
+	CapturedAt time.Time `json:"captured_at"`
+}
+
 type Query struct {
 	ID          int64     `json:"id"`
 	Fingerprint string    `json:"fingerprint"`
@@ -16,6 +22,7 @@ type Query struct {
 
 type QueryMetrics struct {
 	ID              int64     `json:"id"`
+	SnapshotID      int64     `json:"snapshot_id,omitempty"`
 	QueryID         int64     `json:"query_id"`
 	MeanMS          float64   `json:"mean_ms"`
 	Calls           int64     `json:"calls"`
@@ -25,23 +32,55 @@ type QueryMetrics struct {
 	SharedBlksRead  int64     `json:"shared_blks_read,omitempty"`
 	TempBlksRead    int64     `json:"temp_blks_read,omitempty"`
 	TempBlksWritten int64     `json:"temp_blks_written,omitempty"`
+	MinMS           float64   `json:"min_ms,omitempty"`
+	MaxMS           float64   `json:"max_ms,omitempty"`
+	StddevMS        float64   `json:"stddev_ms,omitempty"`
+	Plans           int64     `json:"plans,omitempty"`
+	TotalPlanMS     float64   `json:"total_plan_ms,omitempty"`
+	BlkReadMS       float64   `json:"blk_read_ms,omitempty"`
+	BlkWriteMS      float64   `json:"blk_write_ms,omitempty"`
+	WALRecords      int64     `json:"wal_records,omitempty"`
+	WALBytes        int64     `json:"wal_bytes,omitempty"`
 	CapturedAt      time.Time `json:"captured_at"`
 }
 
 type QueryPlan struct {
-	ID          int64     `json:"id"`
-	QueryID     int64     `json:"query_id"`
-	PlanJSON    string    `json:"plan_json"`
-	HadSeqScan  bool      `json:"had_seq_scan"`
-	EstRows     int64     `json:"est_rows,omitempty"`
-	ActRows     int64     `json:"act_rows,omitempty"`
-	BuffersHit  int64     `json:"buffers_hit,omitempty"`
-	BuffersRead int64     `json:"buffers_read,omitempty"`
-	CapturedAt  time.Time `json:"captured_at"`
+	ID           int64     `json:"id"`
+	SnapshotID   int64     `json:"snapshot_id,omitempty"`
+	QueryID      int64     `json:"query_id"`
+	PlanJSON     string    `json:"plan_json"`
+	HadSeqScan   bool      `json:"had_seq_scan"`
+	HadIndexScan bool      `json:"had_index_scan"`
+	JoinTypes    []string  `json:"join_types,omitempty"`
+	TotalCost    float64   `json:"total_cost"`
+	EstRows      int64     `json:"est_rows,omitempty"`
+	ActRows      int64     `json:"act_rows,omitempty"`
+	MaxRowSkew   float64   `json:"max_row_skew,omitempty"`
+	BuffersHit   int64     `json:"buffers_hit,omitempty"`
+	BuffersRead  int64     `json:"buffers_read,omitempty"`
+	TempBlocks   int64     `json:"temp_blocks,omitempty"`
+	Analyzed     bool      `json:"analyzed"`
+	ExecutionMS  float64   `json:"execution_ms,omitempty"`
+	CapturedAt   time.Time `json:"captured_at"`
+}
+
+// LogSample is one statement execution recovered from the server log.
+type LogSample struct {
+	ID           int64     `json:"id"`
+	SnapshotID   int64     `json:"snapshot_id,omitempty"`
+	QueryID      int64     `json:"query_id"`
+	LoggedAt     time.Time `json:"logged_at"`
+	DurationMS   float64   `json:"duration_ms"`
+	UserName     string    `json:"user_name,omitempty"`
+	DatabaseName string    `json:"database_name,omitempty"`
+	Parameters   []string  `json:"parameters,omitempty"`
+	HasPlan      bool      `json:"has_plan"`
+	SourceFile   string    `json:"source_file,omitempty"`
 }
 
 type SchemaTable struct {
 	ID           int64     `json:"id"`
+	SnapshotID   int64     `json:"snapshot_id,omitempty"`
 	SchemaName   string    `json:"schema_name"`
 	TableName    string    `json:"table_name"`
 	RowsEst      int64     `json:"rows_est,omitempty"`
@@ -52,6 +91,7 @@ type SchemaTable struct {
 
 type SchemaIndex struct {
 	ID            int64     `json:"id"`
+	SnapshotID    int64     `json:"snapshot_id,omitempty"`
 	SchemaName    string    `json:"schema_name"`
 	IndexName     string    `json:"index_name"`
 	TableName     string    `json:"table_name"`
@@ -67,7 +107,9 @@ type SchemaIndex struct {
 
 type Recommendation struct {
 	ID             int64     `json:"id"`
+	SnapshotID     int64     `json:"snapshot_id,omitempty"`
 	QueryID        int64     `json:"query_id,omitempty"`
+	RuleID         string    `json:"rule_id,omitempty"`
 	Type           string    `json:"type"`
 	DDL            string    `json:"ddl,omitempty"`
 	RewriteSQL     string    `json:"rewrite_sql,omitempty"`
@@ -79,22 +121,89 @@ type Recommendation struct {
 }
 
 type QueryStats struct {
-	Query          string  `json:"query"`
-	Calls          int64   `json:"calls"`
-	MeanExecTime   float64 `json:"mean_exec_time"`
-	TotalTime      float64 `json:"total_time"`
-	Rows           int64   `json:"rows"`
-	SharedBlksHit  int64   `json:"shared_blks_hit"`
-	SharedBlksRead int64   `json:"shared_blks_read"`
+	QueryID           int64   `json:"queryid,omitempty"`
+	UserID            int64   `json:"userid,omitempty"`
+	DBID              int64   `json:"dbid,omitempty"`
+	TopLevel          bool    `json:"toplevel"`
+	Query             string  `json:"query"`
+	Calls             int64   `json:"calls"`
+	MeanExecTime      float64 `json:"mean_exec_time"`
+	TotalTime         float64 `json:"total_time"`
+	MinExecTime       float64 `json:"min_exec_time"`
+	MaxExecTime       float64 `json:"max_exec_time"`
+	StddevExecTime    float64 `json:"stddev_exec_time"`
+	Rows              int64   `json:"rows"`
+	Plans             int64   `json:"plans"`
+	TotalPlanTime     float64 `json:"total_plan_time"`
+	MeanPlanTime      float64 `json:"mean_plan_time"`
+	SharedBlksHit     int64   `json:"shared_blks_hit"`
+	SharedBlksRead    int64   `json:"shared_blks_read"`
+	SharedBlksDirtied int64   `json:"shared_blks_dirtied"`
+	SharedBlksWritten int64   `json:"shared_blks_written"`
+	LocalBlksHit      int64   `json:"local_blks_hit"`
+	LocalBlksRead     int64   `json:"local_blks_read"`
+	LocalBlksDirtied  int64   `json:"local_blks_dirtied"`
+	LocalBlksWritten  int64   `json:"local_blks_written"`
+	TempBlksRead      int64   `json:"temp_blks_read"`
+	TempBlksWritten   int64   `json:"temp_blks_written"`
+	BlkReadTime       float64 `json:"blk_read_time"`
+	BlkWriteTime      float64 `json:"blk_write_time"`
+	WALRecords        int64   `json:"wal_records"`
+	WALFPI            int64   `json:"wal_fpi"`
+	WALBytes          int64   `json:"wal_bytes"`
 }
 
+// TableInfo describes a table's size and activity. RowCount is the best
+// available estimate of the rows in the table; the other fields are the raw
+// catalog and statistics counters it is derived from.
 type TableInfo struct {
 	SchemaName string `json:"schema_name"`
 	TableName  string `json:"table_name"`
 	RowCount   int64  `json:"row_count"`
 	SizeBytes  int64  `json:"size_bytes"`
+	ToastBytes int64  `json:"toast_bytes,omitempty"`
+
+	LiveTuples int64   `json:"n_live_tup"`
+	DeadTuples int64   `json:"n_dead_tup"`
+	RelTuples  float64 `json:"reltuples"` // -1 until first analyzed on PostgreSQL 14+
+	RelPages   int64   `json:"relpages"`
+
+	SeqScans   int64 `json:"seq_scan"`
+	SeqTupRead int64 `json:"seq_tup_read"`
+	IdxScans   int64 `json:"idx_scan"`
+
+	// Rows written since the stats reset
+	Inserts int64 `json:"n_tup_ins"`
+	Updates int64 `json:"n_tup_upd"`
+	Deletes int64 `json:"n_tup_del"`
+
+	LastVacuum      *time.Time `json:"last_vacuum,omitempty"`
+	LastAutovacuum  *time.Time `json:"last_autovacuum,omitempty"`
+	LastAnalyze     *time.Time `json:"last_analyze,omitempty"`
+	LastAutoanalyze *time.Time `json:"last_autoanalyze,omitempty"`
+}
+
+// LastAnalyzed returns the most recent manual or automatic ANALYZE, or nil
+// when the table has never been analyzed.
+func (t TableInfo) LastAnalyzed() *time.Time {
+	return latest(t.LastAnalyze, t.LastAutoanalyze)
 }
 
+// LastVacuumed returns the most recent manual or automatic VACUUM, or nil
+// when the table has never been vacuumed.
+func (t TableInfo) LastVacuumed() *time.Time {
+	return latest(t.LastVacuum, t.LastAutovacuum)
+}
+
+func latest(a, b *time.Time) *time.Time {
+	if a == nil || (b != nil && b.After(*a)) {
+		return b
+	}
+	return a
+}
+
+// IndexInfo describes an index and its usage. Columns lists the key columns
+// followed by any INCLUDE columns; expressions appear in their SQL form.
 type IndexInfo struct {
 	SchemaName  string   `json:"schema_name"`
 	TableName   string   `json:"table_name"`
@@ -106,4 +215,389 @@ type IndexInfo struct {
 	IndexScans  int64    `json:"index_scans"`
 	TuplesRead  int64    `json:"tuples_read"`
 	TuplesFetch int64    `json:"tuples_fetch"`
+
+	Method     string   `json:"method,omitempty"`      // btree, hash, gin, ...
+	KeyColumns int      `json:"key_columns,omitempty"` // 0 when every column is a key column
+	OpClasses  []string `json:"opclasses,omitempty"`   // per key column, empty for the default
+	Predicate  string   `json:"predicate,omitempty"`   // WHERE clause of a partial index
+	Definition string   `json:"definition,omitempty"`
+
+	// Constraint names the unique, primary key or exclusion constraint the
+	// index enforces, or a foreign key that depends on it; such an index
+	// cannot be dropped on its own.
+	Constraint      string `json:"constraint,omitempty"`
+	ReplicaIdentity bool   `json:"replica_identity,omitempty"`
+	Invalid         bool   `json:"invalid,omitempty"` // a failed CREATE INDEX CONCURRENTLY
+
+	// UsageUnknown is set when the scan counters could not be read, so
+	// IndexScans is not evidence that the index is unused
+	UsageUnknown bool       `json:"usage_unknown,omitempty"`
+	StatsReset   *time.Time `json:"stats_reset,omitempty"` // since when IndexScans counts
+}
+
+// Keys returns the key columns, without INCLUDE columns
+func (i IndexInfo) Keys() []string {
+	if i.KeyColumns <= 0 || i.KeyColumns > len(i.Columns) {
+		return i.Columns
+	}
+	return i.Columns[:i.KeyColumns]
+}
+
+// Included returns the INCLUDE columns
+func (i IndexInfo) Included() []string {
+	return i.Columns[len(i.Keys()):]
+}
+
+// ForeignKey is a foreign key constraint. Columns are on the referencing
+// (child) table, RefColumns the matching columns of the parent.
+type ForeignKey struct {
+	SchemaName     string   `json:"schema_name"`
+	TableName      string   `json:"table_name"`
+	ConstraintName string   `json:"constraint_name"`
+	Columns        []string `json:"columns"`
+	RefSchemaName  string   `json:"ref_schema_name"`
+	RefTableName   string   `json:"ref_table_name"`
+	RefColumns     []string `json:"ref_columns"`
+	OnDelete       string   `json:"on_delete"` // NO ACTION, RESTRICT, CASCADE, SET NULL or SET DEFAULT
+	OnUpdate       string   `json:"on_update"`
+}
+
+// Bloat sources
+const (
+	BloatEstimated   = "estimate"    // statistics-based estimation query
+	BloatPgstattuple = "pgstattuple" // measured by the pgstattuple extension
+	BloatDataFree    = "data_free"   // InnoDB free space in information_schema.TABLES
+)
+
+// BloatEstimate is the space a table or index holds beyond what its live
+// rows need at its fill factor. IndexName is empty for the table itself.
+type BloatEstimate struct {
+	SchemaName  string `json:"schema_name"`
+	TableName   string `json:"table_name"`
+	IndexName   string `json:"index_name,omitempty"`
+	SizeBytes   int64  `json:"size_bytes"`
+	WastedBytes int64  `json:"wasted_bytes"`
+	// DeadTupleBytes is the part of the waste held by dead rows, which a
+	// plain VACUUM frees for reuse; only pgstattuple measures it
+	DeadTupleBytes int64  `json:"dead_tuple_bytes,omitempty"`
+	FillFactor     int    `json:"fill_factor,omitempty"`
+	Source         string `json:"source"`
+}
+
+// BloatRatio is the wasted fraction of the relation
+func (b BloatEstimate) BloatRatio() float64 {
+	if b.SizeBytes <= 0 {
+		return 0
+	}
+	return float64(b.WastedBytes) / float64(b.SizeBytes)
+}
+
+// VacuumHealth is the vacuum and freeze state of a PostgreSQL server: how
+// close each database is to transaction ID wraparound, how far behind
+// autovacuum is per table, and the vacuums running right now.
+type VacuumHealth struct {
+	CapturedAt time.Time        `json:"captured_at"`
+	Settings   VacuumSettings   `json:"settings"`
+	Databases  []DatabaseFreeze `json:"databases"`
+	Tables     []TableVacuum    `json:"tables"`
+	Running    []VacuumProgress `json:"running,omitempty"`
+}
+
+// VacuumSettings are the server-wide autovacuum settings
+type VacuumSettings struct {
+	Autovacuum            bool    `json:"autovacuum"`
+	ScaleFactor           float64 `json:"autovacuum_vacuum_scale_factor"`
+	Threshold             int64   `json:"autovacuum_vacuum_threshold"`
+	FreezeMaxAge          int64   `json:"autovacuum_freeze_max_age"`
+	MultixactFreezeMaxAge int64   `json:"autovacuum_multixact_freeze_max_age"`
+	MaxWorkers            int     `json:"autovacuum_max_workers"`
+	CostLimit             int     `json:"autovacuum_vacuum_cost_limit"` // vacuum_cost_limit when set to -1
+}
+
+// DatabaseFreeze is the age of a database's oldest unfrozen transaction
+// and multixact IDs. Both wrap around at 2^31.
+type DatabaseFreeze struct {
+	Name    string `json:"name"`
+	XIDAge  int64  `json:"xid_age"`  // age(datfrozenxid)
+	MXIDAge int64  `json:"mxid_age"` // mxid_age(datminmxid)
+}
+
+// TableVacuum is the vacuum state of one table. XIDAge covers the table's
+// TOAST relation too. The override fields are the table's storage
+// parameters, nil where the server setting applies.
+type TableVacuum struct {
+	SchemaName string `json:"schema_name"`
+	TableName  string `json:"table_name"`
+	SizeBytes  int64  `json:"size_bytes"`
+
+	LiveTuples      int64 `json:"n_live_tup"`
+	DeadTuples      int64 `json:"n_dead_tup"`
+	ModSinceAnalyze int64 `json:"n_mod_since_analyze"`
+	XIDAge          int64 `json:"xid_age"`
+	MXIDAge         int64 `json:"mxid_age"`
+
+	LastVacuum      *time.Time `json:"last_vacuum,omitempty"`
+	LastAutovacuum  *time.Time `json:"last_autovacuum,omitempty"`
+	LastAnalyze     *time.Time `json:"last_analyze,omitempty"`
+	LastAutoanalyze *time.Time `json:"last_autoanalyze,omitempty"`
+	AutovacuumCount int64      `json:"autovacuum_count"`
+
+	AutovacuumEnabled *bool    `json:"autovacuum_enabled,omitempty"`
+	ScaleFactor       *float64 `json:"autovacuum_vacuum_scale_factor,omitempty"`
+	Threshold         *int64   `json:"autovacuum_vacuum_threshold,omitempty"`
+	CostLimit         *int     `json:"autovacuum_vacuum_cost_limit,omitempty"`
+}
+
+// DeadRatio is the share of the table's rows that are dead
+func (t TableVacuum) DeadRatio() float64 {
+	total := t.LiveTuples + t.DeadTuples
+	if total == 0 {
+		return 0
+	}
+	return float64(t.DeadTuples) / float64(total)
+}
+
+// VacuumProgress is a vacuum running now, from pg_stat_progress_vacuum.
+// Tables in other databases are only known by their OID.
+type VacuumProgress struct {
+	PID              int        `json:"pid"`
+	Database         string     `json:"database"`
+	SchemaName       string     `json:"schema_name,omitempty"`
+	TableName        string     `json:"table_name"`
+	Phase            string     `json:"phase"`
+	HeapBlksTotal    int64      `json:"heap_blks_total"`
+	HeapBlksScanned  int64      `json:"heap_blks_scanned"`
+	HeapBlksVacuumed int64      `json:"heap_blks_vacuumed"`
+	IndexVacuumCount int64      `json:"index_vacuum_count"`
+	Started          *time.Time `json:"started,omitempty"`
+	Autovacuum       bool       `json:"autovacuum"`
+	Wraparound       bool       `json:"wraparound"` // an autovacuum "to prevent wraparound"
+}
+
+// ActivitySample is one look at the sessions of a server: every backend
+// that was not idle, and what it was waiting for.
+type ActivitySample struct {
+	CapturedAt time.Time `json:"captured_at"`
+	Sessions   []Session `json:"sessions"`
+}
+
+// Session is one backend from pg_stat_activity, or a MySQL connection from
+// the process list. The lock fields are set when it waits for a lock.
+type Session struct {
+	PID           int        `json:"pid"`
+	BackendType   string     `json:"backend_type,omitempty"`
+	User          string     `json:"user,omitempty"`
+	Database      string     `json:"database,omitempty"`
+	Application   string     `json:"application,omitempty"`
+	State         string     `json:"state"`
+	WaitEventType string     `json:"wait_event_type,omitempty"`
+	WaitEvent     string     `json:"wait_event,omitempty"`
+	QueryID       int64      `json:"queryid,omitempty"` // PostgreSQL 14+ with compute_query_id
+	Query         string     `json:"query"`
+	XactStart     *time.Time `json:"xact_start,omitempty"`
+	QueryStart    *time.Time `json:"query_start,omitempty"`
+	StateChange   *time.Time `json:"state_change,omitempty"`
+	// BlockedBy lists the sessions holding or queued ahead for the lock
+	// this one waits for, from pg_blocking_pids
+	BlockedBy []int      `json:"blocked_by,omitempty"`
+	LockType  string     `json:"lock_type,omitempty"` // relation, tuple, transactionid, ...
+	LockMode  string     `json:"lock_mode,omitempty"`
+	Relation  string     `json:"relation,omitempty"`
+	WaitStart *time.Time `json:"wait_start,omitempty"` // PostgreSQL 14+
+	// XminAge is the age of the oldest transaction ID the session keeps
+	// vacuum from cleaning up after, its backend_xmin or backend_xid
+	XminAge int64 `json:"xmin_age,omitempty"`
+}
+
+// TransactionHorizon is what holds back the oldest transaction ID vacuum
+// must keep rows for: open transactions, replication slots and prepared
+// transactions, with the timeouts that would end them.
+type TransactionHorizon struct {
+	CapturedAt time.Time         `json:"captured_at"`
+	Settings   TimeoutSettings   `json:"settings"`
+	Sessions   []Session         `json:"sessions"`
+	Slots      []ReplicationSlot `json:"slots"`
+	Prepared   []PreparedXact    `json:"prepared"`
+}
+
+// TimeoutSettings are the server-wide session timeouts; zero is off.
+type TimeoutSettings struct {
+	IdleInTransaction time.Duration `json:"idle_in_transaction_session_timeout"`
+	Statement         time.Duration `json:"statement_timeout"`
+	IdleSession       time.Duration `json:"idle_session_timeout"` // PostgreSQL 14+
+}
+
+// ReplicationSlot is one row of pg_replication_slots. A slot keeps the WAL
+// its consumer has not confirmed, and with hot_standby_feedback or logical
+// decoding, also the rows it may still need.
+type ReplicationSlot struct {
+	Name             string `json:"name"`
+	Type             string `json:"type"` // physical or logical
+	Database         string `json:"database,omitempty"`
+	Active           bool   `json:"active"`
+	XminAge          int64  `json:"xmin_age"`
+	CatalogXminAge   int64  `json:"catalog_xmin_age"`
+	RetainedWALBytes int64  `json:"retained_wal_bytes"`
+}
+
+// PreparedXact is a transaction prepared for two-phase commit and not yet
+// committed or rolled back, from pg_prepared_xacts.
+type PreparedXact struct {
+	GID      string    `json:"gid"`
+	Prepared time.Time `json:"prepared"`
+	Owner    string    `json:"owner"`
+	Database string    `json:"database"`
+	XIDAge   int64     `json:"xid_age"`
+}
+
+// MemorySettings are the server's memory settings, and the login roles
+// with the work_mem they set for themselves. Sizes are in bytes.
+type MemorySettings struct {
+	WorkMem            int64        `json:"work_mem"`
+	HashMemMultiplier  float64      `json:"hash_mem_multiplier"` // 1 before PostgreSQL 13
+	MaxConnections     int          `json:"max_connections"`
+	BlockSize          int64        `json:"block_size"`
+	SharedBuffers      int64        `json:"shared_buffers,omitempty"`
+	EffectiveCacheSize int64        `json:"effective_cache_size,omitempty"`
+	Roles              []RoleMemory `json:"roles,omitempty"`
+}
+
+// RoleMemory is a login role; WorkMem is zero unless ALTER ROLE ... SET
+// work_mem overrides the server value for it.
+type RoleMemory struct {
+	UserID  int64  `json:"userid"`
+	Name    string `json:"name"`
+	WorkMem int64  `json:"work_mem,omitempty"`
+}
+
+// Role finds a role by the userid pg_stat_statements records
+func (m *MemorySettings) Role(userID int64) (RoleMemory, bool) {
+	for _, r := range m.Roles {
+		if r.UserID == userID {
+			return r, true
+		}
+	}
+	return RoleMemory{}, false
+}
+
+// WorkMemFor is the work_mem the statements of a role run with
+func (m *MemorySettings) WorkMemFor(userID int64) int64 {
+	if r, ok := m.Role(userID); ok && r.WorkMem > 0 {
+		return r.WorkMem
+	}
+	return m.WorkMem
+}
+
+// CacheUsage is how well shared_buffers serves each table and index, from
+// pg_statio_user_tables and pg_statio_user_indexes. The counters run from
+// the last statistics reset.
+type CacheUsage struct {
+	Relations  []CacheStats `json:"relations"`
+	StatsReset *time.Time   `json:"stats_reset,omitempty"`
+	CapturedAt time.Time    `json:"captured_at"`
+	// Buffercache is set when pg_buffercache is installed and CachedBytes
+	// was measured
+	Buffercache bool `json:"buffercache"`
+	// Prewarm is set when the pg_prewarm extension is installed, and
+	// Autoprewarm when it is also in shared_preload_libraries
+	Prewarm     bool `json:"prewarm"`
+	Autoprewarm bool `json:"autoprewarm"`
+}
+
+// CacheStats is the buffer cache activity of one table or index. IndexName
+// is empty for a table, whose counters cover its heap only. Blocks read
+// were not in shared_buffers and came from the OS cache or disk.
+type CacheStats struct {
+	SchemaName  string `json:"schema_name"`
+	TableName   string `json:"table_name"`
+	IndexName   string `json:"index_name,omitempty"`
+	BlksRead    int64  `json:"blks_read"`
+	BlksHit     int64  `json:"blks_hit"`
+	SizeBytes   int64  `json:"size_bytes"`
+	CachedBytes int64  `json:"cached_bytes,omitempty"` // in shared_buffers now
+}
+
+// HitRatio is the share of block accesses served from shared_buffers, or 1
+// when the relation was not accessed
+func (c CacheStats) HitRatio() float64 {
+	if c.BlksHit+c.BlksRead == 0 {
+		return 1
+	}
+	return float64(c.BlksHit) / float64(c.BlksHit+c.BlksRead)
+}
+
+// Waiting reports whether the session waits for a lock held by another
+func (s Session) Waiting() bool {
+	return len(s.BlockedBy) > 0
+}
+
+// ColumnStats is the planner's view of one column, as ANALYZE leaves it in
+// pg_stats. Values are kept in their text form.
+type ColumnStats struct {
+	SchemaName string  `json:"schema_name"`
+	TableName  string  `json:"table_name"`
+	ColumnName string  `json:"column_name"`
+	NullFrac   float64 `json:"null_frac"`
+	// NDistinct is the number of distinct values, or when negative, minus
+	// that number divided by the row count (-1 for a unique column)
+	NDistinct       float64   `json:"n_distinct"`
+	AvgWidth        int       `json:"avg_width"`
+	MostCommonVals  []string  `json:"most_common_vals,omitempty"`
+	MostCommonFreqs []float64 `json:"most_common_freqs,omitempty"`
+	HistogramBounds []string  `json:"histogram_bounds,omitempty"`
+	// Correlation between the column's order and the physical row order,
+	// from -1 to 1; near either end, range scans read few pages
+	Correlation float64 `json:"correlation"`
+}
+
+// DistinctValues resolves NDistinct against a row count.
+func (c ColumnStats) DistinctValues(rows int64) float64 {
+	if c.NDistinct < 0 {
+		return -c.NDistinct * float64(rows)
+	}
+	return c.NDistinct
+}
+
+// QueryDelta is the activity of one statement between two pg_stat_statements
+// snapshots, rather than cumulative since the last stats reset.
+type QueryDelta struct {
+	QueryID         int64     `json:"queryid,omitempty"`
+	Query           string    `json:"query"`
+	Calls           int64     `json:"calls"`
+	TotalTime       float64   `json:"total_time"`
+	MeanExecTime    float64   `json:"mean_exec_time"`
+	CallsPerSec     float64   `json:"calls_per_sec"`
+	Rows            int64     `json:"rows"`
+	TotalPlanTime   float64   `json:"total_plan_time"`
+	SharedBlksHit   int64     `json:"shared_blks_hit"`
+	SharedBlksRead  int64     `json:"shared_blks_read"`
+	TempBlksRead    int64     `json:"temp_blks_read"`
+	TempBlksWritten int64     `json:"temp_blks_written"`
+	BlkReadTime     float64   `json:"blk_read_time"`
+	WALBytes        int64     `json:"wal_bytes"`
+	WindowStart     time.Time `json:"window_start"`
+	WindowEnd       time.Time `json:"window_end"`
+	IntervalSeconds float64   `json:"interval_seconds"`
+	Reset           bool      `json:"reset"`
+}
+
+// AsQueryStats lets window deltas be fed to code that expects cumulative
+// stats, such as the rule engine.
+func (d QueryDelta) AsQueryStats() QueryStats {
+	return QueryStats{
+		QueryID:         d.QueryID,
+		TopLevel:        true,
+		Query:           d.Query,
+		Calls:           d.Calls,
+		MeanExecTime:    d.MeanExecTime,
+		TotalTime:       d.TotalTime,
+		Rows:            d.Rows,
+		TotalPlanTime:   d.TotalPlanTime,
+		SharedBlksHit:   d.SharedBlksHit,
+		SharedBlksRead:  d.SharedBlksRead,
+		TempBlksRead:    d.TempBlksRead,
+		TempBlksWritten: d.TempBlksWritten,
+		BlkReadTime:     d.BlkReadTime,
+		WALBytes:        d.WALBytes,
+	}
 }
@@ -0,0 +1,445 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"cli/internal/logger"
+
+	"github.com/lib/pq"
+)
+
+// Repository persists scans into the optidb_meta schema and reads back query,
+// metric and recommendation history.
+type Repository struct {
+	db *sql.DB
+}
+
+// SnapshotQuery is one analyzed statement within a scan.
+type SnapshotQuery struct {
+	Fingerprint     string
+	NormSQL         string
+	Stats           QueryStats
+	Recommendations []Recommendation
+	// Plan is nil when the statement was not explained in this scan
+	Plan *QueryPlan
+}
+
+// LoggedStatement is one statement execution read from the server log.
+type LoggedStatement struct {
+	Fingerprint string
+	RawSQL      string
+	NormSQL     string
+	Sample      LogSample
+	// Plan is the auto_explain plan, nil for plain duration lines
+	Plan *QueryPlan
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) Close() error {
+	return r.db.Close()
+}
+
+// SaveSnapshot writes a complete scan in a single transaction. Queries are
+// upserted by fingerprint so first_seen is kept and last_seen advances.
+func (r *Repository) SaveSnapshot(source string, queries []SnapshotQuery, tables []TableInfo, indexes []IndexInfo) (*Snapshot, error) {
+	logger.LogInfof("Persisting %s snapshot: %d queries, %d tables, %d indexes", source, len(queries), len(tables), len(indexes))
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin snapshot transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	snapshot := &Snapshot{Source: source}
+	err = tx.QueryRow(`INSERT INTO optidb_meta.snapshots (source) VALUES ($1) RETURNING id, captured_at`, source).
+		Scan(&snapshot.ID, &snapshot.CapturedAt)
+	if err != nil {
+		logger.LogErrorf("Failed to create snapshot: %v", err)
+		return nil, fmt.Errorf("failed to create snapshot: %w", err)
+	}
+
+	for _, q := range queries {
+		queryID, err := upsertQuery(tx, q, snapshot.CapturedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO optidb_meta.query_metrics (
+				snapshot_id, query_id, mean_ms, calls, rows_returned, total_ms,
+				shared_blks_hit, shared_blks_read, temp_blks_read, temp_blks_written,
+				min_ms, max_ms, stddev_ms, plans, total_plan_ms,
+				blk_read_ms, blk_write_ms, wal_records, wal_bytes, captured_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)`,
+			snapshot.ID, queryID, q.Stats.MeanExecTime, q.Stats.Calls, q.Stats.Rows, q.Stats.TotalTime,
+			q.Stats.SharedBlksHit, q.Stats.SharedBlksRead, q.Stats.TempBlksRead, q.Stats.TempBlksWritten,
+			q.Stats.MinExecTime, q.Stats.MaxExecTime, q.Stats.StddevExecTime, q.Stats.Plans, q.Stats.TotalPlanTime,
+			q.Stats.BlkReadTime, q.Stats.BlkWriteTime, q.Stats.WALRecords, q.Stats.WALBytes, snapshot.CapturedAt,
+		)
+		if err != nil {
+			logger.LogErrorf("Failed to insert query metrics for %s: %v", q.Fingerprint, err)
+			return nil, fmt.Errorf("failed to insert query metrics: %w", err)
+		}
+
+		for _, rec := range q.Recommendations {
+			if err := insertRecommendation(tx, snapshot.ID, queryID, rec, snapshot.CapturedAt); err != nil {
+				return nil, err
+			}
+		}
+
+		if q.Plan != nil {
+			if err := insertQueryPlan(tx, snapshot.ID, queryID, *q.Plan, snapshot.CapturedAt); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, t := range tables {
+		_, err := tx.Exec(`
+			INSERT INTO optidb_meta.schema_tables (
+				snapshot_id, schema_name, table_name, rows_est, bytes, toast_bytes,
+				live_tuples, dead_tuples, reltuples, relpages, seq_scan, seq_tup_read, idx_scan,
+				last_analyzed, last_vacuumed, captured_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)`,
+			snapshot.ID, t.SchemaName, t.TableName, t.RowCount, t.SizeBytes, t.ToastBytes,
+			t.LiveTuples, t.DeadTuples, t.RelTuples, t.RelPages, t.SeqScans, t.SeqTupRead, t.IdxScans,
+			t.LastAnalyzed(), t.LastVacuumed(), snapshot.CapturedAt,
+		)
+		if err != nil {
+			logger.LogErrorf("Failed to insert schema table %s.%s: %v", t.SchemaName, t.TableName, err)
+			return nil, fmt.Errorf("failed to insert schema table: %w", err)
+		}
+	}
+
+	for _, idx := range indexes {
+		_, err := tx.Exec(`
+			INSERT INTO optidb_meta.schema_indexes (
+				snapshot_id, schema_name, index_name, table_name, cols, is_unique, is_primary,
+				size_bytes, scans, tuples_read, tuples_fetched, captured_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+			snapshot.ID, idx.SchemaName, idx.IndexName, idx.TableName, pq.Array(idx.Columns), idx.IsUnique, idx.IsPrimary,
+			idx.SizeBytes, idx.IndexScans, idx.TuplesRead, idx.TuplesFetch, snapshot.CapturedAt,
+		)
+		if err != nil {
+			logger.LogErrorf("Failed to insert schema index %s: %v", idx.IndexName, err)
+			return nil, fmt.Errorf("failed to insert schema index: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit snapshot: %w", err)
+	}
+
+	logger.LogInfof("Persisted snapshot %d", snapshot.ID)
+	return snapshot, nil
+}
+
+// SaveLogSamples records log-derived executions as a snapshot. Queries are
+// upserted by the same fingerprint used for pg_stat_statements, so logged
+// executions and plans line up with scanned statements.
+func (r *Repository) SaveLogSamples(source string, statements []LoggedStatement) (*Snapshot, error) {
+	logger.LogInfof("Persisting %s snapshot: %d logged statements", source, len(statements))
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin snapshot transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	snapshot := &Snapshot{Source: source}
+	err = tx.QueryRow(`INSERT INTO optidb_meta.snapshots (source) VALUES ($1) RETURNING id, captured_at`, source).
+		Scan(&snapshot.ID, &snapshot.CapturedAt)
+	if err != nil {
+		logger.LogErrorf("Failed to create snapshot: %v", err)
+		return nil, fmt.Errorf("failed to create snapshot: %w", err)
+	}
+
+	for _, s := range statements {
+		loggedAt := s.Sample.LoggedAt
+		if loggedAt.IsZero() {
+			loggedAt = snapshot.CapturedAt
+		}
+
+		queryID, err := upsertQuery(tx, SnapshotQuery{
+			Fingerprint: s.Fingerprint,
+			NormSQL:     s.NormSQL,
+			Stats:       QueryStats{Query: s.RawSQL},
+		}, loggedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO optidb_meta.log_samples (
+				snapshot_id, query_id, logged_at, duration_ms, user_name,
+				database_name, parameters, has_plan, source_file
+			) VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7, $8, NULLIF($9, ''))`,
+			snapshot.ID, queryID, loggedAt, s.Sample.DurationMS, s.Sample.UserName,
+			s.Sample.DatabaseName, pq.Array(s.Sample.Parameters), s.Plan != nil, s.Sample.SourceFile,
+		)
+		if err != nil {
+			logger.LogErrorf("Failed to insert log sample for %s: %v", s.Fingerprint, err)
+			return nil, fmt.Errorf("failed to insert log sample: %w", err)
+		}
+
+		if s.Plan != nil {
+			if err := insertQueryPlan(tx, snapshot.ID, queryID, *s.Plan, loggedAt); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit snapshot: %w", err)
+	}
+
+	logger.LogInfof("Persisted snapshot %d", snapshot.ID)
+	return snapshot, nil
+}
+
+func upsertQuery(tx *sql.Tx, q SnapshotQuery, seenAt time.Time) (int64, error) {
+	var id int64
+	err := tx.QueryRow(`
+		INSERT INTO optidb_meta.queries (fingerprint, raw_sql, norm_sql, query_hash, first_seen, last_seen)
+		VALUES ($1, $2, $3, NULLIF($4::bigint, 0), $5, $5)
+		ON CONFLICT (fingerprint) DO UPDATE
+			SET raw_sql = EXCLUDED.raw_sql,
+			    norm_sql = EXCLUDED.norm_sql,
+			    query_hash = COALESCE(EXCLUDED.query_hash, optidb_meta.queries.query_hash),
+			    first_seen = LEAST(optidb_meta.queries.first_seen, EXCLUDED.first_seen),
+			    last_seen = GREATEST(optidb_meta.queries.last_seen, EXCLUDED.last_seen)
+		RETURNING id`,
+		q.Fingerprint, q.Stats.Query, q.NormSQL, q.Stats.QueryID, seenAt,
+	).Scan(&id)
+	if err != nil {
+		logger.LogErrorf("Failed to upsert query %s: %v", q.Fingerprint, err)
+		return 0, fmt.Errorf("failed to upsert query: %w", err)
+	}
+	return id, nil
+}
+
+func insertRecommendation(tx *sql.Tx, snapshotID, queryID int64, rec Recommendation, createdAt time.Time) error {
+	if !rec.CreatedAt.IsZero() {
+		createdAt = rec.CreatedAt
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO optidb_meta.recommendations (
+			snapshot_id, query_id, rule_id, type, ddl, rewrite_sql, rationale,
+			confidence, impact_estimate, risk_level, created_at
+		) VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8, $9, $10, $11)`,
+		snapshotID, queryID, rec.RuleID, rec.Type, rec.DDL, rec.RewriteSQL, rec.Rationale,
+		rec.Confidence, rec.ImpactEstimate, rec.RiskLevel, createdAt,
+	)
+	if err != nil {
+		logger.LogErrorf("Failed to insert recommendation: %v", err)
+		return fmt.Errorf("failed to insert recommendation: %w", err)
+	}
+	return nil
+}
+
+func insertQueryPlan(tx *sql.Tx, snapshotID, queryID int64, plan QueryPlan, capturedAt time.Time) error {
+	_, err := tx.Exec(`
+		INSERT INTO optidb_meta.query_plans (
+			snapshot_id, query_id, plan_json, had_seq_scan, had_index_scan, join_types,
+			total_cost, est_rows, act_rows, max_row_skew, buffers_hit, buffers_read,
+			temp_blocks, analyzed, execution_ms, captured_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)`,
+		snapshotID, queryID, plan.PlanJSON, plan.HadSeqScan, plan.HadIndexScan, pq.Array(plan.JoinTypes),
+		plan.TotalCost, plan.EstRows, plan.ActRows, plan.MaxRowSkew, plan.BuffersHit, plan.BuffersRead,
+		plan.TempBlocks, plan.Analyzed, plan.ExecutionMS, capturedAt,
+	)
+	if err != nil {
+		logger.LogErrorf("Failed to insert query plan: %v", err)
+		return fmt.Errorf("failed to insert query plan: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) ListSnapshots(limit int) ([]Snapshot, error) {
+	rows, err := r.db.Query(`
+		SELECT id, source, captured_at
+		FROM optidb_meta.snapshots
+		ORDER BY captured_at DESC
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	var snapshots []Snapshot
+	for rows.Next() {
+		var s Snapshot
+		if err := rows.Scan(&s.ID, &s.Source, &s.CapturedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan snapshot: %w", err)
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, rows.Err()
+}
+
+func (r *Repository) ListQueries(limit int) ([]Query, error) {
+	rows, err := r.db.Query(`
+		SELECT id, fingerprint, raw_sql, COALESCE(norm_sql, ''), COALESCE(query_hash, 0), first_seen, last_seen
+		FROM optidb_meta.queries
+		ORDER BY last_seen DESC
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stored queries: %w", err)
+	}
+	defer rows.Close()
+
+	var queries []Query
+	for rows.Next() {
+		var q Query
+		if err := rows.Scan(&q.ID, &q.Fingerprint, &q.RawSQL, &q.NormSQL, &q.QueryHash, &q.FirstSeen, &q.LastSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan stored query: %w", err)
+		}
+		queries = append(queries, q)
+	}
+	return queries, rows.Err()
+}
+
+// ErrAmbiguousFingerprint is returned when a fingerprint prefix matches
+// more than one stored query.
+var ErrAmbiguousFingerprint = errors.New("fingerprint prefix matches more than one query")
+
+// FindQueryByFingerprint looks a query up by its full fingerprint or by the
+// short prefix shown in the CLI and dashboard. It returns nil if nothing
+// matches and ErrAmbiguousFingerprint if the prefix is not unique.
+func (r *Repository) FindQueryByFingerprint(fingerprint string) (*Query, error) {
+	if fingerprint == "" {
+		return nil, nil
+	}
+
+	// left() compares the prefix literally, where LIKE would treat % and _
+	// in the input as wildcards
+	rows, err := r.db.Query(`
+		SELECT id, fingerprint, raw_sql, COALESCE(norm_sql, ''), COALESCE(query_hash, 0), first_seen, last_seen
+		FROM optidb_meta.queries
+		WHERE left(fingerprint, length($1)) = $1
+		ORDER BY last_seen DESC
+		LIMIT 2`, fingerprint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find query %s: %w", fingerprint, err)
+	}
+	defer rows.Close()
+
+	var matches []Query
+	for rows.Next() {
+		var q Query
+		if err := rows.Scan(&q.ID, &q.Fingerprint, &q.RawSQL, &q.NormSQL, &q.QueryHash, &q.FirstSeen, &q.LastSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan stored query: %w", err)
+		}
+		matches = append(matches, q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find query %s: %w", fingerprint, err)
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &matches[0], nil
+	}
+	return nil, fmt.Errorf("%w: %s, use a longer prefix", ErrAmbiguousFingerprint, fingerprint)
+}
+
+// GetMetricHistory returns the most recent metric rows for a query, newest
+// first.
+func (r *Repository) GetMetricHistory(queryID int64, limit int) ([]QueryMetrics, error) {
+	rows, err := r.db.Query(`
+		SELECT id, snapshot_id, query_id, mean_ms, calls, rows_returned, total_ms,
+		       shared_blks_hit, shared_blks_read, temp_blks_read, temp_blks_written,
+		       min_ms, max_ms, stddev_ms, plans, total_plan_ms,
+		       blk_read_ms, blk_write_ms, wal_records, wal_bytes, captured_at
+		FROM optidb_meta.query_metrics
+		WHERE query_id = $1
+		ORDER BY captured_at DESC
+		LIMIT $2`, queryID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query metric history: %w", err)
+	}
+	defer rows.Close()
+
+	var history []QueryMetrics
+	for rows.Next() {
+		var m QueryMetrics
+		err := rows.Scan(
+			&m.ID, &m.SnapshotID, &m.QueryID, &m.MeanMS, &m.Calls, &m.RowsReturned, &m.TotalMS,
+			&m.SharedBlksHit, &m.SharedBlksRead, &m.TempBlksRead, &m.TempBlksWritten,
+			&m.MinMS, &m.MaxMS, &m.StddevMS, &m.Plans, &m.TotalPlanMS,
+			&m.BlkReadMS, &m.BlkWriteMS, &m.WALRecords, &m.WALBytes, &m.CapturedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan query metrics: %w", err)
+		}
+		history = append(history, m)
+	}
+	return history, rows.Err()
+}
+
+// GetRecommendationHistory returns every recommendation made for a query
+// across snapshots, newest first.
+func (r *Repository) GetRecommendationHistory(queryID int64, limit int) ([]Recommendation, error) {
+	rows, err := r.db.Query(`
+		SELECT id, COALESCE(snapshot_id, 0), COALESCE(query_id, 0), COALESCE(rule_id, ''), type, COALESCE(ddl, ''), COALESCE(rewrite_sql, ''),
+		       rationale, confidence, COALESCE(impact_estimate, ''), risk_level, created_at
+		FROM optidb_meta.recommendations
+		WHERE query_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2`, queryID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recommendation history: %w", err)
+	}
+	defer rows.Close()
+
+	var history []Recommendation
+	for rows.Next() {
+		var rec Recommendation
+		err := rows.Scan(
+			&rec.ID, &rec.SnapshotID, &rec.QueryID, &rec.RuleID, &rec.Type, &rec.DDL, &rec.RewriteSQL,
+			&rec.Rationale, &rec.Confidence, &rec.ImpactEstimate, &rec.RiskLevel, &rec.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan recommendation: %w", err)
+		}
+		history = append(history, rec)
+	}
+	return history, rows.Err()
+}
+
+// GetLatestPlan returns the most recently captured plan for a query, or nil
+// if it has never been explained.
+func (r *Repository) GetLatestPlan(queryID int64) (*QueryPlan, error) {
+	var plan QueryPlan
+	var joinTypes []string
+	err := r.db.QueryRow(`
+		SELECT id, COALESCE(snapshot_id, 0), query_id, plan_json::text, had_seq_scan, had_index_scan, join_types,
+		       total_cost, est_rows, act_rows, max_row_skew, buffers_hit, buffers_read,
+		       temp_blocks, analyzed, execution_ms, captured_at
+		FROM optidb_meta.query_plans
+		WHERE query_id = $1
+		ORDER BY captured_at DESC
+		LIMIT 1`, queryID,
+	).Scan(
+		&plan.ID, &plan.SnapshotID, &plan.QueryID, &plan.PlanJSON, &plan.HadSeqScan, &plan.HadIndexScan, pq.Array(&joinTypes),
+		&plan.TotalCost, &plan.EstRows, &plan.ActRows, &plan.MaxRowSkew, &plan.BuffersHit, &plan.BuffersRead,
+		&plan.TempBlocks, &plan.Analyzed, &plan.ExecutionMS, &plan.CapturedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query latest plan: %w", err)
+	}
+	plan.JoinTypes = joinTypes
+	return &plan, nil
+}
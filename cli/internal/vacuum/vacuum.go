@@ -0,0 +1,317 @@
+package vacuum
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"cli/internal/format"
+	"cli/internal/logger"
+	"cli/internal/store"
+)
+
+// Finding kinds
+const (
+	KindAutovacuumOff      = "autovacuum_off"      // autovacuum is disabled server-wide
+	KindWraparound         = "wraparound"          // transaction or multixact IDs are running out
+	KindFreezeBehind       = "freeze_behind"       // anti-wraparound vacuums are not keeping up
+	KindAutovacuumDisabled = "autovacuum_disabled" // disabled on a table that needs it
+	KindTuning             = "autovacuum_tuning"   // per-table autovacuum settings
+)
+
+// xidLimit is where transaction and multixact IDs wrap around. The server
+// stops assigning new ones a few million short of it.
+const (
+	xidLimit      = 1 << 31
+	xidStopMargin = 3_000_000
+)
+
+// Options tune the analysis.
+type Options struct {
+	// WraparoundRatio is the share of the ID space in use above which a
+	// database or table is a wraparound alert
+	WraparoundRatio float64
+	// LargeTableRows is the size from which the default scale factor lets
+	// too many dead rows build up between vacuums
+	LargeTableRows int64
+	// TargetDeadRows is how many dead rows a tuned table should collect
+	// before autovacuum visits it
+	TargetDeadRows int64
+	// MaxDeadRatio is the dead row share above which autovacuum is behind
+	MaxDeadRatio float64
+}
+
+func DefaultOptions() Options {
+	return Options{
+		WraparoundRatio: 0.5,
+		LargeTableRows:  1_000_000,
+		TargetDeadRows:  100_000,
+		MaxDeadRatio:    0.2,
+	}
+}
+
+// Finding is one vacuum problem and its fix. Database-level findings have
+// no table.
+type Finding struct {
+	Kind       string  `json:"kind"`
+	Database   string  `json:"database,omitempty"`
+	Schema     string  `json:"schema,omitempty"`
+	Table      string  `json:"table,omitempty"`
+	XIDAge     int64   `json:"xid_age,omitempty"`
+	DeadTuples int64   `json:"dead_tuples,omitempty"`
+	DeadRatio  float64 `json:"dead_ratio,omitempty"`
+	DDL        string  `json:"ddl"`
+	RiskLevel  string  `json:"risk_level"`
+	Rationale  string  `json:"rationale"`
+}
+
+// Report is the vacuum health of a server, alerts first.
+type Report struct {
+	Findings []Finding           `json:"findings"`
+	Health   *store.VacuumHealth `json:"health"`
+	// WraparoundRatio is the share of the ID space used by the oldest
+	// database
+	WraparoundRatio float64 `json:"wraparound_ratio"`
+}
+
+// Analyze checks the freeze age of every database and table against the
+// wraparound limit and the autovacuum settings of every table against its
+// size and dead rows.
+func Analyze(health *store.VacuumHealth, opts Options) *Report {
+	logger.LogInfof("Analyzing vacuum health of %d databases and %d tables", len(health.Databases), len(health.Tables))
+
+	report := &Report{Health: health}
+	settings := health.Settings
+
+	if !settings.Autovacuum {
+		report.Findings = append(report.Findings, Finding{
+			Kind:      KindAutovacuumOff,
+			DDL:       "ALTER SYSTEM SET autovacuum = on; SELECT pg_reload_conf();",
+			RiskLevel: "high",
+			Rationale: "Autovacuum is off, so dead rows are never cleaned up and only the forced anti-wraparound vacuums still run. Tables grow without bound unless VACUUM is scheduled by hand.",
+		})
+	}
+
+	for _, d := range health.Databases {
+		report.WraparoundRatio = math.Max(report.WraparoundRatio, idRatio(max(d.XIDAge, d.MXIDAge)))
+		if f, ok := databaseFinding(d, settings, opts); ok {
+			report.Findings = append(report.Findings, f)
+		}
+	}
+
+	for _, t := range health.Tables {
+		running := runningOn(health.Running, t)
+		if f, ok := freezeFinding(t, settings, running, opts); ok {
+			report.Findings = append(report.Findings, f)
+		}
+		if f, ok := tuningFinding(t, settings, running, opts); ok {
+			report.Findings = append(report.Findings, f)
+		}
+	}
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		return format.RiskRank(report.Findings[i].RiskLevel) > format.RiskRank(report.Findings[j].RiskLevel)
+	})
+	logger.LogInfof("Found %d vacuum findings", len(report.Findings))
+	return report
+}
+
+// databaseFinding alerts when a database nears wraparound, or when its age
+// is well past the point where anti-wraparound autovacuum should have
+// frozen it
+func databaseFinding(d store.DatabaseFreeze, settings store.VacuumSettings, opts Options) (Finding, bool) {
+	id, age, freezeMaxAge := "transaction", d.XIDAge, settings.FreezeMaxAge
+	if idRatio(d.MXIDAge) > idRatio(d.XIDAge) {
+		id, age, freezeMaxAge = "multixact", d.MXIDAge, settings.MultixactFreezeMaxAge
+	}
+
+	f := Finding{
+		Database: d.Name,
+		XIDAge:   age,
+		DDL:      fmt.Sprintf("VACUUM (FREEZE, VERBOSE); -- connected to %s", d.Name),
+	}
+	switch {
+	case idRatio(age) >= opts.WraparoundRatio:
+		f.Kind = KindWraparound
+		f.RiskLevel = "high"
+		f.Rationale = fmt.Sprintf("Database '%s' has used %.0f%% of its %s ID space (age %s). In about %s more %ss the server stops accepting writes until it is vacuumed. Freeze its oldest tables now and find what holds vacuum back: long transactions, abandoned replication slots or prepared transactions.",
+			d.Name, idRatio(age)*100, id, format.Count(age), format.Count(remaining(age)), id)
+	case freezeMaxAge > 0 && float64(age) > 1.5*float64(freezeMaxAge):
+		f.Kind = KindFreezeBehind
+		f.RiskLevel = "medium"
+		f.Rationale = fmt.Sprintf("Database '%s' has a %s ID age of %s, well past the %s at which autovacuum forces a freeze, so anti-wraparound vacuums are not keeping up (%.0f%% of the ID space used).",
+			d.Name, id, format.Count(age), format.Count(freezeMaxAge), idRatio(age)*100)
+	default:
+		return Finding{}, false
+	}
+	return f, true
+}
+
+// freezeFinding flags the tables that hold a database's freeze age back
+func freezeFinding(t store.TableVacuum, settings store.VacuumSettings, running *store.VacuumProgress, opts Options) (Finding, bool) {
+	age := max(t.XIDAge, t.MXIDAge)
+	f := Finding{
+		Schema:     t.SchemaName,
+		Table:      t.TableName,
+		XIDAge:     age,
+		DeadTuples: t.DeadTuples,
+		DeadRatio:  t.DeadRatio(),
+		DDL:        fmt.Sprintf("VACUUM (FREEZE, VERBOSE) %s;", format.Qualified(t.SchemaName, t.TableName)),
+	}
+	switch {
+	case idRatio(age) >= opts.WraparoundRatio:
+		f.Kind = KindWraparound
+		f.RiskLevel = "high"
+		f.Rationale = fmt.Sprintf("Table '%s' has an ID age of %s, %.0f%% of the way to wraparound; it holds its database back from being frozen.",
+			t.TableName, format.Count(age), idRatio(age)*100)
+	case settings.FreezeMaxAge > 0 && float64(t.XIDAge) > 1.5*float64(settings.FreezeMaxAge):
+		f.Kind = KindFreezeBehind
+		f.RiskLevel = "medium"
+		f.Rationale = fmt.Sprintf("Table '%s' has an ID age of %s, well past autovacuum_freeze_max_age (%s), so its anti-wraparound vacuum is overdue or keeps failing.",
+			t.TableName, format.Count(t.XIDAge), format.Count(settings.FreezeMaxAge))
+	default:
+		return Finding{}, false
+	}
+	f.Rationale += lastRun(t) + progress(running)
+	return f, true
+}
+
+// tuningFinding recommends per-table settings: re-enabling autovacuum where
+// it was turned off, a lower scale factor for large tables that collect
+// many dead rows between vacuums, and a higher cost limit where autovacuum
+// does run but cannot keep up.
+func tuningFinding(t store.TableVacuum, settings store.VacuumSettings, running *store.VacuumProgress, opts Options) (Finding, bool) {
+	f := Finding{
+		Kind:       KindTuning,
+		Schema:     t.SchemaName,
+		Table:      t.TableName,
+		DeadTuples: t.DeadTuples,
+		DeadRatio:  t.DeadRatio(),
+		RiskLevel:  "low",
+	}
+	name := format.Qualified(t.SchemaName, t.TableName)
+	behind := t.DeadRatio() >= opts.MaxDeadRatio && t.DeadTuples >= 1000
+
+	if t.AutovacuumEnabled != nil && !*t.AutovacuumEnabled {
+		if !behind {
+			return Finding{}, false
+		}
+		f.Kind = KindAutovacuumDisabled
+		f.RiskLevel = "medium"
+		f.DDL = fmt.Sprintf("ALTER TABLE %s RESET (autovacuum_enabled);", name)
+		f.Rationale = fmt.Sprintf("Autovacuum is disabled on '%s' and %.0f%% of its rows (%s) are dead.%s Re-enable it, or make sure a scheduled VACUUM covers the table.",
+			t.TableName, t.DeadRatio()*100, format.Count(t.DeadTuples), lastRun(t))
+		return f, true
+	}
+
+	scaleFactor, threshold, costLimit := settings.ScaleFactor, settings.Threshold, settings.CostLimit
+	if t.ScaleFactor != nil {
+		scaleFactor = *t.ScaleFactor
+	}
+	if t.Threshold != nil {
+		threshold = *t.Threshold
+	}
+	if t.CostLimit != nil && *t.CostLimit > 0 {
+		costLimit = *t.CostLimit
+	}
+	trigger := float64(threshold) + scaleFactor*float64(t.LiveTuples)
+
+	var set, reasons []string
+	if t.LiveTuples >= opts.LargeTableRows && trigger > 2*float64(opts.TargetDeadRows) && t.DeadTuples >= opts.TargetDeadRows {
+		suggested := roundScaleFactor(float64(opts.TargetDeadRows) / float64(t.LiveTuples))
+		set = append(set, fmt.Sprintf("autovacuum_vacuum_scale_factor = %s", formatScaleFactor(suggested)))
+		reasons = append(reasons, fmt.Sprintf("With a scale factor of %s autovacuum waits for %s dead rows on this %s-row table; %s starts it at about %s.",
+			formatScaleFactor(scaleFactor), format.Count(int64(trigger)), format.Count(t.LiveTuples),
+			formatScaleFactor(suggested), format.Count(int64(float64(threshold)+suggested*float64(t.LiveTuples)))))
+	}
+	if behind && t.LastAutovacuum != nil && float64(t.DeadTuples) > trigger {
+		// Autovacuum visits the table but finishes too slowly for the churn
+		suggested := min(costLimit*2, 10000)
+		if suggested > costLimit {
+			set = append(set, fmt.Sprintf("autovacuum_vacuum_cost_limit = %d", suggested))
+			reasons = append(reasons, fmt.Sprintf("Autovacuum runs but %.0f%% of rows are still dead, so let it do more work per cycle (cost limit %d → %d); if that does not help, look for old snapshots holding dead rows back.",
+				t.DeadRatio()*100, costLimit, suggested))
+		}
+	}
+	if len(set) == 0 {
+		return Finding{}, false
+	}
+
+	if behind {
+		f.RiskLevel = "medium"
+	}
+	f.DDL = fmt.Sprintf("ALTER TABLE %s SET (%s);", name, strings.Join(set, ", "))
+	f.Rationale = fmt.Sprintf("Table '%s' has %s dead rows (%.0f%%). %s%s%s",
+		t.TableName, format.Count(t.DeadTuples), t.DeadRatio()*100, strings.Join(reasons, " "), lastRun(t), progress(running))
+	return f, true
+}
+
+func runningOn(running []store.VacuumProgress, t store.TableVacuum) *store.VacuumProgress {
+	for i, p := range running {
+		if p.SchemaName == t.SchemaName && p.TableName == t.TableName {
+			return &running[i]
+		}
+	}
+	return nil
+}
+
+func lastRun(t store.TableVacuum) string {
+	last := t.LastAutovacuum
+	if t.LastVacuum != nil && (last == nil || t.LastVacuum.After(*last)) {
+		last = t.LastVacuum
+	}
+	if last == nil {
+		return " It has not been vacuumed since the statistics were reset."
+	}
+	return fmt.Sprintf(" It was last vacuumed %s ago.", formatAge(time.Since(*last)))
+}
+
+func progress(p *store.VacuumProgress) string {
+	if p == nil {
+		return ""
+	}
+	kind := "A manual VACUUM"
+	if p.Wraparound {
+		kind = "An anti-wraparound autovacuum"
+	} else if p.Autovacuum {
+		kind = "An autovacuum"
+	}
+	done := ""
+	if p.HeapBlksTotal > 0 {
+		done = fmt.Sprintf(", %.0f%% scanned", float64(p.HeapBlksScanned)/float64(p.HeapBlksTotal)*100)
+	}
+	return fmt.Sprintf(" %s is running on it now (%s%s).", kind, p.Phase, done)
+}
+
+func idRatio(age int64) float64 {
+	return float64(age) / xidLimit
+}
+
+func remaining(age int64) int64 {
+	return max(xidLimit-xidStopMargin-age, 0)
+}
+
+// roundScaleFactor keeps two significant digits, never below 0.001
+func roundScaleFactor(f float64) float64 {
+	if f <= 0.001 {
+		return 0.001
+	}
+	scale := math.Pow(10, math.Floor(math.Log10(f))-1)
+	return math.Floor(f/scale+1e-9) * scale
+}
+
+func formatScaleFactor(f float64) string {
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.4f", f), "0"), ".")
+}
+
+func formatAge(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%d days", int(d.Hours()/24))
+	case d >= time.Hour:
+		return fmt.Sprintf("%.0f hours", d.Hours())
+	}
+	return fmt.Sprintf("%.0f minutes", d.Minutes())
+}
@@ -0,0 +1,166 @@
+package vacuum
+
+import (
+	"testing"
+	"time"
+
+	"cli/internal/store"
+)
+
+func TestAnalyze(t *testing.T) {
+	settings := store.VacuumSettings{
+		Autovacuum:            true,
+		ScaleFactor:           0.2,
+		Threshold:             50,
+		FreezeMaxAge:          200_000_000,
+		MultixactFreezeMaxAge: 400_000_000,
+		MaxWorkers:            3,
+		CostLimit:             200,
+	}
+	off := false
+	lastAutovacuum := time.Date(2026, 3, 1, 4, 0, 0, 0, time.UTC)
+	table := func(change func(*store.TableVacuum)) store.TableVacuum {
+		t := store.TableVacuum{SchemaName: "public", TableName: "events", LiveTuples: 50_000, DeadTuples: 500, XIDAge: 50_000_000}
+		change(&t)
+		return t
+	}
+
+	type finding struct {
+		kind string
+		risk string
+		ddl  string
+	}
+	tests := []struct {
+		name      string
+		health    store.VacuumHealth
+		want      []finding
+		wantRatio float64
+	}{
+		{
+			name: "healthy server",
+			health: store.VacuumHealth{
+				Settings:  settings,
+				Databases: []store.DatabaseFreeze{{Name: "shop", XIDAge: 100_000_000}},
+				Tables:    []store.TableVacuum{table(func(*store.TableVacuum) {})},
+			},
+			wantRatio: 100_000_000.0 / xidLimit,
+		},
+		{
+			name:   "autovacuum off",
+			health: store.VacuumHealth{Settings: store.VacuumSettings{}},
+			want:   []finding{{kind: KindAutovacuumOff, risk: "high", ddl: "ALTER SYSTEM SET autovacuum = on; SELECT pg_reload_conf();"}},
+		},
+		{
+			name: "database near wraparound",
+			health: store.VacuumHealth{
+				Settings:  settings,
+				Databases: []store.DatabaseFreeze{{Name: "shop", XIDAge: 1_200_000_000}},
+			},
+			want:      []finding{{kind: KindWraparound, risk: "high", ddl: "VACUUM (FREEZE, VERBOSE); -- connected to shop"}},
+			wantRatio: 1_200_000_000.0 / xidLimit,
+		},
+		{
+			name: "database multixacts near wraparound",
+			health: store.VacuumHealth{
+				Settings:  settings,
+				Databases: []store.DatabaseFreeze{{Name: "shop", XIDAge: 100_000_000, MXIDAge: 1_500_000_000}},
+			},
+			want:      []finding{{kind: KindWraparound, risk: "high", ddl: "VACUUM (FREEZE, VERBOSE); -- connected to shop"}},
+			wantRatio: 1_500_000_000.0 / xidLimit,
+		},
+		{
+			name: "database freeze behind",
+			health: store.VacuumHealth{
+				Settings:  settings,
+				Databases: []store.DatabaseFreeze{{Name: "shop", XIDAge: 400_000_000}},
+			},
+			want:      []finding{{kind: KindFreezeBehind, risk: "medium", ddl: "VACUUM (FREEZE, VERBOSE); -- connected to shop"}},
+			wantRatio: 400_000_000.0 / xidLimit,
+		},
+		{
+			name: "table holding wraparound back",
+			health: store.VacuumHealth{
+				Settings: settings,
+				Tables:   []store.TableVacuum{table(func(t *store.TableVacuum) { t.XIDAge = 1_200_000_000 })},
+			},
+			want: []finding{{kind: KindWraparound, risk: "high", ddl: "VACUUM (FREEZE, VERBOSE) public.events;"}},
+		},
+		{
+			name: "autovacuum disabled on a table with many dead rows",
+			health: store.VacuumHealth{
+				Settings: settings,
+				Tables: []store.TableVacuum{table(func(t *store.TableVacuum) {
+					t.AutovacuumEnabled, t.LiveTuples, t.DeadTuples = &off, 6_000, 4_000
+				})},
+			},
+			want: []finding{{kind: KindAutovacuumDisabled, risk: "medium", ddl: "ALTER TABLE public.events RESET (autovacuum_enabled);"}},
+		},
+		{
+			name: "autovacuum disabled on a clean table",
+			health: store.VacuumHealth{
+				Settings: settings,
+				Tables:   []store.TableVacuum{table(func(t *store.TableVacuum) { t.AutovacuumEnabled = &off })},
+			},
+		},
+		{
+			name: "large table waits too long for autovacuum",
+			health: store.VacuumHealth{
+				Settings: settings,
+				Tables: []store.TableVacuum{table(func(t *store.TableVacuum) {
+					t.LiveTuples, t.DeadTuples = 10_000_000, 500_000
+				})},
+			},
+			want: []finding{{kind: KindTuning, risk: "low", ddl: "ALTER TABLE public.events SET (autovacuum_vacuum_scale_factor = 0.01);"}},
+		},
+		{
+			name: "autovacuum runs but falls behind",
+			health: store.VacuumHealth{
+				Settings: settings,
+				Tables: []store.TableVacuum{table(func(t *store.TableVacuum) {
+					t.LiveTuples, t.DeadTuples, t.LastAutovacuum = 100_000, 50_000, &lastAutovacuum
+				})},
+			},
+			want: []finding{{kind: KindTuning, risk: "medium", ddl: "ALTER TABLE public.events SET (autovacuum_vacuum_cost_limit = 400);"}},
+		},
+		{
+			name: "alerts before tuning",
+			health: store.VacuumHealth{
+				Settings: settings,
+				Databases: []store.DatabaseFreeze{
+					{Name: "shop", XIDAge: 100_000_000},
+					{Name: "analytics", XIDAge: 1_100_000_000},
+				},
+				Tables: []store.TableVacuum{table(func(t *store.TableVacuum) {
+					t.LiveTuples, t.DeadTuples = 10_000_000, 500_000
+				})},
+			},
+			want: []finding{
+				{kind: KindWraparound, risk: "high", ddl: "VACUUM (FREEZE, VERBOSE); -- connected to analytics"},
+				{kind: KindTuning, risk: "low", ddl: "ALTER TABLE public.events SET (autovacuum_vacuum_scale_factor = 0.01);"},
+			},
+			wantRatio: 1_100_000_000.0 / xidLimit,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := Analyze(&tt.health, DefaultOptions())
+
+			if len(report.Findings) != len(tt.want) {
+				t.Fatalf("got %d findings, want %d: %+v", len(report.Findings), len(tt.want), report.Findings)
+			}
+			for i, want := range tt.want {
+				f := report.Findings[i]
+				if f.Kind != want.kind || f.RiskLevel != want.risk || f.DDL != want.ddl {
+					t.Errorf("finding %d = %s (%s) %q, want %s (%s) %q", i, f.Kind, f.RiskLevel, f.DDL, want.kind, want.risk, want.ddl)
+				}
+				if f.Rationale == "" {
+					t.Errorf("finding %d has no rationale", i)
+				}
+			}
+			if report.WraparoundRatio != tt.wantRatio {
+				t.Errorf("WraparoundRatio = %v, want %v", report.WraparoundRatio, tt.wantRatio)
+			}
+		})
+	}
+}
@@ -1 +1,10 @@
 CREATE EXTENSION IF NOT EXISTS pg_stat_statements;
+
+-- hypopg powers `optidb simulate`; the rest of OptiDB works without it
+DO $$
+BEGIN
+    CREATE EXTENSION IF NOT EXISTS hypopg;
+EXCEPTION WHEN OTHERS THEN
+    RAISE NOTICE 'hypopg not available, index simulation disabled: %', SQLERRM;
+END
+$$;
@@ -8,6 +8,9 @@ GRANT SELECT ON pg_stat_user_tables TO profiler_ro;
 GRANT SELECT ON pg_stat_user_indexes TO profiler_ro;
 GRANT SELECT ON pg_class TO profiler_ro;
 GRANT SELECT ON pg_index TO profiler_ro;
+-- EXPLAIN needs SELECT on the tables a statement touches
+GRANT SELECT ON ALL TABLES IN SCHEMA public TO profiler_ro;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT ON TABLES TO profiler_ro;
 
 DROP ROLE IF EXISTS profiler_sb;
 CREATE ROLE profiler_sb WITH LOGIN PASSWORD 'profiler_sb_pass';
@@ -16,3 +19,6 @@ GRANT CONNECT ON DATABASE optidb TO profiler_sb;
 GRANT USAGE ON SCHEMA public TO profiler_sb;
 GRANT EXECUTE ON ALL FUNCTIONS IN SCHEMA public TO profiler_sb;
 GRANT TEMPORARY ON DATABASE optidb TO profiler_sb;
+-- Simulation explains queries before and after hypothetical indexes
+GRANT SELECT ON ALL TABLES IN SCHEMA public TO profiler_sb;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT ON TABLES TO profiler_sb;